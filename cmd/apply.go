@@ -0,0 +1,307 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iamthemuffinman/cli"
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/hostspec"
+	"github.com/iamthemuffinman/overseer/pkg/summary"
+	"github.com/iamthemuffinman/overseer/pkg/vsphere"
+	flag "github.com/ogier/pflag"
+)
+
+type ApplyCommand struct {
+	UI      cli.Ui
+	FlagSet *flag.FlagSet
+}
+
+func (c *ApplyCommand) Run(args []string) int {
+	c.FlagSet = flag.NewFlagSet("apply", flag.ContinueOnError)
+	c.FlagSet.Usage = func() { c.UI.Output(c.Help()) }
+
+	specfile := c.FlagSet.String("buildspec", "", "The buildspec the hosts were built from")
+	hostspecPath := c.FlagSet.StringP("hostspec", "f", "./hostspec", "The hosts to change")
+	windowFlag := c.FlagSet.String("reboot-window", "", "When VMs may be powered off for changes that need it (i.e. 22:00-02:00)")
+	planOnly := c.FlagSet.Bool("plan-only", false, "Show the plan without changing anything")
+	autoApprove := c.FlagSet.Bool("auto-approve", false, "Don't ask before making changes")
+	profile := c.FlagSet.String("profile", os.Getenv(configspec.ProfileEnvVar), "Select a profile from your configspec")
+
+	if err := c.FlagSet.Parse(args); err != nil {
+		return 1
+	}
+
+	if *specfile == "" {
+		c.UI.Error("You must specify a buildspec")
+		return cli.RunResultHelp
+	}
+
+	var window *rebootWindow
+	if *windowFlag != "" {
+		var err error
+		window, err = parseRebootWindow(*windowFlag)
+		if err != nil {
+			c.UI.Error(err.Error())
+			return 1
+		}
+	}
+
+	home, err := getHomeDir()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("unable to retrieve users home directory: %s", err))
+		return 1
+	}
+
+	cspec, err := loadConfigspec(c.UI, home, *profile)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	if cspec.Vsphere.Endpoint.URL == "" {
+		c.UI.Error("Your configspec doesn't have a vsphere block to make changes with")
+		return 1
+	}
+
+	bspec, err := buildspec.ParseDir(buildspecDir, *specfile)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("unable to parse buildspec: %s", err))
+		return 1
+	}
+
+	if err := bspec.CheckProfile(*profile); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	hspec, err := hostspec.ParseFile(*hostspecPath)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("unable to parse hostspec: %s", err))
+		return 1
+	}
+
+	govc := vsphere.New(cspec.Vsphere, bspec.Vsphere.Datacenter)
+	results := summary.New(hspec.Hosts)
+
+	// Work out every host's plan up front so the whole thing can be
+	// looked over before anything is touched
+	var plans []*vsphere.Plan
+	changes := 0
+	for _, host := range hspec.Hosts {
+		vm, err := govc.VM(host)
+		if err == nil && vm == nil {
+			err = fmt.Errorf("no VM named %s", host)
+		}
+		if err != nil {
+			results.Fail(host, "plan", err)
+			continue
+		}
+
+		plan := vsphere.NewPlan(vm, bspec.Vsphere)
+		plans = append(plans, plan)
+		changes += len(plan.Changes)
+
+		c.UI.Output(plan.String())
+	}
+
+	if changes == 0 || *planOnly {
+		if changes == 0 {
+			c.UI.Output("Nothing to change.")
+		}
+		return c.finish(results)
+	}
+
+	if !*autoApprove {
+		answer, err := c.UI.Ask(fmt.Sprintf("Make %d changes? Only 'yes' will be accepted:", changes))
+		if err != nil {
+			c.UI.Error(err.Error())
+			return 1
+		}
+		if answer != "yes" {
+			c.UI.Output("Nothing changed.")
+			return 1
+		}
+	}
+
+	// Changes that can be made with the VM running go straight in
+	var cold []*vsphere.Plan
+	for _, plan := range plans {
+		if hot := plan.Hot(); len(hot) > 0 {
+			if err := govc.ApplyHot(plan); err != nil {
+				results.Fail(plan.VM, "resize", err)
+				continue
+			}
+			results.OK(plan.VM, "resize", describeChanges(hot))
+		}
+
+		if len(plan.Cold()) > 0 {
+			cold = append(cold, plan)
+		}
+	}
+
+	if len(cold) == 0 {
+		return c.finish(results)
+	}
+
+	if window == nil {
+		for _, plan := range cold {
+			results.Skip(plan.VM, "reboot", "needs a power off, run again with --reboot-window: "+describeChanges(plan.Cold()))
+		}
+		return c.finish(results)
+	}
+
+	// The rest wait for the reboot window, and hosts are taken down one at
+	// a time so no more than one is ever off
+	opens, closes := window.next(time.Now())
+	if wait := time.Until(opens); wait > 0 {
+		c.UI.Info(fmt.Sprintf("Waiting until %s to power off %d hosts", opens.Format("Jan 2 15:04"), len(cold)))
+		time.Sleep(wait)
+	}
+
+	for _, plan := range cold {
+		if time.Now().After(closes) {
+			results.Skip(plan.VM, "reboot", "the reboot window closed: "+describeChanges(plan.Cold()))
+			continue
+		}
+
+		c.UI.Info(fmt.Sprintf("Powering off %s", plan.VM))
+		if err := govc.ApplyCold(plan); err != nil {
+			results.Fail(plan.VM, "reboot", err)
+			continue
+		}
+		results.OK(plan.VM, "reboot", describeChanges(plan.Cold()))
+	}
+
+	return c.finish(results)
+}
+
+func (c *ApplyCommand) finish(results *summary.Summary) int {
+	for _, host := range results.Hosts {
+		if len(host.Steps) > 0 {
+			c.UI.Output(results.String())
+			break
+		}
+	}
+	if results.Failed() {
+		return 1
+	}
+	return 0
+}
+
+func describeChanges(changes []*vsphere.Change) string {
+	var descriptions []string
+	for _, change := range changes {
+		descriptions = append(descriptions, change.Description)
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// rebootWindow is a daily stretch of time, like 22:00-02:00, when VMs can
+// be powered off. It may run past midnight.
+type rebootWindow struct {
+	// start and end are how far into the day the window opens and closes
+	start, end time.Duration
+}
+
+func parseRebootWindow(s string) (*rebootWindow, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("reboot window %q should look like HH:MM-HH:MM", s)
+	}
+
+	var times [2]time.Duration
+	for i, part := range parts {
+		hm := strings.Split(strings.TrimSpace(part), ":")
+		if len(hm) != 2 {
+			return nil, fmt.Errorf("reboot window %q should look like HH:MM-HH:MM", s)
+		}
+
+		hours, err := strconv.Atoi(hm[0])
+		if err != nil || hours < 0 || hours > 23 {
+			return nil, fmt.Errorf("reboot window %q has a bad hour %q", s, hm[0])
+		}
+		minutes, err := strconv.Atoi(hm[1])
+		if err != nil || minutes < 0 || minutes > 59 {
+			return nil, fmt.Errorf("reboot window %q has a bad minute %q", s, hm[1])
+		}
+
+		times[i] = time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute
+	}
+
+	if times[0] == times[1] {
+		return nil, fmt.Errorf("reboot window %q opens and closes at the same time", s)
+	}
+
+	return &rebootWindow{start: times[0], end: times[1]}, nil
+}
+
+// next returns when the window next opens and closes, in now's time zone.
+// If now is inside the window it opens now.
+func (w *rebootWindow) next(now time.Time) (time.Time, time.Time) {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	length := w.end - w.start
+	if length < 0 {
+		length += 24 * time.Hour
+	}
+
+	// A window that runs past midnight may have opened yesterday
+	for _, day := range []int{-1, 0, 1} {
+		opens := midnight.AddDate(0, 0, day).Add(w.start)
+		closes := opens.Add(length)
+
+		if now.Before(closes) {
+			if now.After(opens) {
+				opens = now
+			}
+			return opens, closes
+		}
+	}
+
+	// Not reached: tomorrow's window always closes after now
+	return now, now
+}
+
+func (c *ApplyCommand) Help() string {
+	return c.helpApply()
+}
+
+func (c *ApplyCommand) Synopsis() string {
+	return "Resize existing VMs to match their buildspec"
+}
+
+func (c *ApplyCommand) helpApply() string {
+	helpText := `
+Usage: overseer apply [OPTIONS]
+
+  Bring the VMs of hosts that are already built in line with their
+  buildspec's vsphere block: change CPUs and memory, grow disks and add
+  disks, network adapters and SCSI controllers. The plan for every host is
+  shown, and confirmed, before anything is changed.
+
+  Changes that can be made with the VM running (adding CPUs or memory to a
+  VM with hot-add enabled, and all disk and device changes) are made
+  straight away. The rest need the VM powered off, and are only made
+  during --reboot-window, one host at a time. Without a window they're
+  reported and left for later.
+
+  Disks are never shrunk and devices are never removed. Those differences
+  are shown in the plan and have to be dealt with by hand.
+
+Options:
+
+  --buildspec        The buildspec the hosts were built from.
+  --hostspec, -f     The hosts to change. Defaults to ./hostspec.
+  --reboot-window    When VMs may be powered off, like 22:00-02:00, in local
+                     time. overseer waits for the window if it isn't open.
+  --plan-only        Show the plan without changing anything.
+  --auto-approve     Don't ask before making changes.
+  --profile          The configspec profile to use. Defaults to $OVERSEER_PROFILE.
+`
+	return strings.TrimSpace(helpText)
+}
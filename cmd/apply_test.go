@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRebootWindow(t *testing.T) {
+	cases := []struct {
+		Window string
+		Err    bool
+	}{
+		{"22:00-02:00", false},
+		{"01:30-04:00", false},
+		{" 09:00 - 17:30 ", false},
+		{"22:00", true},
+		{"22-02", true},
+		{"25:00-02:00", true},
+		{"22:60-02:00", true},
+		{"03:00-03:00", true},
+	}
+
+	for _, tt := range cases {
+		_, err := parseRebootWindow(tt.Window)
+		if (err != nil) != tt.Err {
+			t.Fatalf("%q: %v", tt.Window, err)
+		}
+	}
+}
+
+func TestRebootWindowNext(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.October, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	cases := []struct {
+		Window string
+		Now    time.Time
+		Opens  time.Time
+		Closes time.Time
+	}{
+		// Before the window opens
+		{"01:30-04:00", at(19, 0, 15), at(19, 1, 30), at(19, 4, 0)},
+		// Inside it
+		{"01:30-04:00", at(19, 2, 0), at(19, 2, 0), at(19, 4, 0)},
+		// After it's closed, so tomorrow's
+		{"01:30-04:00", at(19, 12, 0), at(20, 1, 30), at(20, 4, 0)},
+		// Past midnight, opened last night
+		{"22:00-02:00", at(19, 1, 0), at(19, 1, 0), at(19, 2, 0)},
+		// Past midnight, opening tonight
+		{"22:00-02:00", at(19, 9, 0), at(19, 22, 0), at(20, 2, 0)},
+		{"22:00-02:00", at(19, 23, 0), at(19, 23, 0), at(20, 2, 0)},
+	}
+
+	for _, tt := range cases {
+		window, err := parseRebootWindow(tt.Window)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		opens, closes := window.next(tt.Now)
+		if !opens.Equal(tt.Opens) || !closes.Equal(tt.Closes) {
+			t.Fatalf("%s at %s\n\n%s - %s\n\n%s - %s", tt.Window, tt.Now, opens, closes, tt.Opens, tt.Closes)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/iamthemuffinman/cli"
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/credentials"
+)
+
+type CredentialsCommand struct {
+	UI cli.Ui
+}
+
+func (c *CredentialsCommand) Run(args []string) int {
+	return cli.RunResultHelp
+}
+
+func (c *CredentialsCommand) Help() string {
+	return c.helpCredentials()
+}
+
+func (c *CredentialsCommand) Synopsis() string {
+	return "Manage credentials in the encrypted credential store"
+}
+
+func (c *CredentialsCommand) helpCredentials() string {
+	helpText := `
+Usage: overseer credentials [SUBCOMMANDS] [NAME]
+
+  Manage backend credentials kept in the encrypted credential store at
+  "~/.overseer/credentials". The store is encrypted with a key derived from a
+  passphrase, which is read from $OVERSEER_PASSPHRASE or asked for.
+
+  Credentials are named after the backend they're for ("foreman", "chef",
+  "vsphere" or "infoblox"), optionally prefixed by a profile
+  ("indy-prod/foreman"). When a block in overseer.conf leaves out its password,
+  overseer looks for "<profile>/<backend>" and then "<backend>" in the store.
+`
+	return strings.TrimSpace(helpText)
+}
+
+// credentialsPath returns the location of the credential store.
+func credentialsPath() (string, error) {
+	home, err := getHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return credentials.DefaultPath(home), nil
+}
+
+// openCredentials asks for the passphrase and opens the credential store.
+// When the store doesn't exist yet and create is set, the passphrase is
+// asked for twice so a typo doesn't lock everyone out.
+func openCredentials(ui cli.Ui, path string, create bool) (*credentials.Store, error) {
+	if !credentials.Exists(path) && !create {
+		return nil, fmt.Errorf("no credential store at %s, add something with \"overseer credentials set\"", path)
+	}
+
+	passphrase := os.Getenv(credentials.PassphraseEnvVar)
+	if passphrase == "" {
+		var err error
+		passphrase, err = ui.AskSecret("Passphrase:")
+		if err != nil {
+			return nil, err
+		}
+
+		if passphrase == "" {
+			return nil, fmt.Errorf("the passphrase can't be empty")
+		}
+
+		if !credentials.Exists(path) {
+			confirm, err := ui.AskSecret("Confirm passphrase:")
+			if err != nil {
+				return nil, err
+			}
+
+			if confirm != passphrase {
+				return nil, fmt.Errorf("passphrases don't match")
+			}
+		}
+	}
+
+	return credentials.Open(path, []byte(passphrase))
+}
+
+// fillCredentials fills in any passwords missing from the configspec
+// using the credential store. The store is only opened (and the
+// passphrase only asked for) when something is actually missing.
+func fillCredentials(ui cli.Ui, home, profile string, cspec *configspec.Spec) error {
+	if len(cspec.MissingPasswords()) == 0 {
+		return nil
+	}
+
+	path := credentials.DefaultPath(home)
+	if !credentials.Exists(path) {
+		return nil
+	}
+
+	store, err := openCredentials(ui, path, false)
+	if err != nil {
+		return err
+	}
+
+	cspec.FillCredentials(store, profile)
+	return nil
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iamthemuffinman/cli"
+)
+
+type CredentialsGetCommand struct {
+	UI cli.Ui
+}
+
+func (c *CredentialsGetCommand) Run(args []string) int {
+	if len(args) != 1 || strings.HasPrefix(args[0], "-") {
+		return cli.RunResultHelp
+	}
+	name := args[0]
+
+	path, err := credentialsPath()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("unable to find the credential store: %s", err))
+		return 1
+	}
+
+	store, err := openCredentials(c.UI, path, false)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	credential, ok := store.Get(name)
+	if !ok {
+		c.UI.Error(fmt.Sprintf("no credentials stored for %s", name))
+		return 1
+	}
+
+	// Password first, the same as pass, so this plays nicely with
+	// exec:// references and other tools that only read the first line.
+	c.UI.Output(credential.Password)
+	c.UI.Output(fmt.Sprintf("username: %s", credential.Username))
+	return 0
+}
+
+func (c *CredentialsGetCommand) Help() string {
+	return c.helpCredentialsGet()
+}
+
+func (c *CredentialsGetCommand) Synopsis() string {
+	return "Print a stored credential"
+}
+
+func (c *CredentialsGetCommand) helpCredentialsGet() string {
+	helpText := `
+Usage: overseer credentials get NAME
+
+  Print the password stored under NAME on the first line, followed by the
+  username.
+`
+	return strings.TrimSpace(helpText)
+}
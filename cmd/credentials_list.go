@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iamthemuffinman/cli"
+)
+
+type CredentialsListCommand struct {
+	UI cli.Ui
+}
+
+func (c *CredentialsListCommand) Run(args []string) int {
+	if len(args) != 0 {
+		return cli.RunResultHelp
+	}
+
+	path, err := credentialsPath()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("unable to find the credential store: %s", err))
+		return 1
+	}
+
+	store, err := openCredentials(c.UI, path, false)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	for _, name := range store.Names() {
+		credential, _ := store.Get(name)
+		c.UI.Output(fmt.Sprintf("%s\t%s", name, credential.Username))
+	}
+
+	return 0
+}
+
+func (c *CredentialsListCommand) Help() string {
+	return c.helpCredentialsList()
+}
+
+func (c *CredentialsListCommand) Synopsis() string {
+	return "List stored credentials"
+}
+
+func (c *CredentialsListCommand) helpCredentialsList() string {
+	helpText := `
+Usage: overseer credentials list
+
+  List the name and username of every stored credential. Passwords are never
+  printed by list.
+`
+	return strings.TrimSpace(helpText)
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iamthemuffinman/cli"
+)
+
+type CredentialsRmCommand struct {
+	UI cli.Ui
+}
+
+func (c *CredentialsRmCommand) Run(args []string) int {
+	if len(args) != 1 || strings.HasPrefix(args[0], "-") {
+		return cli.RunResultHelp
+	}
+	name := args[0]
+
+	path, err := credentialsPath()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("unable to find the credential store: %s", err))
+		return 1
+	}
+
+	store, err := openCredentials(c.UI, path, false)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	if !store.Delete(name) {
+		c.UI.Error(fmt.Sprintf("no credentials stored for %s", name))
+		return 1
+	}
+
+	if err := store.Save(); err != nil {
+		c.UI.Error(fmt.Sprintf("unable to save the credential store: %s", err))
+		return 1
+	}
+
+	c.UI.Output(fmt.Sprintf("Removed credentials for %s", name))
+	return 0
+}
+
+func (c *CredentialsRmCommand) Help() string {
+	return c.helpCredentialsRm()
+}
+
+func (c *CredentialsRmCommand) Synopsis() string {
+	return "Remove a stored credential"
+}
+
+func (c *CredentialsRmCommand) helpCredentialsRm() string {
+	helpText := `
+Usage: overseer credentials rm NAME
+
+  Remove the credential stored under NAME.
+`
+	return strings.TrimSpace(helpText)
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iamthemuffinman/cli"
+	"github.com/iamthemuffinman/overseer/pkg/credentials"
+)
+
+type CredentialsSetCommand struct {
+	UI cli.Ui
+}
+
+func (c *CredentialsSetCommand) Run(args []string) int {
+	if len(args) != 1 || strings.HasPrefix(args[0], "-") {
+		return cli.RunResultHelp
+	}
+	name := args[0]
+
+	path, err := credentialsPath()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("unable to find the credential store: %s", err))
+		return 1
+	}
+
+	store, err := openCredentials(c.UI, path, true)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	username, err := c.UI.Ask("Username:")
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	password, err := c.UI.AskSecret("Password:")
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	store.Set(name, credentials.Credential{
+		Username: username,
+		Password: password,
+	})
+
+	if err := store.Save(); err != nil {
+		c.UI.Error(fmt.Sprintf("unable to save the credential store: %s", err))
+		return 1
+	}
+
+	c.UI.Output(fmt.Sprintf("Saved credentials for %s", name))
+	return 0
+}
+
+func (c *CredentialsSetCommand) Help() string {
+	return c.helpCredentialsSet()
+}
+
+func (c *CredentialsSetCommand) Synopsis() string {
+	return "Add or replace a credential"
+}
+
+func (c *CredentialsSetCommand) helpCredentialsSet() string {
+	helpText := `
+Usage: overseer credentials set NAME
+
+  Ask for a username and password and store them under NAME (e.g. "foreman"
+  or "indy-prod/foreman"), replacing anything already there.
+`
+	return strings.TrimSpace(helpText)
+}
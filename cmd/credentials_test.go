@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/pkg/credentials"
+)
+
+func TestCredentialsCommands(t *testing.T) {
+	_, cleanup := withTestHome(t)
+	defer cleanup()
+
+	defer os.Unsetenv(credentials.PassphraseEnvVar)
+	os.Setenv(credentials.PassphraseEnvVar, "correct horse")
+
+	ui := newTestUi("admin", "datpass")
+	if code := (&CredentialsSetCommand{UI: ui}).Run([]string{"foreman"}); code != 0 {
+		t.Fatalf("set exited %d: %s", code, ui.ErrorWriter.String())
+	}
+
+	ui = newTestUi()
+	if code := (&CredentialsGetCommand{UI: ui}).Run([]string{"foreman"}); code != 0 {
+		t.Fatalf("get exited %d: %s", code, ui.ErrorWriter.String())
+	}
+	if actual := ui.OutputWriter.String(); actual != "datpass\nusername: admin\n" {
+		t.Fatalf("unexpected get output: %q", actual)
+	}
+
+	ui = newTestUi()
+	if code := (&CredentialsListCommand{UI: ui}).Run(nil); code != 0 {
+		t.Fatalf("list exited %d: %s", code, ui.ErrorWriter.String())
+	}
+	if actual := ui.OutputWriter.String(); actual != "foreman\tadmin\n" {
+		t.Fatalf("unexpected list output: %q", actual)
+	}
+
+	ui = newTestUi()
+	if code := (&CredentialsRmCommand{UI: ui}).Run([]string{"foreman"}); code != 0 {
+		t.Fatalf("rm exited %d: %s", code, ui.ErrorWriter.String())
+	}
+
+	ui = newTestUi()
+	if code := (&CredentialsGetCommand{UI: ui}).Run([]string{"foreman"}); code != 1 {
+		t.Fatalf("get of a removed credential should fail, exited %d", code)
+	}
+
+	os.Setenv(credentials.PassphraseEnvVar, "wrong horse")
+	ui = newTestUi()
+	if code := (&CredentialsListCommand{UI: ui}).Run(nil); code != 1 {
+		t.Fatalf("list with the wrong passphrase should fail, exited %d", code)
+	}
+}
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/iamthemuffinman/cli"
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+	"github.com/iamthemuffinman/overseer/pkg/hostspec"
+	"github.com/iamthemuffinman/overseer/pkg/provider"
+	"github.com/iamthemuffinman/overseer/pkg/vsphere"
+	flag "github.com/ogier/pflag"
+)
+
+// diffDrifted is the exit status when hosts have drifted from their
+// buildspec, as opposed to 1 when they couldn't be checked.
+const diffDrifted = 2
+
+type DiffCommand struct {
+	UI      cli.Ui
+	FlagSet *flag.FlagSet
+}
+
+func (c *DiffCommand) Run(args []string) int {
+	c.FlagSet = flag.NewFlagSet("diff", flag.ContinueOnError)
+	c.FlagSet.Usage = func() { c.UI.Output(c.Help()) }
+
+	specfile := c.FlagSet.String("buildspec", "", "The buildspec the hosts were built from")
+	hostspecPath := c.FlagSet.StringP("hostspec", "f", "./hostspec", "The hosts to check")
+	parallel := c.FlagSet.Int("parallel", 0, "How many hosts to check at once")
+	jsonOutput := c.FlagSet.Bool("json", false, "Print the differences as JSON")
+	profile := c.FlagSet.String("profile", os.Getenv(configspec.ProfileEnvVar), "Select a profile from your configspec")
+
+	if err := c.FlagSet.Parse(args); err != nil {
+		return 1
+	}
+
+	if *specfile == "" {
+		c.UI.Error("You must specify a buildspec")
+		return cli.RunResultHelp
+	}
+
+	home, err := getHomeDir()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("unable to retrieve users home directory: %s", err))
+		return 1
+	}
+
+	cspec, err := loadConfigspec(c.UI, home, *profile)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	bspec, err := buildspec.ParseDir(buildspecDir, *specfile)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("unable to parse buildspec: %s", err))
+		return 1
+	}
+
+	if err := bspec.CheckProfile(*profile); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	hspec, err := hostspec.ParseFile(*hostspecPath)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("unable to parse hostspec: %s", err))
+		return 1
+	}
+
+	sources, err := diffSources(bspec, cspec, hspec)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	reports := drift.Detect(hspec.Hosts, sources, *parallel)
+
+	if *jsonOutput {
+		out, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("unable to render differences: %s", err))
+			return 1
+		}
+		c.UI.Output(string(out))
+	} else {
+		c.UI.Output(drift.Format(reports))
+	}
+
+	status := 0
+	for _, report := range reports {
+		if len(report.Errors) > 0 {
+			return 1
+		}
+		if report.Drifted() {
+			status = diffDrifted
+		}
+	}
+	return status
+}
+
+// diffSources returns the systems to check hosts against: the
+// buildspec's compute, DNS and config providers, and vSphere if the
+// configspec has a vCenter.
+func diffSources(bspec *buildspec.Spec, cspec *configspec.Spec, hspec *hostspec.Spec) ([]drift.Source, error) {
+	providers, err := provider.Load(bspec, cspec)
+	if err != nil {
+		return nil, err
+	}
+
+	if preparer, ok := providers.Config.(provider.Preparer); ok {
+		preparer.Prepare(hspec.Hosts, hspec.Vars)
+	}
+
+	sources := []drift.Source{
+		{
+			Name: providers.Names["compute"],
+			Diff: providers.Compute.Diff,
+		},
+	}
+
+	if cspec.Vsphere.Endpoint.URL != "" {
+		govc := vsphere.New(cspec.Vsphere, bspec.Vsphere.Datacenter)
+		sources = append(sources, drift.Source{
+			Name: "vsphere",
+			Diff: func(host string) ([]drift.Difference, error) {
+				vm, err := govc.VM(host)
+				if err != nil {
+					return nil, err
+				}
+				if vm == nil {
+					return []drift.Difference{drift.Missing("vm", "present")}, nil
+				}
+				return vm.Diff(bspec.Vsphere), nil
+			},
+		})
+	}
+
+	if providers.DNS != nil {
+		sources = append(sources, drift.Source{
+			Name: providers.Names["dns"],
+			Diff: func(host string) ([]drift.Difference, error) {
+				// The record should point at whatever address the host
+				// was given. Hosts that don't exist are already reported
+				// by the compute provider.
+				exists, err := providers.Compute.Exists(host)
+				if err != nil || !exists {
+					return nil, err
+				}
+
+				ip, err := providers.IPAM.Address(host)
+				if err != nil {
+					return nil, err
+				}
+				return providers.DNS.Diff(host, ip)
+			},
+		})
+	}
+
+	sources = append(sources, drift.Source{
+		Name: providers.Names["config"],
+		Diff: providers.Config.Diff,
+	})
+
+	return sources, nil
+}
+
+func (c *DiffCommand) Help() string {
+	return c.helpDiff()
+}
+
+func (c *DiffCommand) Synopsis() string {
+	return "Show how hosts have drifted from their buildspec"
+}
+
+func (c *DiffCommand) helpDiff() string {
+	helpText := `
+Usage: overseer diff [OPTIONS]
+
+  Compare each host in a hostspec with the buildspec it was built from and
+  report every difference: its Foreman settings, its VM's CPUs, memory,
+  disks and network adapters in vSphere, its A record in Infoblox and its
+  Chef environment, run list and attributes. Nothing is changed.
+
+  Exits 0 if every host matches, 2 if any have drifted and 1 if some
+  couldn't be checked.
+
+Options:
+
+  --buildspec        The buildspec the hosts were built from.
+  --hostspec, -f     The hosts to check. Defaults to ./hostspec.
+  --parallel         How many hosts to check at once. Defaults to 10.
+  --json             Print the differences as JSON.
+  --profile          The configspec profile to use. Defaults to $OVERSEER_PROFILE.
+`
+	return strings.TrimSpace(helpText)
+}
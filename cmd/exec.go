@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/iamthemuffinman/cli"
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/chef"
+	"github.com/iamthemuffinman/overseer/pkg/hostspec"
+	"github.com/iamthemuffinman/overseer/pkg/ssh"
+	flag "github.com/ogier/pflag"
+)
+
+type ExecCommand struct {
+	UI      cli.Ui
+	FlagSet *flag.FlagSet
+}
+
+func (c *ExecCommand) Run(args []string) int {
+	args, command := splitCommand(args)
+	if command == "" {
+		c.UI.Error("No command given. Put the command to run after --")
+		return cli.RunResultHelp
+	}
+
+	c.FlagSet = flag.NewFlagSet("exec", flag.ContinueOnError)
+	c.FlagSet.Usage = func() { c.UI.Output(c.Help()) }
+
+	hostspecPath := c.FlagSet.StringP("hostspec", "f", "", "Run on the hosts in a hostspec")
+	query := c.FlagSet.StringP("query", "q", "", "Run on the nodes matching a Chef search query")
+	specfile := c.FlagSet.String("buildspec", "", "Run on the nodes built from a buildspec")
+	parallel := c.FlagSet.Int("parallel", 0, "How many hosts to run on at once")
+	profile := c.FlagSet.String("profile", os.Getenv(configspec.ProfileEnvVar), "Select a profile from your configspec")
+
+	if err := c.FlagSet.Parse(args); err != nil {
+		return 1
+	}
+
+	targets := 0
+	for _, set := range []bool{len(c.FlagSet.Args()) > 0, *hostspecPath != "", *query != "", *specfile != ""} {
+		if set {
+			targets++
+		}
+	}
+	if targets != 1 {
+		c.UI.Error("Give exactly one of: hosts, --hostspec, --query or --buildspec")
+		return 1
+	}
+
+	home, err := getHomeDir()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("unable to retrieve users home directory: %s", err))
+		return 1
+	}
+
+	cspec, err := loadConfigspec(c.UI, home, *profile)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	var hosts []string
+	switch {
+	case *hostspecPath != "":
+		hspec, err := hostspec.ParseFile(*hostspecPath)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("unable to parse hostspec: %s", err))
+			return 1
+		}
+		hosts = hspec.Hosts
+	case *query != "":
+		hosts, err = chef.SearchNodes(cspec.Chef.Username, cspec.Chef.ClientKey, cspec.Chef.Endpoint, *query)
+		if err != nil {
+			c.UI.Error(err.Error())
+			return 1
+		}
+	case *specfile != "":
+		bspec, err := buildspec.ParseDir(buildspecDir, *specfile)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("unable to parse buildspec: %s", err))
+			return 1
+		}
+
+		if err := bspec.CheckProfile(*profile); err != nil {
+			c.UI.Error(err.Error())
+			return 1
+		}
+
+		q := chef.Query(bspec.Chef)
+		if q == "" {
+			c.UI.Error(fmt.Sprintf("buildspec %q doesn't have an environment, run list or policy to search for", *specfile))
+			return 1
+		}
+
+		hosts, err = chef.SearchNodes(cspec.Chef.Username, cspec.Chef.ClientKey, chef.ServerEndpoint(bspec.Chef, cspec.Chef), q)
+		if err != nil {
+			c.UI.Error(err.Error())
+			return 1
+		}
+	default:
+		hosts = c.FlagSet.Args()
+	}
+
+	if len(hosts) == 0 {
+		c.UI.Error("No hosts to run on")
+		return 1
+	}
+
+	config := cspec.SSH
+	if *parallel > 0 {
+		config.Parallel = *parallel
+	}
+
+	executor := &ssh.Executor{Config: config}
+	results := executor.Run(hosts, command)
+
+	c.UI.Output(formatResults(results))
+
+	for _, result := range results {
+		if !result.OK() {
+			return 1
+		}
+	}
+	return 0
+}
+
+// splitCommand splits the arguments at "--" into overseer's own and the
+// command to run. The command's arguments are quoted so the remote shell
+// sees them just as they were given.
+func splitCommand(args []string) ([]string, string) {
+	for i, arg := range args {
+		if arg == "--" {
+			var command []string
+			for _, arg := range args[i+1:] {
+				command = append(command, quoteArg(arg))
+			}
+			return args[:i], strings.Join(command, " ")
+		}
+	}
+	return args, ""
+}
+
+var plainArg = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// quoteArg quotes arg for the remote shell, leaving arguments that don't
+// need it alone so the command stays readable in the output.
+func quoteArg(arg string) string {
+	if plainArg.MatchString(arg) {
+		return arg
+	}
+	return ssh.Quote(arg)
+}
+
+// execGroup is a set of hosts that gave the same output and exit status.
+type execGroup struct {
+	Hosts      []string
+	Output     string
+	ExitStatus int
+}
+
+// groupResults collapses the hosts the command ran on into groups with
+// identical output, in the order they first appear.
+func groupResults(results []*ssh.Result) []*execGroup {
+	var groups []*execGroup
+	for _, result := range results {
+		if result.Err != nil {
+			continue
+		}
+
+		output := string(result.Stdout) + string(result.Stderr)
+
+		var group *execGroup
+		for _, g := range groups {
+			if g.Output == output && g.ExitStatus == result.ExitStatus {
+				group = g
+				break
+			}
+		}
+		if group == nil {
+			group = &execGroup{Output: output, ExitStatus: result.ExitStatus}
+			groups = append(groups, group)
+		}
+
+		group.Hosts = append(group.Hosts, result.Host)
+	}
+	return groups
+}
+
+// formatResults prints each group of identical output once, followed by
+// the hosts that failed and why.
+func formatResults(results []*ssh.Result) string {
+	var buf bytes.Buffer
+
+	for _, group := range groupResults(results) {
+		count := fmt.Sprintf("%d hosts", len(group.Hosts))
+		if len(group.Hosts) == 1 {
+			count = "1 host"
+		}
+		if group.ExitStatus != 0 {
+			count += fmt.Sprintf(", exit %d", group.ExitStatus)
+		}
+
+		fmt.Fprintf(&buf, "==> %s (%s)\n", strings.Join(group.Hosts, ", "), count)
+		if group.Output != "" {
+			buf.WriteString(group.Output)
+			if !strings.HasSuffix(group.Output, "\n") {
+				buf.WriteString("\n")
+			}
+		}
+		buf.WriteString("\n")
+	}
+
+	var failed []string
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			failed = append(failed, fmt.Sprintf("  %s: %s", result.Host, result.Err))
+		case result.ExitStatus != 0:
+			failed = append(failed, fmt.Sprintf("  %s: exited %d", result.Host, result.ExitStatus))
+		}
+	}
+
+	fmt.Fprintf(&buf, "%d succeeded, %d failed", len(results)-len(failed), len(failed))
+	if len(failed) > 0 {
+		fmt.Fprintf(&buf, ":\n%s", strings.Join(failed, "\n"))
+	}
+
+	return buf.String()
+}
+
+func (c *ExecCommand) Help() string {
+	return c.helpExec()
+}
+
+func (c *ExecCommand) Synopsis() string {
+	return "Run a command on many hosts over SSH"
+}
+
+func (c *ExecCommand) helpExec() string {
+	helpText := `
+Usage: overseer exec [OPTIONS] [HOSTS] -- COMMAND
+
+  Run a command on many hosts at once over SSH and print what each one
+  returned, with hosts that returned the same thing grouped together.
+  Exits non-zero if the command couldn't be run or failed on any host.
+
+  The hosts come from exactly one of the list given on the command line,
+  a hostspec, a Chef search query or a buildspec. SSH settings are taken
+  from the ssh block in your configspec.
+
+  The command's arguments are passed on as they were given, so pipes and
+  redirects need a shell of their own (i.e. -- sh -c 'df -h | grep /var').
+
+Options:
+
+  --hostspec, -f     Run on the hosts in a hostspec.
+  --query, -q        Run on the nodes matching a Chef search query
+                     (i.e. "roles:kafka AND chef_environment:qa").
+  --buildspec        Run on the nodes built from a buildspec.
+  --parallel         How many hosts to run on at once. Defaults to the
+                     configspec's ssh parallel setting, or 10.
+  --profile          The configspec profile to use. Defaults to $OVERSEER_PROFILE.
+`
+	return strings.TrimSpace(helpText)
+}
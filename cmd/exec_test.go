@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/pkg/ssh"
+)
+
+func TestSplitCommand(t *testing.T) {
+	cases := []struct {
+		Args     []string
+		Expected []string
+		Command  string
+	}{
+		{[]string{"-q", "roles:kafka", "--", "systemctl", "status", "kafka"}, []string{"-q", "roles:kafka"}, "systemctl status kafka"},
+		{[]string{"hello.qa.local", "--", "uptime"}, []string{"hello.qa.local"}, "uptime"},
+		{[]string{"hello.qa.local", "uptime"}, []string{"hello.qa.local", "uptime"}, ""},
+		{[]string{"hello.qa.local", "--", "echo", "a  b"}, []string{"hello.qa.local"}, "echo 'a  b'"},
+		{[]string{"hello.qa.local", "--", "echo", "it's", "$HOME", ""}, []string{"hello.qa.local"}, `echo 'it'\''s' '$HOME' ''`},
+		{[]string{"hello.qa.local", "--", "sh", "-c", "df -h | grep /var"}, []string{"hello.qa.local"}, "sh -c 'df -h | grep /var'"},
+	}
+
+	for _, tt := range cases {
+		args, command := splitCommand(tt.Args)
+		if !reflect.DeepEqual(args, tt.Expected) || command != tt.Command {
+			t.Fatalf("%q\n\n%q %q\n\n%q %q", tt.Args, args, command, tt.Expected, tt.Command)
+		}
+	}
+}
+
+func TestFormatResults(t *testing.T) {
+	results := []*ssh.Result{
+		{Host: "hello.qa.local", Stdout: []byte("active\n")},
+		{Host: "lol.qa.local", Stdout: []byte("inactive\n"), ExitStatus: 3},
+		{Host: "with1234.qa.local", Stdout: []byte("active\n")},
+		{Host: "nope.qa.local", ExitStatus: -1, Err: errors.New("unable to connect to nope.qa.local: connection refused")},
+	}
+
+	expected := `==> hello.qa.local, with1234.qa.local (2 hosts)
+active
+
+==> lol.qa.local (1 host, exit 3)
+inactive
+
+2 succeeded, 2 failed:
+  lol.qa.local: exited 3
+  nope.qa.local: unable to connect to nope.qa.local: connection refused`
+
+	if actual := formatResults(results); actual != expected {
+		t.Fatalf("%s\n\n%s", actual, expected)
+	}
+}
+
+func TestExecCommandTargets(t *testing.T) {
+	cases := [][]string{
+		// No command
+		{"hello.qa.local"},
+		// No hosts
+		{"--", "uptime"},
+		// More than one place to get hosts from
+		{"-q", "roles:kafka", "hello.qa.local", "--", "uptime"},
+	}
+
+	for _, args := range cases {
+		c := &ExecCommand{UI: newTestUi()}
+		if code := c.Run(args); code == 0 {
+			t.Fatalf("%q should have failed", args)
+		}
+	}
+}
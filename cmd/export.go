@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/iamthemuffinman/cli"
+)
+
+type ExportCommand struct {
+	UI cli.Ui
+}
+
+func (c *ExportCommand) Run(args []string) int {
+	return cli.RunResultHelp
+}
+
+func (c *ExportCommand) Help() string {
+	return c.helpExport()
+}
+
+func (c *ExportCommand) Synopsis() string {
+	return "Export hosts as configuration for other tools"
+}
+
+func (c *ExportCommand) helpExport() string {
+	helpText := `
+Usage: overseer export [SUBCOMMANDS] [OPTIONS]
+
+  Render the hosts a buildspec and hostspec describe as configuration for
+  another tool, so they can be moved to it or shared with it rather than
+  described twice.
+`
+	return strings.TrimSpace(helpText)
+}
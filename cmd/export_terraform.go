@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/iamthemuffinman/cli"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/hostspec"
+	"github.com/iamthemuffinman/overseer/pkg/terraform"
+	flag "github.com/ogier/pflag"
+)
+
+type ExportTerraformCommand struct {
+	UI      cli.Ui
+	FlagSet *flag.FlagSet
+}
+
+func (c *ExportTerraformCommand) Run(args []string) int {
+	c.FlagSet = flag.NewFlagSet("export terraform", flag.ContinueOnError)
+	c.FlagSet.Usage = func() { c.UI.Output(c.Help()) }
+
+	specfile := c.FlagSet.String("buildspec", "", "The buildspec to export")
+	hostspecPath := c.FlagSet.StringP("hostspec", "f", "./hostspec", "The hosts to export")
+	guestID := c.FlagSet.String("guest-id", terraform.DefaultGuestID, "The vSphere guest OS of the VMs")
+	out := c.FlagSet.StringP("out", "o", "", "Write the configuration to a file instead of printing it")
+
+	if err := c.FlagSet.Parse(args); err != nil {
+		return 1
+	}
+
+	if *specfile == "" {
+		c.UI.Error("You must specify a buildspec")
+		return cli.RunResultHelp
+	}
+
+	bspec, err := buildspec.ParseDir(buildspecDir, *specfile)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("unable to parse buildspec: %s", err))
+		return 1
+	}
+
+	hspec, err := hostspec.ParseFile(*hostspecPath)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("unable to parse hostspec: %s", err))
+		return 1
+	}
+
+	config, err := terraform.Render(bspec, hspec.Hosts, terraform.Options{GuestID: *guestID})
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("unable to export %s: %s", bspec.Name, err))
+		return 1
+	}
+
+	if *out == "" {
+		c.UI.Output(strings.TrimSuffix(string(config), "\n"))
+		return 0
+	}
+
+	if err := ioutil.WriteFile(*out, config, 0644); err != nil {
+		c.UI.Error(fmt.Sprintf("unable to write %s: %s", *out, err))
+		return 1
+	}
+	c.UI.Info(fmt.Sprintf("Wrote %d hosts to %s", len(hspec.Hosts), *out))
+	return 0
+}
+
+func (c *ExportTerraformCommand) Help() string {
+	return c.helpExportTerraform()
+}
+
+func (c *ExportTerraformCommand) Synopsis() string {
+	return "Render a buildspec's hosts as Terraform configuration"
+}
+
+func (c *ExportTerraformCommand) helpExportTerraform() string {
+	helpText := `
+Usage: overseer export terraform [OPTIONS]
+
+  Render each host in a hostspec, as the buildspec would build it, as
+  Terraform configuration: a vsphere_virtual_machine with the buildspec's
+  hardware, a foreman_host that installs it and, when the buildspec has an
+  infoblox block, an address allocated from its subnet with an A record.
+  Nothing is looked up or changed; the configuration is only rendered.
+
+  Only buildspecs whose hosts Foreman builds in vSphere can be exported.
+  Configuring the hosts isn't part of the export.
+
+Options:
+
+  --buildspec        The buildspec to export.
+  --hostspec, -f     The hosts to export. Defaults to ./hostspec.
+  --guest-id         The vSphere guest OS of the VMs. Defaults to otherLinux64Guest.
+  --out, -o          Write the configuration to a file instead of printing it.
+`
+	return strings.TrimSpace(helpText)
+}
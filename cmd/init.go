@@ -1,71 +1,425 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/hashicorp/hcl/hcl/parser"
 	"github.com/hashicorp/hcl/hcl/printer"
 	"github.com/iamthemuffinman/cli"
-	log "github.com/iamthemuffinman/logsip"
-	"github.com/mitchellh/go-homedir"
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/chef"
+	"github.com/iamthemuffinman/overseer/pkg/credentials"
+	"github.com/iamthemuffinman/overseer/pkg/foreman"
+	"github.com/iamthemuffinman/overseer/pkg/infoblox"
+	"github.com/iamthemuffinman/overseer/pkg/secret"
+	"github.com/iamthemuffinman/overseer/pkg/transport"
+	flag "github.com/ogier/pflag"
 )
 
 type InitCommand struct {
 	UI         cli.Ui
+	FlagSet    *flag.FlagSet
 	ShutdownCh <-chan struct{}
 }
 
-const overseerConfigTemplate = `
-hammer {
-    username = "admin"
-    password = "datpass"
+// initBackend describes what the wizard asks about a backend block.
+type initBackend struct {
+	Name        string
+	Description string
+	DefaultURL  string
+	// Chef authenticates with a client key rather than a password.
+	ClientKey bool
 }
 
-knife {
-    username = "admin"
-    password = "datpass"
+var initBackends = []initBackend{
+	{Name: "foreman", Description: "Foreman", DefaultURL: "https://foreman.example.com"},
+	{Name: "chef", Description: "Chef server", DefaultURL: "https://chef.example.com/organizations/example", ClientKey: true},
+	{Name: "vsphere", Description: "vCenter", DefaultURL: "https://vcenter.example.com/sdk"},
+	{Name: "infoblox", Description: "Infoblox", DefaultURL: "https://infoblox.example.com"},
 }
 
-infoblox {
-    username = "admin"
-    password = "datpass"
+// initAnswers is everything the wizard learned about a backend.
+type initAnswers struct {
+	Backend   initBackend
+	URL       string
+	Username  string
+	Password  string
+	ClientKey string
+	CAFile    string
 }
-`
 
 func (c *InitCommand) Run(args []string) int {
-	home, err := homedir.Dir()
+	c.FlagSet = flag.NewFlagSet("init", flag.ContinueOnError)
+	c.FlagSet.Usage = func() { c.UI.Output(c.Help()) }
+
+	force := c.FlagSet.Bool("force", false, "Overwrite an existing overseer.conf")
+
+	if err := c.FlagSet.Parse(args); err != nil {
+		return 1
+	}
+
+	home, err := getHomeDir()
 	if err != nil {
-		log.Errorf("couldn't get the current user's homedir: %s", err)
+		c.UI.Error(fmt.Sprintf("couldn't get the current user's homedir: %s", err))
 		return 1
 	}
 
-	if err := os.MkdirAll(fmt.Sprintf("%s/.overseer", home), 0644); err != nil {
-		log.Errorf("couldn't create .overseer in your home directory: %s", err)
+	dir := filepath.Join(home, ".overseer")
+	path := filepath.Join(dir, "overseer.conf")
+
+	if _, err := os.Stat(path); err == nil && !*force {
+		c.UI.Error(fmt.Sprintf("%s already exists, use --force to overwrite it", path))
 		return 1
 	}
 
-	overseerConfig, err := os.Create(fmt.Sprintf("%s/.overseer/overseer.conf", home))
+	var answers []*initAnswers
+	for _, backend := range initBackends {
+		a, err := c.askBackend(backend)
+		if err != nil {
+			c.UI.Error(err.Error())
+			return 1
+		}
+
+		if a != nil {
+			answers = append(answers, a)
+		}
+	}
+
+	config, err := renderConfig(answers)
 	if err != nil {
-		log.Errorf("wasn't able to create the file: %s", err)
+		c.UI.Error(fmt.Sprintf("error generating config: %s", err))
 		return 1
 	}
 
-	ast, err := parser.Parse([]byte(overseerConfigTemplate))
+	// Make sure what we're about to write is something we can read back
+	cspec, err := configspec.Parse(bytes.NewReader(config))
 	if err != nil {
-		log.Errorf("error parsing config: %s", err)
+		c.UI.Error(fmt.Sprintf("the generated config is invalid: %s", err))
+		return 1
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		c.UI.Error(fmt.Sprintf("couldn't create .overseer in your home directory: %s", err))
+		return 1
+	}
+
+	// MkdirAll leaves an existing directory alone, so tighten up any that
+	// were created by older versions with looser permissions
+	if err := os.Chmod(dir, 0700); err != nil {
+		c.UI.Error(fmt.Sprintf("couldn't set permissions on %s: %s", dir, err))
 		return 1
 	}
 
-	if err := printer.Fprint(overseerConfig, ast); err != nil {
-		log.Errorf("error writing config: %s", err)
+	// Plain passwords go in the encrypted credential store rather than
+	// the config file. The store is opened (and the passphrase asked for)
+	// now but only saved once the config has been written, so a config
+	// that can't be written doesn't leave passwords behind without one.
+	var plain []*initAnswers
+	for _, a := range answers {
+		if a.Password != "" && !isReference(a.Password) {
+			plain = append(plain, a)
+		}
+	}
+
+	var store *credentials.Store
+	if len(plain) > 0 {
+		c.UI.Output("Passwords are kept in the encrypted credential store, not in overseer.conf.")
+
+		store, err = openCredentials(c.UI, credentials.DefaultPath(home), true)
+		if err != nil {
+			c.UI.Error(err.Error())
+			return 1
+		}
+
+		for _, a := range plain {
+			store.Set(a.Backend.Name, credentials.Credential{Username: a.Username, Password: a.Password})
+		}
+	}
+
+	if err := writeConfig(path, config, *force); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	if store != nil {
+		if err := store.Save(); err != nil {
+			// A new config without its passwords is no use, so take it
+			// back out. One that was overwritten is already gone.
+			if !*force {
+				os.Remove(path)
+				c.UI.Error(fmt.Sprintf("unable to save the credential store, so %s wasn't written either: %s", path, err))
+				return 1
+			}
+			c.UI.Error(fmt.Sprintf("wrote %s but was unable to save the credential store: %s\nAdd the passwords with \"overseer credentials set\"", path, err))
+			return 1
+		}
+	}
+
+	c.UI.Output(fmt.Sprintf("Wrote %s", path))
+
+	if len(answers) == 0 {
+		return 0
+	}
+
+	check, err := askYesNo(c.UI, "Test connectivity to each backend now?", true)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	if check && !c.checkConnectivity(cspec, answers) {
 		return 1
 	}
 
 	return 0
 }
 
+// writeConfig writes the config to path, which must not exist unless
+// force is set. A file it created is removed again if writing it fails.
+func writeConfig(path string, config []byte, force bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+
+	f, err := os.OpenFile(path, flags, 0600)
+	if err != nil {
+		return fmt.Errorf("wasn't able to create the file: %s", err)
+	}
+
+	// O_TRUNC keeps the old mode, so make sure an overwritten file ends up
+	// private too
+	err = f.Chmod(0600)
+	if err != nil {
+		err = fmt.Errorf("couldn't set permissions on %s: %s", path, err)
+	} else if _, err = f.Write(config); err != nil {
+		err = fmt.Errorf("error writing config: %s", err)
+	}
+	if cerr := f.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("error writing config: %s", cerr)
+	}
+
+	if err != nil && !force {
+		os.Remove(path)
+	}
+	return err
+}
+
+// askBackend walks through the questions for one backend. It returns nil
+// if the backend is skipped.
+func (c *InitCommand) askBackend(backend initBackend) (*initAnswers, error) {
+	configure, err := askYesNo(c.UI, fmt.Sprintf("Configure %s?", backend.Description), true)
+	if err != nil || !configure {
+		return nil, err
+	}
+
+	a := &initAnswers{Backend: backend}
+
+	if a.URL, err = askDefault(c.UI, fmt.Sprintf("%s URL", backend.Description), backend.DefaultURL); err != nil {
+		return nil, err
+	}
+
+	if a.Username, err = askDefault(c.UI, fmt.Sprintf("%s username", backend.Description), ""); err != nil {
+		return nil, err
+	}
+	// Requests are signed as the user the client key belongs to
+	for backend.ClientKey && a.Username == "" {
+		c.UI.Error("The username is needed to sign requests with your client key.")
+		if a.Username, err = askDefault(c.UI, fmt.Sprintf("%s username", backend.Description), ""); err != nil {
+			return nil, err
+		}
+	}
+
+	if backend.ClientKey {
+		if a.ClientKey, err = askDefault(c.UI, "Path to your Chef client key", "~/.chef/client.pem"); err != nil {
+			return nil, err
+		}
+	} else {
+		query := fmt.Sprintf("%s password (or a reference like env://%s_PASSWORD, blank to skip):", backend.Description, strings.ToUpper(backend.Name))
+		if a.Password, err = c.UI.AskSecret(query); err != nil {
+			return nil, err
+		}
+	}
+
+	if a.CAFile, err = askDefault(c.UI, "CA bundle (blank to use the system roots)", ""); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// checkConnectivity tries to talk to every configured backend and reports
+// how it went. It returns false if any of them failed.
+func (c *InitCommand) checkConnectivity(cspec *configspec.Spec, answers []*initAnswers) bool {
+	// Use the passwords we were just given rather than asking for the
+	// credential store passphrase again
+	for _, a := range answers {
+		switch a.Backend.Name {
+		case "foreman":
+			cspec.Foreman.Password = a.Password
+		case "vsphere":
+			cspec.Vsphere.Password = a.Password
+		case "infoblox":
+			cspec.Infoblox.Password = a.Password
+		}
+	}
+
+	resolver, err := secret.NewResolver(cspec)
+	if err == nil {
+		err = cspec.ResolveSecrets(resolver)
+	}
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("unable to resolve secrets: %s", err))
+		return false
+	}
+
+	ok := true
+	for _, a := range answers {
+		var err error
+		switch a.Backend.Name {
+		case "foreman":
+			var client *foreman.Client
+			if client, err = foreman.New(cspec.Foreman); err == nil {
+				err = client.Ping()
+			}
+		case "chef":
+			err = chef.Ping(a.Username, cspec.Chef.ClientKey, cspec.Chef.Endpoint)
+		case "vsphere":
+			err = pingURL(cspec.Vsphere.Endpoint)
+		case "infoblox":
+			var client *infoblox.Client
+			if client, err = infoblox.New(cspec.Infoblox); err == nil {
+				err = client.Ping()
+			}
+		}
+
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("%s: %s", a.Backend.Name, err))
+			ok = false
+			continue
+		}
+
+		c.UI.Output(fmt.Sprintf("%s: ok", a.Backend.Name))
+	}
+
+	return ok
+}
+
+// pingURL makes sure something answers at the endpoint and that its TLS
+// certificate checks out. Any HTTP response at all counts as success.
+func pingURL(endpoint configspec.Endpoint) error {
+	client, err := transport.New(endpoint)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Get(endpoint.URL)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("%s returned %s", endpoint.URL, resp.Status)
+	}
+
+	return nil
+}
+
+// renderConfig turns the answers into a formatted overseer.conf.
+func renderConfig(answers []*initAnswers) ([]byte, error) {
+	var buf bytes.Buffer
+
+	for _, a := range answers {
+		fmt.Fprintf(&buf, "%s {\n", a.Backend.Name)
+		fmt.Fprintf(&buf, "url = %s\n", strconv.Quote(a.URL))
+		if a.Username != "" {
+			fmt.Fprintf(&buf, "username = %s\n", strconv.Quote(a.Username))
+		}
+		if isReference(a.Password) {
+			fmt.Fprintf(&buf, "password = %s\n", strconv.Quote(a.Password))
+		}
+		if a.ClientKey != "" {
+			fmt.Fprintf(&buf, "client_key = %s\n", strconv.Quote(a.ClientKey))
+		}
+		if a.CAFile != "" {
+			fmt.Fprintf(&buf, "ca_file = %s\n", strconv.Quote(a.CAFile))
+		}
+		fmt.Fprintf(&buf, "}\n\n")
+	}
+
+	ast, err := parser.Parse(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := printer.Fprint(&out, ast); err != nil {
+		return nil, err
+	}
+	out.WriteString("\n")
+
+	return out.Bytes(), nil
+}
+
+func isReference(value string) bool {
+	_, ok, err := secret.ParseReference(value)
+	return ok && err == nil
+}
+
+// askDefault asks a question, offering def as the answer if the user just
+// hits enter.
+func askDefault(ui cli.Ui, query, def string) (string, error) {
+	if def != "" {
+		query = fmt.Sprintf("%s [%s]", query, def)
+	}
+
+	answer, err := ui.Ask(query + ":")
+	if err != nil {
+		return "", err
+	}
+
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return def, nil
+	}
+
+	return answer, nil
+}
+
+// askYesNo asks a yes or no question, with def being the answer if the
+// user just hits enter.
+func askYesNo(ui cli.Ui, query string, def bool) (bool, error) {
+	choices := "[y/N]"
+	if def {
+		choices = "[Y/n]"
+	}
+
+	for {
+		answer, err := ui.Ask(fmt.Sprintf("%s %s", query, choices))
+		if err != nil {
+			return false, err
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+
+		ui.Error("Please answer yes or no.")
+	}
+}
+
 func (c *InitCommand) Help() string {
 	return c.helpInit()
 }
@@ -76,17 +430,32 @@ func (c *InitCommand) Synopsis() string {
 
 func (c *InitCommand) helpInit() string {
 	helpText := `
-Usage: overseer init
-
-  Initialize overseer in your home directory "~/.overseer/overseer.conf". This config
-  file will contain your usernames and passwords to various parts of the
-  infrastructure. Make sure you keep it safe! There are sensible defaults in
-  place. Normally, I'd consider it bad practice to keep passwords in a file
-  somewhere on the filesystem, but A: we do it with our knife.rb file anyway and
-  B: we don't have something like Vault setup where we could "lease" the secrets
-  for the life of the overseer process and then revoke them at the end. Inputting
-  the passwords manually is a hassle, error-prone, and just barbaric. This way
-  is best for the time being.
+Usage: overseer init [OPTIONS]
+
+  Initialize overseer in your home directory "~/.overseer/overseer.conf". This
+  walks you through setting up each backend (Foreman, Chef, vCenter and
+  Infoblox), checks the result parses, and can test that each endpoint is
+  reachable with the credentials you gave it. The directory is created with
+  mode 0700 and the file with mode 0600.
+
+  Passwords don't have to live in the file. Any username or password can be a
+  reference that's looked up each time overseer runs instead:
+
+    password = "env://FOREMAN_PASSWORD"               # an environment variable
+    password = "file://~/.overseer/foreman.pass"      # the contents of a file
+    password = "exec://pass show foreman"             # the first line a helper prints
+    password = "secret://vault/kv/foreman#password"   # a key in Vault's KV store
+
+  Vault references need a "vault" block with a url (or VAULT_ADDR) and a
+  token (or VAULT_TOKEN, or ~/.vault-token).
+
+  If a password is left out entirely, overseer looks it up in the encrypted
+  credential store managed by "overseer credentials". Any plain password you
+  give init is put there rather than in overseer.conf.
+
+Options:
+
+  --force    Overwrite an existing overseer.conf.
 `
 
 	return strings.TrimSpace(helpText)
@@ -1 +1,190 @@
 package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iamthemuffinman/cli"
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/credentials"
+	"github.com/mitchellh/go-homedir"
+)
+
+// testUi answers questions from a script, one answer per question.
+type testUi struct {
+	*cli.MockUi
+	answers []string
+}
+
+func newTestUi(answers ...string) *testUi {
+	return &testUi{
+		MockUi:  &cli.MockUi{OutputWriter: new(bytes.Buffer), ErrorWriter: new(bytes.Buffer)},
+		answers: answers,
+	}
+}
+
+func (u *testUi) Ask(query string) (string, error) {
+	if len(u.answers) == 0 {
+		return "", fmt.Errorf("unexpected question: %s", query)
+	}
+
+	answer := u.answers[0]
+	u.answers = u.answers[1:]
+	return answer, nil
+}
+
+func (u *testUi) AskSecret(query string) (string, error) {
+	return u.Ask(query)
+}
+
+// withTestHome points the home directory at a fresh temporary directory
+// for the length of a test.
+func withTestHome(t *testing.T) (string, func()) {
+	home, err := ioutil.TempDir("", "overseer-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldHome := os.Getenv("HOME")
+	os.Setenv("HOME", home)
+	homedir.DisableCache = true
+
+	return home, func() {
+		homedir.DisableCache = false
+		os.Setenv("HOME", oldHome)
+		os.RemoveAll(home)
+	}
+}
+
+func TestInitCommand(t *testing.T) {
+	home, cleanup := withTestHome(t)
+	defer cleanup()
+
+	defer os.Unsetenv(credentials.PassphraseEnvVar)
+	os.Setenv(credentials.PassphraseEnvVar, "correct horse")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); r.URL.Path != "/api/v2/status" || user != "admin" || pass != "datpass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"result":"ok"}`))
+	}))
+	defer server.Close()
+
+	ui := newTestUi(
+		// foreman
+		"y", server.URL, "admin", "datpass", "",
+		// chef
+		"n",
+		// vsphere
+		"y", "", "administrator@vsphere.local", "env://VSPHERE_PASSWORD", "/etc/pki/ca.pem",
+		// infoblox
+		"no",
+		// connectivity
+		"n",
+	)
+	if code := (&InitCommand{UI: ui}).Run(nil); code != 0 {
+		t.Fatalf("init exited %d: %s", code, ui.ErrorWriter.String())
+	}
+
+	dir := filepath.Join(home, ".overseer")
+	path := filepath.Join(dir, "overseer.conf")
+
+	for p, mode := range map[string]os.FileMode{dir: 0700, path: 0600} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != mode {
+			t.Fatalf("%s should be %s, got %s", p, mode, info.Mode().Perm())
+		}
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "datpass") {
+		t.Fatalf("overseer.conf contains a plain password:\n%s", b)
+	}
+
+	cspec, err := configspec.ParseFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cspec.Foreman.Endpoint.URL != server.URL || cspec.Foreman.Username != "admin" || cspec.Foreman.Password != "" {
+		t.Fatalf("unexpected foreman block: %#v", cspec.Foreman)
+	}
+	if cspec.Vsphere.Endpoint.URL != "https://vcenter.example.com/sdk" || cspec.Vsphere.Password != "env://VSPHERE_PASSWORD" || cspec.Vsphere.Endpoint.CAFile != "/etc/pki/ca.pem" {
+		t.Fatalf("unexpected vsphere block: %#v", cspec.Vsphere)
+	}
+	if cspec.Chef != (configspec.Chef{}) || cspec.Infoblox != (configspec.Infoblox{}) {
+		t.Fatalf("skipped backends should be empty: %#v", cspec)
+	}
+
+	store, err := credentials.Open(credentials.DefaultPath(home), []byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, ok := store.Get("foreman"); !ok || c.Password != "datpass" {
+		t.Fatalf("foreman password should be in the credential store: %#v", c)
+	}
+
+	// Running it again shouldn't clobber the file...
+	ui = newTestUi()
+	if code := (&InitCommand{UI: ui}).Run(nil); code != 1 {
+		t.Fatalf("init without --force should refuse to overwrite, exited %d", code)
+	}
+
+	// ...unless asked to, and this time test connectivity
+	ui = newTestUi(
+		"y", server.URL, "admin", "datpass", "",
+		"n", "n", "n",
+		"y",
+	)
+	if code := (&InitCommand{UI: ui}).Run([]string{"--force"}); code != 0 {
+		t.Fatalf("init --force exited %d: %s", code, ui.ErrorWriter.String())
+	}
+	if !strings.Contains(ui.OutputWriter.String(), "foreman: ok") {
+		t.Fatalf("expected a successful connectivity check:\n%s", ui.OutputWriter.String())
+	}
+}
+
+func TestInitCommandUnwritableConfig(t *testing.T) {
+	home, cleanup := withTestHome(t)
+	defer cleanup()
+
+	defer os.Unsetenv(credentials.PassphraseEnvVar)
+	os.Setenv(credentials.PassphraseEnvVar, "correct horse")
+
+	// A dangling symlink gets past the check for an existing file but
+	// can't be created exclusively
+	dir := filepath.Join(home, ".overseer")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "missing"), filepath.Join(dir, "overseer.conf")); err != nil {
+		t.Fatal(err)
+	}
+
+	ui := newTestUi(
+		"y", "https://foreman.qa.local", "admin", "datpass", "",
+		"n", "n", "n",
+	)
+	if code := (&InitCommand{UI: ui}).Run(nil); code != 1 {
+		t.Fatalf("init should have failed to write the config, exited %d", code)
+	}
+
+	if credentials.Exists(credentials.DefaultPath(home)) {
+		t.Fatal("the credential store was saved without a config to go with it")
+	}
+}
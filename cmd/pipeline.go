@@ -0,0 +1,421 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/provider"
+	"github.com/iamthemuffinman/overseer/pkg/summary"
+	"github.com/iamthemuffinman/overseer/pkg/verify"
+
+	log "github.com/iamthemuffinman/logsip"
+)
+
+// pipeline provisions hosts with a buildspec's providers, recording how
+// each step went for each host rather than bailing out on the first
+// failure. Steps that already succeeded in an earlier attempt at the same
+// run aren't done again.
+type pipeline struct {
+	providers *provider.Set
+	verifier  *verify.Verifier
+	checks    []*buildspec.Check
+	results   *summary.Summary
+
+	// cloudInit is the buildspec's cloud_init block, if it has one, for
+	// seeding the hosts that are created.
+	cloudInit *buildspec.CloudInit
+	// hostVars are the hostspec's variables for each host, for config
+	// managers that use them.
+	hostVars map[string]map[string]string
+
+	// pollInterval is how often the compute provider is asked whether a
+	// host has finished building.
+	pollInterval time.Duration
+	// buildTimeout is how long the hosts get to build, all together,
+	// before the ones still building are failed.
+	buildTimeout time.Duration
+}
+
+// defaultBuildTimeout is how long hosts get to build when the buildspec
+// doesn't set build_timeout.
+const defaultBuildTimeout = time.Hour
+
+// buildTimeout returns how long hosts built from bspec get to build.
+func buildTimeout(bspec *buildspec.Spec) time.Duration {
+	if bspec.BuildTimeout > 0 {
+		return time.Duration(bspec.BuildTimeout) * time.Second
+	}
+	return defaultBuildTimeout
+}
+
+// run takes the hosts through every step. started is when the run began:
+// anything the config manager does after that counts as the hosts' first
+// converge.
+func (p *pipeline) run(hosts []string, started time.Time) {
+	p.create(hosts)
+	p.build(hosts)
+	if p.providers.DNS != nil {
+		p.dns(hosts)
+	}
+	p.configure(hosts, started)
+
+	for _, host := range hosts {
+		if !p.results.HostFailed(host) {
+			p.results.SetOutcome(host, hostOutcome(p.results, host))
+		}
+	}
+}
+
+func (p *pipeline) done(host, step string) bool {
+	return p.results.Succeeded(host, step)
+}
+
+// create creates the hosts the compute provider doesn't have yet. Ones it
+// does have are brought in line with the buildspec, so running the same
+// hostspec twice only changes what's different.
+func (p *pipeline) create(hosts []string) {
+	compute, config := p.providers.Compute, p.providers.Config
+
+	for _, host := range hosts {
+		if p.done(host, "host") {
+			continue
+		}
+
+		exists, err := compute.Exists(host)
+		if err != nil {
+			log.Errorf("%s", err)
+			p.results.Fail(host, "host", err)
+			continue
+		}
+
+		if exists {
+			diffs, err := compute.Diff(host)
+			if err != nil {
+				log.Errorf("%s", err)
+				p.results.Fail(host, "host", err)
+				continue
+			}
+			if len(diffs) == 0 {
+				p.results.OK(host, "host", provider.Unchanged)
+				continue
+			}
+
+			if err := compute.Update(host, diffs); err != nil {
+				log.Errorf("unable to update %s: %s", host, err)
+				p.results.Fail(host, "host", err)
+				continue
+			}
+
+			var changes []string
+			for _, diff := range diffs {
+				changes = append(changes, diff.String())
+			}
+			p.results.OK(host, "host", provider.Updated+" "+strings.Join(changes, ", "))
+			continue
+		}
+
+		// A hostname that's being re-provisioned may still be known to the
+		// config manager. Deal with that before building anything so the
+		// first run doesn't trip over it.
+		if !p.done(host, "conflict") {
+			detail, err := config.ResolveConflict(host)
+			if err != nil {
+				log.Errorf("%s", err)
+				p.results.Fail(host, "conflict", err)
+				p.results.Skip(host, "host", "config conflict")
+				continue
+			}
+			if detail != "" {
+				log.Infof("%s: %s", host, detail)
+				p.results.OK(host, "conflict", detail)
+			}
+		}
+
+		if err := p.createHost(host); err != nil {
+			log.Errorf("unable to create %s: %s", host, err)
+			p.results.Fail(host, "host", err)
+			continue
+		}
+		p.results.OK(host, "host", provider.Created)
+	}
+}
+
+// checkCloudInit makes sure the providers can seed hosts the way the
+// buildspec's cloud_init block asks, before anything is created.
+func checkCloudInit(spec *buildspec.CloudInit, providers *provider.Set) error {
+	if spec == nil {
+		return nil
+	}
+
+	if spec.Delivery == buildspec.DeliveryGuestinfo {
+		return fmt.Errorf("cloud-init seeds are only delivered by guestinfo when overseer rebuild reclones a host. "+
+			"New hosts need delivery = %q and the libvirt compute provider", buildspec.DeliveryISO)
+	}
+	if _, ok := providers.Compute.(provider.Seeder); !ok {
+		return fmt.Errorf("compute provider %s can't deliver cloud-init seeds", providers.Names["compute"])
+	}
+	if !spec.DHCP {
+		if _, ok := providers.IPAM.(provider.Allocator); !ok {
+			return fmt.Errorf("ipam provider %s can't reserve addresses before hosts are created, which cloud_init needs "+
+				"unless it uses dhcp. Try ipam = \"infoblox\"", providers.Names["ipam"])
+		}
+	}
+	return nil
+}
+
+// createHost creates the host, with a cloud-init seed if the buildspec
+// asks for one.
+func (p *pipeline) createHost(host string) error {
+	if p.cloudInit == nil {
+		return p.providers.Compute.Create(host)
+	}
+	if err := checkCloudInit(p.cloudInit, p.providers); err != nil {
+		return err
+	}
+
+	// A static address goes in the seed, so it's reserved before the host
+	// exists
+	var ip string
+	if !p.cloudInit.DHCP {
+		var err error
+		if ip, err = p.providers.IPAM.(provider.Allocator).Allocate(host); err != nil {
+			return err
+		}
+	}
+
+	seed, err := p.providers.Seed(host, ip, p.cloudInit)
+	if err != nil {
+		return err
+	}
+	return p.providers.Compute.(provider.Seeder).CreateSeeded(host, seed)
+}
+
+// build waits for every host to finish building. They were all created
+// before it started, so they share the one deadline.
+func (p *pipeline) build(hosts []string) {
+	deadline := time.Now().Add(p.buildTimeout)
+	for _, host := range hosts {
+		if p.results.HostFailed(host) {
+			p.results.Skip(host, "build", "host not created")
+			continue
+		}
+
+		if p.done(host, "build") {
+			continue
+		}
+
+		for {
+			built, err := p.providers.Compute.Built(host)
+			if err != nil {
+				log.Errorf("unable to check whether %s has built: %s", host, err)
+				p.results.Fail(host, "build", err)
+				break
+			}
+
+			if built {
+				log.Infof("%s built successfully!", host)
+				p.results.OK(host, "build", "")
+				break
+			}
+
+			if time.Now().After(deadline) {
+				err := fmt.Errorf("%s hadn't built after %s", host, p.buildTimeout)
+				log.Errorf("%s", err)
+				p.results.Fail(host, "build", err)
+				break
+			}
+
+			time.Sleep(p.pollInterval)
+		}
+	}
+}
+
+// dns points each host's record at the address it was given.
+func (p *pipeline) dns(hosts []string) {
+	for _, host := range hosts {
+		if p.results.HostFailed(host) {
+			p.results.Skip(host, "dns", "host not built")
+			continue
+		}
+
+		if p.done(host, "dns") {
+			continue
+		}
+
+		ip, err := p.providers.IPAM.Address(host)
+		if err != nil {
+			log.Errorf("%s", err)
+			p.results.Fail(host, "dns", err)
+			continue
+		}
+
+		change, err := p.providers.DNS.EnsureRecord(host, ip)
+		if err != nil {
+			log.Errorf("%s", err)
+			p.results.Fail(host, "dns", err)
+			continue
+		}
+		p.results.OK(host, "dns", change)
+	}
+}
+
+// configure bootstraps the config manager on each host, gives it the
+// buildspec's configuration, waits for it to converge and runs the
+// buildspec's verify checks against it. Each check is its own step.
+func (p *pipeline) configure(hosts []string, started time.Time) {
+	config := p.providers.Config
+
+	var verifySteps []string
+	for _, check := range p.checks {
+		verifySteps = append(verifySteps, "verify: "+check.Name)
+	}
+	skip := func(host, reason string, steps ...string) {
+		for _, step := range append(steps, verifySteps...) {
+			p.results.Skip(host, step, reason)
+		}
+	}
+	verified := func(host string) bool {
+		for _, step := range verifySteps {
+			if !p.done(host, step) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if preparer, ok := config.(provider.Preparer); ok {
+		var pending []string
+		for _, host := range hosts {
+			if !p.results.HostFailed(host) && !p.done(host, "config") {
+				pending = append(pending, host)
+			}
+		}
+		preparer.Prepare(pending, p.hostVars)
+	}
+
+	for _, host := range hosts {
+		if p.results.HostFailed(host) {
+			steps := []string{"config", "converge"}
+			if config.Bootstraps() {
+				steps = append([]string{"bootstrap"}, steps...)
+			}
+			skip(host, "host not ready", steps...)
+			continue
+		}
+
+		created := p.results.Detail(host, "host") == provider.Created
+
+		if !p.done(host, "converge") {
+			if config.Bootstraps() && !p.done(host, "bootstrap") {
+				// A host that was already there only needs bootstrapping if
+				// it never got as far as registering
+				registered := false
+				if !created {
+					var err error
+					registered, err = config.Registered(host)
+					if err != nil {
+						log.Errorf("%s", err)
+						p.results.Fail(host, "bootstrap", err)
+						skip(host, "bootstrap failed", "config", "converge")
+						continue
+					}
+				}
+
+				if registered {
+					p.results.OK(host, "bootstrap", "already registered")
+				} else {
+					log.Infof("Bootstrapping %s", host)
+					if err := config.Bootstrap(host); err != nil {
+						log.Errorf("unable to bootstrap %s: %s", host, err)
+						p.results.Fail(host, "bootstrap", err)
+						skip(host, "bootstrap failed", "config", "converge")
+						continue
+					}
+					p.results.OK(host, "bootstrap", "")
+				}
+			}
+
+			if !p.done(host, "config") {
+				change, err := config.Apply(host)
+				if err != nil {
+					log.Errorf("unable to configure %s: %s", host, err)
+					p.results.Fail(host, "config", err)
+					skip(host, "config failed", "converge")
+					continue
+				}
+				p.results.OK(host, "config", change)
+			}
+
+			// New hosts (and old ones that have only just been
+			// bootstrapped) aren't done until they've converged. Hosts that
+			// were already up only need a run if their configuration
+			// changed.
+			firstRun := created || (p.done(host, "bootstrap") && p.results.Detail(host, "bootstrap") == "")
+			switch {
+			case firstRun:
+				log.Infof("Waiting for %s to converge", host)
+				if err := config.WaitForConverge(host, started); err != nil {
+					log.Errorf("%s didn't converge: %s", host, err)
+					p.results.Fail(host, "converge", err)
+					skip(host, "host didn't converge")
+					continue
+				}
+				p.results.OK(host, "converge", "")
+			case p.results.Detail(host, "config") == provider.Unchanged:
+				p.results.OK(host, "converge", provider.Unchanged)
+			default:
+				log.Infof("Converging %s", host)
+				if err := config.Converge(host); err != nil {
+					log.Errorf("%s didn't converge: %s", host, err)
+					p.results.Fail(host, "converge", err)
+					skip(host, "host didn't converge")
+					continue
+				}
+				p.results.OK(host, "converge", "converged")
+			}
+		}
+
+		if verified(host) {
+			continue
+		}
+
+		if len(verifySteps) > 0 {
+			log.Infof("Verifying %s", host)
+		}
+		for i, result := range p.verifier.Verify(host) {
+			if !result.OK() {
+				log.Errorf("%s failed check %q: %s", host, result.Check.Name, result.Err)
+				p.results.Fail(host, verifySteps[i], result.Err)
+				continue
+			}
+			p.results.OK(host, verifySteps[i], result.Detail)
+		}
+	}
+}
+
+// hostOutcome sums up what a run did to a host from the steps recorded
+// for it.
+func hostOutcome(results *summary.Summary, host string) string {
+	detail := results.Detail(host, "host")
+	switch {
+	case detail == provider.Created:
+		return provider.Created
+	case strings.HasPrefix(detail, provider.Updated):
+		return provider.Updated
+	}
+
+	changed := func(step string) bool {
+		detail := results.Detail(host, step)
+		return detail == provider.Created || strings.HasPrefix(detail, provider.Updated)
+	}
+	if changed("dns") || changed("config") {
+		return provider.Updated
+	}
+	if results.Succeeded(host, "bootstrap") && results.Detail(host, "bootstrap") == "" {
+		return provider.Updated
+	}
+
+	return provider.Unchanged
+}
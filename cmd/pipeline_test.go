@@ -0,0 +1,490 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/cloudinit"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+	"github.com/iamthemuffinman/overseer/pkg/infoblox"
+	"github.com/iamthemuffinman/overseer/pkg/provider"
+	"github.com/iamthemuffinman/overseer/pkg/summary"
+	"github.com/iamthemuffinman/overseer/pkg/verify"
+)
+
+// fakeCompute has the hosts in existing, with the differences in diffs,
+// and builds hosts instantly.
+type fakeCompute struct {
+	existing map[string]bool
+	diffs    map[string][]drift.Difference
+	created  []string
+	updated  []string
+}
+
+func (f *fakeCompute) Exists(host string) (bool, error) { return f.existing[host], nil }
+
+func (f *fakeCompute) Create(host string) error {
+	f.created = append(f.created, host)
+	return nil
+}
+
+func (f *fakeCompute) Diff(host string) ([]drift.Difference, error) { return f.diffs[host], nil }
+
+func (f *fakeCompute) Update(host string, diffs []drift.Difference) error {
+	f.updated = append(f.updated, host)
+	return nil
+}
+
+func (f *fakeCompute) Built(host string) (bool, error) { return true, nil }
+
+// stuckCompute is a fakeCompute whose hosts never finish building.
+type stuckCompute struct {
+	fakeCompute
+}
+
+func (f *stuckCompute) Built(host string) (bool, error) { return false, nil }
+
+type fakeIPAM struct{}
+
+func (fakeIPAM) Address(host string) (string, error) { return "10.0.0.10", nil }
+
+// fakeAllocator is a fakeIPAM that reserves addresses before hosts exist.
+type fakeAllocator struct {
+	fakeIPAM
+	allocated []string
+}
+
+func (f *fakeAllocator) Allocate(host string) (string, error) {
+	f.allocated = append(f.allocated, host)
+	return "10.0.0.10", nil
+}
+
+type fakeDNS struct {
+	records map[string]string
+}
+
+func (f *fakeDNS) EnsureRecord(host, ip string) (string, error) {
+	if f.records[host] == ip {
+		return provider.Unchanged, nil
+	}
+	f.records[host] = ip
+	return provider.Created, nil
+}
+
+func (f *fakeDNS) Diff(host, ip string) ([]drift.Difference, error) { return nil, nil }
+
+// fakeConfig has registered the hosts in registered and fails to
+// bootstrap the ones in broken.
+type fakeConfig struct {
+	registered   map[string]bool
+	broken       map[string]bool
+	bootstrapped []string
+	converged    []string
+	prepared     []string
+}
+
+func (f *fakeConfig) Prepare(hosts []string, vars map[string]map[string]string) {
+	f.prepared = hosts
+}
+
+func (f *fakeConfig) ResolveConflict(host string) (string, error) { return "", nil }
+func (f *fakeConfig) Registered(host string) (bool, error)        { return f.registered[host], nil }
+func (f *fakeConfig) Bootstraps() bool                            { return true }
+
+func (f *fakeConfig) Bootstrap(host string) error {
+	if f.broken[host] {
+		return fmt.Errorf("no route to host")
+	}
+	f.bootstrapped = append(f.bootstrapped, host)
+	f.registered[host] = true
+	return nil
+}
+
+func (f *fakeConfig) Apply(host string) (string, error) {
+	if f.registered[host] && !contains(f.bootstrapped, host) {
+		return provider.Unchanged, nil
+	}
+	return provider.Created, nil
+}
+
+func (f *fakeConfig) WaitForConverge(host string, since time.Time) error {
+	f.converged = append(f.converged, host)
+	return nil
+}
+
+func (f *fakeConfig) Converge(host string) error {
+	f.converged = append(f.converged, host)
+	return nil
+}
+
+func (f *fakeConfig) Diff(host string) ([]drift.Difference, error) { return nil, nil }
+func (f *fakeConfig) Remove(host string) error                     { return nil }
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPipeline(t *testing.T) {
+	compute := &fakeCompute{
+		existing: map[string]bool{"old.qa.local": true, "drifted.qa.local": true},
+		diffs: map[string][]drift.Difference{
+			"drifted.qa.local": {{Field: "hostgroup", Have: "base", Want: "base/kafka"}},
+		},
+	}
+	dns := &fakeDNS{records: map[string]string{"old.qa.local": "10.0.0.10", "drifted.qa.local": "10.0.0.10"}}
+	config := &fakeConfig{
+		registered: map[string]bool{"old.qa.local": true, "drifted.qa.local": true},
+		broken:     map[string]bool{"broken.qa.local": true},
+	}
+
+	hosts := []string{"new.qa.local", "old.qa.local", "drifted.qa.local", "broken.qa.local"}
+	results := summary.New(hosts)
+
+	p := &pipeline{
+		providers: &provider.Set{Compute: compute, IPAM: fakeIPAM{}, DNS: dns, Config: config},
+		verifier:  verify.New(buildspec.Verify{}, configspec.SSH{}),
+		results:   results,
+	}
+	p.run(hosts, time.Now())
+
+	if expected := []string{"new.qa.local", "broken.qa.local"}; !reflect.DeepEqual(compute.created, expected) {
+		t.Fatalf("created %#v", compute.created)
+	}
+	if expected := []string{"drifted.qa.local"}; !reflect.DeepEqual(compute.updated, expected) {
+		t.Fatalf("updated %#v", compute.updated)
+	}
+	if expected := []string{"new.qa.local"}; !reflect.DeepEqual(config.bootstrapped, expected) {
+		t.Fatalf("bootstrapped %#v", config.bootstrapped)
+	}
+	if expected := []string{"new.qa.local"}; !reflect.DeepEqual(config.converged, expected) {
+		t.Fatalf("converged %#v", config.converged)
+	}
+	if !reflect.DeepEqual(config.prepared, hosts) {
+		t.Fatalf("prepared %#v", config.prepared)
+	}
+
+	outcomes := make(map[string]string)
+	for _, host := range results.Hosts {
+		outcomes[host.Name] = host.Outcome
+	}
+	expected := map[string]string{
+		"new.qa.local":     "created",
+		"old.qa.local":     "unchanged",
+		"drifted.qa.local": "updated",
+		"broken.qa.local":  "",
+	}
+	if !reflect.DeepEqual(outcomes, expected) {
+		t.Fatalf("%#v\n\n%#v", outcomes, expected)
+	}
+
+	if !results.HostFailed("broken.qa.local") || results.Detail("broken.qa.local", "converge") != "bootstrap failed" {
+		t.Fatalf("%s", results)
+	}
+}
+
+// fakeSeeder is a fakeCompute that keeps the seeds hosts were created with.
+type fakeSeeder struct {
+	fakeCompute
+	seeds map[string]*cloudinit.Seed
+}
+
+func (f *fakeSeeder) CreateSeeded(host string, seed *cloudinit.Seed) error {
+	f.seeds[host] = seed
+	return f.Create(host)
+}
+
+func (f *fakeConfig) FirstBoot(host string) ([]cloudinit.File, []string, error) {
+	return []cloudinit.File{{Path: "/etc/chef/client.rb", Mode: 0644}}, []string{"chef-client"}, nil
+}
+
+func TestPipelineCloudInit(t *testing.T) {
+	spec := &buildspec.CloudInit{Interface: "eth0", Prefix: 24, ChefBootstrap: true}
+
+	compute := &fakeSeeder{seeds: make(map[string]*cloudinit.Seed)}
+	ipam := &fakeAllocator{}
+	hosts := []string{"new.qa.local"}
+	p := &pipeline{
+		providers: &provider.Set{Compute: compute, IPAM: ipam, Config: &fakeConfig{registered: make(map[string]bool)}},
+		verifier:  verify.New(buildspec.Verify{}, configspec.SSH{}),
+		results:   summary.New(hosts),
+		cloudInit: spec,
+	}
+	p.create(hosts)
+
+	seed := compute.seeds["new.qa.local"]
+	if seed == nil {
+		t.Fatalf("no seed: %s", p.results)
+	}
+	if !strings.Contains(string(seed.NetworkConfig), `"10.0.0.10/24"`) {
+		t.Fatalf("network-config:\n%s", seed.NetworkConfig)
+	}
+	if !reflect.DeepEqual(ipam.allocated, hosts) {
+		t.Fatalf("allocated %#v", ipam.allocated)
+	}
+	if !strings.Contains(string(seed.UserData), `path: "/etc/chef/client.rb"`) || !strings.Contains(string(seed.UserData), `- "chef-client"`) {
+		t.Fatalf("user-data:\n%s", seed.UserData)
+	}
+
+	// IPAM providers that can only say what address a host already has
+	// can't seed a static one
+	p.providers.IPAM = fakeIPAM{}
+	p.providers.Names = map[string]string{"ipam": "foreman"}
+	if err := checkCloudInit(spec, p.providers); err == nil || !strings.Contains(err.Error(), "ipam provider foreman") {
+		t.Fatalf("expected an error about ipam, got %v", err)
+	}
+	p.results = summary.New(hosts)
+	p.create(hosts)
+	if !p.results.HostFailed("new.qa.local") {
+		t.Fatalf("%s", p.results)
+	}
+
+	// Unless the seed leaves the address to DHCP
+	dhcp := &buildspec.CloudInit{Interface: "eth0", DHCP: true}
+	if err := checkCloudInit(dhcp, p.providers); err != nil {
+		t.Fatal(err)
+	}
+
+	// Compute providers that can't take a seed fail the host
+	p.providers.Compute = &fakeCompute{}
+	p.providers.Names = map[string]string{"compute": "foreman"}
+	if err := checkCloudInit(dhcp, p.providers); err == nil || !strings.Contains(err.Error(), "compute provider foreman") {
+		t.Fatalf("expected an error about compute, got %v", err)
+	}
+	p.results = summary.New(hosts)
+	p.create(hosts)
+	if !p.results.HostFailed("new.qa.local") {
+		t.Fatalf("%s", p.results)
+	}
+
+	// Guestinfo seeds are only for rebuild
+	guestinfo := &buildspec.CloudInit{Delivery: buildspec.DeliveryGuestinfo, Interface: "ens192", DHCP: true}
+	if err := checkCloudInit(guestinfo, p.providers); err == nil || !strings.Contains(err.Error(), "overseer rebuild") {
+		t.Fatalf("expected an error about guestinfo, got %v", err)
+	}
+}
+
+func TestPipelineBuildTimeout(t *testing.T) {
+	hosts := []string{"stuck.qa.local"}
+	p := &pipeline{
+		providers:    &provider.Set{Compute: &stuckCompute{}},
+		results:      summary.New(hosts),
+		pollInterval: time.Millisecond,
+		buildTimeout: 10 * time.Millisecond,
+	}
+	p.build(hosts)
+
+	if !p.results.HostFailed("stuck.qa.local") || !strings.Contains(p.results.Detail("stuck.qa.local", "build"), "hadn't built after 10ms") {
+		t.Fatalf("%s", p.results)
+	}
+}
+
+func TestBuildTimeout(t *testing.T) {
+	if timeout := buildTimeout(&buildspec.Spec{}); timeout != defaultBuildTimeout {
+		t.Fatalf("default: %s", timeout)
+	}
+	if timeout := buildTimeout(&buildspec.Spec{BuildTimeout: 5400}); timeout != 90*time.Minute {
+		t.Fatalf("set: %s", timeout)
+	}
+}
+
+// fakeHostWAPI is an Infoblox WAPI that hands out addresses from
+// 10.20.0.0/24 as host records, starting at .10.
+type fakeHostWAPI struct {
+	mu      sync.Mutex
+	records map[string]*infoblox.HostRecord
+}
+
+func (f *fakeHostWAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/wapi/v2.5/")
+	switch {
+	case r.Method == "GET" && path == "record:host":
+		records := []*infoblox.HostRecord{}
+		if record := f.records[r.URL.Query().Get("name")]; record != nil {
+			records = append(records, record)
+		}
+		json.NewEncoder(w).Encode(records)
+	case r.Method == "POST" && path == "record:host":
+		var record infoblox.HostRecord
+		json.NewDecoder(r.Body).Decode(&record)
+		if len(record.IPv4Addrs) != 1 || record.IPv4Addrs[0].IPv4Addr != "func:nextavailableip:10.20.0.0/24" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		record.IPv4Addrs[0].IPv4Addr = fmt.Sprintf("10.20.0.%d", 10+len(f.records))
+		f.records[record.Name] = &record
+		json.NewEncoder(w).Encode("record:host/" + record.Name)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// TestPipelineLibvirtStaticSeed runs the pipeline with the libvirt compute
+// provider and the infoblox IPAM provider, with virsh and genisoimage
+// swapped for scripts, to be sure a host's static address is reserved
+// before it's created and ends up in its seed.
+func TestPipelineLibvirtStaticSeed(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+
+	dir, err := ioutil.TempDir("", "overseer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// virsh keeps the domains it's started and the seed ISO it was given,
+	// and genisoimage just concatenates the seed's files
+	scripts := map[string]string{
+		"virsh": `#!/bin/sh
+shift 2
+case "$1" in
+list) cat "` + dir + `/domains" ;;
+start) echo "$2" >> "` + dir + `/domains" ;;
+vol-upload) cp "$5" "` + dir + `/seed.iso" ;;
+dumpxml) echo "<domain type='kvm' id='1'><name>$2</name><memory unit='KiB'>4194304</memory><vcpu>2</vcpu></domain>" ;;
+esac
+`,
+		"genisoimage": `#!/bin/sh
+while [ "$1" != "-output" ]; do shift; done
+cat user-data meta-data network-config > "$2"
+`,
+	}
+	for name, script := range scripts {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "domains"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	wapi := &fakeHostWAPI{records: make(map[string]*infoblox.HostRecord)}
+	server := httptest.NewServer(wapi)
+	defer server.Close()
+
+	config := &fakeConfig{registered: make(map[string]bool)}
+	provider.RegisterConfig("fake", func(bspec *buildspec.Spec, cspec *configspec.Spec) (provider.ConfigManager, error) {
+		return config, nil
+	})
+
+	bspec := &buildspec.Spec{
+		Compute: "libvirt",
+		IPAM:    "infoblox",
+		DNS:     provider.None,
+		Config:  "fake",
+		Libvirt: buildspec.Libvirt{
+			URI:  "qemu:///system",
+			Pool: "default",
+			Devices: buildspec.LibvirtDevices{
+				Disks: []*buildspec.LibvirtDisk{{DeviceName: "root", DeviceType: "disk", Size: 40, Pool: "default", Image: "centos7-base.qcow2"}},
+			},
+		},
+		Infoblox:  buildspec.Infoblox{Subnet: "10.20.0.0/24"},
+		CloudInit: &buildspec.CloudInit{Delivery: buildspec.DeliveryISO, Interface: "eth0", Prefix: 24, Gateway: "10.20.0.1"},
+	}
+	cspec := &configspec.Spec{Infoblox: configspec.Infoblox{Endpoint: configspec.Endpoint{URL: server.URL}}}
+
+	providers, err := provider.Load(bspec, cspec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkCloudInit(bspec.CloudInit, providers); err != nil {
+		t.Fatal(err)
+	}
+
+	hosts := []string{"web01.lab.local"}
+	p := &pipeline{
+		providers:    providers,
+		verifier:     verify.New(buildspec.Verify{}, configspec.SSH{}),
+		results:      summary.New(hosts),
+		cloudInit:    bspec.CloudInit,
+		pollInterval: time.Millisecond,
+		buildTimeout: time.Second,
+	}
+	p.run(hosts, time.Now())
+
+	if p.results.HostFailed("web01.lab.local") {
+		t.Fatalf("%s", p.results)
+	}
+
+	seed, err := ioutil.ReadFile(filepath.Join(dir, "seed.iso"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(seed), `"10.20.0.10/24"`) {
+		t.Fatalf("seed:\n%s", seed)
+	}
+
+	// The address stays reserved for the host
+	ip, err := providers.IPAM.Address("web01.lab.local")
+	if err != nil || ip != "10.20.0.10" {
+		t.Fatalf("address %q %v", ip, err)
+	}
+}
+
+func TestHostOutcome(t *testing.T) {
+	cases := []struct {
+		Steps    map[string]string
+		Expected string
+	}{
+		{
+			map[string]string{"host": "created", "build": "", "bootstrap": "", "config": "created"},
+			"created",
+		},
+		{
+			map[string]string{"host": `updated hostgroup "base" -> "base/kafka"`, "config": "unchanged"},
+			"updated",
+		},
+		{
+			map[string]string{"host": "unchanged", "dns": "created", "config": "unchanged"},
+			"updated",
+		},
+		{
+			map[string]string{"host": "unchanged", "bootstrap": "", "config": "unchanged"},
+			"updated",
+		},
+		{
+			map[string]string{"host": "unchanged", "config": "updated (5 ok, 2 changed, 0 skipped)", "converge": "converged"},
+			"updated",
+		},
+		{
+			map[string]string{"host": "unchanged", "dns": "unchanged", "bootstrap": "already registered", "config": "unchanged", "converge": "unchanged"},
+			"unchanged",
+		},
+	}
+
+	for _, tt := range cases {
+		results := summary.New([]string{"hello.qa.local"})
+		for step, detail := range tt.Steps {
+			results.OK("hello.qa.local", step, detail)
+		}
+
+		if actual := hostOutcome(results, "hello.qa.local"); actual != tt.Expected {
+			t.Fatalf("%#v\n\n%s != %s", tt.Steps, actual, tt.Expected)
+		}
+	}
+}
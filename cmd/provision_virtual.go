@@ -9,10 +9,11 @@ import (
 
 	"github.com/iamthemuffinman/overseer/configspec"
 	"github.com/iamthemuffinman/overseer/pkg/buildspec"
-	"github.com/iamthemuffinman/overseer/pkg/chef"
-	"github.com/iamthemuffinman/overseer/pkg/hammer"
 	"github.com/iamthemuffinman/overseer/pkg/hostspec"
-	"github.com/iamthemuffinman/overseer/pkg/workerpool"
+	"github.com/iamthemuffinman/overseer/pkg/provider"
+	"github.com/iamthemuffinman/overseer/pkg/runstate"
+	"github.com/iamthemuffinman/overseer/pkg/secret"
+	"github.com/iamthemuffinman/overseer/pkg/verify"
 
 	"github.com/iamthemuffinman/cli"
 	log "github.com/iamthemuffinman/logsip"
@@ -20,6 +21,9 @@ import (
 	flag "github.com/ogier/pflag"
 )
 
+// buildspecDir is where buildspecs are looked up by name.
+const buildspecDir = "/etc/overseer/buildspecs"
+
 type ProvisionVirtualCommand struct {
 	UI         cli.Ui
 	FlagSet    *flag.FlagSet
@@ -37,25 +41,25 @@ func (c *ProvisionVirtualCommand) Run(args []string) int {
 		}
 	}
 
-	// Okay, we're ready to start doing some work at this point.
-	// Let's create the pool of workers so they can start listening
-	// for jobs that are put into the JobQueue.
-	dispatcher := workerpool.NewDispatcher()
-	dispatcher.Run()
-
+	failed := false
 	doneCh := make(chan struct{})
 	go func() {
 		defer close(doneCh)
 		c.FlagSet = flag.NewFlagSet("virtual", flag.ExitOnError)
 
 		specfile := c.FlagSet.StringP("buildspec", "h", "", "Provide a buildspec for your host(s) (i.e. indy.prod.kafka)")
+		profile := c.FlagSet.String("profile", os.Getenv(configspec.ProfileEnvVar), "Select a profile from your configspec (i.e. indy-prod)")
+		resume := c.FlagSet.String("resume", "", "Pick up an earlier run where it left off")
+		jsonOutput := c.FlagSet.Bool("json", false, "Print the summary as JSON")
 
 		// Parse everything after 3 arguments (i.e overseer provision virtual STARTHERE)
 		c.FlagSet.Parse(os.Args[3:])
 
-		// GTFO if a buildspec wasn't specified
-		if *specfile == "" {
-			log.Fatal("You must specify a buildspec")
+		// If there are arguments, then the user has specified a host on the
+		// command line rather than using a hostspec
+		if len(c.FlagSet.Args()) > 0 {
+			log.Errorf("Please use a hostspec instead of specifying hosts on the command line")
+			os.Exit(1)
 		}
 
 		home, err := getHomeDir()
@@ -63,52 +67,100 @@ func (c *ProvisionVirtualCommand) Run(args []string) int {
 			log.Fatalf("unable to retrieve users home directory: %s", err)
 		}
 
-		bspec, hspec, cspec := loadSpecs(home, *specfile)
+		// Every run saves how far each host got, so one that dies halfway
+		// can be resumed without creating hosts all over again. A resumed
+		// run builds the same hosts from the same buildspec as before.
+		var run *runstate.Run
+		if *resume != "" {
+			run, err = runstate.Load(home, *resume)
+			if err != nil {
+				log.Fatalf("unable to resume run: %s", err)
+			}
 
-		// temporary
-		hammerCmd := hammer.New(bspec, cspec)
+			if *specfile != "" && *specfile != run.Buildspec {
+				log.Fatalf("run %s was started with buildspec %q, not %q", run.ID, run.Buildspec, *specfile)
+			}
+			if *profile != "" && *profile != run.Profile {
+				log.Fatalf("run %s was started with profile %q, not %q", run.ID, run.Profile, *profile)
+			}
+			*specfile, *profile = run.Buildspec, run.Profile
+		}
 
-		// If there are arguments, then the user has specified a host on the
-		// command line rather than using a hostspec
-		if len(c.FlagSet.Args()) > 0 {
-			log.Errorf("Please use a hostspec instead of specifying hosts on the command line")
-			os.Exit(1)
+		// GTFO if a buildspec wasn't specified
+		if *specfile == "" {
+			log.Fatal("You must specify a buildspec")
 		}
 
-		// Range over all the hosts in the hostspec
-		for _, host := range hspec.Hosts {
-			hammerCmd.Hostname = host
-			// Execute is a method that will send the command to a job queue
-			// to be processed by a goroutine. This way we can build more
-			// hosts at the same time by executing hammer in parallel.
-			if err := hammerCmd.Execute(); err != nil {
-				log.Fatalf("error executing hammer: %s", err)
+		bspec, cspec := loadSpecs(c.UI, home, *specfile, *profile)
+
+		if run == nil {
+			// Parse the hostspec in the current directory to get a list of hosts
+			hspec, err := hostspec.ParseFile("./hostspec")
+			if err != nil {
+				log.Fatalf("couldn't find your hostspec: %s", err)
 			}
 
-			for {
-				// GetBuildStatus will return 0 if Foreman says the host has been
-				// build successfully. We'll wait until all hosts have been built
-				// successfully and then we'll execute hammer.
-				status, err := hammerCmd.GetBuildStatus()
-				if err != nil {
-					log.Fatalf("error executing hammer: %s", err)
+			run, err = runstate.New(home, *specfile, *profile, hspec.Hosts)
+			if err != nil {
+				log.Fatalf("unable to save run state: %s", err)
+			}
+			if hspec.Vars != nil {
+				run.Vars = hspec.Vars
+				if err := run.Save(); err != nil {
+					log.Fatalf("unable to save run state: %s", err)
 				}
+			}
+			log.Infof("Starting run %s. If it's interrupted, pick it back up with --resume %s", run.ID, run.ID)
+		} else {
+			log.Infof("Resuming run %s", run.ID)
+		}
+		hosts := run.Hosts()
 
-				if status == 0 {
-					log.Infof("%s built successfully!", host)
-					break
-				} else {
-					time.Sleep(30 * time.Second)
-				}
+		providers, err := provider.Load(bspec, cspec)
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		if err := checkCloudInit(bspec.CloudInit, providers); err != nil {
+			log.Fatalf("%s", err)
+		}
+
+		// Keep track of how each step went for each host so we can tell the
+		// user at the end rather than bailing out on the first failure.
+		// Steps are saved to the run as soon as they're recorded, and ones
+		// that already succeeded in an earlier attempt aren't done again.
+		results := run.Summary
+		results.OnRecord = func() {
+			if err := run.Save(); err != nil {
+				log.Errorf("unable to save run state: %s", err)
 			}
 		}
 
-		for _, host := range hspec.Hosts {
-			// Add all recipes/cookbooks/roles to the run list
-			// of each node
-			if err := chef.UpdateNode(host, cspec.Chef.ClientKey, cspec.Chef.ChefServer, bspec.Chef.RunList); err != nil {
-				log.Warnf("unable to update chef node: %s", err)
+		p := &pipeline{
+			providers:    providers,
+			verifier:     verify.New(bspec.Verify, cspec.SSH),
+			checks:       bspec.Verify.Checks,
+			results:      results,
+			cloudInit:    bspec.CloudInit,
+			hostVars:     run.Vars,
+			pollInterval: 30 * time.Second,
+			buildTimeout: buildTimeout(bspec),
+		}
+		p.run(hosts, run.Started)
+
+		if *jsonOutput {
+			out, err := results.JSON()
+			if err != nil {
+				log.Fatalf("unable to render summary: %s", err)
 			}
+			c.UI.Output(string(out))
+		} else {
+			c.UI.Output(results.String())
+		}
+
+		if results.Failed() {
+			failed = true
+			log.Errorf("Some hosts failed to provision. Once you've fixed what went wrong, pick up where this run left off with --resume %s", run.ID)
+			return
 		}
 
 		log.Info("All hosts successfully created and chef'd!")
@@ -131,6 +183,9 @@ func (c *ProvisionVirtualCommand) Run(args []string) int {
 	case <-doneCh:
 	}
 
+	if failed {
+		return 1
+	}
 	return 0
 }
 
@@ -153,27 +208,61 @@ func getHomeDir() (string, error) {
 
 // No need to return an error here. We can keep it local because if there are any issues
 // whatsoever with any of these we need to bail out ASAP.
-func loadSpecs(home, specfile string) (*buildspec.Spec, *hostspec.Spec, *configspec.Spec) {
-	// Parse overseer's configspec file which contains usernames and passwords
-	cspec, err := configspec.ParseFile(fmt.Sprintf("%s/.overseer/overseer.conf", home))
+func loadSpecs(ui cli.Ui, home, specfile, profile string) (*buildspec.Spec, *configspec.Spec) {
+	cspec, err := loadConfigspec(ui, home, profile)
 	if err != nil {
-		log.Fatalf("unable to parse overseer configspec: %s", err)
+		log.Fatal(err)
 	}
 
 	// Here is where we essentially parse the entire buildspecs directory to find
 	// the buildspec specified on the command line.
-	bspec, err := buildspec.ParseDir("/etc/overseer/buildspecs", specfile)
+	bspec, err := buildspec.ParseDir(buildspecDir, specfile)
 	if err != nil {
 		log.Fatalf("unable to parse buildspec: %s", err)
 	}
 
-	// Parse the hostspec in the current directory to get a list of hosts
-	hspec, err := hostspec.ParseFile("./hostspec")
+	// Don't let a buildspec run against the wrong site
+	if err := bspec.CheckProfile(profile); err != nil {
+		log.Fatal(err)
+	}
+
+	return bspec, cspec
+}
+
+// loadConfigspec parses overseer's configspec, narrows it down to the
+// profile and fills in its credentials.
+func loadConfigspec(ui cli.Ui, home, profile string) (*configspec.Spec, error) {
+	// Parse overseer's configspec file which contains usernames and passwords
+	config, err := configspec.ParseFile(fmt.Sprintf("%s/.overseer/overseer.conf", home))
 	if err != nil {
-		log.Fatalf("couldn't find your hostspec: %s", err)
+		return nil, fmt.Errorf("unable to parse overseer configspec: %s", err)
 	}
 
-	return bspec, hspec, cspec
+	// Narrow the configspec down to the selected profile (or the top-level
+	// blocks if there isn't one)
+	cspec, err := config.Profile(profile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load profile: %s", err)
+	}
+
+	// Fill in any passwords left out of the configspec from the encrypted
+	// credential store
+	if err := fillCredentials(ui, home, profile, cspec); err != nil {
+		return nil, fmt.Errorf("unable to read credential store: %s", err)
+	}
+
+	// Swap any secret references (env://, file://, exec://, secret://) for
+	// the real thing
+	resolver, err := secret.NewResolver(cspec)
+	if err != nil {
+		return nil, fmt.Errorf("unable to set up secret providers: %s", err)
+	}
+
+	if err := cspec.ResolveSecrets(resolver); err != nil {
+		return nil, fmt.Errorf("unable to resolve secrets: %s", err)
+	}
+
+	return cspec, nil
 }
 
 func (c *ProvisionVirtualCommand) Help() string {
@@ -187,6 +276,20 @@ func (c *ProvisionVirtualCommand) Synopsis() string {
 func (c *ProvisionVirtualCommand) helpProvisionVirtual() string {
 	helpText := `
 Usage: overseer provision virtual [OPTIONS] [HOSTS]
+
+  Make the hosts in ./hostspec look like the buildspec says. Hosts that
+  don't exist yet are created, built, bootstrapped and converged; hosts
+  that do are only changed where they differ from the buildspec. Each
+  host is reported as created, updated or unchanged.
+
+Options:
+
+  --buildspec, -h    The buildspec to build the hosts from.
+  --profile          The configspec profile to use. Defaults to $OVERSEER_PROFILE.
+  --resume           Pick up an earlier run where it left off, given the run
+                     ID it printed when it started. Steps that succeeded
+                     aren't done again.
+  --json             Print the per-host summary as JSON.
 `
 	return strings.TrimSpace(helpText)
 }
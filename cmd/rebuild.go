@@ -0,0 +1,388 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/iamthemuffinman/cli"
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/foreman"
+	"github.com/iamthemuffinman/overseer/pkg/hostspec"
+	"github.com/iamthemuffinman/overseer/pkg/provider"
+	"github.com/iamthemuffinman/overseer/pkg/summary"
+	"github.com/iamthemuffinman/overseer/pkg/verify"
+	"github.com/iamthemuffinman/overseer/pkg/vsphere"
+	flag "github.com/ogier/pflag"
+)
+
+// rebuildPollInterval is how often Foreman is asked whether a host has
+// finished building.
+var rebuildPollInterval = 30 * time.Second
+
+type RebuildCommand struct {
+	UI      cli.Ui
+	FlagSet *flag.FlagSet
+}
+
+func (c *RebuildCommand) Run(args []string) int {
+	c.FlagSet = flag.NewFlagSet("rebuild", flag.ContinueOnError)
+	c.FlagSet.Usage = func() { c.UI.Output(c.Help()) }
+
+	specfile := c.FlagSet.String("buildspec", "", "The buildspec to reapply once the hosts are rebuilt")
+	hostspecPath := c.FlagSet.StringP("hostspec", "f", "", "Rebuild the hosts in a hostspec")
+	template := c.FlagSet.String("template", "", "Reclone image-based hosts from this template instead of their Foreman image")
+	autoApprove := c.FlagSet.Bool("auto-approve", false, "Don't ask before rebuilding")
+	jsonOutput := c.FlagSet.Bool("json", false, "Print the summary as JSON")
+	profile := c.FlagSet.String("profile", os.Getenv(configspec.ProfileEnvVar), "Select a profile from your configspec")
+
+	if err := c.FlagSet.Parse(args); err != nil {
+		return 1
+	}
+
+	if *specfile == "" {
+		c.UI.Error("You must specify a buildspec")
+		return cli.RunResultHelp
+	}
+
+	hosts := c.FlagSet.Args()
+	var hostVars map[string]map[string]string
+	if *hostspecPath != "" {
+		if len(hosts) > 0 {
+			c.UI.Error("Give either hosts or --hostspec, not both")
+			return 1
+		}
+
+		hspec, err := hostspec.ParseFile(*hostspecPath)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("unable to parse hostspec: %s", err))
+			return 1
+		}
+		hosts, hostVars = hspec.Hosts, hspec.Vars
+	}
+	if len(hosts) == 0 {
+		c.UI.Error("No hosts to rebuild")
+		return cli.RunResultHelp
+	}
+
+	home, err := getHomeDir()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("unable to retrieve users home directory: %s", err))
+		return 1
+	}
+
+	cspec, err := loadConfigspec(c.UI, home, *profile)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	bspec, err := buildspec.ParseDir(buildspecDir, *specfile)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("unable to parse buildspec: %s", err))
+		return 1
+	}
+
+	if err := bspec.CheckProfile(*profile); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	foremanClient, err := foreman.New(cspec.Foreman)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("unable to create foreman client: %s", err))
+		return 1
+	}
+
+	providers, err := provider.Load(bspec, cspec)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	config := providers.Config
+
+	var govc *vsphere.Govc
+	if cspec.Vsphere.Endpoint.URL != "" {
+		govc = vsphere.New(cspec.Vsphere, bspec.Vsphere.Datacenter)
+	}
+
+	if !*autoApprove {
+		answer, err := c.UI.Ask(fmt.Sprintf("Wipe and reinstall %s? Only 'yes' will be accepted:", strings.Join(hosts, ", ")))
+		if err != nil {
+			c.UI.Error(err.Error())
+			return 1
+		}
+		if answer != "yes" {
+			c.UI.Output("Nothing rebuilt.")
+			return 1
+		}
+	}
+
+	results := summary.New(hosts)
+	started := time.Now()
+
+	// Start every host rebuilding before waiting on any of them. Their
+	// DNS records and IPAM reservations are left as they are: the hosts
+	// keep their names, addresses and MACs.
+	building := make(map[string]bool)
+	for _, host := range hosts {
+		h, err := foremanClient.Host(host)
+		if err == nil && h == nil {
+			err = fmt.Errorf("foreman doesn't have %s", host)
+		}
+		if err != nil {
+			results.Fail(host, "rebuild", err)
+			continue
+		}
+
+		// The reinstalled host is bootstrapped afresh, so the config
+		// manager has to forget the old one
+		if err := config.Remove(host); err != nil {
+			results.Fail(host, "config cleanup", err)
+			continue
+		}
+		results.OK(host, "config cleanup", "")
+
+		guestinfo, err := rebuildSeed(providers, bspec.CloudInit, h)
+		if err != nil {
+			results.Fail(host, "rebuild", err)
+			continue
+		}
+
+		c.UI.Info(fmt.Sprintf("Rebuilding %s", host))
+		detail, err := rebuildHost(foremanClient, govc, h, *template, bspec.Vsphere, guestinfo)
+		if err != nil {
+			results.Fail(host, "rebuild", err)
+			continue
+		}
+		results.OK(host, "rebuild", detail)
+
+		building[host] = h.ProvisionMethod != foreman.ProvisionImage
+	}
+
+	// The hosts were all started rebuilding first, so they share the
+	// one deadline
+	timeout := buildTimeout(bspec)
+	deadline := time.Now().Add(timeout)
+	for _, host := range hosts {
+		if results.HostFailed(host) {
+			results.Skip(host, "build", "host not rebuilt")
+			continue
+		}
+		if !building[host] {
+			results.OK(host, "build", "cloned from template")
+			continue
+		}
+
+		c.UI.Info(fmt.Sprintf("Waiting for %s to build", host))
+		if err := waitForBuild(foremanClient, host, deadline, timeout); err != nil {
+			results.Fail(host, "build", err)
+			continue
+		}
+		results.OK(host, "build", "")
+	}
+
+	verifier := verify.New(bspec.Verify, cspec.SSH)
+
+	if preparer, ok := config.(provider.Preparer); ok {
+		var rebuilt []string
+		for _, host := range hosts {
+			if !results.HostFailed(host) {
+				rebuilt = append(rebuilt, host)
+			}
+		}
+		preparer.Prepare(rebuilt, hostVars)
+	}
+
+	for _, host := range hosts {
+		if results.HostFailed(host) {
+			continue
+		}
+
+		if config.Bootstraps() {
+			c.UI.Info(fmt.Sprintf("Bootstrapping %s", host))
+			if err := config.Bootstrap(host); err != nil {
+				results.Fail(host, "bootstrap", err)
+				continue
+			}
+			results.OK(host, "bootstrap", "")
+		}
+
+		change, err := config.Apply(host)
+		if err != nil {
+			results.Fail(host, "config", err)
+			continue
+		}
+		results.OK(host, "config", change)
+
+		c.UI.Info(fmt.Sprintf("Waiting for %s to converge", host))
+		if err := config.WaitForConverge(host, started); err != nil {
+			results.Fail(host, "converge", err)
+			continue
+		}
+		results.OK(host, "converge", "")
+
+		for _, result := range verifier.Verify(host) {
+			step := "verify: " + result.Check.Name
+			if !result.OK() {
+				results.Fail(host, step, result.Err)
+				continue
+			}
+			results.OK(host, step, result.Detail)
+		}
+	}
+
+	for _, host := range hosts {
+		if !results.HostFailed(host) {
+			results.SetOutcome(host, "rebuilt")
+		}
+	}
+
+	if *jsonOutput {
+		out, err := results.JSON()
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("unable to render summary: %s", err))
+			return 1
+		}
+		c.UI.Output(string(out))
+	} else {
+		c.UI.Output(results.String())
+	}
+
+	if results.Failed() {
+		return 1
+	}
+	return 0
+}
+
+// rebuildHost starts reinstalling a host in place. Hosts Foreman installs
+// over the network are put in build mode and power cycled into PXE, bare
+// metal through its BMC. Hosts cloned from a template are recloned in
+// vSphere, with guestinfo set on the clone. It returns what it did.
+func rebuildHost(foremanClient *foreman.Client, govc *vsphere.Govc, h *foreman.Host, template string, spec buildspec.Vsphere, guestinfo map[string]string) (string, error) {
+	if h.ProvisionMethod == foreman.ProvisionImage {
+		if govc == nil {
+			return "", fmt.Errorf("%s was cloned from an image, and recloning it needs a vsphere block in your configspec", h.Name)
+		}
+
+		if template == "" {
+			template = h.ImageFile
+		}
+		if template == "" {
+			return "", fmt.Errorf("foreman doesn't say which template %s was cloned from, give one with --template", h.Name)
+		}
+
+		vm, err := govc.VM(h.Name)
+		if err != nil {
+			return "", err
+		}
+		if vm == nil {
+			return "", fmt.Errorf("no VM named %s", h.Name)
+		}
+
+		if err := govc.Reclone(vm, template, spec, guestinfo); err != nil {
+			return "", err
+		}
+		return "recloned from " + template, nil
+	}
+
+	if err := foremanClient.SetBuild(h.ID); err != nil {
+		return "", fmt.Errorf("unable to put %s in build mode: %s", h.Name, err)
+	}
+
+	if h.Bare() {
+		if err := foremanClient.Boot(h.ID, "pxe"); err != nil {
+			return "", fmt.Errorf("unable to set %s to boot from the network: %s", h.Name, err)
+		}
+	}
+
+	if err := foremanClient.Power(h.ID, "cycle"); err != nil {
+		return "", fmt.Errorf("unable to power cycle %s: %s", h.Name, err)
+	}
+
+	return "reinstalling over PXE", nil
+}
+
+// rebuildSeed returns the guestinfo properties that seed cloud-init on the
+// recloned host, or nil if the buildspec doesn't have a cloud_init block.
+// The host keeps the address Foreman has for it.
+func rebuildSeed(providers *provider.Set, spec *buildspec.CloudInit, h *foreman.Host) (map[string]string, error) {
+	if spec == nil {
+		return nil, nil
+	}
+	if h.ProvisionMethod != foreman.ProvisionImage {
+		return nil, fmt.Errorf("the buildspec seeds cloud-init, but %s is installed over PXE rather than cloned from an image", h.Name)
+	}
+	if spec.Delivery != buildspec.DeliveryGuestinfo {
+		return nil, fmt.Errorf("recloned hosts can only get their cloud-init seed from guestinfo, not by %s", spec.Delivery)
+	}
+
+	seed, err := providers.Seed(h.Name, h.IP, spec)
+	if err != nil {
+		return nil, err
+	}
+	return seed.GuestInfo(), nil
+}
+
+// waitForBuild waits for Foreman to take the host out of build mode, which
+// it does once the installer reports back, giving up at deadline. timeout
+// is only for the error.
+func waitForBuild(foremanClient *foreman.Client, host string, deadline time.Time, timeout time.Duration) error {
+	for {
+		h, err := foremanClient.Host(host)
+		if err != nil {
+			return err
+		}
+		if h == nil {
+			return fmt.Errorf("%s disappeared from foreman while building", host)
+		}
+		if !h.Build {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s hadn't built after %s", host, timeout)
+		}
+
+		time.Sleep(rebuildPollInterval)
+	}
+}
+
+func (c *RebuildCommand) Help() string {
+	return c.helpRebuild()
+}
+
+func (c *RebuildCommand) Synopsis() string {
+	return "Reinstall existing hosts in place"
+}
+
+func (c *RebuildCommand) helpRebuild() string {
+	helpText := `
+Usage: overseer rebuild [OPTIONS] [HOSTS]
+
+  Wipe and reinstall hosts in place, keeping their names, addresses and MAC
+  addresses, then bootstrap them, reapply the buildspec's Chef settings
+  and wait for them to converge and pass their verify checks.
+
+  Hosts Foreman installs over the network are put back in build mode and
+  power cycled into PXE (through their BMC for bare metal). Hosts cloned
+  from a template are destroyed and cloned again in vSphere, with the
+  buildspec's cloud-init seed in their guestinfo if it has one. Their old
+  Chef node and client are deleted first. DNS records and IPAM
+  reservations aren't touched.
+
+  The hosts come from the command line or a hostspec.
+
+Options:
+
+  --buildspec        The buildspec to reapply once the hosts are rebuilt.
+  --hostspec, -f     Rebuild the hosts in a hostspec.
+  --template         Reclone image-based hosts from this template rather
+                     than the image Foreman has for them.
+  --auto-approve     Don't ask before rebuilding.
+  --json             Print the summary as JSON.
+  --profile          The configspec profile to use. Defaults to $OVERSEER_PROFILE.
+`
+	return strings.TrimSpace(helpText)
+}
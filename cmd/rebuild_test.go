@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/foreman"
+	"github.com/iamthemuffinman/overseer/pkg/provider"
+)
+
+func TestRebuildHost(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		json.NewEncoder(w).Encode(map[string]interface{}{})
+	}))
+	defer server.Close()
+
+	client, err := foreman.New(configspec.Foreman{Endpoint: configspec.Endpoint{URL: server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Host     *foreman.Host
+		Expected []string
+		Err      bool
+	}{
+		{
+			&foreman.Host{ID: 42, Name: "hello.qa.local", ProvisionMethod: foreman.ProvisionBuild, ComputeResourceName: "vcenter"},
+			[]string{"PUT /api/v2/hosts/42", "PUT /api/v2/hosts/42/power"},
+			false,
+		},
+		{
+			// Bare metal is told to boot from the network through its BMC
+			&foreman.Host{ID: 7, Name: "metal.qa.local", ProvisionMethod: foreman.ProvisionBuild},
+			[]string{"PUT /api/v2/hosts/7", "PUT /api/v2/hosts/7/boot", "PUT /api/v2/hosts/7/power"},
+			false,
+		},
+		{
+			// Recloning needs vSphere
+			&foreman.Host{ID: 9, Name: "image.qa.local", ProvisionMethod: foreman.ProvisionImage, ImageFile: "templates/centos-7"},
+			nil,
+			true,
+		},
+	}
+
+	for _, tt := range cases {
+		requests = nil
+
+		_, err := rebuildHost(client, nil, tt.Host, "", buildspec.Vsphere{}, nil)
+		if (err != nil) != tt.Err {
+			t.Fatalf("%s: %v", tt.Host.Name, err)
+		}
+		if !reflect.DeepEqual(requests, tt.Expected) {
+			t.Fatalf("%s\n\n%#v\n\n%#v", tt.Host.Name, requests, tt.Expected)
+		}
+	}
+}
+
+func TestRebuildSeed(t *testing.T) {
+	providers := &provider.Set{Config: &fakeConfig{}, Names: map[string]string{"config": "chef"}}
+	image := &foreman.Host{Name: "image.qa.local", IP: "10.0.0.20", ProvisionMethod: foreman.ProvisionImage}
+	pxe := &foreman.Host{Name: "pxe.qa.local", ProvisionMethod: foreman.ProvisionBuild}
+
+	guestinfo, err := rebuildSeed(providers, nil, image)
+	if err != nil || guestinfo != nil {
+		t.Fatalf("expected no guestinfo without cloud_init: %v %v", guestinfo, err)
+	}
+
+	spec := &buildspec.CloudInit{Delivery: buildspec.DeliveryGuestinfo, Interface: "ens192", Prefix: 24, ChefBootstrap: true}
+	guestinfo, err = rebuildSeed(providers, spec, image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := base64.StdEncoding.DecodeString(guestinfo["guestinfo.metadata"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(metadata), `local-hostname: "image.qa.local"`) || guestinfo["guestinfo.userdata.encoding"] != "base64" {
+		t.Fatalf("bad: %#v\n%s", guestinfo, metadata)
+	}
+
+	if _, err := rebuildSeed(providers, spec, pxe); err == nil {
+		t.Fatal("expected an error for a PXE host")
+	}
+
+	spec.Delivery = buildspec.DeliveryISO
+	if _, err := rebuildSeed(providers, spec, image); err == nil {
+		t.Fatal("expected an error for ISO delivery")
+	}
+}
+
+func TestWaitForBuild(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(foreman.Host{ID: 42, Name: "stuck.qa.local", Build: true})
+	}))
+	defer server.Close()
+
+	client, err := foreman.New(configspec.Foreman{Endpoint: configspec.Endpoint{URL: server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(interval time.Duration) { rebuildPollInterval = interval }(rebuildPollInterval)
+	rebuildPollInterval = time.Millisecond
+
+	err = waitForBuild(client, "stuck.qa.local", time.Now().Add(10*time.Millisecond), 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "hadn't built after 10ms") {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+}
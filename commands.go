@@ -20,7 +20,9 @@ func init() {
 	}
 
 	PlumbingCommands = map[string]struct{}{
-		"provision": {}, // includes all subcommands
+		"provision":   {}, // includes all subcommands
+		"credentials": {}, // includes all subcommands
+		"export":      {}, // includes all subcommands
 	}
 
 	Commands = map[string]cli.CommandFactory{
@@ -30,6 +32,72 @@ func init() {
 			}, nil
 		},
 
+		"apply": func() (cli.Command, error) {
+			return &cmd.ApplyCommand{
+				UI: UI,
+			}, nil
+		},
+
+		"credentials": func() (cli.Command, error) {
+			return &cmd.CredentialsCommand{
+				UI: UI,
+			}, nil
+		},
+
+		"credentials set": func() (cli.Command, error) {
+			return &cmd.CredentialsSetCommand{
+				UI: UI,
+			}, nil
+		},
+
+		"credentials get": func() (cli.Command, error) {
+			return &cmd.CredentialsGetCommand{
+				UI: UI,
+			}, nil
+		},
+
+		"credentials list": func() (cli.Command, error) {
+			return &cmd.CredentialsListCommand{
+				UI: UI,
+			}, nil
+		},
+
+		"credentials rm": func() (cli.Command, error) {
+			return &cmd.CredentialsRmCommand{
+				UI: UI,
+			}, nil
+		},
+
+		"diff": func() (cli.Command, error) {
+			return &cmd.DiffCommand{
+				UI: UI,
+			}, nil
+		},
+
+		"exec": func() (cli.Command, error) {
+			return &cmd.ExecCommand{
+				UI: UI,
+			}, nil
+		},
+
+		"export": func() (cli.Command, error) {
+			return &cmd.ExportCommand{
+				UI: UI,
+			}, nil
+		},
+
+		"export terraform": func() (cli.Command, error) {
+			return &cmd.ExportTerraformCommand{
+				UI: UI,
+			}, nil
+		},
+
+		"rebuild": func() (cli.Command, error) {
+			return &cmd.RebuildCommand{
+				UI: UI,
+			}, nil
+		},
+
 		"version": func() (cli.Command, error) {
 			return &cmd.VersionCommand{
 				UI:       UI,
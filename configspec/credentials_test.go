@@ -0,0 +1,76 @@
+package configspec
+
+import (
+	"reflect"
+	"testing"
+)
+
+type fakeStore map[string][2]string
+
+func (s fakeStore) Credential(name string) (string, string, bool) {
+	c, ok := s[name]
+	return c[0], c[1], ok
+}
+
+func TestFillCredentials(t *testing.T) {
+	store := fakeStore{
+		"foreman":           {"admin", "datpass"},
+		"indy-prod/foreman": {"admin", "prodpass"},
+		"chef":              {"admin", "hunter2"},
+		"vsphere":           {"someoneelse", "hunter2"},
+		"infoblox":          {"admin", "ibpass"},
+	}
+
+	cases := []struct {
+		Profile  string
+		Spec     *Spec
+		Expected *Spec
+	}{
+		{
+			"",
+			&Spec{
+				Foreman:  Foreman{Username: "admin"},
+				Chef:     Chef{Username: "admin"},
+				Vsphere:  Vsphere{Username: "admin"},
+				Infoblox: Infoblox{Endpoint: Endpoint{URL: "https://infoblox.qa.local"}},
+			},
+			&Spec{
+				Foreman:  Foreman{Username: "admin", Password: "datpass"},
+				Chef:     Chef{Username: "admin"},
+				Vsphere:  Vsphere{Username: "admin"},
+				Infoblox: Infoblox{Username: "admin", Password: "ibpass", Endpoint: Endpoint{URL: "https://infoblox.qa.local"}},
+			},
+		},
+		{
+			"indy-prod",
+			&Spec{
+				Foreman: Foreman{Username: "admin"},
+				Vsphere: Vsphere{Username: "admin", Password: "vspass"},
+			},
+			&Spec{
+				Foreman: Foreman{Username: "admin", Password: "prodpass"},
+				Vsphere: Vsphere{Username: "admin", Password: "vspass"},
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		tt.Spec.FillCredentials(store, tt.Profile)
+		if !reflect.DeepEqual(tt.Spec, tt.Expected) {
+			t.Fatalf("profile: %q\n\n%#v\n\n%#v", tt.Profile, tt.Spec, tt.Expected)
+		}
+	}
+}
+
+func TestMissingPasswords(t *testing.T) {
+	spec := &Spec{
+		Foreman: Foreman{Username: "admin"},
+		Chef:    Chef{Username: "admin", ClientKey: "~/.chef/admin.pem"},
+		Vsphere: Vsphere{Endpoint: Endpoint{URL: "https://vcenter.qa.local/sdk"}},
+	}
+
+	expected := []string{"foreman", "vsphere"}
+	if actual := spec.MissingPasswords(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("%#v\n\n%#v", actual, expected)
+	}
+}
@@ -0,0 +1,86 @@
+package configspec
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// Endpoint holds the connection settings shared by every backend block.
+// It's squashed into each block so the keys sit right next to the
+// username and password rather than in a nested block of their own.
+type Endpoint struct {
+	URL                string `mapstructure:"url"`
+	APIVersion         string `mapstructure:"api_version"`
+	CAFile             string `mapstructure:"ca_file"`
+	CertFile           string `mapstructure:"cert_file"`
+	KeyFile            string `mapstructure:"key_file"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+	// Timeout is the number of seconds to wait on a request before giving
+	// up. Zero means no timeout.
+	Timeout int    `mapstructure:"timeout"`
+	Proxy   string `mapstructure:"proxy"`
+}
+
+// endpointKeys are the HCL keys that decode into an Endpoint.
+var endpointKeys = []string{
+	"url",
+	"api_version",
+	"ca_file",
+	"cert_file",
+	"key_file",
+	"insecure_skip_verify",
+	"timeout",
+	"proxy",
+}
+
+// validate makes sure the endpoint settings make sense before any client
+// tries to use them. An empty endpoint is valid since not every backend
+// is needed for every run.
+func (e *Endpoint) validate() error {
+	var result error
+
+	if e.URL != "" {
+		if err := checkURL(e.URL); err != nil {
+			result = multierror.Append(result, fmt.Errorf("url: %s", err))
+		}
+	}
+
+	if e.Proxy != "" {
+		if err := checkURL(e.Proxy); err != nil {
+			result = multierror.Append(result, fmt.Errorf("proxy: %s", err))
+		}
+	}
+
+	if (e.CertFile == "") != (e.KeyFile == "") {
+		result = multierror.Append(result, fmt.Errorf("cert_file and key_file must be set together"))
+	}
+
+	if e.InsecureSkipVerify && e.CAFile != "" {
+		result = multierror.Append(result, fmt.Errorf("ca_file has no effect when insecure_skip_verify is set"))
+	}
+
+	if e.Timeout < 0 {
+		result = multierror.Append(result, fmt.Errorf("timeout must not be negative, got %d", e.Timeout))
+	}
+
+	return result
+}
+
+func checkURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%q must use http or https", raw)
+	}
+
+	if u.Host == "" {
+		return fmt.Errorf("%q is missing a host", raw)
+	}
+
+	return nil
+}
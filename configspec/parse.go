@@ -18,31 +18,105 @@ type Spec struct {
 	Chef     Chef     `mapstructure:"chef"`
 	Vsphere  Vsphere  `mapstructure:"vsphere"`
 	Infoblox Infoblox `mapstructure:"infoblox"`
+	Puppet   Puppet   `mapstructure:"puppet"`
+	Vault    Vault    `mapstructure:"vault"`
+	SSH      SSH      `mapstructure:"ssh"`
+
+	// Plugins holds the "plugin" blocks, by plugin name. They're only
+	// allowed at the top level and apply whatever the profile.
+	Plugins map[string]*Plugin `mapstructure:"plugin"`
+
+	// Profiles holds the named "profile" blocks, one per site. A profile
+	// has the same backend blocks as the top level but no profiles of its
+	// own.
+	Profiles map[string]*Spec `mapstructure:"profile"`
+}
+
+// Plugin is a plugin's block. Its settings are the only part of the
+// configspec the plugin is sent.
+type Plugin struct {
+	// ReplaceBuiltin lets the plugin take the place of the in-tree
+	// provider with the same name. Without it, such a plugin isn't used.
+	ReplaceBuiltin bool
+	// Settings is everything else in the block, for the plugin to make
+	// of what it likes.
+	Settings map[string]interface{}
 }
 
 type Foreman struct {
-	Username string `mapstructure:"username"`
-	Password string `mapstructure:"password"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	Endpoint Endpoint `mapstructure:",squash"`
 }
 
 type Chef struct {
-	Username      string `mapstructure:"username"`
-	Password      string `mapstructure:"password"`
-	ChefServer    string `mapstructure:"chef_server"`
-	ClientKey     string `mapstructure:"client_key"`
-	ValidationKey string `mapstructure:"validation_key"`
+	Username      string   `mapstructure:"username"`
+	Password      string   `mapstructure:"password"`
+	ChefServer    string   `mapstructure:"chef_server"`
+	ClientKey     string   `mapstructure:"client_key"`
+	ValidationKey string   `mapstructure:"validation_key"`
+	Endpoint      Endpoint `mapstructure:",squash"`
 }
 
 type Vsphere struct {
-	Username string `mapstructure:"username"`
-	Password string `mapstructure:"password"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	Endpoint Endpoint `mapstructure:",squash"`
 }
 
 type Infoblox struct {
-	Username string `mapstructure:"username"`
-	Password string `mapstructure:"password"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	Endpoint Endpoint `mapstructure:",squash"`
+}
+
+// Puppet is the Puppet CA that signs hosts' certificates. The CA only
+// answers to certificates it trusts, so cert_file and key_file are
+// usually needed. SmartProxy is a Foreman smart proxy with the Puppet CA
+// feature, which autosign entries are added through; it's connected to
+// with the same certificate.
+type Puppet struct {
+	SmartProxy string   `mapstructure:"smart_proxy"`
+	Endpoint   Endpoint `mapstructure:",squash"`
+}
+
+// Vault is where "secret://vault/..." references are looked up. The token
+// falls back to $VAULT_TOKEN and then ~/.vault-token when it isn't set.
+type Vault struct {
+	Token    string   `mapstructure:"token"`
+	Endpoint Endpoint `mapstructure:",squash"`
 }
 
+// SSH is how overseer logs in to the hosts it builds.
+type SSH struct {
+	User string `mapstructure:"user"`
+	Port int    `mapstructure:"port"`
+	// KeyFile is a private key to log in with. The SSH agent is used as
+	// well when $SSH_AUTH_SOCK is set.
+	KeyFile    string `mapstructure:"key_file"`
+	KnownHosts string `mapstructure:"known_hosts"`
+	// HostKeyChecking is "accept-new" (the default), which trusts and
+	// remembers hosts that aren't in known_hosts yet, "strict" or "off".
+	HostKeyChecking string `mapstructure:"host_key_checking"`
+	// Sudo runs commands through sudo when logging in as someone other
+	// than root.
+	Sudo bool `mapstructure:"sudo"`
+	// Timeout is the number of seconds to wait for a connection.
+	Timeout int `mapstructure:"timeout"`
+	// JumpHost is a bastion to connect through, as [user@]host[:port].
+	// It's logged in to with the same keys.
+	JumpHost string `mapstructure:"jump_host"`
+	// Parallel is how many hosts to run commands on at once. Zero means
+	// the default of 10.
+	Parallel int `mapstructure:"parallel"`
+}
+
+const (
+	HostKeyAcceptNew = "accept-new"
+	HostKeyStrict    = "strict"
+	HostKeyOff       = "off"
+)
+
 // ParseFile parses the given configspec file.
 func ParseFile(path string) (*Spec, error) {
 	path, err := filepath.Abs(path)
@@ -87,6 +161,11 @@ func Parse(r io.Reader) (*Spec, error) {
 		"chef",
 		"vsphere",
 		"infoblox",
+		"puppet",
+		"vault",
+		"ssh",
+		"plugin",
+		"profile",
 	}
 	if err := checkHCLKeys(list, valid); err != nil {
 		return nil, err
@@ -94,28 +173,150 @@ func Parse(r io.Reader) (*Spec, error) {
 
 	var spec Spec
 
+	if err := parseBackends(&spec, list); err != nil {
+		return nil, err
+	}
+
+	if o := list.Filter("plugin"); len(o.Items) > 0 {
+		if err := parsePlugins(&spec.Plugins, o); err != nil {
+			return nil, fmt.Errorf("error parsing plugin block: %s", err)
+		}
+	}
+
+	if o := list.Filter("profile"); len(o.Items) > 0 {
+		if err := parseProfiles(&spec.Profiles, o); err != nil {
+			return nil, fmt.Errorf("error parsing profile block: %s", err)
+		}
+	}
+
+	return &spec, nil
+}
+
+// parseBackends parses the backend blocks out of the given list. It's used
+// for both the top level of the file and the inside of each profile.
+func parseBackends(spec *Spec, list *ast.ObjectList) error {
 	if o := list.Filter("foreman"); len(o.Items) > 0 {
 		if err := parseForeman(&spec.Foreman, o); err != nil {
-			return nil, fmt.Errorf("error parsing foreman block: %s", err)
+			return fmt.Errorf("error parsing foreman block: %s", err)
 		}
 	}
 	if o := list.Filter("chef"); len(o.Items) > 0 {
 		if err := parseChef(&spec.Chef, o); err != nil {
-			return nil, fmt.Errorf("error parsing chef block: %s", err)
+			return fmt.Errorf("error parsing chef block: %s", err)
 		}
 	}
 	if o := list.Filter("vsphere"); len(o.Items) > 0 {
 		if err := parseVsphere(&spec.Vsphere, o); err != nil {
-			return nil, fmt.Errorf("error parsing vsphere block: %s", err)
+			return fmt.Errorf("error parsing vsphere block: %s", err)
 		}
 	}
 	if o := list.Filter("infoblox"); len(o.Items) > 0 {
 		if err := parseInfoblox(&spec.Infoblox, o); err != nil {
-			return nil, fmt.Errorf("error parsing infoblox block: %s", err)
+			return fmt.Errorf("error parsing infoblox block: %s", err)
+		}
+	}
+	if o := list.Filter("puppet"); len(o.Items) > 0 {
+		if err := parsePuppet(&spec.Puppet, o); err != nil {
+			return fmt.Errorf("error parsing puppet block: %s", err)
+		}
+	}
+	if o := list.Filter("vault"); len(o.Items) > 0 {
+		if err := parseVault(&spec.Vault, o); err != nil {
+			return fmt.Errorf("error parsing vault block: %s", err)
+		}
+	}
+	if o := list.Filter("ssh"); len(o.Items) > 0 {
+		if err := parseSSH(&spec.SSH, o); err != nil {
+			return fmt.Errorf("error parsing ssh block: %s", err)
 		}
 	}
 
-	return &spec, nil
+	return nil
+}
+
+func parseProfiles(result *map[string]*Spec, list *ast.ObjectList) error {
+	profiles := make(map[string]*Spec)
+
+	for _, item := range list.Items {
+		if len(item.Keys) != 1 {
+			return fmt.Errorf("%q must be followed by exactly one string: a name", "profile")
+		}
+
+		name := item.Keys[0].Token.Value().(string)
+		if _, ok := profiles[name]; ok {
+			return fmt.Errorf("profile names should be unique: %q is defined more than once", name)
+		}
+
+		var listVal *ast.ObjectList
+		if ot, ok := item.Val.(*ast.ObjectType); ok {
+			listVal = ot.List
+		} else {
+			return fmt.Errorf("profile %q should be an object", name)
+		}
+
+		valid := []string{
+			"foreman",
+			"chef",
+			"vsphere",
+			"infoblox",
+			"puppet",
+			"vault",
+			"ssh",
+		}
+		if err := checkHCLKeys(listVal, valid); err != nil {
+			return multierror.Prefix(err, fmt.Sprintf("%s ->", name))
+		}
+
+		var profile Spec
+		if err := parseBackends(&profile, listVal); err != nil {
+			return multierror.Prefix(err, fmt.Sprintf("%s ->", name))
+		}
+
+		profiles[name] = &profile
+	}
+
+	*result = profiles
+	return nil
+}
+
+func parsePlugins(result *map[string]*Plugin, list *ast.ObjectList) error {
+	plugins := make(map[string]*Plugin)
+
+	for _, item := range list.Items {
+		if len(item.Keys) != 1 {
+			return fmt.Errorf("%q must be followed by exactly one string: a name", "plugin")
+		}
+
+		name := item.Keys[0].Token.Value().(string)
+		if _, ok := plugins[name]; ok {
+			return fmt.Errorf("plugin names should be unique: %q is defined more than once", name)
+		}
+		if _, ok := item.Val.(*ast.ObjectType); !ok {
+			return fmt.Errorf("plugin %q should be an object", name)
+		}
+
+		var m map[string]interface{}
+		if err := hcl.DecodeObject(&m, item.Val); err != nil {
+			return multierror.Prefix(err, fmt.Sprintf("%s ->", name))
+		}
+
+		// Everything but replace_builtin is the plugin's business
+		var plugin Plugin
+		if v, ok := m["replace_builtin"]; ok {
+			if err := mapstructure.WeakDecode(v, &plugin.ReplaceBuiltin); err != nil {
+				return multierror.Prefix(err, fmt.Sprintf("%s -> replace_builtin:", name))
+			}
+			delete(m, "replace_builtin")
+		}
+		if len(m) > 0 {
+			plugin.Settings = m
+		}
+
+		plugins[name] = &plugin
+	}
+
+	*result = plugins
+	return nil
 }
 
 func parseForeman(result *Foreman, list *ast.ObjectList) error {
@@ -127,10 +328,10 @@ func parseForeman(result *Foreman, list *ast.ObjectList) error {
 	// Get our "foreman" object
 	o := list.Items[0]
 
-	valid := []string{
+	valid := append([]string{
 		"username",
 		"password",
-	}
+	}, endpointKeys...)
 	if err := checkHCLKeys(o.Val, valid); err != nil {
 		return err
 	}
@@ -145,6 +346,10 @@ func parseForeman(result *Foreman, list *ast.ObjectList) error {
 		return err
 	}
 
+	if err := foreman.Endpoint.validate(); err != nil {
+		return err
+	}
+
 	*result = foreman
 	return nil
 }
@@ -158,13 +363,13 @@ func parseChef(result *Chef, list *ast.ObjectList) error {
 	// Get our "chef" object
 	o := list.Items[0]
 
-	valid := []string{
+	valid := append([]string{
 		"username",
 		"password",
 		"chef_server",
 		"client_key",
 		"validation_key",
-	}
+	}, endpointKeys...)
 	if err := checkHCLKeys(o.Val, valid); err != nil {
 		return err
 	}
@@ -179,6 +384,21 @@ func parseChef(result *Chef, list *ast.ObjectList) error {
 		return err
 	}
 
+	// chef_server predates the url key, so keep honoring it when url
+	// isn't set.
+	if chef.Endpoint.URL == "" {
+		chef.Endpoint.URL = chef.ChefServer
+	}
+
+	errs := chef.Endpoint.validate()
+	// Requests are signed as the user the client key belongs to
+	if chef.ClientKey != "" && chef.Username == "" {
+		errs = multierror.Append(errs, fmt.Errorf("username must be set along with client_key"))
+	}
+	if errs != nil {
+		return errs
+	}
+
 	*result = chef
 	return nil
 }
@@ -197,10 +417,10 @@ func parseVsphere(result *Vsphere, list *ast.ObjectList) error {
 		listVal = ot.List
 	}
 
-	valid := []string{
+	valid := append([]string{
 		"username",
 		"password",
-	}
+	}, endpointKeys...)
 	if err := checkHCLKeys(listVal, valid); err != nil {
 		return multierror.Prefix(err, "vsphere ->")
 	}
@@ -215,6 +435,10 @@ func parseVsphere(result *Vsphere, list *ast.ObjectList) error {
 		return err
 	}
 
+	if err := vsphere.Endpoint.validate(); err != nil {
+		return multierror.Prefix(err, "vsphere ->")
+	}
+
 	*result = vsphere
 	return nil
 }
@@ -233,10 +457,10 @@ func parseInfoblox(result *Infoblox, list *ast.ObjectList) error {
 		listVal = ot.List
 	}
 
-	valid := []string{
+	valid := append([]string{
 		"username",
 		"password",
-	}
+	}, endpointKeys...)
 	if err := checkHCLKeys(listVal, valid); err != nil {
 		return multierror.Prefix(err, "infoblox ->")
 	}
@@ -251,10 +475,161 @@ func parseInfoblox(result *Infoblox, list *ast.ObjectList) error {
 		return err
 	}
 
+	if err := infoblox.Endpoint.validate(); err != nil {
+		return multierror.Prefix(err, "infoblox ->")
+	}
+
 	*result = infoblox
 	return nil
 }
 
+func parsePuppet(result *Puppet, list *ast.ObjectList) error {
+	list = list.Elem()
+	if len(list.Items) > 1 {
+		return fmt.Errorf("only one %q block allowed", "puppet")
+	}
+
+	// Get our puppet object
+	o := list.Items[0]
+
+	var listVal *ast.ObjectList
+	if ot, ok := o.Val.(*ast.ObjectType); ok {
+		listVal = ot.List
+	}
+
+	valid := append([]string{
+		"smart_proxy",
+	}, endpointKeys...)
+	if err := checkHCLKeys(listVal, valid); err != nil {
+		return multierror.Prefix(err, "puppet ->")
+	}
+
+	var m map[string]interface{}
+	if err := hcl.DecodeObject(&m, o.Val); err != nil {
+		return err
+	}
+
+	var puppet Puppet
+	if err := mapstructure.WeakDecode(m, &puppet); err != nil {
+		return err
+	}
+
+	errs := puppet.Endpoint.validate()
+	if puppet.SmartProxy != "" {
+		if err := checkURL(puppet.SmartProxy); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("smart_proxy: %s", err))
+		}
+	}
+	if errs != nil {
+		return multierror.Prefix(errs, "puppet ->")
+	}
+
+	*result = puppet
+	return nil
+}
+
+func parseVault(result *Vault, list *ast.ObjectList) error {
+	list = list.Elem()
+	if len(list.Items) > 1 {
+		return fmt.Errorf("only one %q block allowed", "vault")
+	}
+
+	// Get our vault object
+	o := list.Items[0]
+
+	var listVal *ast.ObjectList
+	if ot, ok := o.Val.(*ast.ObjectType); ok {
+		listVal = ot.List
+	}
+
+	valid := append([]string{
+		"token",
+	}, endpointKeys...)
+	if err := checkHCLKeys(listVal, valid); err != nil {
+		return multierror.Prefix(err, "vault ->")
+	}
+
+	var m map[string]interface{}
+	if err := hcl.DecodeObject(&m, o.Val); err != nil {
+		return err
+	}
+
+	var vault Vault
+	if err := mapstructure.WeakDecode(m, &vault); err != nil {
+		return err
+	}
+
+	if err := vault.Endpoint.validate(); err != nil {
+		return multierror.Prefix(err, "vault ->")
+	}
+
+	*result = vault
+	return nil
+}
+
+func parseSSH(result *SSH, list *ast.ObjectList) error {
+	list = list.Elem()
+	if len(list.Items) > 1 {
+		return fmt.Errorf("only one %q block allowed", "ssh")
+	}
+
+	// Get our ssh object
+	o := list.Items[0]
+
+	var listVal *ast.ObjectList
+	if ot, ok := o.Val.(*ast.ObjectType); ok {
+		listVal = ot.List
+	}
+
+	valid := []string{
+		"user",
+		"port",
+		"key_file",
+		"known_hosts",
+		"host_key_checking",
+		"sudo",
+		"timeout",
+		"jump_host",
+		"parallel",
+	}
+	if err := checkHCLKeys(listVal, valid); err != nil {
+		return multierror.Prefix(err, "ssh ->")
+	}
+
+	var m map[string]interface{}
+	if err := hcl.DecodeObject(&m, o.Val); err != nil {
+		return err
+	}
+
+	var ssh SSH
+	if err := mapstructure.WeakDecode(m, &ssh); err != nil {
+		return err
+	}
+
+	var errs error
+	switch ssh.HostKeyChecking {
+	case "", HostKeyAcceptNew, HostKeyStrict, HostKeyOff:
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("host_key_checking must be %q, %q or %q, got %q",
+			HostKeyAcceptNew, HostKeyStrict, HostKeyOff, ssh.HostKeyChecking))
+	}
+	if ssh.Port < 0 || ssh.Port > 65535 {
+		errs = multierror.Append(errs, fmt.Errorf("port must be between 0 and 65535, got %d", ssh.Port))
+	}
+	if ssh.Timeout < 0 {
+		errs = multierror.Append(errs, fmt.Errorf("timeout must not be negative, got %d", ssh.Timeout))
+	}
+	if ssh.Parallel < 0 {
+		errs = multierror.Append(errs, fmt.Errorf("parallel must not be negative, got %d", ssh.Parallel))
+	}
+	if errs != nil {
+		return multierror.Prefix(errs, "ssh ->")
+	}
+
+	*result = ssh
+	return nil
+}
+
 func checkHCLKeys(node ast.Node, valid []string) error {
 	var list *ast.ObjectList
 	switch n := node.(type) {
@@ -18,6 +18,12 @@ func TestParse(t *testing.T) {
 				Foreman: Foreman{
 					Username: "admin",
 					Password: "datpass",
+					Endpoint: Endpoint{
+						URL:        "https://foreman.qa.local",
+						APIVersion: "2",
+						CAFile:     "/etc/pki/tls/certs/ca-bundle.crt",
+						Timeout:    30,
+					},
 				},
 				Chef: Chef{
 					Username:      "admin",
@@ -25,18 +31,190 @@ func TestParse(t *testing.T) {
 					ChefServer:    "https://localhost/",
 					ClientKey:     "~/.chef/client.pem",
 					ValidationKey: "~/.chef/validation.pem",
+					Endpoint: Endpoint{
+						URL:   "https://localhost/",
+						Proxy: "http://proxy.qa.local:3128",
+					},
 				},
 				Vsphere: Vsphere{
 					Username: "admin",
 					Password: "datpass",
+					Endpoint: Endpoint{
+						URL:                "https://vcenter.qa.local/sdk",
+						InsecureSkipVerify: true,
+					},
 				},
 				Infoblox: Infoblox{
 					Username: "admin",
 					Password: "datpass",
+					Endpoint: Endpoint{
+						URL:        "https://infoblox.qa.local",
+						APIVersion: "2.5",
+						CertFile:   "~/.overseer/infoblox.crt",
+						KeyFile:    "~/.overseer/infoblox.key",
+					},
+				},
+				Puppet: Puppet{
+					SmartProxy: "https://foreman-proxy.qa.local:8443",
+					Endpoint: Endpoint{
+						URL:      "https://puppet.qa.local:8140",
+						CAFile:   "/etc/puppetlabs/puppet/ssl/certs/ca.pem",
+						CertFile: "~/.overseer/puppet.crt",
+						KeyFile:  "~/.overseer/puppet.key",
+					},
+				},
+				Vault: Vault{
+					Token: "env://VAULT_TOKEN",
+					Endpoint: Endpoint{
+						URL: "https://vault.qa.local:8200",
+					},
+				},
+				SSH: SSH{
+					User:            "provision",
+					KeyFile:         "~/.ssh/id_ed25519",
+					HostKeyChecking: "strict",
+					Sudo:            true,
+					JumpHost:        "bastion.qa.local:2222",
+				},
+			},
+			false,
+		},
+		{
+			"chef-client-cert.conf",
+			&Spec{
+				Chef: Chef{
+					Username:  "admin",
+					ClientKey: "~/.chef/admin.pem",
+					Endpoint: Endpoint{
+						URL:      "https://chef.qa.local/organizations/qa",
+						CAFile:   "~/.chef/trusted_certs/chef.qa.local.crt",
+						CertFile: "~/.overseer/chef.crt",
+						KeyFile:  "~/.overseer/chef.key",
+					},
 				},
 			},
 			false,
 		},
+		{
+			"bad-chef-without-username.conf",
+			nil,
+			true,
+		},
+		{
+			"bad-cert-without-key.conf",
+			nil,
+			true,
+		},
+		{
+			"bad-url.conf",
+			nil,
+			true,
+		},
+		{
+			"bad-smart-proxy.conf",
+			nil,
+			true,
+		},
+		{
+			"bad-key.conf",
+			nil,
+			true,
+		},
+		{
+			"bad-host-key-checking.conf",
+			nil,
+			true,
+		},
+		{
+			"profiles.conf",
+			&Spec{
+				Chef: Chef{
+					Username:   "admin",
+					Password:   "datpass",
+					ChefServer: "https://chef.qa.local/",
+					ClientKey:  "~/.chef/client.pem",
+					Endpoint: Endpoint{
+						URL: "https://chef.qa.local/",
+					},
+				},
+				Profiles: map[string]*Spec{
+					"indy-qa": {
+						Foreman: Foreman{
+							Username: "admin",
+							Password: "datpass",
+							Endpoint: Endpoint{
+								URL: "https://foreman.qa.local",
+							},
+						},
+					},
+					"indy-prod": {
+						Foreman: Foreman{
+							Username: "admin",
+							Password: "prodpass",
+							Endpoint: Endpoint{
+								URL: "https://foreman.prod.local",
+							},
+						},
+						Chef: Chef{
+							Username:  "admin",
+							Password:  "prodpass",
+							ClientKey: "~/.chef/prod.pem",
+							Endpoint: Endpoint{
+								URL: "https://chef.prod.local/",
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"bad-duplicate-profile.conf",
+			nil,
+			true,
+		},
+		{
+			"bad-nested-profile.conf",
+			nil,
+			true,
+		},
+		{
+			"plugins.conf",
+			&Spec{
+				Plugins: map[string]*Plugin{
+					"hostsfile": {
+						Settings: map[string]interface{}{"path": "/etc/hosts.overseer"},
+					},
+					"foreman": {
+						ReplaceBuiltin: true,
+						Settings:       map[string]interface{}{"url": "https://cmdb.qa.local", "retries": 3},
+					},
+					"quiet": {},
+				},
+				Profiles: map[string]*Spec{
+					"indy-qa": {
+						Foreman: Foreman{
+							Username: "admin",
+							Password: "datpass",
+							Endpoint: Endpoint{
+								URL: "https://foreman.qa.local",
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"bad-duplicate-plugin.conf",
+			nil,
+			true,
+		},
+		{
+			"bad-profile-plugin.conf",
+			nil,
+			true,
+		},
 	}
 
 	for _, tt := range cases {
@@ -0,0 +1,76 @@
+package configspec
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ProfileEnvVar is the environment variable used to select a profile when
+// one isn't given on the command line.
+const ProfileEnvVar = "OVERSEER_PROFILE"
+
+// Profile returns the configuration for the named profile. The top-level
+// backend blocks act as defaults: any block the profile defines replaces
+// the top-level one wholesale, and anything it leaves out is inherited.
+// An empty name returns the top-level configuration on its own. Plugin
+// blocks only live at the top level, so every profile gets them.
+func (s *Spec) Profile(name string) (*Spec, error) {
+	result := &Spec{
+		Foreman:  s.Foreman,
+		Chef:     s.Chef,
+		Vsphere:  s.Vsphere,
+		Infoblox: s.Infoblox,
+		Puppet:   s.Puppet,
+		Vault:    s.Vault,
+		SSH:      s.SSH,
+		Plugins:  s.Plugins,
+	}
+
+	if name == "" {
+		return result, nil
+	}
+
+	profile, ok := s.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %q not found in configspec (available: %s)", name, s.profileNames())
+	}
+
+	if profile.Foreman != (Foreman{}) {
+		result.Foreman = profile.Foreman
+	}
+	if profile.Chef != (Chef{}) {
+		result.Chef = profile.Chef
+	}
+	if profile.Vsphere != (Vsphere{}) {
+		result.Vsphere = profile.Vsphere
+	}
+	if profile.Infoblox != (Infoblox{}) {
+		result.Infoblox = profile.Infoblox
+	}
+	if profile.Puppet != (Puppet{}) {
+		result.Puppet = profile.Puppet
+	}
+	if profile.Vault != (Vault{}) {
+		result.Vault = profile.Vault
+	}
+	if profile.SSH != (SSH{}) {
+		result.SSH = profile.SSH
+	}
+
+	return result, nil
+}
+
+func (s *Spec) profileNames() string {
+	if len(s.Profiles) == 0 {
+		return "none"
+	}
+
+	names := make([]string, 0, len(s.Profiles))
+	for name := range s.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,72 @@
+package configspec
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	path, err := filepath.Abs(filepath.Join("./test-fixtures", "profiles.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec, err := ParseFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Profile    string
+		ForemanURL string
+		ChefURL    string
+		Err        bool
+	}{
+		{"", "", "https://chef.qa.local/", false},
+		{"indy-qa", "https://foreman.qa.local", "https://chef.qa.local/", false},
+		{"indy-prod", "https://foreman.prod.local", "https://chef.prod.local/", false},
+		{"indy-dev", "", "", true},
+	}
+
+	for _, tt := range cases {
+		actual, err := spec.Profile(tt.Profile)
+		if (err != nil) != tt.Err {
+			t.Fatalf("profile: %s\n\n%s", tt.Profile, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		if actual.Foreman.Endpoint.URL != tt.ForemanURL {
+			t.Fatalf("profile: %s\n\n%q != %q", tt.Profile, actual.Foreman.Endpoint.URL, tt.ForemanURL)
+		}
+		if actual.Chef.Endpoint.URL != tt.ChefURL {
+			t.Fatalf("profile: %s\n\n%q != %q", tt.Profile, actual.Chef.Endpoint.URL, tt.ChefURL)
+		}
+		if actual.Profiles != nil {
+			t.Fatalf("profile: %s\n\nresolved spec should not carry profiles", tt.Profile)
+		}
+	}
+}
+
+func TestProfilePlugins(t *testing.T) {
+	path, err := filepath.Abs(filepath.Join("./test-fixtures", "plugins.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec, err := ParseFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, profile := range []string{"", "indy-qa"} {
+		actual, err := spec.Profile(profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(actual.Plugins) != 3 || !actual.Plugins["foreman"].ReplaceBuiltin {
+			t.Fatalf("profile: %s\n\n%#v", profile, actual.Plugins)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package configspec
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// SecretResolver turns a configspec value into the secret it refers to.
+// Values that aren't references should be handed back untouched.
+type SecretResolver interface {
+	Resolve(value string) (string, error)
+}
+
+// CredentialStore is somewhere to look up a username and password when
+// the configspec leaves the password out, such as the encrypted store
+// managed by "overseer credentials".
+type CredentialStore interface {
+	Credential(name string) (username, password string, ok bool)
+}
+
+// credential points at the username and password of a backend block.
+// Backends that authenticate with a key rather than their password never
+// need one filled in.
+type credential struct {
+	backend    string
+	username   *string
+	password   *string
+	configured bool
+	keyAuth    bool
+}
+
+func (s *Spec) credentials() []credential {
+	return []credential{
+		{"foreman", &s.Foreman.Username, &s.Foreman.Password, s.Foreman != (Foreman{}), false},
+		{"chef", &s.Chef.Username, &s.Chef.Password, s.Chef != (Chef{}), true},
+		{"vsphere", &s.Vsphere.Username, &s.Vsphere.Password, s.Vsphere != (Vsphere{}), false},
+		{"infoblox", &s.Infoblox.Username, &s.Infoblox.Password, s.Infoblox != (Infoblox{}), false},
+	}
+}
+
+// ResolveSecrets runs every credential in the spec through the resolver,
+// replacing references like "secret://vault/kv/foreman#password" with
+// their values. Profiles are left alone; resolve the spec returned by
+// Profile instead so only the credentials that are used get looked up.
+func (s *Spec) ResolveSecrets(r SecretResolver) error {
+	var result error
+	for _, c := range s.credentials() {
+		fields := []struct {
+			name  string
+			value *string
+		}{
+			{"username", c.username},
+			{"password", c.password},
+		}
+
+		for _, f := range fields {
+			if *f.value == "" {
+				continue
+			}
+
+			resolved, err := r.Resolve(*f.value)
+			if err != nil {
+				result = multierror.Append(result, fmt.Errorf("%s.%s: %s", c.backend, f.name, err))
+				continue
+			}
+			*f.value = resolved
+		}
+	}
+
+	return result
+}
+
+// MissingPasswords returns the backends that are configured but don't
+// have a password. Chef signs its requests with client_key, so it's never
+// missing one.
+func (s *Spec) MissingPasswords() []string {
+	var missing []string
+	for _, c := range s.credentials() {
+		if c.configured && !c.keyAuth && *c.password == "" {
+			missing = append(missing, c.backend)
+		}
+	}
+	return missing
+}
+
+// FillCredentials fills in missing passwords from the store. Entries named
+// after the profile and backend ("indy-prod/foreman") win over entries
+// named after just the backend ("foreman"). A stored credential is only
+// used if its username matches the configspec, or the configspec doesn't
+// set one.
+func (s *Spec) FillCredentials(store CredentialStore, profile string) {
+	for _, c := range s.credentials() {
+		if !c.configured || c.keyAuth || *c.password != "" {
+			continue
+		}
+
+		names := []string{c.backend}
+		if profile != "" {
+			names = append([]string{profile + "/" + c.backend}, names...)
+		}
+
+		for _, name := range names {
+			username, password, ok := store.Credential(name)
+			if !ok || (*c.username != "" && *c.username != username) {
+				continue
+			}
+
+			*c.username = username
+			*c.password = password
+			break
+		}
+	}
+}
@@ -2,9 +2,13 @@ package main
 
 import (
 	"os"
+	"path/filepath"
 
 	"github.com/iamthemuffinman/cli"
 	log "github.com/iamthemuffinman/logsip"
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/plugin"
+	"github.com/mitchellh/go-homedir"
 
 	_ "github.com/iamthemuffinman/overseer/pkg/chef"
 	_ "github.com/iamthemuffinman/overseer/pkg/infoblox"
@@ -18,6 +22,16 @@ func main() {
 func realMain() int {
 	args := os.Args[1:]
 
+	// Plugins are registered after the in-tree providers, so one the
+	// configspec lets replace an in-tree provider can take its name
+	home, err := homedir.Dir()
+	if err != nil {
+		log.Warnf("unable to find your home directory, so no plugins will be used: %s", err)
+	} else {
+		plugin.Register(plugin.Discover(plugin.Dir(home)), pluginSettings(home))
+	}
+	defer plugin.CleanupClients()
+
 	cli := &cli.CLI{
 		Args:       args,
 		Commands:   Commands,
@@ -32,3 +46,14 @@ func realMain() int {
 
 	return exitCode
 }
+
+// pluginSettings returns the configspec's plugin blocks. A configspec
+// that's missing or broken has none: commands that need it say what's
+// wrong with it.
+func pluginSettings(home string) map[string]*configspec.Plugin {
+	cspec, err := configspec.ParseFile(filepath.Join(home, ".overseer", "overseer.conf"))
+	if err != nil {
+		return nil
+	}
+	return cspec.Plugins
+}
@@ -0,0 +1,178 @@
+package ansible
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+)
+
+func TestInventory(t *testing.T) {
+	expected, err := ioutil.ReadFile(filepath.Join("test-fixtures", "inventory.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := configspec.SSH{
+		User:       "provision",
+		KeyFile:    "/etc/overseer/id_ed25519",
+		KnownHosts: "/etc/overseer/known_hosts",
+		Sudo:       true,
+		JumpHost:   "provision@bastion.lab.local",
+	}
+	hosts := []string{"kafka01.lab.local", "kafka02.lab.local"}
+	vars := map[string]map[string]string{"kafka01.lab.local": {"broker_id": "1"}}
+
+	actual, err := Inventory(hosts, []string{"kafka", "lab"}, vars, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(actual, expected) {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+func TestConnectionVars(t *testing.T) {
+	cases := []struct {
+		SSH      configspec.SSH
+		Expected map[string]interface{}
+	}{
+		{
+			configspec.SSH{HostKeyChecking: configspec.HostKeyOff},
+			map[string]interface{}{
+				"ansible_user":            "root",
+				"ansible_ssh_common_args": "-o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null",
+			},
+		},
+		{
+			configspec.SSH{User: "root", Port: 2222, Sudo: true, Timeout: 5, HostKeyChecking: configspec.HostKeyStrict, KnownHosts: "/tmp/known_hosts"},
+			map[string]interface{}{
+				"ansible_user":            "root",
+				"ansible_port":            2222,
+				"ansible_timeout":         5,
+				"ansible_ssh_common_args": `-o StrictHostKeyChecking=yes -o UserKnownHostsFile="/tmp/known_hosts"`,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		actual, err := connectionVars(tc.SSH)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			t.Fatalf("%#v\n\n%#v", actual, tc.Expected)
+		}
+	}
+}
+
+func TestParseOutput(t *testing.T) {
+	out, err := ioutil.ReadFile(filepath.Join("test-fixtures", "output.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := ParseOutput(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]*Result{
+		"kafka01.lab.local": {
+			OK: 3, Changed: 2, Skipped: 1,
+			Changes: []string{`task "Install kafka"`, `task "Configure kafka"`},
+		},
+		"kafka02.lab.local": {
+			OK: 1, Failed: 1,
+			Failures: []string{`task "Install kafka" failed: No package matching 'kafka-2.8.1' found available, installed or updated`},
+		},
+		"kafka03.lab.local": {
+			Unreachable: 1,
+			Failures:    []string{"unreachable: Failed to connect to the host via ssh: ssh: connect to host kafka03.lab.local port 22: No route to host"},
+		},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		for host, r := range results {
+			t.Logf("%s: %#v", host, r)
+		}
+		t.Fatal("bad results")
+	}
+
+	if err := results["kafka01.lab.local"].Err(); err != nil {
+		t.Fatalf("kafka01 shouldn't have failed: %s", err)
+	}
+	if err := results["kafka02.lab.local"].Err(); err == nil || !strings.Contains(err.Error(), "Install kafka") {
+		t.Fatalf("expected kafka02 to fail installing kafka, got %v", err)
+	}
+	if s := results["kafka01.lab.local"].String(); s != "3 ok, 2 changed, 1 skipped" {
+		t.Fatalf("bad: %s", s)
+	}
+
+	if _, err := ParseOutput([]byte("ERROR! the playbook could not be found\n")); err == nil {
+		t.Fatal("expected an error without any results")
+	}
+}
+
+func TestRun(t *testing.T) {
+	out, err := ioutil.ReadFile(filepath.Join("test-fixtures", "output.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec := buildspec.Ansible{
+		Playbook:  "playbooks/kafka.yml",
+		Groups:    []string{"kafka"},
+		ExtraVars: map[string]interface{}{"kafka_version": "2.8.1"},
+	}
+	p := New(spec, configspec.SSH{})
+
+	var args []string
+	var inv inventory
+	var extraVars map[string]interface{}
+	p.run = func(a ...string) ([]byte, error) {
+		args = a
+
+		// The files are gone once Run returns
+		b, err := ioutil.ReadFile(a[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(b, &inv); err != nil {
+			t.Fatal(err)
+		}
+		b, err = ioutil.ReadFile(strings.TrimPrefix(a[3], "@"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(b, &extraVars); err != nil {
+			t.Fatal(err)
+		}
+
+		return out, nil
+	}
+
+	hosts := []string{"kafka01.lab.local", "kafka02.lab.local", "kafka03.lab.local"}
+	results, err := p.Run(hosts, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("bad: %#v", results)
+	}
+
+	if args[0] != "-i" || args[2] != "--extra-vars" || !reflect.DeepEqual(args[4:], []string{"--check", "playbooks/kafka.yml"}) {
+		t.Fatalf("bad args: %v", args)
+	}
+	if len(inv.All.Hosts) != 3 || len(inv.All.Children["kafka"].Hosts) != 3 {
+		t.Fatalf("bad inventory: %#v", inv)
+	}
+	if extraVars["kafka_version"] != "2.8.1" {
+		t.Fatalf("bad extra vars: %#v", extraVars)
+	}
+}
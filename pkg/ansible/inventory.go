@@ -0,0 +1,122 @@
+// Package ansible configures hosts by running an ansible-playbook against
+// an inventory of them, the way a buildspec's ansible block says to.
+package ansible
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/ssh"
+	"github.com/iamthemuffinman/overseer/pkg/util"
+)
+
+// inventory is the YAML inventory format, which ansible reads as JSON too.
+type inventory struct {
+	All group `json:"all"`
+}
+
+type group struct {
+	Vars     map[string]interface{}       `json:"vars,omitempty"`
+	Hosts    map[string]map[string]string `json:"hosts,omitempty"`
+	Children map[string]group             `json:"children,omitempty"`
+}
+
+// Inventory returns an inventory of the hosts, each in every one of the
+// groups and with its own vars. Ansible logs in to them the same way
+// overseer does, with the configspec's ssh settings.
+func Inventory(hosts, groups []string, vars map[string]map[string]string, cfg configspec.SSH) ([]byte, error) {
+	sshVars, err := connectionVars(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := inventory{All: group{
+		Vars:  sshVars,
+		Hosts: make(map[string]map[string]string),
+	}}
+
+	for _, host := range hosts {
+		hostVars := vars[host]
+		if hostVars == nil {
+			hostVars = map[string]string{}
+		}
+		inv.All.Hosts[host] = hostVars
+	}
+
+	for _, name := range groups {
+		if inv.All.Children == nil {
+			inv.All.Children = make(map[string]group)
+		}
+
+		g := group{Hosts: make(map[string]map[string]string)}
+		for _, host := range hosts {
+			g.Hosts[host] = map[string]string{}
+		}
+		inv.All.Children[name] = g
+	}
+
+	out, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// connectionVars returns the inventory variables that make ansible connect
+// with the configspec's ssh settings.
+func connectionVars(cfg configspec.SSH) (map[string]interface{}, error) {
+	user := cfg.User
+	if user == "" {
+		user = ssh.DefaultUser
+	}
+
+	vars := map[string]interface{}{
+		"ansible_user": user,
+	}
+	if cfg.Port != 0 {
+		vars["ansible_port"] = cfg.Port
+	}
+	if cfg.KeyFile != "" {
+		path, err := util.ExpandPath(cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		vars["ansible_ssh_private_key_file"] = path
+	}
+	if cfg.Sudo && user != "root" {
+		vars["ansible_become"] = true
+	}
+	if cfg.Timeout != 0 {
+		vars["ansible_timeout"] = cfg.Timeout
+	}
+
+	var args []string
+	switch cfg.HostKeyChecking {
+	case configspec.HostKeyOff:
+		args = append(args, "-o StrictHostKeyChecking=no", "-o UserKnownHostsFile=/dev/null")
+	case configspec.HostKeyStrict:
+		args = append(args, "-o StrictHostKeyChecking=yes")
+	default:
+		args = append(args, "-o StrictHostKeyChecking=accept-new")
+	}
+	if cfg.HostKeyChecking != configspec.HostKeyOff {
+		knownHosts := cfg.KnownHosts
+		if knownHosts == "" {
+			knownHosts = ssh.DefaultKnownHosts
+		}
+		path, err := util.ExpandPath(knownHosts)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "-o UserKnownHostsFile="+strconv.Quote(path))
+	}
+	if cfg.JumpHost != "" {
+		args = append(args, fmt.Sprintf("-o ProxyJump=%s", cfg.JumpHost))
+	}
+	vars["ansible_ssh_common_args"] = strings.Join(args, " ")
+
+	return vars, nil
+}
@@ -0,0 +1,213 @@
+package ansible
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+)
+
+// Playbook runs the buildspec's playbook with ansible-playbook.
+type Playbook struct {
+	spec buildspec.Ansible
+	ssh  configspec.SSH
+
+	// run runs ansible-playbook with args and returns what it printed.
+	// It's swapped out in tests.
+	run func(args ...string) ([]byte, error)
+}
+
+// New returns the Playbook for the buildspec's ansible block, logging in
+// to hosts with the configspec's ssh settings.
+func New(spec buildspec.Ansible, cfg configspec.SSH) *Playbook {
+	return &Playbook{spec: spec, ssh: cfg, run: runPlaybook}
+}
+
+// runPlaybook runs ansible-playbook with its JSON output, so the result
+// for each host can be read back. It exits 2 when tasks failed and 4 when
+// hosts were unreachable, which still leaves output to read.
+func runPlaybook(args ...string) ([]byte, error) {
+	cmd := exec.Command("ansible-playbook", args...)
+	cmd.Env = append(os.Environ(),
+		"ANSIBLE_STDOUT_CALLBACK=json",
+		"ANSIBLE_RETRY_FILES_ENABLED=false",
+	)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if code := exitErr.ExitCode(); code == 2 || code == 4 {
+			return out, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ansible-playbook: %s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// Run runs the playbook against the hosts, each with its vars, and returns
+// how it went on each of them. With check, nothing is changed and the
+// results say what would have been.
+func (p *Playbook) Run(hosts []string, vars map[string]map[string]string, check bool) (map[string]*Result, error) {
+	dir, err := ioutil.TempDir("", "overseer-ansible")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	inv, err := Inventory(hosts, p.spec.Groups, vars, p.ssh)
+	if err != nil {
+		return nil, err
+	}
+	invPath := filepath.Join(dir, "inventory.json")
+	if err := ioutil.WriteFile(invPath, inv, 0600); err != nil {
+		return nil, err
+	}
+
+	args := []string{"-i", invPath}
+
+	if len(p.spec.ExtraVars) > 0 {
+		extraVars, err := json.Marshal(p.spec.ExtraVars)
+		if err != nil {
+			return nil, fmt.Errorf("unable to write extra_vars: %s", err)
+		}
+		varsPath := filepath.Join(dir, "extra-vars.json")
+		if err := ioutil.WriteFile(varsPath, extraVars, 0600); err != nil {
+			return nil, err
+		}
+		args = append(args, "--extra-vars", "@"+varsPath)
+	}
+
+	if check {
+		args = append(args, "--check")
+	}
+	args = append(args, p.spec.Playbook)
+
+	out, err := p.run(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseOutput(out)
+}
+
+// Result is how a playbook run went on one host.
+type Result struct {
+	OK          int
+	Changed     int
+	Failed      int
+	Unreachable int
+	Skipped     int
+
+	// Changes are the tasks that changed something on the host, or would
+	// have in check mode, and Failures the ones that failed, with why.
+	Changes  []string
+	Failures []string
+}
+
+// Err returns why the playbook failed on the host, or nil if it didn't.
+func (r *Result) Err() error {
+	if r.Failed == 0 && r.Unreachable == 0 {
+		return nil
+	}
+	if len(r.Failures) == 0 {
+		return fmt.Errorf("%d failed, %d unreachable", r.Failed, r.Unreachable)
+	}
+	return fmt.Errorf("%s", strings.Join(r.Failures, "; "))
+}
+
+func (r *Result) String() string {
+	return fmt.Sprintf("%d ok, %d changed, %d skipped", r.OK, r.Changed, r.Skipped)
+}
+
+// output is the part of the json stdout callback's output overseer reads.
+type output struct {
+	Plays []struct {
+		Tasks []struct {
+			Task struct {
+				Name string `json:"name"`
+			} `json:"task"`
+			Hosts map[string]struct {
+				Changed     bool   `json:"changed"`
+				Failed      bool   `json:"failed"`
+				Unreachable bool   `json:"unreachable"`
+				Msg         string `json:"msg"`
+			} `json:"hosts"`
+		} `json:"tasks"`
+	} `json:"plays"`
+	Stats map[string]struct {
+		OK          int `json:"ok"`
+		Changed     int `json:"changed"`
+		Failures    int `json:"failures"`
+		Unreachable int `json:"unreachable"`
+		Skipped     int `json:"skipped"`
+	} `json:"stats"`
+}
+
+// ParseOutput reads the result for each host from ansible-playbook's
+// JSON output.
+func ParseOutput(out []byte) (map[string]*Result, error) {
+	// Some versions print warnings before the JSON
+	start := bytes.IndexByte(out, '{')
+	if start < 0 {
+		return nil, fmt.Errorf("ansible-playbook didn't print any results")
+	}
+
+	var o output
+	if err := json.Unmarshal(out[start:], &o); err != nil {
+		return nil, fmt.Errorf("unable to read ansible-playbook's results: %s", err)
+	}
+
+	results := make(map[string]*Result)
+	for host, stats := range o.Stats {
+		results[host] = &Result{
+			OK:          stats.OK,
+			Changed:     stats.Changed,
+			Failed:      stats.Failures,
+			Unreachable: stats.Unreachable,
+			Skipped:     stats.Skipped,
+		}
+	}
+
+	for _, play := range o.Plays {
+		for _, task := range play.Tasks {
+			// Keep the order stable for hosts that share a task
+			var hosts []string
+			for host := range task.Hosts {
+				hosts = append(hosts, host)
+			}
+			sort.Strings(hosts)
+
+			for _, host := range hosts {
+				r, ok := results[host]
+				if !ok {
+					continue
+				}
+
+				h := task.Hosts[host]
+				name := fmt.Sprintf("task %q", task.Task.Name)
+				switch {
+				case h.Unreachable:
+					r.Failures = append(r.Failures, fmt.Sprintf("unreachable: %s", h.Msg))
+				case h.Failed:
+					r.Failures = append(r.Failures, fmt.Sprintf("%s failed: %s", name, h.Msg))
+				case h.Changed:
+					r.Changes = append(r.Changes, name)
+				}
+			}
+		}
+	}
+
+	return results, nil
+}
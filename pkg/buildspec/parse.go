@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/hcl"
@@ -15,11 +16,31 @@ import (
 )
 
 type Spec struct {
-	Name     string
-	Foreman  Foreman  `mapstructure:"foreman"`
-	Chef     Chef     `mapstructure:"chef"`
-	Vsphere  Vsphere  `mapstructure:"vsphere"`
-	Infoblox Infoblox `mapstructure:"infoblox"`
+	Name string
+	// Profile is the configspec profile this buildspec must be run
+	// with. Empty means any profile will do.
+	Profile string `mapstructure:"profile"`
+	// Compute, IPAM, DNS and Config name the providers hosts are built,
+	// addressed, put in DNS and configured with. Empty means the default:
+	// "foreman", "foreman", "infoblox" if there's an infoblox block (and
+	// no DNS otherwise) and "chef".
+	Compute string `mapstructure:"compute"`
+	IPAM    string `mapstructure:"ipam"`
+	DNS     string `mapstructure:"dns"`
+	Config  string `mapstructure:"config"`
+	// BuildTimeout is the number of seconds hosts get to build once
+	// they've been created or rebuilt. Zero means the default of an hour.
+	BuildTimeout int      `mapstructure:"build_timeout"`
+	Foreman      Foreman  `mapstructure:"foreman"`
+	Chef         Chef     `mapstructure:"chef"`
+	Ansible      Ansible  `mapstructure:"ansible"`
+	Puppet       Puppet   `mapstructure:"puppet"`
+	Vsphere      Vsphere  `mapstructure:"vsphere"`
+	Libvirt      Libvirt  `mapstructure:"libvirt"`
+	Infoblox     Infoblox `mapstructure:"infoblox"`
+	Verify       Verify   `mapstructure:"verify"`
+	// CloudInit is nil unless the buildspec has a cloud_init block.
+	CloudInit *CloudInit `mapstructure:"cloud_init"`
 }
 
 type Foreman struct {
@@ -34,15 +55,101 @@ type Foreman struct {
 	OperatingSystemID int    `mapstructure:"operating_system_id"`
 	PartitionTableID  int    `mapstructure:"partition_table_id"`
 	Medium            string `mapstructure:"medium"`
+	// Subnet is the name of the Foreman subnet the host's interface goes
+	// on. The hostgroup's is used when it isn't set.
+	Subnet string `mapstructure:"subnet"`
 }
 
 type Chef struct {
-	Server        string   `mapstructure:"server"`
-	ValidationKey string   `mapstructure:"validation_key"`
-	Environment   string   `mapstructure:"environment"`
-	RunList       []string `mapstructure:"run_list"`
+	Server        string `mapstructure:"server"`
+	ValidationKey string `mapstructure:"validation_key"`
+	// ValidationClientName is the client that owns the validation key.
+	// It defaults to "<org>-validator" when the server URL names an
+	// organization and "chef-validator" when it doesn't.
+	ValidationClientName string `mapstructure:"validation_client_name"`
+	// SkipBootstrap leaves installing and running chef-client on new
+	// hosts to something else, like the Foreman provisioning template.
+	SkipBootstrap bool `mapstructure:"skip_bootstrap"`
+	// OnConflict is what to do when the Chef server already has a node or
+	// client for a host being provisioned: "replace" (the default) deletes
+	// them so they're created afresh, "keep" leaves them be and "fail"
+	// refuses to provision the host. A kept client still has the old
+	// host's key, so the new host can't be bootstrapped without a
+	// validation key.
+	OnConflict string `mapstructure:"on_conflict"`
+	// ConvergeTimeout is the number of seconds to wait for a host's first
+	// successful chef-client run. Zero means the default of 30 minutes.
+	ConvergeTimeout int      `mapstructure:"converge_timeout"`
+	Environment     string   `mapstructure:"environment"`
+	RunList         []string `mapstructure:"run_list"`
+	// RunListMode is either "merge" (the default), which adds the run list
+	// to whatever the node already has, or "replace".
+	RunListMode string `mapstructure:"run_list_mode"`
+	// PolicyName and PolicyGroup put the node on a Policyfile instead of
+	// a run list. They can't be used with run_list or environment.
+	PolicyName  string `mapstructure:"policy_name"`
+	PolicyGroup string `mapstructure:"policy_group"`
+	// Attributes are set as normal attributes on the node.
+	Attributes map[string]interface{} `mapstructure:"attributes"`
+}
+
+// Ansible is how the ansible config manager configures hosts: by running
+// a playbook against an inventory of the hosts once they're built.
+type Ansible struct {
+	// Playbook is the path to the playbook to run.
+	Playbook string `mapstructure:"playbook"`
+	// Groups are the inventory groups the hosts are put in, so the
+	// playbook can target them.
+	Groups []string `mapstructure:"groups"`
+	// ExtraVars are passed to ansible-playbook with --extra-vars.
+	ExtraVars map[string]interface{} `mapstructure:"extra_vars"`
+}
+
+// Puppet is how the puppet config manager configures hosts. Foreman is
+// their ENC, so the environment and classes are set on the Foreman host,
+// and overseer gets their certificates signed by the Puppet CA so the
+// first agent run goes through.
+type Puppet struct {
+	Environment string   `mapstructure:"environment"`
+	Classes     []string `mapstructure:"classes"`
+	// Signing is how a new host's certificate gets signed: "csr" (the
+	// default) waits for the agent's certificate request and signs it
+	// through the CA's API, and "autosign" adds an autosign entry for the
+	// host before it's built so the CA signs the request itself.
+	Signing string `mapstructure:"signing"`
+	// OnConflict is what to do when the CA already has a certificate for
+	// a host being provisioned, as it does when a hostname is reused:
+	// "keep", "replace" (the default) cleans it so the new host can get
+	// its own, and "fail" refuses to provision the host.
+	OnConflict string `mapstructure:"on_conflict"`
+	// ConvergeTimeout is the number of seconds to wait for a host's first
+	// puppet agent run to report to Foreman. Zero means the default of 30
+	// minutes.
+	ConvergeTimeout int `mapstructure:"converge_timeout"`
+}
+
+const (
+	SigningCSR      = "csr"
+	SigningAutosign = "autosign"
+)
+
+// UsesPolicy reports whether the node is managed by a Policyfile rather
+// than a run list.
+func (c *Chef) UsesPolicy() bool {
+	return c.PolicyName != "" || c.PolicyGroup != ""
 }
 
+const (
+	RunListMerge   = "merge"
+	RunListReplace = "replace"
+)
+
+const (
+	ConflictKeep    = "keep"
+	ConflictReplace = "replace"
+	ConflictFail    = "fail"
+)
+
 type Vsphere struct {
 	CPUs       int     `mapstructure:"cpus"`
 	Cores      int     `mapstructure:"cores"`
@@ -55,11 +162,132 @@ type Vsphere struct {
 	Devices    Devices `mapstructure:"device"`
 }
 
+// Libvirt is the hardware of hosts built by the libvirt compute provider.
+type Libvirt struct {
+	// URI is the libvirt connection to create domains on. It defaults to
+	// qemu:///system.
+	URI    string `mapstructure:"uri"`
+	CPUs   int    `mapstructure:"cpus"`
+	Memory int    `mapstructure:"memory"`
+	// Pool is the storage pool disk volumes are created in, unless a disk
+	// says otherwise. It defaults to "default".
+	Pool    string         `mapstructure:"pool"`
+	Devices LibvirtDevices `mapstructure:"device"`
+}
+
+type LibvirtDevices struct {
+	Disks    []*LibvirtDisk    `mapstructure:"disk"`
+	Networks []*LibvirtNetwork `mapstructure:"network"`
+}
+
+// LibvirtDisk is a qcow2 volume attached to the domain.
+type LibvirtDisk struct {
+	DeviceName string
+	DeviceType string
+	Size       int    `mapstructure:"size"`
+	Pool       string `mapstructure:"pool"`
+	// Image is a volume in the same pool to use as the disk's backing
+	// file, so the host starts as a copy of it rather than empty.
+	Image string `mapstructure:"image"`
+}
+
+// LibvirtNetwork is a network interface, plugged into either a host bridge
+// or a libvirt network.
+type LibvirtNetwork struct {
+	DeviceName string
+	DeviceType string
+	Bridge     string `mapstructure:"bridge"`
+	Network    string `mapstructure:"network"`
+	// Model is the emulated network card. It defaults to "virtio".
+	Model string `mapstructure:"model"`
+}
+
+// CloudInit is the cloud-init seed handed to hosts built from an image.
+type CloudInit struct {
+	// Delivery is how the seed gets to the host: "iso" (the default), a
+	// NoCloud ISO attached to it, or "guestinfo", vSphere guestinfo
+	// properties.
+	Delivery string `mapstructure:"delivery"`
+	// Interface is the network interface the host's address goes on. It
+	// defaults to "eth0".
+	Interface string `mapstructure:"interface"`
+	// DHCP leaves the interface to DHCP instead of giving it the address
+	// IPAM has for the host, Prefix, Gateway, Nameservers and Search.
+	DHCP        bool     `mapstructure:"dhcp"`
+	Prefix      int      `mapstructure:"prefix"`
+	Gateway     string   `mapstructure:"gateway"`
+	Nameservers []string `mapstructure:"nameservers"`
+	Search      []string `mapstructure:"search"`
+	// SSHAuthorizedKeys are added to the image's default user.
+	SSHAuthorizedKeys []string `mapstructure:"ssh_authorized_keys"`
+	// ChefBootstrap has cloud-init install chef-client and register the
+	// host on first boot, instead of overseer bootstrapping it over SSH.
+	ChefBootstrap bool `mapstructure:"chef_bootstrap"`
+	// UserData is a text/template for the user-data, replacing the
+	// cloud-config overseer writes by default.
+	UserData string `mapstructure:"user_data"`
+}
+
+const (
+	DeliveryISO       = "iso"
+	DeliveryGuestinfo = "guestinfo"
+)
+
 type Infoblox struct {
 	Subnet string `mapstructure:"subnet"`
 	Zone   string `mapstructure:"zone"`
 }
 
+// Verify holds the checks run against each host once Chef has converged.
+// A host only counts as provisioned when every check passes.
+type Verify struct {
+	// Retries is how many more times failing checks are tried before
+	// giving up, waiting RetryInterval seconds (10 by default) in between.
+	Retries       int      `mapstructure:"retries"`
+	RetryInterval int      `mapstructure:"retry_interval"`
+	Checks        []*Check `mapstructure:"check"`
+}
+
+// Check is a single verify check. Which fields it uses depends on its type.
+type Check struct {
+	Name string
+	Type string
+	// Host is what the check connects to or, for dns_resolves, the name
+	// looked up. It defaults to the host being provisioned.
+	Host string `mapstructure:"host"`
+	// Timeout is the number of seconds the check gets. Zero means the
+	// default of 10 seconds.
+	Timeout int `mapstructure:"timeout"`
+
+	// tcp_port and http_get
+	Port int `mapstructure:"port"`
+
+	// http_get
+	Scheme string `mapstructure:"scheme"`
+	Path   string `mapstructure:"path"`
+	Status int    `mapstructure:"status"`
+	// Body is a regular expression the response body must match.
+	Body string `mapstructure:"body"`
+
+	// command
+	Command  string `mapstructure:"command"`
+	ExitCode int    `mapstructure:"exit_code"`
+	// Output is a regular expression the command's output must match,
+	// with ^ and $ matching at the start and end of each line.
+	Output string `mapstructure:"output"`
+
+	// dns_resolves
+	// Address, if set, must be among the addresses the name resolves to.
+	Address string `mapstructure:"address"`
+}
+
+const (
+	CheckTCPPort     = "tcp_port"
+	CheckHTTPGet     = "http_get"
+	CheckCommand     = "command"
+	CheckDNSResolves = "dns_resolves"
+)
+
 type Devices struct {
 	Disks    []*Disk    `mapstructure:"disk"`
 	Networks []*Network `mapstructure:"network"`
@@ -93,7 +321,11 @@ func ParseDir(path, spec string) (*Spec, error) {
 	}
 
 	for _, file := range files {
-		buildspec, err := ParseFile(file.Name())
+		if file.IsDir() {
+			continue
+		}
+
+		buildspec, err := ParseFile(filepath.Join(path, file.Name()))
 		if err != nil {
 			return nil, err
 		}
@@ -105,7 +337,21 @@ func ParseDir(path, spec string) (*Spec, error) {
 		}
 	}
 
-	return nil, nil
+	return nil, fmt.Errorf("buildspec %q not found in %s", spec, path)
+}
+
+// CheckProfile returns an error if the buildspec requires a configspec
+// profile other than the one selected.
+func (s *Spec) CheckProfile(profile string) error {
+	if s.Profile == "" || s.Profile == profile {
+		return nil
+	}
+
+	if profile == "" {
+		return fmt.Errorf("buildspec %q requires profile %q but no profile was selected", s.Name, s.Profile)
+	}
+
+	return fmt.Errorf("buildspec %q requires profile %q but profile %q was selected", s.Name, s.Profile, profile)
 }
 
 // ParseFile parses the given buildspec file.
@@ -188,10 +434,21 @@ func parseSpec(result *Spec, list *ast.ObjectList) error {
 	}
 
 	valid := []string{
+		"profile",
+		"compute",
+		"ipam",
+		"dns",
+		"config",
+		"build_timeout",
 		"foreman",
 		"chef",
+		"ansible",
+		"puppet",
 		"vsphere",
+		"libvirt",
 		"infoblox",
+		"verify",
+		"cloud_init",
 	}
 	if err := checkHCLKeys(listVal, valid); err != nil {
 		return multierror.Prefix(err, "spec ->")
@@ -204,13 +461,21 @@ func parseSpec(result *Spec, list *ast.ObjectList) error {
 
 	delete(m, "foreman")
 	delete(m, "chef")
+	delete(m, "ansible")
+	delete(m, "puppet")
 	delete(m, "vsphere")
+	delete(m, "libvirt")
 	delete(m, "infoblox")
+	delete(m, "verify")
+	delete(m, "cloud_init")
 
 	var spec Spec
 	if err := mapstructure.WeakDecode(m, &spec); err != nil {
 		return err
 	}
+	if spec.BuildTimeout < 0 {
+		return fmt.Errorf("build_timeout must not be negative, got %d", spec.BuildTimeout)
+	}
 
 	// Parse out foreman fields
 	if o := listVal.Filter("foreman"); len(o.Items) > 0 {
@@ -226,6 +491,20 @@ func parseSpec(result *Spec, list *ast.ObjectList) error {
 		}
 	}
 
+	// Parse out ansible fields
+	if o := listVal.Filter("ansible"); len(o.Items) > 0 {
+		if err := parseAnsible(&spec.Ansible, o); err != nil {
+			return multierror.Prefix(err, "ansible ->")
+		}
+	}
+
+	// Parse out puppet fields
+	if o := listVal.Filter("puppet"); len(o.Items) > 0 {
+		if err := parsePuppet(&spec.Puppet, o); err != nil {
+			return multierror.Prefix(err, "puppet ->")
+		}
+	}
+
 	// Parse out vsphere fields
 	if o := listVal.Filter("vsphere"); len(o.Items) > 0 {
 		if err := parseVsphere(&spec.Vsphere, o); err != nil {
@@ -233,6 +512,13 @@ func parseSpec(result *Spec, list *ast.ObjectList) error {
 		}
 	}
 
+	// Parse out libvirt fields
+	if o := listVal.Filter("libvirt"); len(o.Items) > 0 {
+		if err := parseLibvirt(&spec.Libvirt, o); err != nil {
+			return multierror.Prefix(err, "libvirt ->")
+		}
+	}
+
 	// Parse out infoblox fields
 	if o := listVal.Filter("infoblox"); len(o.Items) > 0 {
 		if err := parseInfoblox(&spec.Infoblox, o); err != nil {
@@ -240,6 +526,24 @@ func parseSpec(result *Spec, list *ast.ObjectList) error {
 		}
 	}
 
+	// Parse out verify checks
+	if o := listVal.Filter("verify"); len(o.Items) > 0 {
+		if err := parseVerify(&spec.Verify, o); err != nil {
+			return multierror.Prefix(err, "verify ->")
+		}
+	}
+
+	// Parse out cloud-init settings
+	if o := listVal.Filter("cloud_init"); len(o.Items) > 0 {
+		spec.CloudInit = new(CloudInit)
+		if err := parseCloudInit(spec.CloudInit, o); err != nil {
+			return multierror.Prefix(err, "cloud_init ->")
+		}
+		if err := checkCloudInitCompute(spec.CloudInit, spec.Compute); err != nil {
+			return multierror.Prefix(err, "cloud_init ->")
+		}
+	}
+
 	*result = spec
 	return nil
 }
@@ -258,6 +562,7 @@ func parseForeman(result *Foreman, list *ast.ObjectList) error {
 		"location",
 		"organization",
 		"environment",
+		"subnet",
 		"compute_profile",
 		"architecture_id",
 		"compute_resource",
@@ -296,8 +601,16 @@ func parseChef(result *Chef, list *ast.ObjectList) error {
 	valid := []string{
 		"server",
 		"validation_key",
+		"validation_client_name",
+		"skip_bootstrap",
+		"on_conflict",
+		"converge_timeout",
 		"environment",
 		"run_list",
+		"run_list_mode",
+		"policy_name",
+		"policy_group",
+		"attributes",
 	}
 	if err := checkHCLKeys(o.Val, valid); err != nil {
 		return err
@@ -308,15 +621,167 @@ func parseChef(result *Chef, list *ast.ObjectList) error {
 		return err
 	}
 
+	attributes := m["attributes"]
+	delete(m, "attributes")
+
 	var chef Chef
 	if err := mapstructure.WeakDecode(m, &chef); err != nil {
 		return err
 	}
 
+	switch chef.RunListMode {
+	case "":
+		chef.RunListMode = RunListMerge
+	case RunListMerge, RunListReplace:
+	default:
+		return fmt.Errorf("run_list_mode must be %q or %q, got %q", RunListMerge, RunListReplace, chef.RunListMode)
+	}
+
+	switch chef.OnConflict {
+	case "":
+		chef.OnConflict = ConflictReplace
+	case ConflictKeep, ConflictReplace, ConflictFail:
+	default:
+		return fmt.Errorf("on_conflict must be %q, %q or %q, got %q", ConflictKeep, ConflictReplace, ConflictFail, chef.OnConflict)
+	}
+
+	if chef.UsesPolicy() {
+		var errs error
+		if chef.PolicyName == "" || chef.PolicyGroup == "" {
+			errs = multierror.Append(errs, fmt.Errorf("policy_name and policy_group must be set together"))
+		}
+		if len(chef.RunList) > 0 {
+			errs = multierror.Append(errs, fmt.Errorf("run_list can't be used with policy_name and policy_group"))
+		}
+		if chef.Environment != "" {
+			errs = multierror.Append(errs, fmt.Errorf("environment can't be used with policy_name and policy_group; the policy group takes its place"))
+		}
+		if errs != nil {
+			return errs
+		}
+	}
+
+	if chef.ConvergeTimeout < 0 {
+		return fmt.Errorf("converge_timeout must not be negative, got %d", chef.ConvergeTimeout)
+	}
+
+	if attributes != nil {
+		attrs, ok := flattenObject(attributes).(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("attributes must be an object")
+		}
+		chef.Attributes = attrs
+	}
+
 	*result = chef
 	return nil
 }
 
+func parseAnsible(result *Ansible, list *ast.ObjectList) error {
+	list = list.Elem()
+	if len(list.Items) > 1 {
+		return fmt.Errorf("only one %q block allowed", "ansible")
+	}
+
+	// Get our "ansible" object
+	o := list.Items[0]
+
+	valid := []string{
+		"playbook",
+		"groups",
+		"extra_vars",
+	}
+	if err := checkHCLKeys(o.Val, valid); err != nil {
+		return err
+	}
+
+	var m map[string]interface{}
+	if err := hcl.DecodeObject(&m, o.Val); err != nil {
+		return err
+	}
+
+	extraVars := m["extra_vars"]
+	delete(m, "extra_vars")
+
+	var ansible Ansible
+	if err := mapstructure.WeakDecode(m, &ansible); err != nil {
+		return err
+	}
+
+	if ansible.Playbook == "" {
+		return fmt.Errorf("playbook must be set")
+	}
+
+	if extraVars != nil {
+		vars, ok := flattenObject(extraVars).(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("extra_vars must be an object")
+		}
+		ansible.ExtraVars = vars
+	}
+
+	*result = ansible
+	return nil
+}
+
+func parsePuppet(result *Puppet, list *ast.ObjectList) error {
+	list = list.Elem()
+	if len(list.Items) > 1 {
+		return fmt.Errorf("only one %q block allowed", "puppet")
+	}
+
+	// Get our "puppet" object
+	o := list.Items[0]
+
+	valid := []string{
+		"environment",
+		"classes",
+		"signing",
+		"on_conflict",
+		"converge_timeout",
+	}
+	if err := checkHCLKeys(o.Val, valid); err != nil {
+		return err
+	}
+
+	var m map[string]interface{}
+	if err := hcl.DecodeObject(&m, o.Val); err != nil {
+		return err
+	}
+
+	var puppet Puppet
+	if err := mapstructure.WeakDecode(m, &puppet); err != nil {
+		return err
+	}
+
+	var errs error
+	switch puppet.Signing {
+	case "":
+		puppet.Signing = SigningCSR
+	case SigningCSR, SigningAutosign:
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("signing must be %q or %q, got %q", SigningCSR, SigningAutosign, puppet.Signing))
+	}
+
+	switch puppet.OnConflict {
+	case "":
+		puppet.OnConflict = ConflictReplace
+	case ConflictKeep, ConflictReplace, ConflictFail:
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("on_conflict must be %q, %q or %q, got %q", ConflictKeep, ConflictReplace, ConflictFail, puppet.OnConflict))
+	}
+
+	if puppet.ConvergeTimeout < 0 {
+		errs = multierror.Append(errs, fmt.Errorf("converge_timeout must not be negative, got %d", puppet.ConvergeTimeout))
+	}
+	if errs != nil {
+		return errs
+	}
+
+	*result = puppet
+	return nil
+}
+
 func parseVsphere(result *Vsphere, list *ast.ObjectList) error {
 	list = list.Elem()
 	if len(list.Items) > 1 {
@@ -369,6 +834,207 @@ func parseVsphere(result *Vsphere, list *ast.ObjectList) error {
 	return nil
 }
 
+func parseLibvirt(result *Libvirt, list *ast.ObjectList) error {
+	list = list.Elem()
+	if len(list.Items) > 1 {
+		return fmt.Errorf("only one %q block allowed", "libvirt")
+	}
+
+	// Get our libvirt object
+	o := list.Items[0]
+
+	var listVal *ast.ObjectList
+	if ot, ok := o.Val.(*ast.ObjectType); ok {
+		listVal = ot.List
+	}
+
+	valid := []string{
+		"uri",
+		"cpus",
+		"memory",
+		"pool",
+		"device",
+	}
+	if err := checkHCLKeys(listVal, valid); err != nil {
+		return err
+	}
+
+	var m map[string]interface{}
+	if err := hcl.DecodeObject(&m, o.Val); err != nil {
+		return err
+	}
+
+	delete(m, "device")
+
+	var libvirt Libvirt
+	if err := mapstructure.WeakDecode(m, &libvirt); err != nil {
+		return err
+	}
+
+	if libvirt.URI == "" {
+		libvirt.URI = "qemu:///system"
+	}
+	if libvirt.Pool == "" {
+		libvirt.Pool = "default"
+	}
+
+	// Parse out device fields
+	if o := listVal.Filter("device"); len(o.Items) > 0 {
+		if err := parseLibvirtDevices(&libvirt, o); err != nil {
+			return multierror.Prefix(err, "device ->")
+		}
+	}
+
+	*result = libvirt
+	return nil
+}
+
+func parseLibvirtDevices(result *Libvirt, list *ast.ObjectList) error {
+	list = list.Children()
+
+	var devices LibvirtDevices
+
+	seen := make(map[string]struct{})
+	for _, item := range list.Items {
+		if len(item.Keys) != 2 {
+			return fmt.Errorf("%q must be followed by exactly two strings: a type and a name", "device")
+		}
+
+		t := item.Keys[0].Token.Value().(string)
+		n := item.Keys[1].Token.Value().(string)
+
+		if _, ok := seen[n]; ok {
+			return fmt.Errorf("key names should be unique: %q is defined more than once", n)
+		}
+		seen[n] = struct{}{}
+
+		var valid []string
+		switch t {
+		case "disk":
+			valid = []string{"size", "pool", "image"}
+		case "network":
+			valid = []string{"bridge", "network", "model"}
+		default:
+			return fmt.Errorf("unknown device type %q; must be %q or %q", t, "disk", "network")
+		}
+		if err := checkHCLKeys(item.Val, valid); err != nil {
+			return multierror.Prefix(err, fmt.Sprintf("%s ->", n))
+		}
+
+		var m map[string]interface{}
+		if err := hcl.DecodeObject(&m, item.Val); err != nil {
+			return err
+		}
+
+		switch t {
+		case "disk":
+			disk := LibvirtDisk{DeviceName: n, DeviceType: t}
+			if err := mapstructure.WeakDecode(m, &disk); err != nil {
+				return err
+			}
+			if disk.Size <= 0 {
+				return fmt.Errorf("%s -> size must be set", n)
+			}
+			if disk.Pool == "" {
+				disk.Pool = result.Pool
+			}
+			devices.Disks = append(devices.Disks, &disk)
+		case "network":
+			network := LibvirtNetwork{DeviceName: n, DeviceType: t}
+			if err := mapstructure.WeakDecode(m, &network); err != nil {
+				return err
+			}
+			if (network.Bridge == "") == (network.Network == "") {
+				return fmt.Errorf("%s -> exactly one of bridge and network must be set", n)
+			}
+			if network.Model == "" {
+				network.Model = "virtio"
+			}
+			devices.Networks = append(devices.Networks, &network)
+		}
+	}
+
+	result.Devices = devices
+	return nil
+}
+
+func parseCloudInit(result *CloudInit, list *ast.ObjectList) error {
+	list = list.Elem()
+	if len(list.Items) > 1 {
+		return fmt.Errorf("only one %q block allowed", "cloud_init")
+	}
+
+	// Get our "cloud_init" object
+	o := list.Items[0]
+
+	valid := []string{
+		"delivery",
+		"interface",
+		"dhcp",
+		"prefix",
+		"gateway",
+		"nameservers",
+		"search",
+		"ssh_authorized_keys",
+		"chef_bootstrap",
+		"user_data",
+	}
+	if err := checkHCLKeys(o.Val, valid); err != nil {
+		return err
+	}
+
+	var m map[string]interface{}
+	if err := hcl.DecodeObject(&m, o.Val); err != nil {
+		return err
+	}
+
+	var cloudInit CloudInit
+	if err := mapstructure.WeakDecode(m, &cloudInit); err != nil {
+		return err
+	}
+
+	var errs error
+	switch cloudInit.Delivery {
+	case "":
+		cloudInit.Delivery = DeliveryISO
+	case DeliveryISO, DeliveryGuestinfo:
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("delivery must be %q or %q, got %q", DeliveryISO, DeliveryGuestinfo, cloudInit.Delivery))
+	}
+	if cloudInit.Interface == "" {
+		cloudInit.Interface = "eth0"
+	}
+	if cloudInit.DHCP {
+		if cloudInit.Prefix != 0 || cloudInit.Gateway != "" || len(cloudInit.Nameservers) > 0 || len(cloudInit.Search) > 0 {
+			errs = multierror.Append(errs, fmt.Errorf("prefix, gateway, nameservers and search can't be used with dhcp"))
+		}
+	} else if cloudInit.Prefix < 1 || cloudInit.Prefix > 32 {
+		errs = multierror.Append(errs, fmt.Errorf("prefix must be between 1 and 32, got %d", cloudInit.Prefix))
+	}
+	if errs != nil {
+		return errs
+	}
+
+	*result = cloudInit
+	return nil
+}
+
+// checkCloudInitCompute makes sure the compute provider can get the seed
+// to hosts the way the cloud_init block delivers it. Only libvirt attaches
+// seed ISOs, and guestinfo is only set on the hosts overseer rebuild
+// reclones through Foreman.
+func checkCloudInitCompute(cloudInit *CloudInit, compute string) error {
+	switch {
+	case cloudInit.Delivery == DeliveryISO && compute != "libvirt":
+		return fmt.Errorf("delivery %q needs compute = %q, the only compute provider that attaches seed ISOs, got %q",
+			DeliveryISO, "libvirt", compute)
+	case cloudInit.Delivery == DeliveryGuestinfo && compute != "" && compute != "foreman":
+		return fmt.Errorf("delivery %q is for hosts overseer rebuild reclones through Foreman, so it needs compute = %q, got %q",
+			DeliveryGuestinfo, "foreman", compute)
+	}
+	return nil
+}
+
 func parseInfoblox(result *Infoblox, list *ast.ObjectList) error {
 	list = list.Elem()
 	if len(list.Items) > 1 {
@@ -528,6 +1194,194 @@ func parseSCSIs(result *[]*SCSI, item *ast.ObjectItem) error {
 	return nil
 }
 
+func parseVerify(result *Verify, list *ast.ObjectList) error {
+	list = list.Elem()
+	if len(list.Items) > 1 {
+		return fmt.Errorf("only one %q block allowed", "verify")
+	}
+
+	// Get our verify object
+	o := list.Items[0]
+
+	var listVal *ast.ObjectList
+	if ot, ok := o.Val.(*ast.ObjectType); ok {
+		listVal = ot.List
+	}
+
+	valid := []string{
+		"retries",
+		"retry_interval",
+		"check",
+	}
+	if err := checkHCLKeys(listVal, valid); err != nil {
+		return err
+	}
+
+	var m map[string]interface{}
+	if err := hcl.DecodeObject(&m, o.Val); err != nil {
+		return err
+	}
+
+	delete(m, "check")
+
+	var verify Verify
+	if err := mapstructure.WeakDecode(m, &verify); err != nil {
+		return err
+	}
+
+	if verify.Retries < 0 {
+		return fmt.Errorf("retries must not be negative, got %d", verify.Retries)
+	}
+	if verify.RetryInterval < 0 {
+		return fmt.Errorf("retry_interval must not be negative, got %d", verify.RetryInterval)
+	}
+
+	// Parse out checks
+	if o := listVal.Filter("check"); len(o.Items) > 0 {
+		if err := parseChecks(&verify.Checks, o); err != nil {
+			return multierror.Prefix(err, "check ->")
+		}
+	}
+
+	*result = verify
+	return nil
+}
+
+func parseChecks(result *[]*Check, list *ast.ObjectList) error {
+	list = list.Children()
+
+	var checks []*Check
+
+	seen := make(map[string]struct{})
+	for _, item := range list.Items {
+		if len(item.Keys) != 2 {
+			return fmt.Errorf("%q must be followed by exactly two strings: a type and a name", "check")
+		}
+
+		t := item.Keys[0].Token.Value().(string)
+		n := item.Keys[1].Token.Value().(string)
+
+		if _, ok := seen[n]; ok {
+			return fmt.Errorf("key names should be unique: %q is defined more than once", n)
+		}
+		seen[n] = struct{}{}
+
+		check, err := parseCheck(t, n, item)
+		if err != nil {
+			return multierror.Prefix(err, fmt.Sprintf("%s ->", n))
+		}
+		checks = append(checks, check)
+	}
+
+	*result = checks
+	return nil
+}
+
+func parseCheck(t, n string, item *ast.ObjectItem) (*Check, error) {
+	var valid []string
+	switch t {
+	case CheckTCPPort:
+		valid = []string{"host", "timeout", "port"}
+	case CheckHTTPGet:
+		valid = []string{"host", "timeout", "port", "scheme", "path", "status", "body"}
+	case CheckCommand:
+		valid = []string{"timeout", "command", "exit_code", "output"}
+	case CheckDNSResolves:
+		valid = []string{"host", "timeout", "address"}
+	default:
+		return nil, fmt.Errorf("unknown check type %q; must be %q, %q, %q or %q", t, CheckTCPPort, CheckHTTPGet, CheckCommand, CheckDNSResolves)
+	}
+	if err := checkHCLKeys(item.Val, valid); err != nil {
+		return nil, err
+	}
+
+	var m map[string]interface{}
+	if err := hcl.DecodeObject(&m, item.Val); err != nil {
+		return nil, err
+	}
+
+	var check Check
+	check.Name = n
+	check.Type = t
+
+	if err := mapstructure.WeakDecode(m, &check); err != nil {
+		return nil, err
+	}
+
+	var errs error
+	if check.Timeout < 0 {
+		errs = multierror.Append(errs, fmt.Errorf("timeout must not be negative, got %d", check.Timeout))
+	}
+
+	switch t {
+	case CheckTCPPort:
+		if check.Port <= 0 || check.Port > 65535 {
+			errs = multierror.Append(errs, fmt.Errorf("port must be between 1 and 65535, got %d", check.Port))
+		}
+	case CheckHTTPGet:
+		switch check.Scheme {
+		case "":
+			check.Scheme = "http"
+		case "http", "https":
+		default:
+			errs = multierror.Append(errs, fmt.Errorf("scheme must be %q or %q, got %q", "http", "https", check.Scheme))
+		}
+		if check.Port < 0 || check.Port > 65535 {
+			errs = multierror.Append(errs, fmt.Errorf("port must be between 1 and 65535, got %d", check.Port))
+		}
+		if check.Path == "" {
+			check.Path = "/"
+		}
+		if check.Status == 0 {
+			check.Status = 200
+		}
+		if _, err := regexp.Compile(check.Body); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("body isn't a valid regular expression: %s", err))
+		}
+	case CheckCommand:
+		if check.Command == "" {
+			errs = multierror.Append(errs, fmt.Errorf("command must be set"))
+		}
+		if _, err := regexp.Compile(check.Output); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("output isn't a valid regular expression: %s", err))
+		}
+	}
+	if errs != nil {
+		return nil, errs
+	}
+
+	return &check, nil
+}
+
+// flattenObject undoes HCL's habit of decoding every nested object into a
+// list of maps, so attributes come out shaped the way Chef expects them.
+func flattenObject(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []map[string]interface{}:
+		result := make(map[string]interface{})
+		for _, m := range v {
+			for k, val := range m {
+				result[k] = flattenObject(val)
+			}
+		}
+		return result
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			result[k] = flattenObject(val)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, val := range v {
+			result[i] = flattenObject(val)
+		}
+		return result
+	}
+
+	return v
+}
+
 func checkHCLKeys(node ast.Node, valid []string) error {
 	var list *ast.ObjectList
 	switch n := node.(type) {
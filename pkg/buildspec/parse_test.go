@@ -146,6 +146,7 @@ func TestParse(t *testing.T) {
 					OperatingSystemID: 2,
 					PartitionTableID:  6,
 					Medium:            "centos-7",
+					Subnet:            "qa-appservers",
 				},
 			},
 			false,
@@ -197,6 +198,8 @@ func TestParse(t *testing.T) {
 						"role[role01]",
 						"role[role02]",
 					},
+					RunListMode: RunListMerge,
+					OnConflict:  ConflictReplace,
 				},
 			},
 			false,
@@ -311,6 +314,8 @@ func TestParse(t *testing.T) {
 						"role[role01]",
 						"role[role02]",
 					},
+					RunListMode: RunListMerge,
+					OnConflict:  ConflictReplace,
 				},
 			},
 			false,
@@ -392,6 +397,8 @@ func TestParse(t *testing.T) {
 						"role[role01]",
 						"role[role02]",
 					},
+					RunListMode: RunListMerge,
+					OnConflict:  ConflictReplace,
 				},
 			},
 			false,
@@ -401,6 +408,313 @@ func TestParse(t *testing.T) {
 			nil,
 			true,
 		},
+		{
+			"chef-attributes.hcl",
+			&Spec{
+				Name: "default",
+				Chef: Chef{
+					Environment: "qa",
+					RunList: []string{
+						"role[kafka]",
+					},
+					RunListMode: RunListReplace,
+					OnConflict:  ConflictReplace,
+					Attributes: map[string]interface{}{
+						"kafka": map[string]interface{}{
+							"heap":    "4g",
+							"brokers": []interface{}{"kafka01", "kafka02"},
+						},
+						"datadog": true,
+					},
+				},
+			},
+			false,
+		},
+		{
+			"chef-bootstrap.hcl",
+			&Spec{
+				Name: "default",
+				Chef: Chef{
+					Server:               "https://chef.qa.local/organizations/qa",
+					ValidationKey:        "~/.chef/qa-validator.pem",
+					ValidationClientName: "qa-validator",
+					SkipBootstrap:        true,
+					OnConflict:           ConflictReplace,
+					ConvergeTimeout:      3600,
+					RunList: []string{
+						"role[role01]",
+					},
+					RunListMode: RunListMerge,
+				},
+			},
+			false,
+		},
+		{
+			"chef-policy.hcl",
+			&Spec{
+				Name: "default",
+				Chef: Chef{
+					PolicyName:  "kafka",
+					PolicyGroup: "qa",
+					RunListMode: RunListMerge,
+					OnConflict:  ConflictReplace,
+				},
+			},
+			false,
+		},
+		{
+			"bad-policy-with-run-list.hcl",
+			nil,
+			true,
+		},
+		{
+			"bad-policy-without-group.hcl",
+			nil,
+			true,
+		},
+		{
+			"bad-on-conflict.hcl",
+			nil,
+			true,
+		},
+		{
+			"bad-run-list-mode.hcl",
+			nil,
+			true,
+		},
+		{
+			"verify.hcl",
+			&Spec{
+				Name: "default",
+				Verify: Verify{
+					Retries:       3,
+					RetryInterval: 20,
+					Checks: []*Check{
+						{
+							Name: "kafka listening",
+							Type: CheckTCPPort,
+							Port: 9092,
+						},
+						{
+							Name:    "jolokia",
+							Type:    CheckHTTPGet,
+							Port:    8778,
+							Scheme:  "http",
+							Path:    "/jolokia/version",
+							Status:  200,
+							Body:    `"agent":"1\.`,
+							Timeout: 5,
+						},
+						{
+							Name:    "kafka running",
+							Type:    CheckCommand,
+							Command: "systemctl is-active kafka",
+							Output:  "^active",
+						},
+						{
+							Name:    "registered",
+							Type:    CheckDNSResolves,
+							Host:    "kafka.qa.local",
+							Address: "10.0.0.10",
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"bad-check-type.hcl",
+			nil,
+			true,
+		},
+		{
+			"bad-check-regex.hcl",
+			nil,
+			true,
+		},
+		{
+			"providers.hcl",
+			&Spec{
+				Name:    "indy.prod.kafka",
+				Compute: "foreman",
+				IPAM:    "foreman",
+				DNS:     "none",
+				Config:  "chef",
+				Chef: Chef{
+					Environment: "prod",
+					RunListMode: RunListMerge,
+					OnConflict:  ConflictReplace,
+				},
+			},
+			false,
+		},
+		{
+			"libvirt.hcl",
+			&Spec{
+				Name:    "lab.kafka",
+				Compute: "libvirt",
+				Libvirt: Libvirt{
+					URI:    "qemu+ssh://kvm01.lab.local/system",
+					CPUs:   4,
+					Memory: 8192,
+					Pool:   "default",
+					Devices: LibvirtDevices{
+						Disks: []*LibvirtDisk{
+							{
+								DeviceName: "root",
+								DeviceType: "disk",
+								Size:       40,
+								Pool:       "default",
+								Image:      "centos7-base.qcow2",
+							},
+							{
+								DeviceName: "data",
+								DeviceType: "disk",
+								Size:       200,
+								Pool:       "fast",
+							},
+						},
+						Networks: []*LibvirtNetwork{
+							{
+								DeviceName: "eth0",
+								DeviceType: "network",
+								Bridge:     "br0",
+								Model:      "virtio",
+							},
+							{
+								DeviceName: "eth1",
+								DeviceType: "network",
+								Network:    "backup",
+								Model:      "e1000",
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"bad-libvirt-network.hcl",
+			nil,
+			true,
+		},
+		{
+			"bad-libvirt-device.hcl",
+			nil,
+			true,
+		},
+		{
+			"cloud-init.hcl",
+			&Spec{
+				Name:    "lab.kafka",
+				Compute: "libvirt",
+				CloudInit: &CloudInit{
+					Delivery:          DeliveryISO,
+					Interface:         "eth0",
+					Prefix:            24,
+					Gateway:           "10.20.0.1",
+					Nameservers:       []string{"10.20.0.2", "10.20.0.3"},
+					Search:            []string{"lab.local"},
+					SSHAuthorizedKeys: []string{"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIHVzCk7yV4d ops@lab.local"},
+					ChefBootstrap:     true,
+					UserData:          "#cloud-config\nhostname: {{ .Hostname }}\n",
+				},
+			},
+			false,
+		},
+		{
+			"bad-cloud-init.hcl",
+			nil,
+			true,
+		},
+		{
+			"bad-cloud-init-compute.hcl",
+			nil,
+			true,
+		},
+		{
+			"bad-cloud-init-guestinfo.hcl",
+			nil,
+			true,
+		},
+		{
+			"ansible.hcl",
+			&Spec{
+				Name:   "lab.kafka",
+				Config: "ansible",
+				Ansible: Ansible{
+					Playbook: "playbooks/kafka.yml",
+					Groups:   []string{"kafka", "lab"},
+					ExtraVars: map[string]interface{}{
+						"kafka_version": "2.8.1",
+						"kafka": map[string]interface{}{
+							"heap": "4g",
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"bad-ansible.hcl",
+			nil,
+			true,
+		},
+		{
+			"puppet.hcl",
+			&Spec{
+				Name:   "lab.kafka",
+				Config: "puppet",
+				Foreman: Foreman{
+					Hostgroup: "base/kafka",
+				},
+				Puppet: Puppet{
+					Environment:     "production",
+					Classes:         []string{"profile::base", "profile::kafka"},
+					Signing:         SigningAutosign,
+					OnConflict:      ConflictReplace,
+					ConvergeTimeout: 3600,
+				},
+			},
+			false,
+		},
+		{
+			"bad-puppet.hcl",
+			nil,
+			true,
+		},
+		{
+			"profile.hcl",
+			&Spec{
+				Name:    "indy.prod.kafka",
+				Profile: "indy-prod",
+				Chef: Chef{
+					Environment: "prod",
+					RunList: []string{
+						"role[kafka]",
+					},
+					RunListMode: RunListMerge,
+					OnConflict:  ConflictReplace,
+				},
+			},
+			false,
+		},
+		{
+			"build-timeout.hcl",
+			&Spec{
+				Name:         "indy.prod.kafka",
+				BuildTimeout: 5400,
+				Foreman: Foreman{
+					Hostgroup: "base/kafka",
+				},
+			},
+			false,
+		},
+		{
+			"bad-build-timeout.hcl",
+			nil,
+			true,
+		},
 	}
 
 	for _, tt := range cases {
@@ -423,3 +737,26 @@ func TestParse(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckProfile(t *testing.T) {
+	cases := []struct {
+		Required string
+		Selected string
+		Err      bool
+	}{
+		{"", "", false},
+		{"", "indy-qa", false},
+		{"indy-prod", "indy-prod", false},
+		{"indy-prod", "indy-qa", true},
+		{"indy-prod", "", true},
+	}
+
+	for _, tt := range cases {
+		spec := &Spec{Name: "indy.prod.kafka", Profile: tt.Required}
+
+		err := spec.CheckProfile(tt.Selected)
+		if (err != nil) != tt.Err {
+			t.Fatalf("required: %q, selected: %q\n\n%s", tt.Required, tt.Selected, err)
+		}
+	}
+}
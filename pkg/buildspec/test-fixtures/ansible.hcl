@@ -0,0 +1,15 @@
+spec "lab.kafka" {
+    config = "ansible"
+
+    ansible {
+        playbook = "playbooks/kafka.yml"
+        groups = ["kafka", "lab"]
+
+        extra_vars {
+            kafka_version = "2.8.1"
+            kafka {
+                heap = "4g"
+            }
+        }
+    }
+}
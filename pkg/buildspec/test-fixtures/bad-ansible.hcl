@@ -0,0 +1,7 @@
+spec "lab.kafka" {
+    config = "ansible"
+
+    ansible {
+        groups = ["kafka"]
+    }
+}
@@ -0,0 +1,3 @@
+spec "indy.prod.kafka" {
+    build_timeout = -1
+}
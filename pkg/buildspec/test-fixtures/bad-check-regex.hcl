@@ -0,0 +1,8 @@
+spec "default" {
+    verify {
+        check "command" "kafka running" {
+            command = "systemctl is-active kafka"
+            output = "(active"
+        }
+    }
+}
@@ -0,0 +1,7 @@
+spec "default" {
+    verify {
+        check "udp_port" "syslog" {
+            port = 514
+        }
+    }
+}
@@ -0,0 +1,7 @@
+spec "lab.kafka" {
+    compute = "foreman"
+
+    cloud_init {
+        prefix = 24
+    }
+}
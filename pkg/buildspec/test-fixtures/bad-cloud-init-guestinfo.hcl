@@ -0,0 +1,8 @@
+spec "lab.kafka" {
+    compute = "libvirt"
+
+    cloud_init {
+        delivery = "guestinfo"
+        dhcp = true
+    }
+}
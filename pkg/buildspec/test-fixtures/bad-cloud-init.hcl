@@ -0,0 +1,7 @@
+spec "lab.kafka" {
+    cloud_init {
+        delivery = "floppy"
+        dhcp = true
+        gateway = "10.20.0.1"
+    }
+}
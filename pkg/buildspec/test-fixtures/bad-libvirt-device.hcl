@@ -0,0 +1,10 @@
+spec "lab.kafka" {
+    libvirt {
+        cpus = 2
+        memory = 4096
+
+        device "scsi" "SCSI controller 1" {
+            type = "paravirtual"
+        }
+    }
+}
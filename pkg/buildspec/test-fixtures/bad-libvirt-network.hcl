@@ -0,0 +1,11 @@
+spec "lab.kafka" {
+    libvirt {
+        cpus = 2
+        memory = 4096
+
+        device "network" "eth0" {
+            bridge = "br0"
+            network = "default"
+        }
+    }
+}
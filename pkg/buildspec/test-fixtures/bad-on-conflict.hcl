@@ -0,0 +1,8 @@
+spec "default" {
+    chef {
+        run_list = [
+            "role[kafka]"
+        ]
+        on_conflict = "overwrite"
+    }
+}
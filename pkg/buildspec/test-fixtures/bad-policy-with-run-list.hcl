@@ -0,0 +1,9 @@
+spec "default" {
+    chef {
+        policy_name = "kafka"
+        policy_group = "qa"
+        run_list = [
+            "role[kafka]"
+        ]
+    }
+}
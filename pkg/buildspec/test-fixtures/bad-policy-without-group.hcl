@@ -0,0 +1,5 @@
+spec "default" {
+    chef {
+        policy_name = "kafka"
+    }
+}
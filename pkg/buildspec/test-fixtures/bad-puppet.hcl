@@ -0,0 +1,8 @@
+spec "lab.kafka" {
+    config = "puppet"
+
+    puppet {
+        environment = "production"
+        signing = "policy"
+    }
+}
@@ -0,0 +1,7 @@
+spec "indy.prod.kafka" {
+    build_timeout = 5400
+
+    foreman {
+        hostgroup = "base/kafka"
+    }
+}
@@ -0,0 +1,17 @@
+spec "default" {
+    chef {
+        environment = "qa"
+        run_list = [
+            "role[kafka]"
+        ]
+        run_list_mode = "replace"
+
+        attributes {
+            kafka {
+                heap = "4g"
+                brokers = ["kafka01", "kafka02"]
+            }
+            datadog = true
+        }
+    }
+}
@@ -0,0 +1,13 @@
+spec "default" {
+    chef {
+        server = "https://chef.qa.local/organizations/qa"
+        validation_key = "~/.chef/qa-validator.pem"
+        validation_client_name = "qa-validator"
+        skip_bootstrap = true
+        on_conflict = "replace"
+        converge_timeout = 3600
+        run_list = [
+            "role[role01]"
+        ]
+    }
+}
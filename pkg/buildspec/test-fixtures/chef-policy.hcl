@@ -0,0 +1,6 @@
+spec "default" {
+    chef {
+        policy_name = "kafka"
+        policy_group = "qa"
+    }
+}
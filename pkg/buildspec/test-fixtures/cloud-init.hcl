@@ -0,0 +1,16 @@
+spec "lab.kafka" {
+    compute = "libvirt"
+
+    cloud_init {
+        prefix = 24
+        gateway = "10.20.0.1"
+        nameservers = ["10.20.0.2", "10.20.0.3"]
+        search = ["lab.local"]
+        ssh_authorized_keys = ["ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIHVzCk7yV4d ops@lab.local"]
+        chef_bootstrap = true
+        user_data = <<EOF
+#cloud-config
+hostname: {{ .Hostname }}
+EOF
+    }
+}
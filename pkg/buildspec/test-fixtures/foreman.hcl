@@ -36,5 +36,6 @@ spec "default" {
         operating_system_id = 2
         partition_table_id = 6
         medium = "centos-7"
+        subnet = "qa-appservers"
     }
 }
@@ -0,0 +1,28 @@
+spec "lab.kafka" {
+    compute = "libvirt"
+
+    libvirt {
+        uri = "qemu+ssh://kvm01.lab.local/system"
+        cpus = 4
+        memory = 8192
+
+        device "disk" "root" {
+            size = 40
+            image = "centos7-base.qcow2"
+        }
+
+        device "disk" "data" {
+            size = 200
+            pool = "fast"
+        }
+
+        device "network" "eth0" {
+            bridge = "br0"
+        }
+
+        device "network" "eth1" {
+            network = "backup"
+            model = "e1000"
+        }
+    }
+}
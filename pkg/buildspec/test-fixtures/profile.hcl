@@ -0,0 +1,10 @@
+spec "indy.prod.kafka" {
+    profile = "indy-prod"
+
+    chef {
+        environment = "prod"
+        run_list = [
+            "role[kafka]"
+        ]
+    }
+}
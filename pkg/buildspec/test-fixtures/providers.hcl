@@ -0,0 +1,10 @@
+spec "indy.prod.kafka" {
+    compute = "foreman"
+    ipam = "foreman"
+    dns = "none"
+    config = "chef"
+
+    chef {
+        environment = "prod"
+    }
+}
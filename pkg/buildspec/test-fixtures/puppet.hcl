@@ -0,0 +1,14 @@
+spec "lab.kafka" {
+    config = "puppet"
+
+    foreman {
+        hostgroup = "base/kafka"
+    }
+
+    puppet {
+        environment = "production"
+        classes = ["profile::base", "profile::kafka"]
+        signing = "autosign"
+        converge_timeout = 3600
+    }
+}
@@ -0,0 +1,27 @@
+spec "default" {
+    verify {
+        retries = 3
+        retry_interval = 20
+
+        check "tcp_port" "kafka listening" {
+            port = 9092
+        }
+
+        check "http_get" "jolokia" {
+            port = 8778
+            path = "/jolokia/version"
+            body = "\"agent\":\"1\\."
+            timeout = 5
+        }
+
+        check "command" "kafka running" {
+            command = "systemctl is-active kafka"
+            output = "^active"
+        }
+
+        check "dns_resolves" "registered" {
+            host = "kafka.qa.local"
+            address = "10.0.0.10"
+        }
+    }
+}
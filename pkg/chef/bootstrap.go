@@ -0,0 +1,378 @@
+package chef
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/go-chef/chef"
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/ssh"
+	"github.com/iamthemuffinman/overseer/pkg/util"
+)
+
+// InstallURL is the omnitruck script used to install chef-client on hosts
+// that don't already have it.
+const InstallURL = "https://omnitruck.chef.io/install.sh"
+
+const (
+	configDir      = "/etc/chef"
+	clientKeyPath  = configDir + "/client.pem"
+	validationPath = configDir + "/validation.pem"
+	firstBootPath  = configDir + "/first-boot.json"
+	trustedCAPath  = configDir + "/trusted_certs/overseer-ca.crt"
+)
+
+// Remote runs commands on a host. *ssh.Client satisfies it.
+type Remote interface {
+	Run(cmd string, stdin io.Reader, stdout, stderr io.Writer) error
+	Close() error
+}
+
+// Bootstrapper does what "knife bootstrap" does for freshly built hosts:
+// installs chef-client, registers the host with the Chef server, writes
+// client.rb and runs chef-client for the first time.
+//
+// With a validation key the host registers itself on its first run.
+// Without one the client is created up front using the configspec's
+// client key, and the node is created with the new client's key so the
+// client owns it.
+type Bootstrapper struct {
+	// Dial connects to the host being bootstrapped.
+	Dial func(host string) (Remote, error)
+
+	// Output, if set, returns where the output of a host's chef-client
+	// run should go.
+	Output func(host string) io.Writer
+
+	spec                 buildspec.Chef
+	endpoint             configspec.Endpoint
+	admin                *chef.Client
+	validationKey        []byte
+	validationClientName string
+}
+
+// NewBootstrapper returns a Bootstrapper that points hosts at the
+// buildspec's Chef server (or the configspec's when the buildspec doesn't
+// name one) and logs in to them over SSH.
+func NewBootstrapper(spec buildspec.Chef, cspec configspec.Chef, sshConfig configspec.SSH) (*Bootstrapper, error) {
+	endpoint := ServerEndpoint(spec, cspec)
+
+	b := &Bootstrapper{
+		Dial: func(host string) (Remote, error) {
+			client, err := ssh.Dial(host, sshConfig)
+			if err != nil {
+				return nil, err
+			}
+			return client, nil
+		},
+		spec:                 spec,
+		endpoint:             endpoint,
+		validationClientName: spec.ValidationClientName,
+	}
+
+	validationKey := spec.ValidationKey
+	if validationKey == "" {
+		validationKey = cspec.ValidationKey
+	}
+
+	if validationKey != "" {
+		key, err := ReadKey(validationKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read validation key: %s", err)
+		}
+		b.validationKey = []byte(key)
+
+		if b.validationClientName == "" {
+			b.validationClientName = defaultValidationClientName(endpoint.URL)
+		}
+
+		return b, nil
+	}
+
+	key, err := ReadKey(cspec.ClientKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read client key: %s", err)
+	}
+
+	b.admin, err = NewClient(cspec.Username, key, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// defaultValidationClientName guesses the validator's name the same way
+// the Chef server names it: after the organization in the server URL.
+func defaultValidationClientName(serverURL string) string {
+	u, err := url.Parse(serverURL)
+	if err == nil {
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(parts) >= 2 && parts[0] == "organizations" {
+			return parts[1] + "-validator"
+		}
+	}
+	return "chef-validator"
+}
+
+// Bootstrap installs chef-client on the host, registers it and runs
+// chef-client for the first time. It returns an error if any of that,
+// including the chef-client run, fails.
+func (b *Bootstrapper) Bootstrap(host string) error {
+	r, err := b.Dial(host)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	install := fmt.Sprintf("command -v chef-client >/dev/null 2>&1 || curl -fsSL %s | sh", InstallURL)
+	if err := run(r, install, nil, nil); err != nil {
+		return fmt.Errorf("unable to install chef-client on %s: %s", host, err)
+	}
+
+	if err := run(r, "mkdir -p "+configDir, nil, nil); err != nil {
+		return fmt.Errorf("unable to create %s on %s: %s", configDir, host, err)
+	}
+
+	if b.endpoint.CAFile != "" {
+		ca, err := readFile(b.endpoint.CAFile)
+		if err != nil {
+			return fmt.Errorf("unable to read ca_file: %s", err)
+		}
+		if err := upload(r, trustedCAPath, 0644, ca); err != nil {
+			return fmt.Errorf("unable to copy ca_file to %s: %s", host, err)
+		}
+	}
+
+	chefClient := "chef-client"
+
+	if b.validationKey != nil {
+		if err := upload(r, validationPath, 0600, b.validationKey); err != nil {
+			return fmt.Errorf("unable to copy validation key to %s: %s", host, err)
+		}
+		// Don't leave the validation key lying around once the host has
+		// its own, or if registering didn't work out
+		defer run(r, "rm -f "+validationPath, nil, nil)
+
+		// The node doesn't exist yet, so hand chef-client what it should
+		// look like on its first run
+		firstBoot, err := b.firstBoot()
+		if err != nil {
+			return err
+		}
+		if err := upload(r, firstBootPath, 0600, firstBoot); err != nil {
+			return fmt.Errorf("unable to copy first boot attributes to %s: %s", host, err)
+		}
+		chefClient += " -j " + firstBootPath
+	} else {
+		key, err := b.createClient(host)
+		if err != nil {
+			return err
+		}
+		if err := upload(r, clientKeyPath, 0600, []byte(key)); err != nil {
+			return fmt.Errorf("unable to copy client key to %s: %s", host, err)
+		}
+
+		client, err := clientFor(host, key, b.endpoint)
+		if err != nil {
+			return err
+		}
+		manager := &NodeManager{client: client}
+		if _, err := manager.Apply(host, b.spec); err != nil {
+			return err
+		}
+	}
+
+	if err := upload(r, configDir+"/client.rb", 0644, b.clientRB(host)); err != nil {
+		return fmt.Errorf("unable to write client.rb on %s: %s", host, err)
+	}
+
+	var output io.Writer
+	if b.Output != nil {
+		output = b.Output(host)
+	}
+
+	if err := run(r, chefClient, nil, output); err != nil {
+		return fmt.Errorf("chef-client failed on %s: %s", host, err)
+	}
+
+	return nil
+}
+
+// File is a file a host needs to bootstrap itself.
+type File struct {
+	Path    string
+	Mode    os.FileMode
+	Content []byte
+}
+
+// FirstBoot returns what a host needs to bootstrap itself on first boot,
+// for handing to cloud-init instead of bootstrapping it over SSH: the
+// files Bootstrap would copy to it and the commands that install and run
+// chef-client. The host registers itself, so this needs a validation key.
+func (b *Bootstrapper) FirstBoot(host string) ([]File, []string, error) {
+	if b.validationKey == nil {
+		return nil, nil, fmt.Errorf("hosts can only bootstrap themselves with a validation key, and neither the buildspec nor the configspec has one")
+	}
+
+	var files []File
+
+	if b.endpoint.CAFile != "" {
+		ca, err := readFile(b.endpoint.CAFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to read ca_file: %s", err)
+		}
+		files = append(files, File{trustedCAPath, 0644, ca})
+	}
+
+	firstBoot, err := b.firstBoot()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	files = append(files,
+		File{validationPath, 0600, b.validationKey},
+		File{firstBootPath, 0600, firstBoot},
+		File{configDir + "/client.rb", 0644, b.clientRB(host)},
+	)
+
+	commands := []string{
+		fmt.Sprintf("command -v chef-client >/dev/null 2>&1 || curl -fsSL %s | sh", InstallURL),
+		"chef-client -j " + firstBootPath,
+		"rm -f " + validationPath,
+	}
+
+	return files, commands, nil
+}
+
+// createClient creates an API client for the host and returns its
+// private key.
+func (b *Bootstrapper) createClient(host string) (string, error) {
+	result, err := b.admin.Clients.Create(chef.ApiNewClient{
+		Name:       host,
+		ClientName: host,
+		CreateKey:  true,
+	})
+	if cerr, ok := err.(*chef.ErrorResponse); ok && cerr.Response != nil && cerr.Response.StatusCode == http.StatusConflict {
+		return "", fmt.Errorf("client %s already exists; set on_conflict = %q in the buildspec to replace it", host, buildspec.ConflictReplace)
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to create client %s: %s", host, err)
+	}
+
+	if result == nil || result.ChefKey.PrivateKey == "" {
+		return "", fmt.Errorf("chef server didn't return a private key for client %s", host)
+	}
+
+	return result.ChefKey.PrivateKey, nil
+}
+
+// clientRB returns the contents of /etc/chef/client.rb for the host.
+func (b *Bootstrapper) clientRB(host string) []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "chef_server_url %s\n", rubyString(b.endpoint.URL))
+	fmt.Fprintf(&buf, "node_name %s\n", rubyString(host))
+	fmt.Fprintf(&buf, "client_key %s\n", rubyString(clientKeyPath))
+	fmt.Fprintf(&buf, "log_location STDOUT\n")
+
+	if b.validationKey != nil {
+		fmt.Fprintf(&buf, "validation_client_name %s\n", rubyString(b.validationClientName))
+		fmt.Fprintf(&buf, "validation_key %s\n", rubyString(validationPath))
+	}
+	if b.spec.Environment != "" {
+		fmt.Fprintf(&buf, "environment %s\n", rubyString(b.spec.Environment))
+	}
+	if b.spec.UsesPolicy() {
+		fmt.Fprintf(&buf, "policy_name %s\n", rubyString(b.spec.PolicyName))
+		fmt.Fprintf(&buf, "policy_group %s\n", rubyString(b.spec.PolicyGroup))
+	}
+	if b.endpoint.InsecureSkipVerify {
+		fmt.Fprintf(&buf, "ssl_verify_mode :verify_none\n")
+	}
+	if b.endpoint.Proxy != "" {
+		fmt.Fprintf(&buf, "http_proxy %s\n", rubyString(b.endpoint.Proxy))
+		fmt.Fprintf(&buf, "https_proxy %s\n", rubyString(b.endpoint.Proxy))
+	}
+	buf.WriteString(failedRunHandler)
+
+	return buf.Bytes()
+}
+
+// failedRunHandler is an exception handler for client.rb that saves a
+// failed run on the node, so WaitForConverge can tell it apart from one
+// that hasn't finished yet.
+var failedRunHandler = fmt.Sprintf(`require 'chef/handler'
+exception_handlers << Class.new(Chef::Handler) do
+  def report
+    return if node.nil?
+    node.automatic_attrs[%s] = {
+      'start_time' => start_time.to_f,
+      'exception' => formatted_exception,
+    }
+    node.save
+  rescue StandardError => e
+    Chef::Log.warn("Unable to save the failed run on the node: #{e}")
+  end
+end.new
+`, rubyString(failedRunAttribute))
+
+// firstBoot returns the JSON attributes for the first chef-client run: the
+// buildspec's normal attributes and its run list or policy.
+func (b *Bootstrapper) firstBoot() ([]byte, error) {
+	attrs := copyAttributes(b.spec.Attributes)
+	if b.spec.UsesPolicy() {
+		attrs["policy_name"] = b.spec.PolicyName
+		attrs["policy_group"] = b.spec.PolicyGroup
+	} else {
+		attrs["run_list"] = normalizeRunList(b.spec.RunList)
+	}
+
+	return json.MarshalIndent(attrs, "", "  ")
+}
+
+// run runs the command and, if it fails, includes what it wrote to stderr
+// in the error.
+func run(r Remote, cmd string, stdin io.Reader, stdout io.Writer) error {
+	var stderr bytes.Buffer
+	if err := r.Run(cmd, stdin, stdout, &stderr); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// upload writes data to the file at p on the host, creating the directory
+// it's in if need be.
+func upload(r Remote, p string, mode os.FileMode, data []byte) error {
+	cmd := fmt.Sprintf("umask 077 && mkdir -p %s && cat > %s && chmod %o %s",
+		ssh.Quote(path.Dir(p)), ssh.Quote(p), mode, ssh.Quote(p))
+	return run(r, cmd, bytes.NewReader(data), nil)
+}
+
+func readFile(p string) ([]byte, error) {
+	p, err := util.ExpandPath(p)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(p)
+}
+
+// rubyString quotes s as a single-quoted Ruby string so nothing in it is
+// interpolated.
+func rubyString(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `'`, `\'`, -1)
+	return "'" + s + "'"
+}
@@ -0,0 +1,300 @@
+package chef
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/go-chef/chef"
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+)
+
+// fakeRemote records what would have been run on a host. Files written
+// with upload are kept by path.
+type fakeRemote struct {
+	commands []string
+	files    map[string]string
+	fail     string
+}
+
+func (r *fakeRemote) Run(cmd string, stdin io.Reader, stdout, stderr io.Writer) error {
+	r.commands = append(r.commands, cmd)
+
+	if stdin != nil {
+		data, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+		if i := strings.Index(cmd, "cat > '"); i >= 0 {
+			p := cmd[i+len("cat > '"):]
+			r.files[p[:strings.Index(p, "'")]] = string(data)
+		}
+	}
+
+	if r.fail != "" && strings.HasPrefix(cmd, r.fail) {
+		fmt.Fprintln(stderr, "ERROR: 403 Forbidden")
+		return fmt.Errorf("Process exited with status 1")
+	}
+
+	if stdout != nil {
+		fmt.Fprintf(stdout, "ran %s\n", cmd)
+	}
+	return nil
+}
+
+func (r *fakeRemote) Close() error {
+	return nil
+}
+
+func TestBootstrap(t *testing.T) {
+	server := newFakeServer()
+	defer server.Close()
+
+	key, err := ReadKey(testKeyPath(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.clientKey = key
+
+	spec := buildspec.Chef{
+		Server:      server.URL + "/organizations/qa/",
+		Environment: "qa",
+		RunList:     []string{"role[role01]", "ntp"},
+		RunListMode: buildspec.RunListMerge,
+		Attributes:  map[string]interface{}{"kafka": map[string]interface{}{"heap": "4g"}},
+	}
+	cspec := configspec.Chef{Username: "admin", ClientKey: testKeyPath(t)}
+
+	cases := []struct {
+		Name     string
+		Spec     buildspec.Chef
+		Cspec    configspec.Chef
+		Files    []string
+		Expected []string
+		Command  string
+	}{
+		{
+			"pre-created client",
+			spec,
+			cspec,
+			[]string{"/etc/chef/client.pem", "/etc/chef/client.rb"},
+			[]string{"node_name 'hello.qa.local'", "environment 'qa'", "exception_handlers << Class.new(Chef::Handler) do"},
+			"chef-client",
+		},
+		{
+			"validation key",
+			func() buildspec.Chef { s := spec; s.ValidationKey = testKeyPath(t); return s }(),
+			cspec,
+			[]string{"/etc/chef/validation.pem", "/etc/chef/first-boot.json", "/etc/chef/client.rb"},
+			[]string{"validation_client_name 'qa-validator'", "validation_key '/etc/chef/validation.pem'"},
+			"chef-client -j /etc/chef/first-boot.json",
+		},
+		{
+			"policy",
+			buildspec.Chef{
+				Server:        server.URL + "/organizations/qa/",
+				ValidationKey: testKeyPath(t),
+				PolicyName:    "kafka",
+				PolicyGroup:   "qa",
+			},
+			cspec,
+			[]string{"/etc/chef/validation.pem", "/etc/chef/first-boot.json", "/etc/chef/client.rb"},
+			[]string{"policy_name 'kafka'", "policy_group 'qa'"},
+			"chef-client -j /etc/chef/first-boot.json",
+		},
+	}
+
+	for _, tt := range cases {
+		remote := &fakeRemote{files: make(map[string]string)}
+
+		b, err := NewBootstrapper(tt.Spec, tt.Cspec, configspec.SSH{})
+		if err != nil {
+			t.Fatalf("case: %s\n\n%s", tt.Name, err)
+		}
+		b.Dial = func(host string) (Remote, error) { return remote, nil }
+
+		var output bytes.Buffer
+		b.Output = func(host string) io.Writer { return &output }
+
+		if err := b.Bootstrap("hello.qa.local"); err != nil {
+			t.Fatalf("case: %s\n\n%s", tt.Name, err)
+		}
+
+		for _, f := range tt.Files {
+			if _, ok := remote.files[f]; !ok {
+				t.Fatalf("case: %s\n\n%s wasn't written: %v", tt.Name, f, remote.commands)
+			}
+		}
+
+		for _, line := range tt.Expected {
+			if !strings.Contains(remote.files["/etc/chef/client.rb"], line+"\n") {
+				t.Fatalf("case: %s\n\nclient.rb is missing %q:\n%s", tt.Name, line, remote.files["/etc/chef/client.rb"])
+			}
+		}
+
+		if !strings.Contains(output.String(), "ran "+tt.Command+"\n") {
+			t.Fatalf("case: %s\n\nexpected %q to run:\n%s", tt.Name, tt.Command, output.String())
+		}
+
+		if tt.Spec.ValidationKey != "" {
+			last := remote.commands[len(remote.commands)-1]
+			if last != "rm -f /etc/chef/validation.pem" {
+				t.Fatalf("case: %s\n\nvalidation key wasn't removed: %v", tt.Name, remote.commands)
+			}
+
+			var firstBoot map[string]interface{}
+			if err := json.Unmarshal([]byte(remote.files["/etc/chef/first-boot.json"]), &firstBoot); err != nil {
+				t.Fatal(err)
+			}
+			if tt.Spec.UsesPolicy() {
+				if firstBoot["policy_name"] != "kafka" || firstBoot["policy_group"] != "qa" || firstBoot["run_list"] != nil {
+					t.Fatalf("case: %s\n\n%#v", tt.Name, firstBoot)
+				}
+				continue
+			}
+
+			runList := fmt.Sprint(firstBoot["run_list"])
+			if runList != "[role[role01] recipe[ntp]]" || firstBoot["kafka"] == nil {
+				t.Fatalf("case: %s\n\n%#v", tt.Name, firstBoot)
+			}
+		}
+	}
+
+	// The pre-created client's node should have been set up before
+	// chef-client ran
+	node, ok := server.nodes["hello.qa.local"]
+	if !ok || !server.clients["hello.qa.local"] {
+		t.Fatalf("client and node weren't created: %v", server.requests)
+	}
+	if node.Environment != "qa" || len(node.RunList) != 2 {
+		t.Fatalf("%#v", node)
+	}
+}
+
+func TestBootstrapError(t *testing.T) {
+	spec := buildspec.Chef{
+		Server:        "https://chef.qa.local/",
+		ValidationKey: testKeyPath(t),
+	}
+
+	remote := &fakeRemote{files: make(map[string]string), fail: "chef-client"}
+
+	b, err := NewBootstrapper(spec, configspec.Chef{}, configspec.SSH{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Dial = func(host string) (Remote, error) { return remote, nil }
+
+	err = b.Bootstrap("hello.qa.local")
+	if err == nil || !strings.Contains(err.Error(), "403 Forbidden") {
+		t.Fatalf("expected chef-client's error, got %v", err)
+	}
+
+	if client := remote.files["/etc/chef/client.rb"]; !strings.Contains(client, "validation_client_name 'chef-validator'\n") {
+		t.Fatalf("client.rb:\n%s", client)
+	}
+
+	// The validation key comes off the host even when the run fails
+	if last := remote.commands[len(remote.commands)-1]; last != "rm -f /etc/chef/validation.pem" {
+		t.Fatalf("validation key wasn't removed: %v", remote.commands)
+	}
+}
+
+func TestFirstBoot(t *testing.T) {
+	spec := buildspec.Chef{
+		Server:        "https://chef.qa.local/organizations/qa",
+		ValidationKey: testKeyPath(t),
+		RunList:       []string{"role[kafka]"},
+	}
+
+	b, err := NewBootstrapper(spec, configspec.Chef{}, configspec.SSH{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, commands, err := b.FirstBoot("hello.qa.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, fmt.Sprintf("%s %o", f.Path, f.Mode))
+	}
+	expected := []string{"/etc/chef/validation.pem 600", "/etc/chef/first-boot.json 600", "/etc/chef/client.rb 644"}
+	if strings.Join(paths, ",") != strings.Join(expected, ",") {
+		t.Fatalf("bad files: %v", paths)
+	}
+	if client := string(files[2].Content); !strings.Contains(client, "node_name 'hello.qa.local'\n") || !strings.Contains(client, "validation_client_name 'qa-validator'\n") {
+		t.Fatalf("client.rb:\n%s", client)
+	}
+	if !strings.Contains(string(files[1].Content), `"role[kafka]"`) {
+		t.Fatalf("first-boot.json:\n%s", files[1].Content)
+	}
+
+	if commands[1] != "chef-client -j /etc/chef/first-boot.json" || commands[2] != "rm -f /etc/chef/validation.pem" {
+		t.Fatalf("bad commands: %v", commands)
+	}
+
+	// Without a validation key the host can't register itself
+	b, err = NewBootstrapper(buildspec.Chef{Server: "https://chef.qa.local/"}, configspec.Chef{Username: "admin", ClientKey: testKeyPath(t)}, configspec.SSH{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := b.FirstBoot("hello.qa.local"); err == nil {
+		t.Fatal("expected an error without a validation key")
+	}
+}
+
+func TestBootstrapLeftoverClient(t *testing.T) {
+	server := newFakeServer()
+	defer server.Close()
+
+	key, err := ReadKey(testKeyPath(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.clientKey = key
+
+	// The old host's node and client are still on the server
+	host := "hello.qa.local"
+	server.nodes[host] = chef.NewNode(host)
+	server.clients[host] = true
+
+	bspec, err := buildspec.Parse(strings.NewReader(fmt.Sprintf(`
+spec "default" {
+    chef {
+        server = %q
+        run_list = ["role[role01]"]
+    }
+}`, server.URL+"/")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager, err := NewNodeManager("admin", testKeyPath(t), server.endpoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.ResolveConflict(host, bspec.Chef); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := NewBootstrapper(bspec.Chef, configspec.Chef{Username: "admin", ClientKey: testKeyPath(t)}, configspec.SSH{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Dial = func(host string) (Remote, error) { return &fakeRemote{files: make(map[string]string)}, nil }
+
+	if err := b.Bootstrap(host); err != nil {
+		t.Fatal(err)
+	}
+	if !server.clients[host] {
+		t.Fatalf("client wasn't created again: %v", server.requests)
+	}
+}
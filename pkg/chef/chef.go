@@ -1,21 +1,58 @@
 package chef
 
 import (
+	"fmt"
 	"io/ioutil"
 
 	"github.com/go-chef/chef"
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/transport"
 	"github.com/iamthemuffinman/overseer/pkg/util"
 )
 
 type Chef struct {
 }
 
-func NewClient(key, chefServer string) (*chef.Client, error) {
-	client, err := chef.NewClient(&chef.Config{
-		Name:    "overseer",
+// ServerEndpoint returns the endpoint for the buildspec's Chef server,
+// which is the configspec's with the URL swapped out when the buildspec
+// names a server of its own.
+func ServerEndpoint(spec buildspec.Chef, cspec configspec.Chef) configspec.Endpoint {
+	endpoint := cspec.Endpoint
+	if spec.Server != "" {
+		endpoint.URL = spec.Server
+	}
+	return endpoint
+}
+
+// NewClient returns a client that signs its requests as the named user
+// (or client) with their key.
+func NewClient(name, key string, endpoint configspec.Endpoint) (*chef.Client, error) {
+	if name == "" {
+		return nil, fmt.Errorf("the chef block needs a username to sign requests as")
+	}
+	return clientFor(name, key, endpoint)
+}
+
+// clientFor returns a client that signs its requests as the named client.
+// Connections go through the endpoint's transport so its CA bundle,
+// client certificate, timeout and proxy all apply.
+func clientFor(name, key string, endpoint configspec.Endpoint) (*chef.Client, error) {
+	httpClient, err := transport.New(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &chef.Config{
+		Name:    name,
 		Key:     key,
-		BaseURL: chefServer,
-	})
+		BaseURL: endpoint.URL,
+		SkipSSL: endpoint.InsecureSkipVerify,
+		Timeout: endpoint.Timeout,
+		Client:  httpClient,
+	}
+
+	client, err := chef.NewClient(config)
 	if err != nil {
 		return nil, err
 	}
@@ -23,12 +60,6 @@ func NewClient(key, chefServer string) (*chef.Client, error) {
 	return client, nil
 }
 
-func AddToRunList(name, runListItem string) chef.Node {
-	node := chef.NewNode(name)
-	node.RunList = append(node.RunList, runListItem)
-	return node
-}
-
 func ReadKey(keyPath string) (string, error) {
 	path, err := util.ExpandPath(keyPath)
 	if err != nil {
@@ -43,22 +74,25 @@ func ReadKey(keyPath string) (string, error) {
 	return string(key), nil
 }
 
-func UpdateNode(name, keyPath, chefServer string, runList []string) error {
+// Ping checks that the Chef server is reachable and accepts the user's
+// client key by fetching the _default environment, which every server
+// has.
+func Ping(username, keyPath string, endpoint configspec.Endpoint) error {
 	key, err := ReadKey(keyPath)
 	if err != nil {
 		return err
 	}
 
-	client, err := NewClient(key, chefServer)
+	client, err := clientFor(username, key, endpoint)
 	if err != nil {
 		return err
 	}
 
-	var node chef.Node
-	for _, item := range runList {
-		node = AddToRunList(name, item)
+	req, err := client.NewRequest("GET", "environments/_default", nil)
+	if err != nil {
+		return err
 	}
 
-	client.Nodes.Put(node)
-	return nil
+	_, err = client.Do(req, nil)
+	return err
 }
@@ -4,6 +4,9 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"testing"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
 )
 
 func TestNewClient(t *testing.T) {
@@ -36,7 +39,7 @@ func TestNewClient(t *testing.T) {
 			continue
 		}
 
-		_, err = NewClient(string(key), tt.ChefServer)
+		_, err = NewClient("admin", string(key), configspec.Endpoint{URL: tt.ChefServer})
 		if err != nil {
 			t.Fatalf("file: %s\n\n%s", tt.File, err)
 			continue
@@ -44,6 +47,51 @@ func TestNewClient(t *testing.T) {
 	}
 }
 
-func TestAddToRunList(t *testing.T) {}
-
 func TestReadValidationKey(t *testing.T) {}
+
+func TestNewClientCert(t *testing.T) {
+	key, err := ioutil.ReadFile(filepath.Join("./test-fixtures", "testkey1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The client certificate is loaded up front, so one that isn't there
+	// is caught before any request is made
+	endpoint := configspec.Endpoint{
+		URL:      "https://localhost/",
+		CertFile: filepath.Join("./test-fixtures", "missing.crt"),
+		KeyFile:  filepath.Join("./test-fixtures", "missing.key"),
+	}
+	if _, err := NewClient("admin", string(key), endpoint); err == nil {
+		t.Fatal("expected an error for a missing client certificate")
+	}
+}
+
+func TestNewClientSignsAsUser(t *testing.T) {
+	server := newFakeServer()
+	defer server.Close()
+
+	manager, err := NewNodeManager("jdoe", testKeyPath(t), server.endpoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.Apply("hello.qa.local", buildspec.Chef{RunList: []string{"role[role01]"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.Registered("hello.qa.local"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(server.users) == 0 {
+		t.Fatal("no requests were made")
+	}
+	for _, user := range server.users {
+		if user != "jdoe" {
+			t.Fatalf("signed as %#v", server.users)
+		}
+	}
+
+	if _, err := NewNodeManager("", testKeyPath(t), server.endpoint()); err == nil {
+		t.Fatal("expected an error without a username")
+	}
+}
@@ -0,0 +1,77 @@
+package chef
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+)
+
+// ResolveConflict checks whether the Chef server already has a node or
+// client for the host, as it will when a hostname is re-provisioned, and
+// deals with them as the buildspec's on_conflict says. It returns what it
+// found and did, or an empty string if the host was new to the server.
+func (m *NodeManager) ResolveConflict(host string, spec buildspec.Chef) (string, error) {
+	var existing []string
+
+	_, err := m.client.Nodes.Get(host)
+	if err != nil && !IsNotFound(err) {
+		return "", fmt.Errorf("unable to get node %s: %s", host, err)
+	}
+	if err == nil {
+		existing = append(existing, "node")
+	}
+
+	_, err = m.client.Clients.Get(host)
+	if err != nil && !IsNotFound(err) {
+		return "", fmt.Errorf("unable to get client %s: %s", host, err)
+	}
+	if err == nil {
+		existing = append(existing, "client")
+	}
+
+	if len(existing) == 0 {
+		return "", nil
+	}
+
+	found := strings.Join(existing, " and ")
+
+	switch spec.OnConflict {
+	case buildspec.ConflictFail:
+		return "", fmt.Errorf("chef server already has a %s for %s (on_conflict = %q)", found, host, spec.OnConflict)
+	case buildspec.ConflictReplace:
+		if err := m.Remove(host); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("deleted existing %s", found), nil
+	default:
+		return fmt.Sprintf("kept existing %s", found), nil
+	}
+}
+
+// Remove deletes the host's node and client from the Chef server, if it
+// has them, so it can be bootstrapped again from scratch.
+func (m *NodeManager) Remove(host string) error {
+	// The node goes first so it's never left without the client that owns
+	// it
+	if err := m.client.Nodes.Delete(host); err != nil && !IsNotFound(err) {
+		return fmt.Errorf("unable to delete node %s: %s", host, err)
+	}
+	if err := m.client.Clients.Delete(host); err != nil && !IsNotFound(err) {
+		return fmt.Errorf("unable to delete client %s: %s", host, err)
+	}
+	return nil
+}
+
+// Registered reports whether the Chef server has a client for the host,
+// which it will once the host has been bootstrapped.
+func (m *NodeManager) Registered(host string) (bool, error) {
+	_, err := m.client.Clients.Get(host)
+	if IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to get client %s: %s", host, err)
+	}
+	return true, nil
+}
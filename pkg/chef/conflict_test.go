@@ -0,0 +1,105 @@
+package chef
+
+import (
+	"testing"
+
+	"github.com/go-chef/chef"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+)
+
+func TestResolveConflict(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Node     bool
+		Client   bool
+		Policy   string
+		Expected string
+		Exists   bool
+		Err      bool
+	}{
+		{"new host", false, false, buildspec.ConflictFail, "", false, false},
+		{"keep", true, true, buildspec.ConflictKeep, "kept existing node and client", true, false},
+		{"replace", true, true, buildspec.ConflictReplace, "deleted existing node and client", false, false},
+		{"replace client only", false, true, buildspec.ConflictReplace, "deleted existing client", false, false},
+		{"fail", true, false, buildspec.ConflictFail, "", true, true},
+	}
+
+	for _, tt := range cases {
+		server := newFakeServer()
+
+		host := "hello.qa.local"
+		if tt.Node {
+			server.nodes[host] = chef.NewNode(host)
+		}
+		if tt.Client {
+			server.clients[host] = true
+		}
+
+		manager, err := NewNodeManager("admin", testKeyPath(t), server.endpoint())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual, err := manager.ResolveConflict(host, buildspec.Chef{OnConflict: tt.Policy})
+		server.Close()
+
+		if (err != nil) != tt.Err {
+			t.Fatalf("case: %s\n\n%v", tt.Name, err)
+		}
+
+		if actual != tt.Expected {
+			t.Fatalf("case: %s\n\n%q != %q", tt.Name, actual, tt.Expected)
+		}
+
+		_, nodeExists := server.nodes[host]
+		if exists := nodeExists || server.clients[host]; exists != tt.Exists {
+			t.Fatalf("case: %s\n\nnode or client exists: %t, expected %t", tt.Name, exists, tt.Exists)
+		}
+	}
+}
+
+func TestRegistered(t *testing.T) {
+	server := newFakeServer()
+	defer server.Close()
+
+	server.clients["hello.qa.local"] = true
+
+	manager, err := NewNodeManager("admin", testKeyPath(t), server.endpoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for host, expected := range map[string]bool{"hello.qa.local": true, "lol.qa.local": false} {
+		actual, err := manager.Registered(host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != expected {
+			t.Fatalf("%s: registered %t, expected %t", host, actual, expected)
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	server := newFakeServer()
+	defer server.Close()
+
+	server.nodes["hello.qa.local"] = chef.NewNode("hello.qa.local")
+	server.clients["hello.qa.local"] = true
+
+	manager, err := NewNodeManager("admin", testKeyPath(t), server.endpoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Removing a host the server doesn't know isn't an error
+	for _, host := range []string{"hello.qa.local", "lol.qa.local"} {
+		if err := manager.Remove(host); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, ok := server.nodes["hello.qa.local"]; ok || server.clients["hello.qa.local"] {
+		t.Fatalf("node and client should be gone")
+	}
+}
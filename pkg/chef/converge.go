@@ -0,0 +1,108 @@
+package chef
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultConvergeTimeout is how long to wait for a host's first
+	// chef-client run when the buildspec doesn't say.
+	DefaultConvergeTimeout = 30 * time.Minute
+
+	// DefaultPollInterval is how often the Chef server is asked whether a
+	// node has converged.
+	DefaultPollInterval = 30 * time.Second
+)
+
+// failedRunAttribute is the automatic attribute the exception handler in
+// the client.rb of bootstrapped hosts saves a failed run in. A successful
+// run replaces the automatic attributes, so it's only there while the
+// last run failed.
+const failedRunAttribute = "overseer_failed_run"
+
+// runStatus is what the node says about its last chef-client run.
+type runStatus struct {
+	// ohaiTime is when the last run that saved the node started
+	ohaiTime time.Time
+	// failedAt is when the last run started, if it failed
+	failedAt time.Time
+	// failure is the exception the failed run ended with
+	failure string
+}
+
+// WaitForConverge waits for the node to finish a successful chef-client
+// run that started after since, checking every PollInterval until timeout
+// passes. chef-client only saves the node at the end of a run that
+// succeeded, so a run that started after since shows up as an ohai_time
+// later than since. A node that isn't on the server yet is waited for
+// too, since new hosts register themselves on their first run.
+//
+// Hosts bootstrapped by overseer also save the node when a run fails, so
+// a failed run is returned as an error as soon as it shows up rather than
+// once timeout passes.
+func (m *NodeManager) WaitForConverge(name string, since time.Time, timeout time.Duration) error {
+	interval := m.PollInterval
+	if interval == 0 {
+		interval = DefaultPollInterval
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		status, err := m.lastRun(name)
+		if err != nil {
+			return err
+		}
+
+		if status.failedAt.After(since) {
+			return fmt.Errorf("chef-client run on %s failed: %s", name, status.failure)
+		}
+
+		// A failed run saves ohai_time too, so it only counts when the
+		// last run didn't fail
+		if status.failedAt.IsZero() && status.ohaiTime.After(since) {
+			return nil
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			if status.ohaiTime.IsZero() {
+				return fmt.Errorf("node %s hasn't checked in to the chef server after %s", name, timeout)
+			}
+			return fmt.Errorf("no successful chef-client run on %s after %s (last run finished %s)",
+				name, timeout, status.ohaiTime.Format(time.RFC3339))
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// lastRun returns what the node says about its last chef-client run. The
+// times are zero if the node isn't on the server or has never run.
+func (m *NodeManager) lastRun(name string) (runStatus, error) {
+	var status runStatus
+
+	node, err := m.client.Nodes.Get(name)
+	if IsNotFound(err) {
+		return status, nil
+	}
+	if err != nil {
+		return status, fmt.Errorf("unable to get node %s: %s", name, err)
+	}
+
+	if seconds, ok := node.AutomaticAttributes["ohai_time"].(float64); ok {
+		status.ohaiTime = unixSeconds(seconds)
+	}
+
+	if failed, ok := node.AutomaticAttributes[failedRunAttribute].(map[string]interface{}); ok {
+		if seconds, ok := failed["start_time"].(float64); ok {
+			status.failedAt = unixSeconds(seconds)
+		}
+		status.failure, _ = failed["exception"].(string)
+	}
+
+	return status, nil
+}
+
+func unixSeconds(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
@@ -0,0 +1,80 @@
+package chef
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chef/chef"
+)
+
+func TestWaitForConverge(t *testing.T) {
+	server := newFakeServer()
+	defer server.Close()
+
+	manager, err := NewNodeManager("admin", testKeyPath(t), server.endpoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.PollInterval = 10 * time.Millisecond
+
+	since := time.Now().Add(-time.Minute)
+	node := func(name string, ohaiTime time.Time) chef.Node {
+		n := chef.NewNode(name)
+		n.AutomaticAttributes = map[string]interface{}{
+			"ohai_time": float64(ohaiTime.UnixNano()) / float64(time.Second),
+		}
+		return n
+	}
+
+	server.nodes["converged.qa.local"] = node("converged.qa.local", time.Now())
+	server.nodes["stale.qa.local"] = node("stale.qa.local", since.Add(-time.Hour))
+	server.nodes["new.qa.local"] = chef.NewNode("new.qa.local")
+
+	cases := []struct {
+		Host string
+		Err  bool
+	}{
+		{"converged.qa.local", false},
+		{"stale.qa.local", true},
+		{"new.qa.local", true},
+		{"missing.qa.local", true},
+	}
+
+	for _, tt := range cases {
+		err := manager.WaitForConverge(tt.Host, since, 50*time.Millisecond)
+		if (err != nil) != tt.Err {
+			t.Fatalf("host: %s\n\n%v", tt.Host, err)
+		}
+	}
+
+	// A node that converges while we're waiting on it
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		server.mu.Lock()
+		server.nodes["stale.qa.local"] = node("stale.qa.local", time.Now())
+		server.mu.Unlock()
+	}()
+
+	if err := manager.WaitForConverge("stale.qa.local", since, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed run is given up on right away, even though it saved a
+	// newer ohai_time
+	failed := node("failed.qa.local", time.Now())
+	failed.AutomaticAttributes[failedRunAttribute] = map[string]interface{}{
+		"start_time": float64(time.Now().UnixNano()) / float64(time.Second),
+		"exception":  "Chef::Exceptions::RecipeNotFound: could not find recipe kafka",
+	}
+	server.nodes["failed.qa.local"] = failed
+
+	start := time.Now()
+	err = manager.WaitForConverge("failed.qa.local", since, 5*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "could not find recipe kafka") {
+		t.Fatalf("expected the failed run, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("took %s to notice the failed run", time.Since(start))
+	}
+}
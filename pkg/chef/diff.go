@@ -0,0 +1,67 @@
+package chef
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+)
+
+// Diff returns the ways the node doesn't match the buildspec: what Apply
+// would change if it were run now. Attributes are compared by their
+// top-level key.
+func (m *NodeManager) Diff(name string, spec buildspec.Chef) ([]drift.Difference, error) {
+	node, err := m.client.Nodes.Get(name)
+	if IsNotFound(err) {
+		return []drift.Difference{drift.Missing("node", "present")}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to get node %s: %s", name, err)
+	}
+
+	want := copyNode(node)
+	applyNode(&want, spec)
+
+	var diffs []drift.Difference
+	str := func(field, have, want string) {
+		if have != want {
+			diffs = append(diffs, drift.Difference{Field: field, Have: have, Want: want})
+		}
+	}
+
+	str("environment", node.Environment, want.Environment)
+	str("run_list", strings.Join(node.RunList, ","), strings.Join(want.RunList, ","))
+	str("policy_name", node.PolicyName, want.PolicyName)
+	str("policy_group", node.PolicyGroup, want.PolicyGroup)
+
+	var keys []string
+	for k := range spec.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		have, want := node.NormalAttributes[k], want.NormalAttributes[k]
+		if !reflect.DeepEqual(have, want) {
+			diffs = append(diffs, drift.Difference{Field: "attributes." + k, Have: attributeString(have), Want: attributeString(want)})
+		}
+	}
+
+	return diffs, nil
+}
+
+// attributeString renders an attribute value compactly for a diff.
+func attributeString(v interface{}) string {
+	if v == nil {
+		return "missing"
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
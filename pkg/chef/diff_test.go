@@ -0,0 +1,71 @@
+package chef
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-chef/chef"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+)
+
+func TestNodeManagerDiff(t *testing.T) {
+	server := newFakeServer()
+	defer server.Close()
+
+	node := chef.NewNode("hello.qa.local")
+	node.Environment = "qa"
+	node.RunList = []string{"role[base]", "role[kafka]"}
+	node.NormalAttributes = map[string]interface{}{
+		"kafka": map[string]interface{}{"heap": "2g", "port": float64(9092)},
+	}
+	server.nodes["hello.qa.local"] = node
+
+	manager, err := NewNodeManager("admin", testKeyPath(t), server.endpoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Host     string
+		Spec     buildspec.Chef
+		Expected []drift.Difference
+	}{
+		{
+			"hello.qa.local",
+			buildspec.Chef{Environment: "qa", RunList: []string{"role[kafka]"}, RunListMode: buildspec.RunListMerge},
+			nil,
+		},
+		{
+			"hello.qa.local",
+			buildspec.Chef{
+				Environment: "prod",
+				RunList:     []string{"role[kafka]"},
+				RunListMode: buildspec.RunListReplace,
+				Attributes: map[string]interface{}{
+					"kafka": map[string]interface{}{"heap": "4g"},
+				},
+			},
+			[]drift.Difference{
+				{Field: "environment", Have: "qa", Want: "prod"},
+				{Field: "run_list", Have: "role[base],role[kafka]", Want: "role[kafka]"},
+				{Field: "attributes.kafka", Have: `{"heap":"2g","port":9092}`, Want: `{"heap":"4g","port":9092}`},
+			},
+		},
+		{
+			"lol.qa.local",
+			buildspec.Chef{Environment: "qa"},
+			[]drift.Difference{{Field: "node", Have: "missing", Want: "present"}},
+		},
+	}
+
+	for _, tt := range cases {
+		actual, err := manager.Diff(tt.Host, tt.Spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, tt.Expected) {
+			t.Fatalf("%#v\n\n%#v", actual, tt.Expected)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package chef
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-chef/chef"
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+)
+
+// Change says what Apply did to a node.
+type Change string
+
+const (
+	Created   Change = "created"
+	Updated   Change = "updated"
+	Unchanged Change = "unchanged"
+)
+
+// NodeManager makes Chef nodes look the way a buildspec says they should.
+type NodeManager struct {
+	// PollInterval is how often WaitForConverge checks on a node.
+	// Zero means DefaultPollInterval.
+	PollInterval time.Duration
+
+	client *chef.Client
+}
+
+// NewNodeManager returns a NodeManager that talks to the Chef server at
+// the endpoint as username, using their client key at keyPath.
+func NewNodeManager(username, keyPath string, endpoint configspec.Endpoint) (*NodeManager, error) {
+	key, err := ReadKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := NewClient(username, key, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NodeManager{client: client}, nil
+}
+
+// Apply fetches the node (or starts a new one if the server has never
+// heard of it), sets its environment and run list (or its policy) and its
+// normal attributes from the buildspec and saves it if anything changed.
+func (m *NodeManager) Apply(name string, spec buildspec.Chef) (Change, error) {
+	node, err := m.client.Nodes.Get(name)
+	if err != nil && !IsNotFound(err) {
+		return "", fmt.Errorf("unable to get node %s: %s", name, err)
+	}
+
+	if IsNotFound(err) {
+		node = chef.NewNode(name)
+		applyNode(&node, spec)
+
+		if _, err := m.client.Nodes.Post(node); err != nil {
+			return "", fmt.Errorf("unable to create node %s: %s", name, err)
+		}
+		return Created, nil
+	}
+
+	before := copyNode(node)
+	applyNode(&node, spec)
+
+	if reflect.DeepEqual(before, node) {
+		return Unchanged, nil
+	}
+
+	if _, err := m.client.Nodes.Put(node); err != nil {
+		return "", fmt.Errorf("unable to update node %s: %s", name, err)
+	}
+	return Updated, nil
+}
+
+// applyNode makes the changes the buildspec asks for to the node.
+func applyNode(node *chef.Node, spec buildspec.Chef) {
+	if spec.Environment != "" {
+		node.Environment = spec.Environment
+	}
+
+	switch {
+	case spec.UsesPolicy():
+		// The policy decides what runs, so the run list is left alone
+		node.PolicyName = spec.PolicyName
+		node.PolicyGroup = spec.PolicyGroup
+	case spec.RunListMode == buildspec.RunListReplace:
+		node.RunList = normalizeRunList(spec.RunList)
+	default:
+		node.RunList = mergeRunList(node.RunList, spec.RunList)
+	}
+
+	if len(spec.Attributes) > 0 {
+		if node.NormalAttributes == nil {
+			node.NormalAttributes = make(map[string]interface{})
+		}
+		mergeAttributes(node.NormalAttributes, spec.Attributes)
+	}
+}
+
+// normalizeRunListItem turns the "nginx" shorthand into "recipe[nginx]",
+// which is how the Chef server stores it.
+func normalizeRunListItem(item string) string {
+	if strings.Contains(item, "[") {
+		return item
+	}
+	return fmt.Sprintf("recipe[%s]", item)
+}
+
+func normalizeRunList(items []string) []string {
+	runList := make([]string, 0, len(items))
+	for _, item := range items {
+		runList = append(runList, normalizeRunListItem(item))
+	}
+	return runList
+}
+
+// mergeRunList appends the items that aren't already in the run list,
+// keeping the existing order.
+func mergeRunList(existing, items []string) []string {
+	runList := normalizeRunList(existing)
+
+	seen := make(map[string]struct{}, len(runList))
+	for _, item := range runList {
+		seen[item] = struct{}{}
+	}
+
+	for _, item := range normalizeRunList(items) {
+		if _, ok := seen[item]; ok {
+			continue
+		}
+		seen[item] = struct{}{}
+		runList = append(runList, item)
+	}
+
+	return runList
+}
+
+// mergeAttributes deep merges src into dst. Nested objects are merged key
+// by key; anything else in src replaces what's in dst.
+func mergeAttributes(dst, src map[string]interface{}) {
+	for k, v := range src {
+		srcMap, ok := v.(map[string]interface{})
+		if !ok {
+			dst[k] = v
+			continue
+		}
+
+		dstMap, ok := dst[k].(map[string]interface{})
+		if !ok {
+			dstMap = make(map[string]interface{})
+			dst[k] = dstMap
+		}
+		mergeAttributes(dstMap, srcMap)
+	}
+}
+
+// copyNode returns a copy of the parts of the node Apply changes, deep
+// enough that changing the original doesn't change the copy.
+func copyNode(node chef.Node) chef.Node {
+	c := node
+	c.RunList = append([]string(nil), node.RunList...)
+	if node.NormalAttributes != nil {
+		c.NormalAttributes = copyAttributes(node.NormalAttributes)
+	}
+	return c
+}
+
+func copyAttributes(src map[string]interface{}) map[string]interface{} {
+	dst := make(map[string]interface{}, len(src))
+	for k, v := range src {
+		if m, ok := v.(map[string]interface{}); ok {
+			v = copyAttributes(m)
+		}
+		dst[k] = v
+	}
+	return dst
+}
+
+// IsNotFound reports whether err is the Chef server saying it doesn't
+// have what was asked for.
+func IsNotFound(err error) bool {
+	cerr, ok := err.(*chef.ErrorResponse)
+	return ok && cerr.Response != nil && cerr.Response.StatusCode == http.StatusNotFound
+}
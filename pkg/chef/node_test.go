@@ -0,0 +1,285 @@
+package chef
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chef/chef"
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+)
+
+// fakeServer is just enough of a Chef server to test against. It doesn't
+// check signatures.
+type fakeServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	nodes    map[string]chef.Node
+	clients  map[string]bool
+	requests []string
+	// users are who each request was signed as, by X-Ops-Userid
+	users []string
+
+	// clientKey is handed out as the private key of new clients
+	clientKey string
+}
+
+func newFakeServer() *fakeServer {
+	s := &fakeServer{nodes: make(map[string]chef.Node), clients: make(map[string]bool)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *fakeServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	s.users = append(s.users, r.Header.Get("X-Ops-Userid"))
+
+	// Serve any organization the same
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) > 2 && parts[0] == "organizations" {
+		parts = parts[2:]
+	}
+
+	switch {
+	case strings.Join(parts, "/") == "environments/_default" && r.Method == "GET":
+		json.NewEncoder(w).Encode(map[string]string{"name": "_default"})
+	case parts[0] == "clients" && len(parts) == 1 && r.Method == "POST":
+		var client chef.ApiNewClient
+		json.NewDecoder(r.Body).Decode(&client)
+		if s.clients[client.Name] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		s.clients[client.Name] = true
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(chef.ApiClientCreateResult{
+			Uri:     s.URL + "/clients/" + client.Name,
+			ChefKey: chef.ChefKey{PrivateKey: s.clientKey},
+		})
+	case parts[0] == "clients" && len(parts) == 2:
+		if !s.clients[parts[1]] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		client := chef.ApiClient{Name: parts[1], ClientName: parts[1]}
+		if r.Method == "DELETE" {
+			delete(s.clients, parts[1])
+		}
+		json.NewEncoder(w).Encode(client)
+	case parts[0] == "nodes" && len(parts) == 1 && r.Method == "POST":
+		var node chef.Node
+		json.NewDecoder(r.Body).Decode(&node)
+		if _, ok := s.nodes[node.Name]; ok {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		s.nodes[node.Name] = node
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"uri": s.URL + "/nodes/" + node.Name})
+	case parts[0] == "nodes" && len(parts) == 2:
+		node, ok := s.nodes[parts[1]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			json.NewEncoder(w).Encode(node)
+		case "PUT":
+			json.NewDecoder(r.Body).Decode(&node)
+			s.nodes[parts[1]] = node
+			json.NewEncoder(w).Encode(node)
+		case "DELETE":
+			delete(s.nodes, parts[1])
+			json.NewEncoder(w).Encode(node)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *fakeServer) endpoint() configspec.Endpoint {
+	return configspec.Endpoint{URL: s.URL + "/"}
+}
+
+func testKeyPath(t *testing.T) string {
+	path, err := filepath.Abs(filepath.Join("./test-fixtures", "testkey1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNodeManagerApply(t *testing.T) {
+	server := newFakeServer()
+	defer server.Close()
+
+	existing := chef.NewNode("lol.qa.local")
+	existing.RunList = []string{"recipe[base]", "role[role01]"}
+	existing.NormalAttributes = map[string]interface{}{
+		"kafka": map[string]interface{}{"heap": "1g", "port": 9092.0},
+	}
+	server.nodes[existing.Name] = existing
+
+	manager, err := NewNodeManager("admin", testKeyPath(t), server.endpoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec := buildspec.Chef{
+		Environment: "qa",
+		RunList:     []string{"role[role01]", "role[role02]", "ntp"},
+		RunListMode: buildspec.RunListMerge,
+		Attributes: map[string]interface{}{
+			"kafka": map[string]interface{}{"heap": "4g"},
+		},
+	}
+
+	cases := []struct {
+		Host     string
+		Spec     buildspec.Chef
+		Change   Change
+		RunList  []string
+		Expected map[string]interface{}
+	}{
+		{
+			"hello.qa.local",
+			spec,
+			Created,
+			[]string{"role[role01]", "role[role02]", "recipe[ntp]"},
+			map[string]interface{}{"kafka": map[string]interface{}{"heap": "4g"}},
+		},
+		{
+			"lol.qa.local",
+			spec,
+			Updated,
+			[]string{"recipe[base]", "role[role01]", "role[role02]", "recipe[ntp]"},
+			map[string]interface{}{"kafka": map[string]interface{}{"heap": "4g", "port": 9092.0}},
+		},
+		{
+			"lol.qa.local",
+			spec,
+			Unchanged,
+			[]string{"recipe[base]", "role[role01]", "role[role02]", "recipe[ntp]"},
+			map[string]interface{}{"kafka": map[string]interface{}{"heap": "4g", "port": 9092.0}},
+		},
+		{
+			"lol.qa.local",
+			buildspec.Chef{RunList: []string{"role[kafka]"}, RunListMode: buildspec.RunListReplace},
+			Updated,
+			[]string{"role[kafka]"},
+			map[string]interface{}{"kafka": map[string]interface{}{"heap": "4g", "port": 9092.0}},
+		},
+	}
+
+	for _, tt := range cases {
+		seen := len(server.requests)
+
+		change, err := manager.Apply(tt.Host, tt.Spec)
+		if err != nil {
+			t.Fatalf("host: %s\n\n%s", tt.Host, err)
+		}
+
+		if change == Unchanged {
+			for _, req := range server.requests[seen:] {
+				if strings.HasPrefix(req, "PUT ") {
+					t.Fatalf("host: %s\n\nan unchanged node shouldn't be saved", tt.Host)
+				}
+			}
+		}
+
+		if change != tt.Change {
+			t.Fatalf("host: %s\n\n%s != %s", tt.Host, change, tt.Change)
+		}
+
+		node := server.nodes[tt.Host]
+		if node.Environment != "qa" {
+			t.Fatalf("host: %s\n\nenvironment %q != %q", tt.Host, node.Environment, "qa")
+		}
+		if !reflect.DeepEqual(node.RunList, tt.RunList) {
+			t.Fatalf("host: %s\n\n%#v\n\n%#v", tt.Host, node.RunList, tt.RunList)
+		}
+		if !reflect.DeepEqual(node.NormalAttributes, tt.Expected) {
+			t.Fatalf("host: %s\n\n%#v\n\n%#v", tt.Host, node.NormalAttributes, tt.Expected)
+		}
+	}
+}
+
+func TestNodeManagerApplyPolicy(t *testing.T) {
+	server := newFakeServer()
+	defer server.Close()
+
+	existing := chef.NewNode("lol.qa.local")
+	existing.RunList = []string{"role[kafka]"}
+	server.nodes[existing.Name] = existing
+
+	manager, err := NewNodeManager("admin", testKeyPath(t), server.endpoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Host    string
+		RunList []string
+	}{
+		{"hello.qa.local", nil},
+		{"lol.qa.local", []string{"role[kafka]"}},
+	}
+
+	spec := buildspec.Chef{PolicyName: "kafka", PolicyGroup: "qa"}
+	for _, tt := range cases {
+		if _, err := manager.Apply(tt.Host, spec); err != nil {
+			t.Fatalf("host: %s\n\n%s", tt.Host, err)
+		}
+
+		node := server.nodes[tt.Host]
+		if node.PolicyName != "kafka" || node.PolicyGroup != "qa" {
+			t.Fatalf("host: %s\n\npolicy %q/%q != %q/%q", tt.Host, node.PolicyName, node.PolicyGroup, "kafka", "qa")
+		}
+
+		// The run list is left alone
+		if !reflect.DeepEqual(node.RunList, tt.RunList) {
+			t.Fatalf("host: %s\n\n%#v\n\n%#v", tt.Host, node.RunList, tt.RunList)
+		}
+	}
+}
+
+func TestNodeManagerApplyError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	manager, err := NewNodeManager("admin", testKeyPath(t), configspec.Endpoint{URL: server.URL + "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := manager.Apply("hello.qa.local", buildspec.Chef{RunList: []string{"role[role01]"}}); err == nil {
+		t.Fatalf("expected an error from a server that refuses everything")
+	}
+}
+
+func TestPing(t *testing.T) {
+	server := newFakeServer()
+	defer server.Close()
+
+	if err := Ping("jdoe", testKeyPath(t), server.endpoint()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(server.users, []string{"jdoe"}) {
+		t.Fatalf("signed as %#v", server.users)
+	}
+}
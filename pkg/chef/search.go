@@ -0,0 +1,89 @@
+package chef
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+)
+
+// SearchNodes returns the names of the nodes matching the Chef search
+// query, sorted. Requests are signed as username with the key at keyPath.
+func SearchNodes(username, keyPath string, endpoint configspec.Endpoint, query string) ([]string, error) {
+	key, err := ReadKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := NewClient(username, key, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.Search.Exec("node", query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to search for %q: %s", query, err)
+	}
+
+	var names []string
+	for _, row := range result.Rows {
+		node, ok := row.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if name, ok := node["name"].(string); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Query returns a Chef search query that matches the nodes built from the
+// buildspec: those on its policy, or in its environment with everything
+// in its run list. It's empty if the buildspec doesn't say enough to tell
+// its nodes apart.
+func Query(spec buildspec.Chef) string {
+	var terms []string
+
+	if spec.UsesPolicy() {
+		terms = append(terms,
+			"policy_name:"+escapeQuery(spec.PolicyName),
+			"policy_group:"+escapeQuery(spec.PolicyGroup))
+		return strings.Join(terms, " AND ")
+	}
+
+	if spec.Environment != "" {
+		terms = append(terms, "chef_environment:"+escapeQuery(spec.Environment))
+	}
+
+	for _, item := range normalizeRunList(spec.RunList) {
+		// Search expands roles and recipes, so nodes match even if a
+		// recipe comes in through one of their roles
+		field := "recipes"
+		if strings.HasPrefix(item, "role[") {
+			field = "roles"
+		}
+
+		name := item[strings.Index(item, "[")+1 : len(item)-1]
+		terms = append(terms, field+":"+escapeQuery(name))
+	}
+
+	return strings.Join(terms, " AND ")
+}
+
+// escapeQuery escapes the characters that mean something in a Chef search
+// query (which is Lucene syntax).
+func escapeQuery(s string) string {
+	var buf strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`+-&|!(){}[]^"~*?:\/ `, r) {
+			buf.WriteRune('\\')
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
@@ -0,0 +1,77 @@
+package chef
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+)
+
+func TestQuery(t *testing.T) {
+	cases := []struct {
+		Spec     buildspec.Chef
+		Expected string
+	}{
+		{
+			buildspec.Chef{},
+			"",
+		},
+		{
+			buildspec.Chef{
+				Environment: "qa",
+				RunList:     []string{"role[kafka]", "ntp::client"},
+			},
+			`chef_environment:qa AND roles:kafka AND recipes:ntp\:\:client`,
+		},
+		{
+			buildspec.Chef{PolicyName: "kafka", PolicyGroup: "qa-east"},
+			`policy_name:kafka AND policy_group:qa\-east`,
+		},
+	}
+
+	for _, tt := range cases {
+		actual := Query(tt.Spec)
+		if actual != tt.Expected {
+			t.Fatalf("%#v\n\n%q\n\n%q", tt.Spec, actual, tt.Expected)
+		}
+	}
+}
+
+func TestSearchNodes(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/search/node" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		query = r.URL.Query().Get("q")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"total": 2,
+			"start": 0,
+			"rows": []map[string]interface{}{
+				{"name": "lol.qa.local", "chef_environment": "qa"},
+				{"name": "hello.qa.local", "chef_environment": "qa"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	actual, err := SearchNodes("admin", testKeyPath(t), configspec.Endpoint{URL: server.URL + "/"}, "roles:kafka")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"hello.qa.local", "lol.qa.local"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("%#v\n\n%#v", actual, expected)
+	}
+
+	if query != "roles:kafka" {
+		t.Fatalf("searched for %q", query)
+	}
+}
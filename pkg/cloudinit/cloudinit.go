@@ -0,0 +1,208 @@
+// Package cloudinit renders the cloud-init seed hosts built from an image
+// configure themselves with on first boot: their user-data, meta-data and
+// network-config.
+package cloudinit
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+)
+
+// Host is everything a seed is rendered from. User-data templates see it
+// as their dot.
+type Host struct {
+	// Hostname is the host's short name and FQDN its full one.
+	Hostname string
+	FQDN     string
+
+	// Interface and the rest are the host's network settings. IP is empty
+	// when the interface is left to DHCP.
+	Interface   string
+	IP          string
+	Prefix      int
+	Gateway     string
+	Nameservers []string
+	Search      []string
+
+	SSHAuthorizedKeys []string
+
+	// WriteFiles and RunCmd are files written and commands run on first
+	// boot, for bootstrapping configuration management.
+	WriteFiles []File
+	RunCmd     []string
+}
+
+// File is a file cloud-init writes on the host.
+type File struct {
+	Path    string
+	Mode    os.FileMode
+	Content []byte
+}
+
+// Permissions returns the file's mode the way cloud-init wants it.
+func (f File) Permissions() string {
+	return fmt.Sprintf("%#o", f.Mode)
+}
+
+// NewHost returns the Host for name with the buildspec's settings. ip is
+// ignored when the buildspec asks for DHCP.
+func NewHost(name, ip string, spec buildspec.CloudInit) Host {
+	host := Host{
+		Hostname:          strings.SplitN(name, ".", 2)[0],
+		FQDN:              name,
+		Interface:         spec.Interface,
+		SSHAuthorizedKeys: spec.SSHAuthorizedKeys,
+	}
+
+	if !spec.DHCP {
+		host.IP = ip
+		host.Prefix = spec.Prefix
+		host.Gateway = spec.Gateway
+		host.Nameservers = spec.Nameservers
+		host.Search = spec.Search
+	}
+
+	return host
+}
+
+// Seed is a host's cloud-init configuration.
+type Seed struct {
+	UserData      []byte
+	MetaData      []byte
+	NetworkConfig []byte
+}
+
+// funcs are available to every template. Strings are quoted as JSON,
+// which YAML reads too.
+var funcs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		out, err := json.Marshal(v)
+		return string(out), err
+	},
+	"base64": func(b []byte) string {
+		return base64.StdEncoding.EncodeToString(b)
+	},
+}
+
+// DefaultUserData is the user-data template used when the buildspec
+// doesn't have one.
+const DefaultUserData = `#cloud-config
+hostname: {{ json .Hostname }}
+fqdn: {{ json .FQDN }}
+manage_etc_hosts: true
+{{- if .SSHAuthorizedKeys }}
+ssh_authorized_keys:
+{{- range .SSHAuthorizedKeys }}
+  - {{ json . }}
+{{- end }}
+{{- end }}
+{{- if .WriteFiles }}
+write_files:
+{{- range .WriteFiles }}
+  - path: {{ json .Path }}
+    permissions: {{ json .Permissions }}
+    encoding: b64
+    content: {{ base64 .Content }}
+{{- end }}
+{{- end }}
+{{- if .RunCmd }}
+runcmd:
+{{- range .RunCmd }}
+  - {{ json . }}
+{{- end }}
+{{- end }}
+`
+
+const metaData = `instance-id: {{ json .FQDN }}
+local-hostname: {{ json .FQDN }}
+`
+
+const networkConfig = `version: 2
+ethernets:
+  {{ json .Interface }}:
+{{- if .IP }}
+    dhcp4: false
+    addresses:
+      - {{ json (printf "%s/%d" .IP .Prefix) }}
+{{- if .Gateway }}
+    gateway4: {{ json .Gateway }}
+{{- end }}
+{{- if or .Nameservers .Search }}
+    nameservers:
+{{- if .Nameservers }}
+      addresses: {{ json .Nameservers }}
+{{- end }}
+{{- if .Search }}
+      search: {{ json .Search }}
+{{- end }}
+{{- end }}
+{{- else }}
+    dhcp4: true
+{{- end }}
+`
+
+// Render returns the host's seed, with the buildspec's user-data template
+// if it has one.
+func Render(spec buildspec.CloudInit, host Host) (*Seed, error) {
+	if !spec.DHCP && host.IP == "" {
+		return nil, fmt.Errorf("no address for %s, and cloud_init doesn't use dhcp", host.FQDN)
+	}
+
+	userData := spec.UserData
+	if userData == "" {
+		userData = DefaultUserData
+	}
+
+	var seed Seed
+	var err error
+	if seed.UserData, err = render("user_data", userData, host); err != nil {
+		return nil, err
+	}
+	if seed.MetaData, err = render("meta-data", metaData, host); err != nil {
+		return nil, err
+	}
+	if seed.NetworkConfig, err = render("network-config", networkConfig, host); err != nil {
+		return nil, err
+	}
+
+	return &seed, nil
+}
+
+func render(name, text string, host Host) ([]byte, error) {
+	t, err := template.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s template: %s", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, host); err != nil {
+		return nil, fmt.Errorf("unable to render %s for %s: %s", name, host.FQDN, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// GuestInfo returns the seed as the vSphere guestinfo properties
+// cloud-init's VMware datasource reads, with the network config in the
+// metadata.
+func (s *Seed) GuestInfo() map[string]string {
+	encode := base64.StdEncoding.EncodeToString
+
+	var metadata bytes.Buffer
+	metadata.Write(s.MetaData)
+	fmt.Fprintf(&metadata, "network: %s\n", encode(s.NetworkConfig))
+	fmt.Fprintf(&metadata, "network.encoding: base64\n")
+
+	return map[string]string{
+		"guestinfo.metadata":          encode(metadata.Bytes()),
+		"guestinfo.metadata.encoding": "base64",
+		"guestinfo.userdata":          encode(s.UserData),
+		"guestinfo.userdata.encoding": "base64",
+	}
+}
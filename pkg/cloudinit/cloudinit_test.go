@@ -0,0 +1,157 @@
+package cloudinit
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+)
+
+// labSpec is the cloud_init block from the buildspec package's
+// cloud-init.hcl fixture, without its user_data.
+func labSpec() buildspec.CloudInit {
+	return buildspec.CloudInit{
+		Delivery:          buildspec.DeliveryISO,
+		Interface:         "eth0",
+		Prefix:            24,
+		Gateway:           "10.20.0.1",
+		Nameservers:       []string{"10.20.0.2", "10.20.0.3"},
+		Search:            []string{"lab.local"},
+		SSHAuthorizedKeys: []string{"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIHVzCk7yV4d ops@lab.local"},
+	}
+}
+
+func TestRender(t *testing.T) {
+	dhcp := labSpec()
+	dhcp.DHCP = true
+	dhcp.SSHAuthorizedKeys = nil
+
+	cases := []struct {
+		Name  string
+		Spec  buildspec.CloudInit
+		Files []File
+		Cmds  []string
+	}{
+		{
+			"static",
+			labSpec(),
+			[]File{{Path: "/etc/chef/client.rb", Mode: 0644, Content: []byte("node_name 'kafka01.lab.local'\n")}},
+			[]string{"chef-client -j /etc/chef/first-boot.json"},
+		},
+		{
+			"dhcp",
+			dhcp,
+			nil,
+			nil,
+		},
+	}
+
+	for _, tc := range cases {
+		host := NewHost("kafka01.lab.local", "10.20.0.15", tc.Spec)
+		host.WriteFiles = tc.Files
+		host.RunCmd = tc.Cmds
+
+		seed, err := Render(tc.Spec, host)
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Name, err)
+		}
+
+		actual := map[string][]byte{
+			"user-data":      seed.UserData,
+			"meta-data":      seed.MetaData,
+			"network-config": seed.NetworkConfig,
+		}
+		for name, data := range actual {
+			expected, err := ioutil.ReadFile(filepath.Join("test-fixtures", tc.Name, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, expected) {
+				t.Fatalf("%s: bad %s:\n%s", tc.Name, name, data)
+			}
+		}
+	}
+}
+
+func TestRenderUserData(t *testing.T) {
+	spec := labSpec()
+	spec.UserData = "#cloud-config\nhostname: {{ .Hostname }}\n"
+
+	seed, err := Render(spec, NewHost("kafka01.lab.local", "10.20.0.15", spec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(seed.UserData) != "#cloud-config\nhostname: kafka01\n" {
+		t.Fatalf("bad: %q", seed.UserData)
+	}
+
+	spec.UserData = "{{ .Nope }}"
+	if _, err := Render(spec, NewHost("kafka01.lab.local", "10.20.0.15", spec)); err == nil || !strings.Contains(err.Error(), "kafka01.lab.local") {
+		t.Fatalf("expected an error, got %v", err)
+	}
+
+	// Without DHCP the host needs an address
+	if _, err := Render(labSpec(), NewHost("kafka01.lab.local", "", labSpec())); err == nil {
+		t.Fatal("expected an error without an address")
+	}
+}
+
+func TestGuestInfo(t *testing.T) {
+	seed := &Seed{
+		UserData:      []byte("#cloud-config\n"),
+		MetaData:      []byte("instance-id: \"kafka01.lab.local\"\n"),
+		NetworkConfig: []byte("version: 2\n"),
+	}
+	guestinfo := seed.GuestInfo()
+
+	userData, err := base64.StdEncoding.DecodeString(guestinfo["guestinfo.userdata"])
+	if err != nil || string(userData) != "#cloud-config\n" {
+		t.Fatalf("bad userdata: %q %v", userData, err)
+	}
+
+	metadata, err := base64.StdEncoding.DecodeString(guestinfo["guestinfo.metadata"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "instance-id: \"kafka01.lab.local\"\nnetwork: dmVyc2lvbjogMgo=\nnetwork.encoding: base64\n"
+	if string(metadata) != expected {
+		t.Fatalf("bad metadata:\n%s", metadata)
+	}
+
+	for _, key := range []string{"guestinfo.metadata.encoding", "guestinfo.userdata.encoding"} {
+		if guestinfo[key] != "base64" {
+			t.Fatalf("bad %s: %q", key, guestinfo[key])
+		}
+	}
+}
+
+// TestISO makes a real ISO, so it needs one of the tools ISO uses.
+func TestISO(t *testing.T) {
+	found := false
+	for _, tool := range isoTools {
+		if _, err := exec.LookPath(tool[0]); err == nil {
+			found = true
+		}
+	}
+	if !found {
+		t.Skip("none of genisoimage, mkisofs or xorriso are installed")
+	}
+
+	seed := &Seed{UserData: []byte("#cloud-config\n"), MetaData: []byte("instance-id: x\n"), NetworkConfig: []byte("version: 2\n")}
+	iso, err := seed.ISO()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The volume ID is in the primary volume descriptor, which starts at
+	// sector 16
+	const offset = 16*2048 + 40
+	if len(iso) < offset+6 || string(iso[offset:offset+6]) != "CIDATA" && string(iso[offset:offset+6]) != "cidata" {
+		t.Fatalf("no cidata volume ID in the ISO")
+	}
+}
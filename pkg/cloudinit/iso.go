@@ -0,0 +1,68 @@
+package cloudinit
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// VolumeID is the label cloud-init's NoCloud datasource looks for.
+const VolumeID = "cidata"
+
+// isoTools are the commands that can make an ISO, with the arguments that
+// make them behave like mkisofs, in the order they're tried.
+var isoTools = [][]string{
+	{"genisoimage"},
+	{"mkisofs"},
+	{"xorriso", "-as", "mkisofs"},
+}
+
+// ISO returns the seed as a NoCloud ISO image. It needs genisoimage,
+// mkisofs or xorriso.
+func (s *Seed) ISO() ([]byte, error) {
+	var tool []string
+	for _, t := range isoTools {
+		if _, err := exec.LookPath(t[0]); err == nil {
+			tool = t
+			break
+		}
+	}
+	if tool == nil {
+		return nil, fmt.Errorf("making a cloud-init ISO needs genisoimage, mkisofs or xorriso, and none of them are installed")
+	}
+
+	dir, err := ioutil.TempDir("", "overseer-seed")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string][]byte{
+		"user-data":      s.UserData,
+		"meta-data":      s.MetaData,
+		"network-config": s.NetworkConfig,
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			return nil, err
+		}
+	}
+
+	iso := filepath.Join(dir, "seed.iso")
+	args := append(append([]string{}, tool[1:]...), "-output", iso, "-volid", VolumeID, "-joliet", "-rock", "user-data", "meta-data", "network-config")
+
+	cmd := exec.Command(tool[0], args...)
+	cmd.Dir = dir
+
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %s: %s", tool[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return ioutil.ReadFile(iso)
+}
@@ -0,0 +1,216 @@
+package credentials
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// PassphraseEnvVar lets scripts hand over the passphrase without a prompt.
+const PassphraseEnvVar = "OVERSEER_PASSPHRASE"
+
+// ErrBadPassphrase is returned when the store can't be decrypted, which
+// almost always means the passphrase was wrong.
+var ErrBadPassphrase = errors.New("unable to decrypt credential store: wrong passphrase?")
+
+// scrypt parameters for deriving the secretbox key from the passphrase.
+// They're stored alongside the ciphertext so they can be raised later
+// without breaking existing stores.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// Credential is a username and password for one backend.
+type Credential struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Store is an encrypted file of credentials keyed by name, usually a
+// backend ("foreman") or a profile and backend ("indy-prod/foreman").
+type Store struct {
+	path        string
+	passphrase  []byte
+	credentials map[string]Credential
+}
+
+// file is the on-disk format of the store.
+type file struct {
+	Version int    `json:"version"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Box     []byte `json:"box"`
+}
+
+// DefaultPath returns where the store lives for the given home directory.
+func DefaultPath(home string) string {
+	return filepath.Join(home, ".overseer", "credentials")
+}
+
+// Exists reports whether there's a store at path.
+func Exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Open decrypts the store at path. A store that doesn't exist yet is
+// returned empty and is created on the first Save.
+func Open(path string, passphrase []byte) (*Store, error) {
+	s := &Store{
+		path:        path,
+		passphrase:  passphrase,
+		credentials: make(map[string]Credential),
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f file
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("credential store %s is corrupt: %s", path, err)
+	}
+
+	if f.Version != 1 {
+		return nil, fmt.Errorf("credential store %s has unknown version %d", path, f.Version)
+	}
+
+	if len(f.Nonce) != 24 {
+		return nil, fmt.Errorf("credential store %s is corrupt: bad nonce", path)
+	}
+
+	key, err := deriveKey(passphrase, f.Salt, f.N, f.R, f.P)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], f.Nonce)
+
+	plaintext, ok := secretbox.Open(nil, f.Box, &nonce, key)
+	if !ok {
+		return nil, ErrBadPassphrase
+	}
+
+	if err := json.Unmarshal(plaintext, &s.credentials); err != nil {
+		return nil, fmt.Errorf("credential store %s is corrupt: %s", path, err)
+	}
+
+	return s, nil
+}
+
+// Save encrypts the store with a fresh salt and nonce and writes it out
+// readable only by the current user.
+func (s *Store) Save() error {
+	plaintext, err := json.Marshal(s.credentials)
+	if err != nil {
+		return err
+	}
+
+	f := file{
+		Version: 1,
+		N:       scryptN,
+		R:       scryptR,
+		P:       scryptP,
+		Salt:    make([]byte, 32),
+		Nonce:   make([]byte, 24),
+	}
+
+	if _, err := io.ReadFull(rand.Reader, f.Salt); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(rand.Reader, f.Nonce); err != nil {
+		return err
+	}
+
+	key, err := deriveKey(s.passphrase, f.Salt, f.N, f.R, f.P)
+	if err != nil {
+		return err
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], f.Nonce)
+	f.Box = secretbox.Seal(nil, plaintext, &nonce, key)
+
+	b, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a failed write can't leave us
+	// with half a store.
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+// Get returns the credential stored under name.
+func (s *Store) Get(name string) (Credential, bool) {
+	c, ok := s.credentials[name]
+	return c, ok
+}
+
+// Set stores a credential under name, replacing any existing one.
+func (s *Store) Set(name string, c Credential) {
+	s.credentials[name] = c
+}
+
+// Delete removes the credential stored under name and reports whether
+// there was one.
+func (s *Store) Delete(name string) bool {
+	_, ok := s.credentials[name]
+	delete(s.credentials, name)
+	return ok
+}
+
+// Names returns the names of all stored credentials in sorted order.
+func (s *Store) Names() []string {
+	names := make([]string, 0, len(s.credentials))
+	for name := range s.credentials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Credential satisfies configspec.CredentialStore.
+func (s *Store) Credential(name string) (string, string, bool) {
+	c, ok := s.credentials[name]
+	return c.Username, c.Password, ok
+}
+
+func deriveKey(passphrase, salt []byte, n, r, p int) (*[32]byte, error) {
+	b, err := scrypt.Key(passphrase, salt, n, r, p, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	var key [32]byte
+	copy(key[:], b)
+	return &key, nil
+}
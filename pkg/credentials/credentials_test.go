@@ -0,0 +1,77 @@
+package credentials
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overseer-credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := DefaultPath(dir)
+	if Exists(path) {
+		t.Fatalf("store shouldn't exist yet")
+	}
+
+	store, err := Open(path, []byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.Set("foreman", Credential{Username: "admin", Password: "datpass"})
+	store.Set("indy-prod/chef", Credential{Username: "admin", Password: "hunter2"})
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("store should be 0600, got %s", info.Mode().Perm())
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"datpass", "hunter2"} {
+		if bytes.Contains(raw, []byte(secret)) {
+			t.Fatalf("store contains %q in the clear", secret)
+		}
+	}
+
+	if _, err := Open(path, []byte("wrong horse")); err != ErrBadPassphrase {
+		t.Fatalf("expected ErrBadPassphrase, got %v", err)
+	}
+
+	store, err = Open(path, []byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := store.Names(); !reflect.DeepEqual(names, []string{"foreman", "indy-prod/chef"}) {
+		t.Fatalf("unexpected names: %#v", names)
+	}
+
+	username, password, ok := store.Credential("foreman")
+	if !ok || username != "admin" || password != "datpass" {
+		t.Fatalf("unexpected credential: %s/%s/%t", username, password, ok)
+	}
+
+	if !store.Delete("foreman") || store.Delete("foreman") {
+		t.Fatalf("delete should only succeed once")
+	}
+
+	if _, ok := store.Get("foreman"); ok {
+		t.Fatalf("foreman should be gone")
+	}
+}
@@ -0,0 +1,129 @@
+package drift
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// DefaultParallel is how many hosts are checked at once.
+const DefaultParallel = 10
+
+// Difference is something about a host that doesn't match its buildspec.
+type Difference struct {
+	// Source is where the difference was found: "foreman", "vsphere",
+	// "infoblox" or "chef".
+	Source string `json:"source,omitempty"`
+	// Field is what differs, named the way the buildspec names it where
+	// there's a buildspec setting for it.
+	Field string `json:"field"`
+	Have  string `json:"have"`
+	Want  string `json:"want"`
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf("%s %q -> %q", d.Field, d.Have, d.Want)
+}
+
+// Missing is the difference for something the buildspec wants that isn't
+// there at all.
+func Missing(field, want string) Difference {
+	return Difference{Field: field, Have: "missing", Want: want}
+}
+
+// Source compares hosts against what one system says about them.
+type Source struct {
+	Name string
+	Diff func(host string) ([]Difference, error)
+}
+
+// Report is everything found to differ on one host.
+type Report struct {
+	Host        string       `json:"host"`
+	Differences []Difference `json:"differences"`
+	// Errors says which sources the host couldn't be checked against,
+	// and why.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Drifted reports whether the host differs from its buildspec.
+func (r *Report) Drifted() bool {
+	return len(r.Differences) > 0
+}
+
+// Detect checks every host against every source, no more than parallel
+// hosts at a time, and returns a Report per host in the same order as
+// hosts.
+func Detect(hosts []string, sources []Source, parallel int) []*Report {
+	if parallel <= 0 {
+		parallel = DefaultParallel
+	}
+
+	reports := make([]*Report, len(hosts))
+	sem := make(chan struct{}, parallel)
+
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			report := &Report{Host: host, Differences: []Difference{}}
+			for _, source := range sources {
+				diffs, err := source.Diff(host)
+				if err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", source.Name, err))
+					continue
+				}
+
+				for _, diff := range diffs {
+					diff.Source = source.Name
+					report.Differences = append(report.Differences, diff)
+				}
+			}
+			reports[i] = report
+		}(i, host)
+	}
+	wg.Wait()
+
+	return reports
+}
+
+// Format renders the reports as a table with a line per difference,
+// followed by the hosts that couldn't be fully checked and a count of
+// those that drifted.
+func Format(reports []*Report) string {
+	var buf bytes.Buffer
+
+	drifted := 0
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tSOURCE\tFIELD\tHAVE\tWANT")
+	for _, report := range reports {
+		if report.Drifted() {
+			drifted++
+		}
+		for _, diff := range report.Differences {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", report.Host, diff.Source, diff.Field, diff.Have, diff.Want)
+		}
+	}
+	w.Flush()
+
+	var errs []string
+	for _, report := range reports {
+		for _, err := range report.Errors {
+			errs = append(errs, fmt.Sprintf("unable to check %s against %s", report.Host, err))
+		}
+	}
+	if len(errs) > 0 {
+		fmt.Fprintf(&buf, "\n%s\n", strings.Join(errs, "\n"))
+	}
+
+	fmt.Fprintf(&buf, "\n%d of %d hosts drifted\n", drifted, len(reports))
+
+	return buf.String()
+}
@@ -0,0 +1,53 @@
+package drift
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	sources := []Source{
+		{
+			Name: "foreman",
+			Diff: func(host string) ([]Difference, error) {
+				if host == "lol.qa.local" {
+					return []Difference{{Field: "hostgroup", Have: "base", Want: "base/kafka"}}, nil
+				}
+				return nil, nil
+			},
+		},
+		{
+			Name: "chef",
+			Diff: func(host string) ([]Difference, error) {
+				if host == "nope.qa.local" {
+					return nil, errors.New("403 Forbidden")
+				}
+				return nil, nil
+			},
+		},
+	}
+
+	reports := Detect([]string{"hello.qa.local", "lol.qa.local", "nope.qa.local"}, sources, 2)
+
+	expected := []*Report{
+		{Host: "hello.qa.local", Differences: []Difference{}},
+		{Host: "lol.qa.local", Differences: []Difference{{Source: "foreman", Field: "hostgroup", Have: "base", Want: "base/kafka"}}},
+		{Host: "nope.qa.local", Differences: []Difference{}, Errors: []string{"chef: 403 Forbidden"}},
+	}
+	if !reflect.DeepEqual(reports, expected) {
+		t.Fatalf("%#v\n\n%#v", reports, expected)
+	}
+
+	out := Format(reports)
+	for _, s := range []string{
+		"lol.qa.local  foreman  hostgroup  base  base/kafka",
+		"unable to check nope.qa.local against chef: 403 Forbidden",
+		"1 of 3 hosts drifted",
+	} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("%q not in:\n%s", s, out)
+		}
+	}
+}
@@ -1 +1,142 @@
 package foreman
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/transport"
+)
+
+// DefaultAPIVersion is used when the configspec doesn't pin one.
+const DefaultAPIVersion = "2"
+
+// Client is a small client for the Foreman REST API. It only knows how to
+// do the handful of things overseer needs; hammer still does the heavy
+// lifting for now.
+type Client struct {
+	BaseURL  *url.URL
+	Username string
+	Password string
+
+	client *http.Client
+}
+
+// New returns a Client for the Foreman endpoint in the configspec.
+func New(cspec configspec.Foreman) (*Client, error) {
+	if cspec.Endpoint.URL == "" {
+		return nil, fmt.Errorf("no foreman url configured")
+	}
+
+	version := cspec.Endpoint.APIVersion
+	if version == "" {
+		version = DefaultAPIVersion
+	}
+
+	base, err := url.Parse(fmt.Sprintf("%s/api/v%s/", strings.TrimSuffix(cspec.Endpoint.URL, "/"), version))
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := transport.New(cspec.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		BaseURL:  base,
+		Username: cspec.Username,
+		Password: cspec.Password,
+		client:   client,
+	}, nil
+}
+
+// Get decodes the JSON response for the given API path into v.
+func (c *Client) Get(path string, v interface{}) error {
+	return c.do("GET", path, nil, v)
+}
+
+// Put sends body as JSON to the given API path and decodes the response
+// into v, if v isn't nil.
+func (c *Client) Put(path string, body, v interface{}) error {
+	return c.do("PUT", path, body, v)
+}
+
+// Ping checks that Foreman is reachable and accepts our credentials.
+func (c *Client) Ping() error {
+	var status map[string]interface{}
+	return c.Get("status", &status)
+}
+
+// Error is an unsuccessful response from Foreman.
+type Error struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("foreman: %s %s returned %s: %s", e.Method, e.Path, e.Status, e.Message)
+}
+
+// IsNotFound reports whether err is Foreman saying it doesn't have the
+// thing asked for.
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+func (c *Client) do(method, path string, body, v interface{}) error {
+	rel, err := url.Parse(strings.TrimPrefix(path, "/"))
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL.ResolveReference(rel).String(), r)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.Username, c.Password)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return &Error{
+			Method:     method,
+			Path:       path,
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Message:    strings.TrimSpace(string(msg)),
+		}
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -1 +1,90 @@
 package foreman
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+)
+
+func TestGet(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "admin" || pass != "datpass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Path != "/api/v2/status" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"version": "1.12.0"})
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		Name     string
+		Password string
+		Path     string
+		Err      bool
+	}{
+		{"ok", "datpass", "status", false},
+		{"leading slash", "datpass", "/status", false},
+		{"bad password", "nope", "status", true},
+		{"not found", "datpass", "hosts/lol", true},
+	}
+
+	for _, tt := range cases {
+		client, err := New(configspec.Foreman{
+			Username: "admin",
+			Password: tt.Password,
+			Endpoint: configspec.Endpoint{URL: server.URL},
+		})
+		if err != nil {
+			t.Fatalf("case: %s\n\n%s", tt.Name, err)
+		}
+
+		var status map[string]string
+		err = client.Get(tt.Path, &status)
+		if (err != nil) != tt.Err {
+			t.Fatalf("case: %s\n\n%s", tt.Name, err)
+		}
+
+		if err == nil && status["version"] != "1.12.0" {
+			t.Fatalf("case: %s\n\n%#v", tt.Name, status)
+		}
+	}
+}
+
+func TestPing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/status" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"result":"ok","status":200,"version":"1.12.0","api_version":2}`))
+	}))
+	defer server.Close()
+
+	client, err := New(configspec.Foreman{Endpoint: configspec.Endpoint{URL: server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err = New(configspec.Foreman{Endpoint: configspec.Endpoint{URL: server.URL, APIVersion: "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Ping(); err == nil {
+		t.Fatalf("expected an error pinging the wrong api version")
+	}
+}
@@ -0,0 +1,109 @@
+package foreman
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+)
+
+// Host is the part of a Foreman host that overseer looks at.
+type Host struct {
+	ID                  int    `json:"id"`
+	Name                string `json:"name"`
+	IP                  string `json:"ip"`
+	Build               bool   `json:"build"`
+	HostgroupTitle      string `json:"hostgroup_title"`
+	EnvironmentName     string `json:"environment_name"`
+	LocationName        string `json:"location_name"`
+	OrganizationName    string `json:"organization_name"`
+	DomainID            int    `json:"domain_id"`
+	OperatingSystemID   int    `json:"operatingsystem_id"`
+	ArchitectureID      int    `json:"architecture_id"`
+	PartitionTableID    int    `json:"ptable_id"`
+	MediumName          string `json:"medium_name"`
+	ComputeResourceName string `json:"compute_resource_name"`
+	ComputeProfileName  string `json:"compute_profile_name"`
+	// ProvisionMethod is "build" for hosts installed over the network and
+	// "image" for ones cloned from a template, which is in ImageFile.
+	ProvisionMethod string `json:"provision_method"`
+	ImageFile       string `json:"image_file"`
+}
+
+// Provisioning methods Foreman builds hosts with.
+const (
+	ProvisionBuild = "build"
+	ProvisionImage = "image"
+)
+
+// Bare reports whether the host is bare metal rather than a VM on one of
+// Foreman's compute resources, so it's power cycled through its BMC.
+func (h *Host) Bare() bool {
+	return h.ComputeResourceName == ""
+}
+
+// Host returns the named host, or nil if Foreman doesn't have it.
+func (c *Client) Host(name string) (*Host, error) {
+	var host Host
+	err := c.Get("hosts/"+url.PathEscape(name), &host)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &host, nil
+}
+
+// SetBuild puts the host in build mode, so it's reinstalled the next time
+// it boots from the network.
+func (c *Client) SetBuild(id int) error {
+	return c.Put("hosts/"+strconv.Itoa(id), map[string]interface{}{
+		"host": map[string]interface{}{"build": true},
+	}, nil)
+}
+
+// Power runs a power action ("on", "off", "cycle", ...) on the host,
+// through its compute resource or BMC.
+func (c *Client) Power(id int, action string) error {
+	return c.Put("hosts/"+strconv.Itoa(id)+"/power", map[string]string{"power_action": action}, nil)
+}
+
+// Boot sets the device a bare metal host boots from next ("pxe", "disk",
+// ...) through its BMC.
+func (c *Client) Boot(id int, device string) error {
+	return c.Put("hosts/"+strconv.Itoa(id)+"/boot", map[string]string{"device": device}, nil)
+}
+
+// Diff returns the settings in the buildspec's foreman block that the host
+// doesn't match. Settings the buildspec leaves out are ignored.
+func (h *Host) Diff(spec buildspec.Foreman) []drift.Difference {
+	var diffs []drift.Difference
+
+	str := func(field, have, want string) {
+		if want != "" && have != want {
+			diffs = append(diffs, drift.Difference{Field: field, Have: have, Want: want})
+		}
+	}
+	id := func(field string, have, want int) {
+		if want != 0 && have != want {
+			diffs = append(diffs, drift.Difference{Field: field, Have: strconv.Itoa(have), Want: strconv.Itoa(want)})
+		}
+	}
+
+	str("hostgroup", h.HostgroupTitle, spec.Hostgroup)
+	str("location", h.LocationName, spec.Location)
+	str("organization", h.OrganizationName, spec.Organization)
+	str("environment", h.EnvironmentName, spec.Environment)
+	id("architecture_id", h.ArchitectureID, spec.ArchitectureID)
+	str("compute_resource", h.ComputeResourceName, spec.ComputeResource)
+	str("compute_profile", h.ComputeProfileName, spec.ComputeProfile)
+	id("domain_id", h.DomainID, spec.DomainID)
+	id("operating_system_id", h.OperatingSystemID, spec.OperatingSystemID)
+	id("partition_table_id", h.PartitionTableID, spec.PartitionTableID)
+	str("medium", h.MediumName, spec.Medium)
+
+	return diffs
+}
@@ -0,0 +1,128 @@
+package foreman
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+)
+
+func TestHost(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/hosts/hello.qa.local" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"message": "Resource host not found"}})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":              42,
+			"name":            "hello.qa.local",
+			"ip":              "10.0.0.10",
+			"build":           false,
+			"hostgroup_title": "base/kafka",
+			"ptable_id":       6,
+		})
+	}))
+	defer server.Close()
+
+	client, err := New(configspec.Foreman{Endpoint: configspec.Endpoint{URL: server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host, err := client.Host("hello.qa.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &Host{ID: 42, Name: "hello.qa.local", IP: "10.0.0.10", HostgroupTitle: "base/kafka", PartitionTableID: 6}
+	if !reflect.DeepEqual(host, expected) {
+		t.Fatalf("%#v\n\n%#v", host, expected)
+	}
+
+	host, err = client.Host("lol.qa.local")
+	if err != nil || host != nil {
+		t.Fatalf("a missing host should be nil without an error: %#v, %v", host, err)
+	}
+}
+
+func TestHostDiff(t *testing.T) {
+	host := &Host{
+		HostgroupTitle:  "base/kafka",
+		EnvironmentName: "production",
+		DomainID:        6,
+		MediumName:      "centos-7",
+	}
+
+	cases := []struct {
+		Spec     buildspec.Foreman
+		Expected []drift.Difference
+	}{
+		{
+			buildspec.Foreman{},
+			nil,
+		},
+		{
+			buildspec.Foreman{Hostgroup: "base/kafka", Environment: "production", DomainID: 6, Medium: "centos-7"},
+			nil,
+		},
+		{
+			buildspec.Foreman{Hostgroup: "base/zookeeper", DomainID: 7, ComputeProfile: "large"},
+			[]drift.Difference{
+				{Field: "hostgroup", Have: "base/kafka", Want: "base/zookeeper"},
+				{Field: "compute_profile", Have: "", Want: "large"},
+				{Field: "domain_id", Have: "6", Want: "7"},
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		actual := host.Diff(tt.Spec)
+		if !reflect.DeepEqual(actual, tt.Expected) {
+			t.Fatalf("%#v\n\n%#v\n\n%#v", tt.Spec, actual, tt.Expected)
+		}
+	}
+}
+
+func TestHostRebuild(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		b, _ := json.Marshal(body)
+
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+string(b))
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	client, err := New(configspec.Foreman{Endpoint: configspec.Endpoint{URL: server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.SetBuild(42); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Boot(42, "pxe"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Power(42, "cycle"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		`PUT /api/v2/hosts/42 {"host":{"build":true}}`,
+		`PUT /api/v2/hosts/42/boot {"device":"pxe"}`,
+		`PUT /api/v2/hosts/42/power {"power_action":"cycle"}`,
+	}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Fatalf("%#v\n\n%#v", requests, expected)
+	}
+}
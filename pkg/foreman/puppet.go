@@ -0,0 +1,156 @@
+package foreman
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Puppet is the part of a Foreman host that Puppet agents are given when
+// Foreman is their ENC, and what they last reported back.
+type Puppet struct {
+	ID              int    `json:"id"`
+	EnvironmentID   int    `json:"environment_id"`
+	EnvironmentName string `json:"environment_name"`
+	PuppetClasses   []struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"puppetclasses"`
+	LastReport string `json:"last_report"`
+	// ConfigurationStatusLabel sums up the last report: "Active", "No
+	// changes", "Error", "Out of sync" and so on.
+	ConfigurationStatusLabel string `json:"configuration_status_label"`
+}
+
+// ConfigurationError is the status label of hosts whose last report had
+// failed resources.
+const ConfigurationError = "Error"
+
+// Classes returns the names of the host's Puppet classes, sorted.
+func (p *Puppet) Classes() []string {
+	var names []string
+	for _, class := range p.PuppetClasses {
+		names = append(names, class.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LastReportTime returns when the host last reported, or the zero time if
+// it never has.
+func (p *Puppet) LastReportTime() (time.Time, error) {
+	if p.LastReport == "" {
+		return time.Time{}, nil
+	}
+
+	// Older versions don't use RFC 3339
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05 MST"} {
+		if t, err := time.Parse(layout, p.LastReport); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unable to read last_report %q", p.LastReport)
+}
+
+// HostPuppet returns the Puppet settings of the named host, or nil if
+// Foreman doesn't have it.
+func (c *Client) HostPuppet(name string) (*Puppet, error) {
+	var p Puppet
+	err := c.Get("hosts/"+url.PathEscape(name), &p)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// EnvironmentID returns the ID of the named Puppet environment.
+func (c *Client) EnvironmentID(name string) (int, error) {
+	var result struct {
+		Results []struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		} `json:"results"`
+	}
+	if err := c.Get("environments?search="+url.QueryEscape(fmt.Sprintf("name=%q", name)), &result); err != nil {
+		return 0, err
+	}
+
+	for _, env := range result.Results {
+		if env.Name == name {
+			return env.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("foreman doesn't have a puppet environment named %q", name)
+}
+
+// PuppetClassIDs returns the IDs of the named Puppet classes, in the same
+// order. Every class has to have been imported into Foreman.
+func (c *Client) PuppetClassIDs(names []string) ([]int, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	var terms []string
+	for _, name := range names {
+		terms = append(terms, fmt.Sprintf("name=%q", name))
+	}
+
+	// Classes come back grouped by module
+	var result struct {
+		Results map[string][]struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		} `json:"results"`
+	}
+	path := "puppetclasses?per_page=" + strconv.Itoa(len(names)) + "&search=" + url.QueryEscape(strings.Join(terms, " or "))
+	if err := c.Get(path, &result); err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]int)
+	for _, classes := range result.Results {
+		for _, class := range classes {
+			ids[class.Name] = class.ID
+		}
+	}
+
+	var out []int
+	var missing []string
+	for _, name := range names {
+		id, ok := ids[name]
+		if !ok {
+			missing = append(missing, name)
+			continue
+		}
+		out = append(out, id)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("foreman doesn't have the puppet classes %s; have they been imported?", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+// SetPuppet puts the host in the Puppet environment with the given
+// classes. An environmentID of zero leaves the environment alone and nil
+// classes leave them alone.
+func (c *Client) SetPuppet(id, environmentID int, classIDs []int) error {
+	host := make(map[string]interface{})
+	if environmentID != 0 {
+		host["environment_id"] = environmentID
+	}
+	if classIDs != nil {
+		host["puppetclass_ids"] = classIDs
+	}
+	if len(host) == 0 {
+		return nil
+	}
+
+	return c.Put("hosts/"+strconv.Itoa(id), map[string]interface{}{"host": host}, nil)
+}
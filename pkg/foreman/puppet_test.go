@@ -0,0 +1,30 @@
+package foreman
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLastReportTime(t *testing.T) {
+	cases := []struct {
+		LastReport string
+		Expected   time.Time
+		Err        bool
+	}{
+		{"", time.Time{}, false},
+		{"2026-10-19T12:05:00Z", time.Date(2026, 10, 19, 12, 5, 0, 0, time.UTC), false},
+		{"2026-10-19 12:05:00 UTC", time.Date(2026, 10, 19, 12, 5, 0, 0, time.UTC), false},
+		{"yesterday", time.Time{}, true},
+	}
+
+	for _, tc := range cases {
+		p := &Puppet{LastReport: tc.LastReport}
+		actual, err := p.LastReportTime()
+		if (err != nil) != tc.Err {
+			t.Fatalf("%q: err: %v", tc.LastReport, err)
+		}
+		if !actual.Equal(tc.Expected) {
+			t.Fatalf("%q: bad: %s", tc.LastReport, actual)
+		}
+	}
+}
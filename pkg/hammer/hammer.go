@@ -3,6 +3,7 @@ package hammer
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"strconv"
@@ -10,7 +11,7 @@ import (
 
 	"github.com/iamthemuffinman/overseer/configspec"
 	"github.com/iamthemuffinman/overseer/pkg/buildspec"
-	"github.com/iamthemuffinman/overseer/pkg/workerpool"
+	"github.com/iamthemuffinman/overseer/pkg/util"
 
 	log "github.com/iamthemuffinman/logsip"
 )
@@ -21,11 +22,13 @@ import (
 type Hammer struct {
 	Username          string
 	Password          string
+	Endpoint          configspec.Endpoint
 	Hostname          string
 	Organization      string
 	Location          string
 	Hostgroup         string
 	Environment       string
+	Subnet            string
 	PartitionTableID  int
 	OperatingSystemID int
 	Medium            string
@@ -36,6 +39,7 @@ type Hammer struct {
 	Host              Host
 }
 
+// Host is the hardware a host is created with on its compute resource.
 type Host struct {
 	CPUs   int
 	Cores  int
@@ -43,39 +47,130 @@ type Host struct {
 	Disks  []*buildspec.Disk
 }
 
-func New(bspec *buildspec.Spec, cspec *configspec.Spec) *Hammer {
+// New returns a Hammer that creates hosts with the buildspec's foreman
+// settings and the given hardware, talking to the configspec's Foreman.
+func New(spec buildspec.Foreman, cspec configspec.Foreman, host Host) *Hammer {
 	return &Hammer{
-		Username:          cspec.Foreman.Username,
-		Password:          cspec.Foreman.Password,
+		Username:          cspec.Username,
+		Password:          cspec.Password,
+		Endpoint:          cspec.Endpoint,
 		Hostname:          "",
-		Organization:      bspec.Foreman.Organization,
-		Location:          bspec.Foreman.Location,
-		Hostgroup:         bspec.Foreman.Hostgroup,
-		Environment:       bspec.Foreman.Environment,
-		PartitionTableID:  bspec.Foreman.PartitionTableID,
-		OperatingSystemID: bspec.Foreman.OperatingSystemID,
-		Medium:            bspec.Foreman.Medium,
-		ArchitectureID:    bspec.Foreman.ArchitectureID,
-		DomainID:          bspec.Foreman.DomainID,
-		ComputeProfile:    bspec.Foreman.ComputeProfile,
-		ComputeResource:   bspec.Foreman.ComputeResource,
-		Host: Host{
-			CPUs:   bspec.Vsphere.CPUs,
-			Cores:  bspec.Vsphere.Cores,
-			Memory: bspec.Vsphere.Memory,
-			Disks:  bspec.Vsphere.Devices.Disks,
-		},
+		Organization:      spec.Organization,
+		Location:          spec.Location,
+		Hostgroup:         spec.Hostgroup,
+		Environment:       spec.Environment,
+		Subnet:            spec.Subnet,
+		PartitionTableID:  spec.PartitionTableID,
+		OperatingSystemID: spec.OperatingSystemID,
+		Medium:            spec.Medium,
+		ArchitectureID:    spec.ArchitectureID,
+		DomainID:          spec.DomainID,
+		ComputeProfile:    spec.ComputeProfile,
+		ComputeResource:   spec.ComputeResource,
+		Host:              host,
 	}
 }
 
-func (h *Hammer) joinVolumes() string {
+// connectionArgs returns the global hammer options that tell it which
+// Foreman to talk to and how. The username and password aren't among
+// them, since anyone on the machine can read a command line; they go in
+// the config file from config instead.
+func (h *Hammer) connectionArgs() ([]string, error) {
+	var args []string
+
+	if h.Endpoint.URL != "" {
+		args = append(args, "--server", h.Endpoint.URL)
+	}
+	if h.Endpoint.CAFile != "" {
+		caFile, err := util.ExpandPath(h.Endpoint.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--ssl-ca-file", caFile)
+	}
+	if h.Endpoint.CertFile != "" {
+		certFile, err := util.ExpandPath(h.Endpoint.CertFile)
+		if err != nil {
+			return nil, err
+		}
+		keyFile, err := util.ExpandPath(h.Endpoint.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--ssl-client-cert", certFile, "--ssl-client-key", keyFile)
+	}
+	if h.Endpoint.InsecureSkipVerify {
+		args = append(args, "--verify-ssl", "false")
+	}
+
+	return args, nil
+}
+
+// config returns the hammer config file that holds the credentials and,
+// when the endpoint has one, the request timeout, which hammer only takes
+// from its config files.
+func (h *Hammer) config() string {
+	var buf bytes.Buffer
+	buf.WriteString(":foreman:\n")
+	fmt.Fprintf(&buf, "  :username: %s\n", strconv.Quote(h.Username))
+	fmt.Fprintf(&buf, "  :password: %s\n", strconv.Quote(h.Password))
+	if h.Endpoint.Timeout > 0 {
+		fmt.Fprintf(&buf, "  :request_timeout: %d\n", h.Endpoint.Timeout)
+	}
+	return buf.String()
+}
+
+// command returns a hammer command with the connection options in front
+// of args. The config from config is written to a file only the user can
+// read for the command to load; the returned func removes it once the
+// command is done.
+func (h *Hammer) command(args ...string) (*exec.Cmd, func(), error) {
+	connArgs, err := h.connectionArgs()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// TempFile creates the file 0600
+	f, err := ioutil.TempFile("", "overseer-hammer")
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = f.WriteString(h.config())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, nil, err
+	}
+	cleanup := func() { os.Remove(f.Name()) }
+
+	connArgs = append([]string{"-c", f.Name()}, connArgs...)
+	hammer := exec.Command("hammer", append(connArgs, args...)...)
+	hammer.Env = h.env()
+	hammer.Stderr = os.Stderr
+
+	return hammer, cleanup, nil
+}
+
+// env returns the environment for hammer. Hammer doesn't take a proxy on
+// the command line, but it does honor the usual proxy variables.
+func (h *Hammer) env() []string {
+	env := os.Environ()
+	if h.Endpoint.Proxy != "" {
+		env = append(env, "http_proxy="+h.Endpoint.Proxy, "https_proxy="+h.Endpoint.Proxy)
+	}
+	return env
+}
+
+func (h *Hammer) volumeArgs() []string {
 	var volumes []string
 
 	for _, disk := range h.Host.Disks {
-		volumes = append(volumes, fmt.Sprintf("--volume size_gb=%d", disk.Size))
+		volumes = append(volumes, "--volume", fmt.Sprintf("size_gb=%d", disk.Size))
 	}
 
-	return strings.Join(volumes, ", ")
+	return volumes
 }
 
 func (h *Hammer) joinComputeAttributes() string {
@@ -85,52 +180,144 @@ func (h *Hammer) joinComputeAttributes() string {
 }
 
 func (h *Hammer) Execute() error {
-	// Build massive hammer command
-	// I can't wait for this to be replace by go-foreman
-	hammer := exec.Command("hammer", fmt.Sprintf(`-u %q -p %q host create --name %q --organization %q --location %q
-	--hostgroup-title %q --environment %q --partition-table-id %q --operatingsystem-id %q --medium %q --architecture-id %q
-	--domain-id %q --subnet %q --compute-profile %q --compute-attributes %q %q --compute-resource %q`,
-		h.Username, h.Password, h.Hostname, h.Organization, h.Location, h.Location, h.Environment, h.PartitionTableID,
-		h.OperatingSystemID, h.Medium, h.ArchitectureID, h.DomainID, h.Location, h.ComputeProfile, h.joinComputeAttributes(),
-		h.joinVolumes(), h.ComputeResource))
-
+	hammer, cleanup, err := h.command(h.createArgs()...)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
 	hammer.Stdout = os.Stdout
-	hammer.Stderr = os.Stderr
 
-	log.Infof("Executing: %s", strings.Join(hammer.Args, " "))
+	log.Infof("Executing: hammer host create --name %s", h.Hostname)
 
-	// Create a job to run the hammer command
-	job := workerpool.Job{Command: hammer}
-
-	// Push the job onto the queue
-	workerpool.JobQueue <- job
+	// Whether the host was created is saved with the run, so this waits
+	// for hammer rather than going through the job queue.
+	if err := hammer.Run(); err != nil {
+		return fmt.Errorf("hammer host create --name %s: %s", h.Hostname, err)
+	}
 
 	return nil
 }
 
-func (h *Hammer) GetBuildStatus() (int, error) {
-	hammer := exec.Command("hammer", fmt.Sprintf(`-u %q -p %q host info --name %q | grep "Build" | grep -ic "yes"`, h.Username, h.Password, h.Hostname))
+func (h *Hammer) createArgs() []string {
+	args := []string{"host", "create",
+		"--name", h.Hostname,
+		"--organization", h.Organization,
+		"--location", h.Location,
+		"--hostgroup-title", h.Hostgroup,
+		"--environment", h.Environment,
+		"--partition-table-id", strconv.Itoa(h.PartitionTableID),
+		"--operatingsystem-id", strconv.Itoa(h.OperatingSystemID),
+		"--medium", h.Medium,
+		"--architecture-id", strconv.Itoa(h.ArchitectureID),
+		"--domain-id", strconv.Itoa(h.DomainID),
+	}
+	// Without a subnet Foreman falls back to the hostgroup's
+	if h.Subnet != "" {
+		args = append(args, "--subnet", h.Subnet)
+	}
+	args = append(args,
+		"--compute-profile", h.ComputeProfile,
+		"--compute-attributes", h.joinComputeAttributes(),
+	)
+	args = append(args, h.volumeArgs()...)
+	args = append(args, "--compute-resource", h.ComputeResource)
 
-	var buf bytes.Buffer
+	return args
+}
 
-	hammer.Stdout = &buf
-	hammer.Stderr = os.Stderr
+// Update changes the named buildspec foreman settings (as given by
+// foreman.Host.Diff) on an existing host to what the buildspec says.
+func (h *Hammer) Update(fields []string) error {
+	args, err := h.updateArgs(fields)
+	if err != nil {
+		return err
+	}
+
+	hammer, cleanup, err := h.command(args...)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	hammer.Stdout = os.Stdout
+
+	log.Infof("Executing: hammer host update --name %s", h.Hostname)
+
+	if err := hammer.Run(); err != nil {
+		return fmt.Errorf("hammer host update --name %s: %s", h.Hostname, err)
+	}
+
+	return nil
+}
 
-	log.Infof("Executing: %s", strings.Join(hammer.Args, " "))
+func (h *Hammer) updateArgs(fields []string) ([]string, error) {
+	args := []string{"host", "update", "--name", h.Hostname}
+
+	for _, field := range fields {
+		switch field {
+		case "hostgroup":
+			args = append(args, "--hostgroup-title", h.Hostgroup)
+		case "location":
+			args = append(args, "--location", h.Location)
+		case "organization":
+			args = append(args, "--organization", h.Organization)
+		case "environment":
+			args = append(args, "--environment", h.Environment)
+		case "architecture_id":
+			args = append(args, "--architecture-id", strconv.Itoa(h.ArchitectureID))
+		case "domain_id":
+			args = append(args, "--domain-id", strconv.Itoa(h.DomainID))
+		case "operating_system_id":
+			args = append(args, "--operatingsystem-id", strconv.Itoa(h.OperatingSystemID))
+		case "partition_table_id":
+			args = append(args, "--partition-table-id", strconv.Itoa(h.PartitionTableID))
+		case "medium":
+			args = append(args, "--medium", h.Medium)
+		case "compute_profile":
+			args = append(args, "--compute-profile", h.ComputeProfile)
+		case "compute_resource":
+			return nil, fmt.Errorf("%s can't be moved to compute resource %q without being rebuilt", h.Hostname, h.ComputeResource)
+		default:
+			return nil, fmt.Errorf("don't know how to update %s on an existing host", field)
+		}
+	}
+
+	return args, nil
+}
 
-	// Create a job to run the hammer command
-	job := workerpool.Job{Command: hammer}
+// GetBuildStatus returns 0 once Foreman reports the host as built and 1
+// while it's still waiting on the build.
+func (h *Hammer) GetBuildStatus() (int, error) {
+	hammer, cleanup, err := h.command("host", "info", "--name", h.Hostname)
+	if err != nil {
+		return -1, err
+	}
+	defer cleanup()
 
-	// Push the job onto the queue
-	workerpool.JobQueue <- job
+	log.Infof("Executing: hammer host info --name %s", h.Hostname)
 
-	// trim all the space just in case (see what I did there?)
-	trimmed := strings.TrimSpace(buf.String())
-	// convert output from string to int
-	output, err := strconv.Atoi(trimmed)
+	// We need the output right away, so this one doesn't go through the
+	// job queue.
+	output, err := hammer.Output()
 	if err != nil {
-		return -1, nil
+		return -1, err
+	}
+
+	return parseBuildStatus(output), nil
+}
+
+// parseBuildStatus looks for the "Build:" line in the output of hammer
+// host info. Foreman says "yes" while the host is still pending a build.
+func parseBuildStatus(output []byte) int {
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if len(fields) != 2 || fields[0] != "Build" {
+			continue
+		}
+
+		if strings.EqualFold(strings.TrimSpace(fields[1]), "yes") {
+			return 1
+		}
 	}
 
-	return output, nil
+	return 0
 }
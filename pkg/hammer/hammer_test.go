@@ -1 +1,184 @@
 package hammer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/mitchellh/go-homedir"
+)
+
+func TestConnectionArgs(t *testing.T) {
+	home, err := homedir.Dir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Endpoint configspec.Endpoint
+		Expected []string
+	}{
+		{
+			configspec.Endpoint{},
+			nil,
+		},
+		{
+			configspec.Endpoint{
+				URL:      "https://foreman.qa.local",
+				CAFile:   "/etc/pki/ca.pem",
+				CertFile: "client.crt",
+				KeyFile:  "client.key",
+			},
+			[]string{
+				"--server", "https://foreman.qa.local",
+				"--ssl-ca-file", "/etc/pki/ca.pem",
+				"--ssl-client-cert", "client.crt", "--ssl-client-key", "client.key",
+			},
+		},
+		{
+			configspec.Endpoint{CAFile: "~/ca.pem", CertFile: "~/client.crt", KeyFile: "~/client.key"},
+			[]string{
+				"--ssl-ca-file", filepath.Join(home, "ca.pem"),
+				"--ssl-client-cert", filepath.Join(home, "client.crt"), "--ssl-client-key", filepath.Join(home, "client.key"),
+			},
+		},
+		{
+			configspec.Endpoint{URL: "https://foreman.qa.local", InsecureSkipVerify: true},
+			[]string{"--server", "https://foreman.qa.local", "--verify-ssl", "false"},
+		},
+	}
+
+	for _, tt := range cases {
+		h := &Hammer{Username: "admin", Password: "datpass", Endpoint: tt.Endpoint}
+
+		actual, err := h.connectionArgs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, tt.Expected) {
+			t.Fatalf("%#v\n\n%#v", actual, tt.Expected)
+		}
+	}
+}
+
+func TestParseBuildStatus(t *testing.T) {
+	cases := []struct {
+		Output   string
+		Expected int
+	}{
+		{"Name:  hello.qa.local\nBuild: yes\n", 1},
+		{"Name:  hello.qa.local\nBuild: no\n", 0},
+		{"Name:  hello.qa.local\nBuild Status: yes\n", 0},
+	}
+
+	for _, tt := range cases {
+		if actual := parseBuildStatus([]byte(tt.Output)); actual != tt.Expected {
+			t.Fatalf("output: %q\n\n%d != %d", tt.Output, actual, tt.Expected)
+		}
+	}
+}
+
+func TestUpdateArgs(t *testing.T) {
+	h := &Hammer{
+		Hostname:        "hello.qa.local",
+		Hostgroup:       "base/kafka",
+		DomainID:        6,
+		ComputeResource: "vcenter02",
+	}
+
+	cases := []struct {
+		Fields   []string
+		Expected []string
+		Err      bool
+	}{
+		{
+			nil,
+			[]string{"host", "update", "--name", "hello.qa.local"},
+			false,
+		},
+		{
+			[]string{"hostgroup", "domain_id"},
+			[]string{"host", "update", "--name", "hello.qa.local", "--hostgroup-title", "base/kafka", "--domain-id", "6"},
+			false,
+		},
+		{
+			[]string{"hostgroup", "compute_resource"},
+			nil,
+			true,
+		},
+	}
+
+	for _, tt := range cases {
+		actual, err := h.updateArgs(tt.Fields)
+		if (err != nil) != tt.Err {
+			t.Fatalf("fields: %v\n\n%s", tt.Fields, err)
+		}
+
+		if !reflect.DeepEqual(actual, tt.Expected) {
+			t.Fatalf("%#v\n\n%#v", actual, tt.Expected)
+		}
+	}
+}
+
+func TestCreateArgs(t *testing.T) {
+	h := &Hammer{Hostname: "hello.qa.local", Subnet: "qa-appservers", ComputeResource: "vcenter01"}
+
+	args := h.createArgs()
+	for i, arg := range args {
+		if arg == "--subnet" {
+			if args[i+1] != "qa-appservers" {
+				t.Fatalf("bad subnet: %q", args[i+1])
+			}
+			return
+		}
+	}
+	t.Fatalf("no --subnet in %#v", args)
+}
+
+func TestCommand(t *testing.T) {
+	h := &Hammer{
+		Username: "admin",
+		Password: `dat"pass`,
+		Endpoint: configspec.Endpoint{URL: "https://foreman.qa.local", Timeout: 30},
+	}
+
+	cmd, cleanup, err := h.command("host", "info", "--name", "hello.qa.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, arg := range cmd.Args {
+		if arg == "admin" || arg == h.Password {
+			t.Fatalf("credentials on the command line: %q", cmd.Args)
+		}
+	}
+	if cmd.Args[1] != "-c" {
+		t.Fatalf("no config file: %q", cmd.Args)
+	}
+	path := cmd.Args[2]
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("config file is %s", info.Mode().Perm())
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ":foreman:\n  :username: \"admin\"\n  :password: \"dat\\\"pass\"\n  :request_timeout: 30\n"
+	if string(b) != expected {
+		t.Fatalf("%q\n\n%q", b, expected)
+	}
+
+	cleanup()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("config file wasn't removed: %v", err)
+	}
+}
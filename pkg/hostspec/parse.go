@@ -11,6 +11,9 @@ import (
 type Spec struct {
 	Hosts []string
 	MACs  []string
+	// Vars are the key=value pairs given after a host, by host. It's nil
+	// when no host has any.
+	Vars map[string]map[string]string
 }
 
 func ParseFile(path string) (*Spec, error) {
@@ -32,7 +35,29 @@ func ParseFile(path string) (*Spec, error) {
 		// so I'm gonna go ahead and take care of all extraenous space
 		// on both ends of the line.
 		trimmedLine := strings.TrimSpace(scanner.Text())
-		line := strings.Split(trimmedLine, " ")
+		fields := strings.Split(trimmedLine, " ")
+
+		// Anything after the hostname with an = in it is a variable for
+		// the host, for configuration management to use
+		line := fields[:1]
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				line = append(line, field)
+				continue
+			}
+			if kv[0] == "" {
+				return nil, fmt.Errorf("hostspec has a variable without a name for %s: %q", fields[0], field)
+			}
+
+			if spec.Vars == nil {
+				spec.Vars = make(map[string]map[string]string)
+			}
+			if spec.Vars[fields[0]] == nil {
+				spec.Vars[fields[0]] = make(map[string]string)
+			}
+			spec.Vars[fields[0]][kv[0]] = kv[1]
+		}
 
 		// We only have one field so it's probably just the hostname
 		if len(line) == 1 {
@@ -46,6 +46,32 @@ func TestParse(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"varspec",
+			&Spec{
+				Hosts: []string{
+					"kafka01.lab.local",
+					"kafka02.lab.local",
+					"kafka03.lab.local",
+				},
+				Vars: map[string]map[string]string{
+					"kafka01.lab.local": {"broker_id": "1", "rack": "a"},
+					"kafka02.lab.local": {"broker_id": "2", "rack": "b"},
+				},
+			},
+			false,
+		},
+		{
+			"physicalvarspec",
+			&Spec{
+				Hosts: []string{"hello.qa.local", "lol.qa.local"},
+				MACs:  []string{"1C:29:DF:E5:AA:B5", "52:65:06:7A:C5:C8"},
+				Vars: map[string]map[string]string{
+					"hello.qa.local": {"rack": "a"},
+				},
+			},
+			false,
+		},
 	}
 
 	for _, tt := range cases {
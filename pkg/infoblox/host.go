@@ -0,0 +1,73 @@
+package infoblox
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// HostRecord is a host record, which is how Infoblox reserves addresses
+// for hosts. Overseer's are made without DNS, which is left to A records.
+type HostRecord struct {
+	Ref             string     `json:"_ref,omitempty"`
+	Name            string     `json:"name"`
+	ConfigureForDNS bool       `json:"configure_for_dns"`
+	IPv4Addrs       []HostAddr `json:"ipv4addrs"`
+}
+
+// HostAddr is one of a host record's addresses.
+type HostAddr struct {
+	IPv4Addr string `json:"ipv4addr"`
+}
+
+// HostRecord returns the host record for name, or nil if there isn't one.
+func (c *Client) HostRecord(name string) (*HostRecord, error) {
+	var records []*HostRecord
+	if err := c.Get("record:host", url.Values{"name": {name}}, &records); err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return records[0], nil
+}
+
+// HostAddress returns the address reserved for name, or "" if there isn't
+// one.
+func (c *Client) HostAddress(name string) (string, error) {
+	record, err := c.HostRecord(name)
+	if err != nil {
+		return "", fmt.Errorf("unable to look up host record for %s: %s", name, err)
+	}
+	if record == nil || len(record.IPv4Addrs) == 0 {
+		return "", nil
+	}
+	return record.IPv4Addrs[0].IPv4Addr, nil
+}
+
+// AllocateHostAddress reserves the next available address in subnet (in
+// CIDR notation) for name and returns it. A name that already has one
+// keeps it, so running it again doesn't use up the subnet.
+func (c *Client) AllocateHostAddress(name, subnet string) (string, error) {
+	ip, err := c.HostAddress(name)
+	if err != nil || ip != "" {
+		return ip, err
+	}
+
+	record := &HostRecord{
+		Name:      name,
+		IPv4Addrs: []HostAddr{{IPv4Addr: "func:nextavailableip:" + subnet}},
+	}
+	if _, err := c.Create("record:host", record); err != nil {
+		return "", fmt.Errorf("unable to reserve an address in %s for %s: %s", subnet, name, err)
+	}
+
+	ip, err = c.HostAddress(name)
+	if err != nil {
+		return "", err
+	}
+	if ip == "" {
+		return "", fmt.Errorf("infoblox didn't give %s an address in %s", name, subnet)
+	}
+	return ip, nil
+}
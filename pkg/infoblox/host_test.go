@@ -0,0 +1,82 @@
+package infoblox
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+)
+
+// fakeHostWAPI keeps host records by name and hands out addresses from
+// 10.0.0.0/24, starting at .10.
+type fakeHostWAPI struct {
+	records map[string]*HostRecord
+	next    int
+}
+
+func (f *fakeHostWAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/wapi/v2.5/")
+
+	switch {
+	case r.Method == "GET" && path == "record:host":
+		records := []*HostRecord{}
+		if record := f.records[r.URL.Query().Get("name")]; record != nil {
+			records = append(records, record)
+		}
+		json.NewEncoder(w).Encode(records)
+	case r.Method == "POST" && path == "record:host":
+		var record HostRecord
+		json.NewDecoder(r.Body).Decode(&record)
+		if len(record.IPv4Addrs) != 1 || record.IPv4Addrs[0].IPv4Addr != "func:nextavailableip:10.0.0.0/24" || record.ConfigureForDNS {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		record.Ref = "record:host/" + record.Name
+		record.IPv4Addrs[0].IPv4Addr = fmt.Sprintf("10.0.0.%d", f.next)
+		f.next++
+		f.records[record.Name] = &record
+		json.NewEncoder(w).Encode(record.Ref)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestAllocateHostAddress(t *testing.T) {
+	wapi := &fakeHostWAPI{records: make(map[string]*HostRecord), next: 10}
+	server := httptest.NewServer(wapi)
+	defer server.Close()
+
+	client, err := New(configspec.Infoblox{Endpoint: configspec.Endpoint{URL: server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Name     string
+		Expected string
+	}{
+		{"hello.qa.local", "10.0.0.10"},
+		{"lol.qa.local", "10.0.0.11"},
+		// Already reserved
+		{"hello.qa.local", "10.0.0.10"},
+	}
+
+	for _, tt := range cases {
+		ip, err := client.AllocateHostAddress(tt.Name, "10.0.0.0/24")
+		if err != nil {
+			t.Fatalf("%s: %s", tt.Name, err)
+		}
+		if ip != tt.Expected {
+			t.Fatalf("%s: got %s, expected %s", tt.Name, ip, tt.Expected)
+		}
+	}
+
+	ip, err := client.HostAddress("missing.qa.local")
+	if err != nil || ip != "" {
+		t.Fatalf("expected no address, got %q %v", ip, err)
+	}
+}
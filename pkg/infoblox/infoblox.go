@@ -1 +1,124 @@
 package infoblox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/transport"
+)
+
+// DefaultAPIVersion is the WAPI version used when the configspec doesn't
+// pin one.
+const DefaultAPIVersion = "2.5"
+
+// Client talks to the Infoblox WAPI.
+type Client struct {
+	BaseURL  *url.URL
+	Username string
+	Password string
+
+	client *http.Client
+}
+
+// New returns a Client for the Infoblox endpoint in the configspec.
+func New(cspec configspec.Infoblox) (*Client, error) {
+	if cspec.Endpoint.URL == "" {
+		return nil, fmt.Errorf("no infoblox url configured")
+	}
+
+	version := cspec.Endpoint.APIVersion
+	if version == "" {
+		version = DefaultAPIVersion
+	}
+
+	base, err := url.Parse(fmt.Sprintf("%s/wapi/v%s/", strings.TrimSuffix(cspec.Endpoint.URL, "/"), version))
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := transport.New(cspec.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		BaseURL:  base,
+		Username: cspec.Username,
+		Password: cspec.Password,
+		client:   client,
+	}, nil
+}
+
+// Get searches for objects of the given type (e.g. "record:a") and
+// decodes the results into v.
+func (c *Client) Get(object string, params url.Values, v interface{}) error {
+	return c.do("GET", object, params, nil, v)
+}
+
+// Create creates an object of the given type from body and returns the
+// new object's reference.
+func (c *Client) Create(object string, body interface{}) (string, error) {
+	var ref string
+	err := c.do("POST", object, nil, body, &ref)
+	return ref, err
+}
+
+// Update changes the fields in body on the object with the given
+// reference.
+func (c *Client) Update(ref string, body interface{}) error {
+	return c.do("PUT", ref, nil, body, nil)
+}
+
+// Ping checks that the WAPI is reachable and accepts our credentials by
+// asking it for its schema.
+func (c *Client) Ping() error {
+	var schema map[string]interface{}
+	return c.Get("", url.Values{"_schema": {""}}, &schema)
+}
+
+func (c *Client) do(method, object string, params url.Values, body, v interface{}) error {
+	// WAPI object types look like "record:a", which url.Parse would take
+	// for a scheme, so build the reference by hand.
+	rel := &url.URL{Path: strings.TrimPrefix(object, "/"), RawQuery: params.Encode()}
+
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL.ResolveReference(rel).String(), r)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.Username, c.Password)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("infoblox: %s %s returned %s: %s", method, object, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
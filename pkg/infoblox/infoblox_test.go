@@ -1 +1,63 @@
 package infoblox
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+)
+
+func TestGet(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := r.BasicAuth(); !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Path == "/wapi/v2.7/" {
+			if _, ok := r.URL.Query()["_schema"]; ok {
+				json.NewEncoder(w).Encode(map[string]interface{}{"requested_version": "2.7"})
+				return
+			}
+		}
+
+		if r.URL.Path != "/wapi/v2.7/record:a" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode([]map[string]string{
+			{"name": r.URL.Query().Get("name"), "ipv4addr": "192.168.1.10"},
+		})
+	}))
+	defer server.Close()
+
+	client, err := New(configspec.Infoblox{
+		Username: "admin",
+		Password: "datpass",
+		Endpoint: configspec.Endpoint{URL: server.URL, APIVersion: "2.7"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records []map[string]string
+	if err := client.Get("record:a", url.Values{"name": {"hello.qa.local"}}, &records); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 1 || records[0]["name"] != "hello.qa.local" {
+		t.Fatalf("unexpected records: %#v", records)
+	}
+
+	if err := client.Get("record:cname", nil, &records); err == nil {
+		t.Fatalf("expected an error for an unknown object")
+	}
+
+	if err := client.Ping(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,70 @@
+package infoblox
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+)
+
+// ARecord is a DNS A record.
+type ARecord struct {
+	Ref      string `json:"_ref,omitempty"`
+	Name     string `json:"name"`
+	IPv4Addr string `json:"ipv4addr"`
+}
+
+// ARecord returns the A record for name, or nil if there isn't one.
+func (c *Client) ARecord(name string) (*ARecord, error) {
+	var records []*ARecord
+	if err := c.Get("record:a", url.Values{"name": {name}}, &records); err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return records[0], nil
+}
+
+// EnsureARecord makes sure name has an A record pointing at ip, creating
+// or correcting it as needed. It returns "created", "updated" or
+// "unchanged" to say which.
+func (c *Client) EnsureARecord(name, ip string) (string, error) {
+	record, err := c.ARecord(name)
+	if err != nil {
+		return "", fmt.Errorf("unable to look up A record for %s: %s", name, err)
+	}
+
+	if record == nil {
+		if _, err := c.Create("record:a", &ARecord{Name: name, IPv4Addr: ip}); err != nil {
+			return "", fmt.Errorf("unable to create A record for %s: %s", name, err)
+		}
+		return "created", nil
+	}
+
+	if record.IPv4Addr == ip {
+		return "unchanged", nil
+	}
+
+	if err := c.Update(record.Ref, map[string]string{"ipv4addr": ip}); err != nil {
+		return "", fmt.Errorf("unable to update A record for %s: %s", name, err)
+	}
+	return "updated", nil
+}
+
+// DiffARecord returns how name's A record differs from pointing at ip.
+func (c *Client) DiffARecord(name, ip string) ([]drift.Difference, error) {
+	record, err := c.ARecord(name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to look up A record for %s: %s", name, err)
+	}
+
+	switch {
+	case record == nil:
+		return []drift.Difference{drift.Missing("a_record", ip)}, nil
+	case record.IPv4Addr != ip:
+		return []drift.Difference{{Field: "a_record", Have: record.IPv4Addr, Want: ip}}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,122 @@
+package infoblox
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+)
+
+// fakeWAPI keeps A records by name, keyed by reference.
+type fakeWAPI struct {
+	mu      sync.Mutex
+	records map[string]*ARecord
+}
+
+func (f *fakeWAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/wapi/v2.5/")
+
+	switch {
+	case r.Method == "GET" && path == "record:a":
+		records := []*ARecord{}
+		for _, record := range f.records {
+			if record.Name == r.URL.Query().Get("name") {
+				records = append(records, record)
+			}
+		}
+		json.NewEncoder(w).Encode(records)
+	case r.Method == "POST" && path == "record:a":
+		var record ARecord
+		json.NewDecoder(r.Body).Decode(&record)
+		record.Ref = "record:a/" + record.Name
+		f.records[record.Ref] = &record
+		json.NewEncoder(w).Encode(record.Ref)
+	case r.Method == "PUT" && f.records[path] != nil:
+		var fields map[string]string
+		json.NewDecoder(r.Body).Decode(&fields)
+		f.records[path].IPv4Addr = fields["ipv4addr"]
+		json.NewEncoder(w).Encode(path)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestEnsureARecord(t *testing.T) {
+	wapi := &fakeWAPI{records: map[string]*ARecord{
+		"record:a/lol.qa.local": {Ref: "record:a/lol.qa.local", Name: "lol.qa.local", IPv4Addr: "10.0.0.11"},
+	}}
+	server := httptest.NewServer(wapi)
+	defer server.Close()
+
+	client, err := New(configspec.Infoblox{Endpoint: configspec.Endpoint{URL: server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Name     string
+		IP       string
+		Expected string
+	}{
+		{"hello.qa.local", "10.0.0.10", "created"},
+		{"hello.qa.local", "10.0.0.10", "unchanged"},
+		{"lol.qa.local", "10.0.0.12", "updated"},
+		{"lol.qa.local", "10.0.0.12", "unchanged"},
+	}
+
+	for _, tt := range cases {
+		actual, err := client.EnsureARecord(tt.Name, tt.IP)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.Name, err)
+		}
+		if actual != tt.Expected {
+			t.Fatalf("%s -> %s: %s, expected %s", tt.Name, tt.IP, actual, tt.Expected)
+		}
+	}
+
+	if wapi.records["record:a/lol.qa.local"].IPv4Addr != "10.0.0.12" {
+		t.Fatalf("%#v", wapi.records["record:a/lol.qa.local"])
+	}
+}
+
+func TestDiffARecord(t *testing.T) {
+	wapi := &fakeWAPI{records: map[string]*ARecord{
+		"record:a/lol.qa.local": {Ref: "record:a/lol.qa.local", Name: "lol.qa.local", IPv4Addr: "10.0.0.11"},
+	}}
+	server := httptest.NewServer(wapi)
+	defer server.Close()
+
+	client, err := New(configspec.Infoblox{Endpoint: configspec.Endpoint{URL: server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Name     string
+		IP       string
+		Expected []drift.Difference
+	}{
+		{"lol.qa.local", "10.0.0.11", nil},
+		{"lol.qa.local", "10.0.0.12", []drift.Difference{{Field: "a_record", Have: "10.0.0.11", Want: "10.0.0.12"}}},
+		{"hello.qa.local", "10.0.0.10", []drift.Difference{{Field: "a_record", Have: "missing", Want: "10.0.0.10"}}},
+	}
+
+	for _, tt := range cases {
+		actual, err := client.DiffARecord(tt.Name, tt.IP)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, tt.Expected) {
+			t.Fatalf("%#v\n\n%#v", actual, tt.Expected)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package knife
 
 import (
+	"os"
+
+	"github.com/iamthemuffinman/overseer/configspec"
 	"github.com/iamthemuffinman/overseer/pkg/buildspec"
 )
 
@@ -8,12 +11,51 @@ type Knife struct {
 	Hostname    string
 	Environment string
 	RunList     []string
+	Username    string
+	ClientKey   string
+	Endpoint    configspec.Endpoint
 }
 
-func New(bspec *buildspec.Spec) *Knife {
+func New(bspec *buildspec.Spec, cspec *configspec.Spec) *Knife {
 	return &Knife{
 		Hostname:    "",
 		Environment: bspec.Chef.Environment,
 		RunList:     bspec.Chef.RunList,
+		Username:    cspec.Chef.Username,
+		ClientKey:   cspec.Chef.ClientKey,
+		Endpoint:    cspec.Chef.Endpoint,
+	}
+}
+
+// connectionArgs returns the options that point knife at the Chef server
+// from the configspec instead of whatever knife.rb says.
+func (k *Knife) connectionArgs() []string {
+	var args []string
+
+	if k.Endpoint.URL != "" {
+		args = append(args, "--server-url", k.Endpoint.URL)
+	}
+	if k.Username != "" {
+		args = append(args, "--user", k.Username)
+	}
+	if k.ClientKey != "" {
+		args = append(args, "--key", k.ClientKey)
+	}
+	if k.Endpoint.CAFile != "" {
+		args = append(args, "--config-option", "ssl_ca_file="+k.Endpoint.CAFile)
+	}
+	if k.Endpoint.InsecureSkipVerify {
+		args = append(args, "--config-option", "ssl_verify_mode=verify_none")
+	}
+
+	return args
+}
+
+// env returns the environment for knife with the configured proxy, if any.
+func (k *Knife) env() []string {
+	env := os.Environ()
+	if k.Endpoint.Proxy != "" {
+		env = append(env, "http_proxy="+k.Endpoint.Proxy, "https_proxy="+k.Endpoint.Proxy)
 	}
+	return env
 }
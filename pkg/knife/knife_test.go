@@ -1 +1,47 @@
 package knife
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+)
+
+func TestConnectionArgs(t *testing.T) {
+	cases := []struct {
+		Knife    *Knife
+		Expected []string
+	}{
+		{
+			&Knife{},
+			nil,
+		},
+		{
+			&Knife{
+				Username:  "admin",
+				ClientKey: "~/.chef/client.pem",
+				Endpoint: configspec.Endpoint{
+					URL:    "https://chef.qa.local",
+					CAFile: "/etc/pki/ca.pem",
+				},
+			},
+			[]string{
+				"--server-url", "https://chef.qa.local",
+				"--user", "admin",
+				"--key", "~/.chef/client.pem",
+				"--config-option", "ssl_ca_file=/etc/pki/ca.pem",
+			},
+		},
+		{
+			&Knife{Endpoint: configspec.Endpoint{InsecureSkipVerify: true}},
+			[]string{"--config-option", "ssl_verify_mode=verify_none"},
+		},
+	}
+
+	for _, tt := range cases {
+		actual := tt.Knife.connectionArgs()
+		if !reflect.DeepEqual(actual, tt.Expected) {
+			t.Fatalf("%#v\n\n%#v", actual, tt.Expected)
+		}
+	}
+}
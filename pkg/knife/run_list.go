@@ -1,7 +1,6 @@
 package knife
 
 import (
-	"fmt"
 	"os"
 	"os/exec"
 	"strings"
@@ -13,9 +12,11 @@ import (
 
 func (k *Knife) AddToRunList() error {
 	runList := strings.Join(k.RunList, ",")
-	knife := exec.Command("knife", fmt.Sprintf("node run_list add %q %q", k.Hostname, runList))
+	args := append([]string{"node", "run_list", "add", k.Hostname, runList}, k.connectionArgs()...)
+	knife := exec.Command("knife", args...)
+	knife.Env = k.env()
 
-	log.Infof("Executing: %s", strings.Join(knife.Args, " "))
+	log.Infof("Executing: knife node run_list add %s %q", k.Hostname, runList)
 
 	knife.Stdout = os.Stdout
 	knife.Stderr = os.Stderr
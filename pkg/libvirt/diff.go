@@ -0,0 +1,79 @@
+package libvirt
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+)
+
+// Diff returns the ways the domain doesn't match the buildspec's libvirt
+// block. Disks are matched up by their volume and interfaces by their
+// order, and ones the domain has that the buildspec doesn't are reported
+// too.
+func (d *Domain) Diff(spec buildspec.Libvirt) []drift.Difference {
+	var diffs []drift.Difference
+
+	number := func(field string, have, want int) {
+		if want != 0 && have != want {
+			diffs = append(diffs, drift.Difference{Field: field, Have: strconv.Itoa(have), Want: strconv.Itoa(want)})
+		}
+	}
+	number("cpus", d.CPUs, spec.CPUs)
+	number("memory", d.MemoryMB, spec.Memory)
+
+	disks := make(map[string]*Disk)
+	for _, disk := range d.Disks {
+		disks[disk.Volume] = disk
+	}
+	for _, want := range spec.Devices.Disks {
+		field := fmt.Sprintf("disk %q", want.DeviceName)
+		volume := VolumeName(d.Name, want)
+		have, ok := disks[volume]
+		delete(disks, volume)
+
+		switch {
+		case !ok:
+			diffs = append(diffs, drift.Missing(field, gb(want.Size)))
+		case have.SizeGB != want.Size:
+			diffs = append(diffs, drift.Difference{Field: field, Have: gb(have.SizeGB), Want: gb(want.Size)})
+		}
+	}
+	for _, disk := range d.Disks {
+		if _, ok := disks[disk.Volume]; ok {
+			diffs = append(diffs, drift.Difference{Field: fmt.Sprintf("disk %q", disk.Target), Have: gb(disk.SizeGB), Want: "absent"})
+		}
+	}
+
+	for i, want := range spec.Devices.Networks {
+		field := fmt.Sprintf("network %q", want.DeviceName)
+		if i >= len(d.Networks) {
+			diffs = append(diffs, drift.Missing(field, source(want.Bridge, want.Network)))
+			continue
+		}
+
+		have := d.Networks[i]
+		if have.Bridge != want.Bridge || have.Network != want.Network {
+			diffs = append(diffs, drift.Difference{Field: field, Have: source(have.Bridge, have.Network), Want: source(want.Bridge, want.Network)})
+		}
+	}
+	for i := len(spec.Devices.Networks); i < len(d.Networks); i++ {
+		have := d.Networks[i]
+		diffs = append(diffs, drift.Difference{Field: fmt.Sprintf("network %d", i), Have: source(have.Bridge, have.Network), Want: "absent"})
+	}
+
+	return diffs
+}
+
+// source describes what an interface is plugged into.
+func source(bridge, network string) string {
+	if bridge != "" {
+		return "bridge " + bridge
+	}
+	return "network " + network
+}
+
+func gb(size int) string {
+	return fmt.Sprintf("%dGB", size)
+}
@@ -0,0 +1,64 @@
+package libvirt
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+)
+
+func TestDiff(t *testing.T) {
+	domain := &Domain{
+		Name:     "web01.lab.local",
+		CPUs:     2,
+		MemoryMB: 4096,
+		Disks: []*Disk{
+			{Target: "vda", Pool: "default", Volume: "web01.lab.local-root.qcow2", SizeGB: 40},
+			{Target: "vdb", Pool: "default", Volume: "web01.lab.local-scratch.qcow2", SizeGB: 10},
+		},
+		Networks: []*Network{
+			{Bridge: "br1", Model: "virtio"},
+		},
+	}
+
+	cases := []struct {
+		Spec     buildspec.Libvirt
+		Expected []drift.Difference
+	}{
+		{
+			buildspec.Libvirt{
+				CPUs:   2,
+				Memory: 4096,
+				Devices: buildspec.LibvirtDevices{
+					Disks: []*buildspec.LibvirtDisk{
+						{DeviceName: "root", Size: 40},
+						{DeviceName: "scratch", Size: 10},
+					},
+					Networks: []*buildspec.LibvirtNetwork{
+						{DeviceName: "eth0", Bridge: "br1"},
+					},
+				},
+			},
+			nil,
+		},
+		{
+			labSpec(),
+			[]drift.Difference{
+				{Field: "cpus", Have: "2", Want: "4"},
+				{Field: "memory", Have: "4096", Want: "8192"},
+				{Field: `disk "data"`, Have: "missing", Want: "200GB"},
+				{Field: `disk "vdb"`, Have: "10GB", Want: "absent"},
+				{Field: `network "eth0"`, Have: "bridge br1", Want: "bridge br0"},
+				{Field: `network "eth1"`, Have: "missing", Want: "network backup"},
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		actual := domain.Diff(tt.Spec)
+		if !reflect.DeepEqual(actual, tt.Expected) {
+			t.Fatalf("%#v\n\n%#v", actual, tt.Expected)
+		}
+	}
+}
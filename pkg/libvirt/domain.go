@@ -0,0 +1,286 @@
+// Package libvirt builds KVM hosts from a buildspec's libvirt block. Each
+// host is a libvirt domain named after it, with a qcow2 volume per disk.
+package libvirt
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+)
+
+// domainXML is the part of libvirt's domain XML overseer writes and reads.
+type domainXML struct {
+	XMLName xml.Name `xml:"domain"`
+	Type    string   `xml:"type,attr"`
+	// ID is only set on running domains.
+	ID       string       `xml:"id,attr,omitempty"`
+	Name     string       `xml:"name"`
+	Memory   memoryXML    `xml:"memory"`
+	VCPU     int          `xml:"vcpu"`
+	OS       osXML        `xml:"os"`
+	Features *featuresXML `xml:"features"`
+	Devices  devicesXML   `xml:"devices"`
+}
+
+type memoryXML struct {
+	Unit  string `xml:"unit,attr,omitempty"`
+	Value int64  `xml:",chardata"`
+}
+
+type osXML struct {
+	Type struct {
+		Arch  string `xml:"arch,attr,omitempty"`
+		Value string `xml:",chardata"`
+	} `xml:"type"`
+	Boot []bootXML `xml:"boot"`
+}
+
+type bootXML struct {
+	Dev string `xml:"dev,attr"`
+}
+
+type featuresXML struct {
+	ACPI *struct{} `xml:"acpi"`
+	APIC *struct{} `xml:"apic"`
+}
+
+type devicesXML struct {
+	Disks      []diskXML      `xml:"disk"`
+	Interfaces []interfaceXML `xml:"interface"`
+	Serial     *consoleXML    `xml:"serial"`
+	Console    *consoleXML    `xml:"console"`
+}
+
+type diskXML struct {
+	Type     string         `xml:"type,attr"`
+	Device   string         `xml:"device,attr"`
+	Driver   *driverXML     `xml:"driver"`
+	Source   *diskSourceXML `xml:"source"`
+	Target   diskTargetXML  `xml:"target"`
+	ReadOnly *struct{}      `xml:"readonly"`
+}
+
+type driverXML struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type diskSourceXML struct {
+	Pool   string `xml:"pool,attr,omitempty"`
+	Volume string `xml:"volume,attr,omitempty"`
+	File   string `xml:"file,attr,omitempty"`
+}
+
+type diskTargetXML struct {
+	Dev string `xml:"dev,attr"`
+	Bus string `xml:"bus,attr"`
+}
+
+type interfaceXML struct {
+	Type   string             `xml:"type,attr"`
+	MAC    *macXML            `xml:"mac"`
+	Source interfaceSourceXML `xml:"source"`
+	Model  *modelXML          `xml:"model"`
+}
+
+type macXML struct {
+	Address string `xml:"address,attr"`
+}
+
+type interfaceSourceXML struct {
+	Bridge  string `xml:"bridge,attr,omitempty"`
+	Network string `xml:"network,attr,omitempty"`
+}
+
+type modelXML struct {
+	Type string `xml:"type,attr"`
+}
+
+type consoleXML struct {
+	Type string `xml:"type,attr"`
+}
+
+// VolumeName is the name of the volume backing one of a host's disks.
+func VolumeName(host string, disk *buildspec.LibvirtDisk) string {
+	return host + "-" + strings.Replace(disk.DeviceName, " ", "-", -1) + ".qcow2"
+}
+
+// SeedVolumeName is the name of the volume holding a host's cloud-init
+// seed ISO.
+func SeedVolumeName(host string) string {
+	return host + "-seed.iso"
+}
+
+// domainType returns the kind of domain the connection's driver runs.
+// Everything overseer builds is KVM, apart from in tests against libvirt's
+// test driver, which only runs its own.
+func domainType(uri string) string {
+	if strings.HasPrefix(uri, "test:") {
+		return "test"
+	}
+	return "kvm"
+}
+
+// DomainXML returns the definition of the domain for host. Its disks are
+// virtio disks, vda onwards in the order the buildspec has them, each
+// backed by the volume VolumeName names. It boots from its first disk if
+// that disk is made from an image and from the network, to be installed
+// over PXE, if it isn't. With seed, it also has a CD-ROM drive with the
+// volume SeedVolumeName names in it, for cloud-init to find.
+func DomainXML(host string, spec buildspec.Libvirt, seed bool) ([]byte, error) {
+	if len(spec.Devices.Disks) > 26 {
+		return nil, fmt.Errorf("%s has %d disks, but there are only 26 virtio disk names", host, len(spec.Devices.Disks))
+	}
+
+	d := domainXML{
+		Type:     domainType(spec.URI),
+		Name:     host,
+		Memory:   memoryXML{Unit: "MiB", Value: int64(spec.Memory)},
+		VCPU:     spec.CPUs,
+		Features: &featuresXML{ACPI: &struct{}{}, APIC: &struct{}{}},
+		Devices: devicesXML{
+			Serial:  &consoleXML{Type: "pty"},
+			Console: &consoleXML{Type: "pty"},
+		},
+	}
+	d.OS.Type.Arch = "x86_64"
+	d.OS.Type.Value = "hvm"
+
+	disks := spec.Devices.Disks
+	if len(disks) == 0 || disks[0].Image == "" {
+		d.OS.Boot = append(d.OS.Boot, bootXML{Dev: "network"})
+	}
+	d.OS.Boot = append(d.OS.Boot, bootXML{Dev: "hd"})
+
+	for i, disk := range disks {
+		d.Devices.Disks = append(d.Devices.Disks, diskXML{
+			Type:   "volume",
+			Device: "disk",
+			Driver: &driverXML{Name: "qemu", Type: "qcow2"},
+			Source: &diskSourceXML{Pool: disk.Pool, Volume: VolumeName(host, disk)},
+			Target: diskTargetXML{Dev: "vd" + string(rune('a'+i)), Bus: "virtio"},
+		})
+	}
+
+	if seed {
+		d.Devices.Disks = append(d.Devices.Disks, diskXML{
+			Type:     "volume",
+			Device:   "cdrom",
+			Driver:   &driverXML{Name: "qemu", Type: "raw"},
+			Source:   &diskSourceXML{Pool: spec.Pool, Volume: SeedVolumeName(host)},
+			Target:   diskTargetXML{Dev: "sda", Bus: "sata"},
+			ReadOnly: &struct{}{},
+		})
+	}
+
+	for _, network := range spec.Devices.Networks {
+		x := interfaceXML{
+			Type:   "network",
+			Source: interfaceSourceXML{Network: network.Network},
+			Model:  &modelXML{Type: network.Model},
+		}
+		if network.Bridge != "" {
+			x.Type = "bridge"
+			x.Source = interfaceSourceXML{Bridge: network.Bridge}
+		}
+		d.Devices.Interfaces = append(d.Devices.Interfaces, x)
+	}
+
+	out, err := xml.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// Domain is a libvirt domain's hardware.
+type Domain struct {
+	Name     string
+	Running  bool
+	CPUs     int
+	MemoryMB int
+	Disks    []*Disk
+	Networks []*Network
+}
+
+// Disk is one of a domain's disks. Pool and Volume are only set for disks
+// backed by a storage volume.
+type Disk struct {
+	Target string
+	Pool   string
+	Volume string
+	// SizeGB is the size of the volume, when it's known.
+	SizeGB int
+}
+
+// Network is one of a domain's interfaces, with either Bridge or Network
+// set.
+type Network struct {
+	Bridge  string
+	Network string
+	Model   string
+	MAC     string
+}
+
+// ParseDomain reads the domain from the XML `virsh dumpxml` prints.
+func ParseDomain(data []byte) (*Domain, error) {
+	var d domainXML
+	if err := xml.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("unable to read domain XML: %s", err)
+	}
+
+	memory, err := megabytes(d.Memory)
+	if err != nil {
+		return nil, fmt.Errorf("domain %s: %s", d.Name, err)
+	}
+
+	domain := &Domain{
+		Name:     d.Name,
+		Running:  d.ID != "" && d.ID != "-1",
+		CPUs:     d.VCPU,
+		MemoryMB: memory,
+	}
+
+	for _, x := range d.Devices.Disks {
+		if x.Device != "disk" {
+			continue
+		}
+		disk := &Disk{Target: x.Target.Dev}
+		if x.Source != nil {
+			disk.Pool = x.Source.Pool
+			disk.Volume = x.Source.Volume
+		}
+		domain.Disks = append(domain.Disks, disk)
+	}
+
+	for _, x := range d.Devices.Interfaces {
+		network := &Network{Bridge: x.Source.Bridge, Network: x.Source.Network}
+		if x.Model != nil {
+			network.Model = x.Model.Type
+		}
+		if x.MAC != nil {
+			network.MAC = x.MAC.Address
+		}
+		domain.Networks = append(domain.Networks, network)
+	}
+
+	return domain, nil
+}
+
+// megabytes converts a memory size in whatever unit libvirt gave it in to
+// MiB.
+func megabytes(m memoryXML) (int, error) {
+	switch m.Unit {
+	case "b", "bytes":
+		return int(m.Value / (1024 * 1024)), nil
+	case "", "k", "KiB":
+		return int(m.Value / 1024), nil
+	case "M", "MiB":
+		return int(m.Value), nil
+	case "G", "GiB":
+		return int(m.Value * 1024), nil
+	}
+	return 0, fmt.Errorf("unknown memory unit %q", m.Unit)
+}
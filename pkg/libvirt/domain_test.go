@@ -0,0 +1,155 @@
+package libvirt
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+)
+
+// labSpec is the libvirt block from the buildspec package's libvirt.hcl
+// fixture.
+func labSpec() buildspec.Libvirt {
+	return buildspec.Libvirt{
+		URI:    "qemu:///system",
+		CPUs:   4,
+		Memory: 8192,
+		Pool:   "default",
+		Devices: buildspec.LibvirtDevices{
+			Disks: []*buildspec.LibvirtDisk{
+				{DeviceName: "root", DeviceType: "disk", Size: 40, Pool: "default", Image: "centos7-base.qcow2"},
+				{DeviceName: "data", DeviceType: "disk", Size: 200, Pool: "fast"},
+			},
+			Networks: []*buildspec.LibvirtNetwork{
+				{DeviceName: "eth0", DeviceType: "network", Bridge: "br0", Model: "virtio"},
+				{DeviceName: "eth1", DeviceType: "network", Network: "backup", Model: "e1000"},
+			},
+		},
+	}
+}
+
+func TestDomainXML(t *testing.T) {
+	expected, err := ioutil.ReadFile(filepath.Join("test-fixtures", "domain.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := DomainXML("web01.lab.local", labSpec(), false)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !bytes.Equal(actual, expected) {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+func TestDomainXMLSeed(t *testing.T) {
+	out, err := DomainXML("web01.lab.local", labSpec(), true)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var d domainXML
+	if err := xml.Unmarshal(out, &d); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cdrom := d.Devices.Disks[len(d.Devices.Disks)-1]
+	if cdrom.Device != "cdrom" || cdrom.Source.Volume != "web01.lab.local-seed.iso" || cdrom.Target.Dev != "sda" || cdrom.ReadOnly == nil {
+		t.Fatalf("bad: %s", out)
+	}
+
+	// The seed isn't one of the host's disks
+	domain, err := ParseDomain(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(domain.Disks) != 2 {
+		t.Fatalf("bad: %#v", domain.Disks)
+	}
+	for i, disk := range domain.Disks {
+		disk.SizeGB = labSpec().Devices.Disks[i].Size
+	}
+	if diffs := domain.Diff(labSpec()); len(diffs) > 0 {
+		t.Fatalf("bad: %#v", diffs)
+	}
+}
+
+func TestDomainXMLBoot(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Spec     buildspec.Libvirt
+		Type     string
+		Expected []bootXML
+	}{
+		{
+			"image",
+			labSpec(),
+			"kvm",
+			[]bootXML{{"hd"}},
+		},
+		{
+			"pxe",
+			buildspec.Libvirt{
+				URI: "test:///default",
+				Devices: buildspec.LibvirtDevices{
+					Disks: []*buildspec.LibvirtDisk{{DeviceName: "root", Size: 40, Pool: "default"}},
+				},
+			},
+			"test",
+			[]bootXML{{"network"}, {"hd"}},
+		},
+	}
+
+	for _, tc := range cases {
+		out, err := DomainXML("web01.lab.local", tc.Spec, false)
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Name, err)
+		}
+
+		var d domainXML
+		if err := xml.Unmarshal(out, &d); err != nil {
+			t.Fatalf("%s: err: %s", tc.Name, err)
+		}
+		if d.Type != tc.Type {
+			t.Fatalf("%s: bad type: %s", tc.Name, d.Type)
+		}
+		if !reflect.DeepEqual(d.OS.Boot, tc.Expected) {
+			t.Fatalf("%s: bad boot order: %#v", tc.Name, d.OS.Boot)
+		}
+	}
+}
+
+func TestParseDomain(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("test-fixtures", "dumpxml.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := ParseDomain(data)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &Domain{
+		Name:     "web01.lab.local",
+		Running:  true,
+		CPUs:     2,
+		MemoryMB: 4096,
+		Disks: []*Disk{
+			{Target: "vda", Pool: "default", Volume: "web01.lab.local-root.qcow2"},
+			{Target: "vdb", Pool: "default", Volume: "web01.lab.local-scratch.qcow2"},
+		},
+		Networks: []*Network{
+			{Bridge: "br1", Model: "virtio", MAC: "52:54:00:6b:3c:58"},
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
@@ -0,0 +1,226 @@
+package libvirt
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+)
+
+// Virsh talks to libvirt through the virsh command line tool, the same way
+// govc is used for vSphere.
+type Virsh struct {
+	URI string
+
+	// run runs virsh with args and returns what it printed. It's swapped
+	// out in tests.
+	run func(args ...string) ([]byte, error)
+}
+
+// New returns a Virsh connected to uri.
+func New(uri string) *Virsh {
+	return &Virsh{URI: uri, run: runVirsh}
+}
+
+func runVirsh(args ...string) ([]byte, error) {
+	virsh := exec.Command("virsh", args...)
+
+	var stderr strings.Builder
+	virsh.Stderr = &stderr
+
+	out, err := virsh.Output()
+	if err != nil {
+		return nil, fmt.Errorf("virsh %s: %s: %s", args[2], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func (v *Virsh) virsh(args ...string) ([]byte, error) {
+	return v.run(append([]string{"-c", v.URI}, args...)...)
+}
+
+// Domain returns the named domain, or nil if there isn't one.
+func (v *Virsh) Domain(name string) (*Domain, error) {
+	out, err := v.virsh("list", "--all", "--name")
+	if err != nil {
+		return nil, err
+	}
+
+	found := false
+	for _, line := range strings.Split(string(out), "\n") {
+		found = found || strings.TrimSpace(line) == name
+	}
+	if !found {
+		return nil, nil
+	}
+
+	out, err = v.virsh("dumpxml", name)
+	if err != nil {
+		return nil, err
+	}
+
+	domain, err := ParseDomain(out)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, disk := range domain.Disks {
+		if disk.Volume == "" {
+			continue
+		}
+		if disk.SizeGB, err = v.volumeSize(disk.Pool, disk.Volume); err != nil {
+			return nil, err
+		}
+	}
+
+	return domain, nil
+}
+
+// volumeSize returns the capacity of a volume in GB.
+func (v *Virsh) volumeSize(pool, volume string) (int, error) {
+	out, err := v.virsh("vol-info", "--pool", pool, "--bytes", volume)
+	if err != nil {
+		return 0, err
+	}
+
+	lines := bufio.NewScanner(bytes.NewReader(out))
+	for lines.Scan() {
+		fields := strings.Fields(lines.Text())
+		if len(fields) >= 2 && fields[0] == "Capacity:" {
+			size, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("unable to read the size of volume %s: %s", volume, err)
+			}
+			return int(size / (1024 * 1024 * 1024)), nil
+		}
+	}
+
+	return 0, fmt.Errorf("virsh didn't say how big volume %s is", volume)
+}
+
+// Create creates the volumes for the host's disks, defines its domain and
+// starts it. If seed isn't nil, it's uploaded as the host's cloud-init
+// seed ISO and attached as a CD-ROM.
+func (v *Virsh) Create(host string, spec buildspec.Libvirt, seed []byte) error {
+	def, err := DomainXML(host, spec, seed != nil)
+	if err != nil {
+		return err
+	}
+
+	// created is the volumes made so far, as pool and name, so they can
+	// be deleted again if something fails
+	var created [][2]string
+	cleanup := func() {
+		for _, volume := range created {
+			v.virsh("vol-delete", "--pool", volume[0], volume[1])
+		}
+	}
+
+	for _, disk := range spec.Devices.Disks {
+		args := []string{"vol-create-as", disk.Pool, VolumeName(host, disk), fmt.Sprintf("%dG", disk.Size), "--format", "qcow2"}
+		if disk.Image != "" {
+			args = append(args, "--backing-vol", disk.Image, "--backing-vol-format", "qcow2")
+		}
+		if _, err := v.virsh(args...); err != nil {
+			cleanup()
+			return err
+		}
+		created = append(created, [2]string{disk.Pool, VolumeName(host, disk)})
+	}
+
+	if seed != nil {
+		if _, err := v.virsh("vol-create-as", spec.Pool, SeedVolumeName(host), strconv.Itoa(len(seed)), "--format", "raw"); err != nil {
+			cleanup()
+			return err
+		}
+		created = append(created, [2]string{spec.Pool, SeedVolumeName(host)})
+
+		if err := withTempFile("overseer-seed", seed, func(path string) error {
+			_, err := v.virsh("vol-upload", "--pool", spec.Pool, SeedVolumeName(host), path)
+			return err
+		}); err != nil {
+			cleanup()
+			return err
+		}
+	}
+
+	if err := withTempFile("overseer-domain", def, func(path string) error {
+		_, err := v.virsh("define", path)
+		return err
+	}); err != nil {
+		cleanup()
+		return err
+	}
+
+	_, err = v.virsh("start", host)
+	return err
+}
+
+// withTempFile writes data to a temporary file for virsh to read and calls
+// f with its path.
+func withTempFile(prefix string, data []byte, f func(path string) error) error {
+	tmp, err := ioutil.TempFile("", prefix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	return f(tmp.Name())
+}
+
+// Update makes the changes in diffs to the host's domain. CPUs and memory
+// are changed in its definition, so they take effect the next time it's
+// started, and disks are grown. Anything else needs the host rebuilding.
+func (v *Virsh) Update(host string, spec buildspec.Libvirt, diffs []drift.Difference) error {
+	disks := make(map[string]*buildspec.LibvirtDisk)
+	for _, disk := range spec.Devices.Disks {
+		disks[fmt.Sprintf("disk %q", disk.DeviceName)] = disk
+	}
+
+	var unsupported []string
+	for _, diff := range diffs {
+		var err error
+		switch diff.Field {
+		case "cpus":
+			cpus := strconv.Itoa(spec.CPUs)
+			if _, err = v.virsh("setvcpus", host, cpus, "--config", "--maximum"); err == nil {
+				_, err = v.virsh("setvcpus", host, cpus, "--config")
+			}
+		case "memory":
+			memory := fmt.Sprintf("%dM", spec.Memory)
+			if _, err = v.virsh("setmaxmem", host, memory, "--config"); err == nil {
+				_, err = v.virsh("setmem", host, memory, "--config")
+			}
+		default:
+			disk, ok := disks[diff.Field]
+			if !ok || diff.Have == "missing" {
+				unsupported = append(unsupported, diff.String())
+				continue
+			}
+			_, err = v.virsh("vol-resize", "--pool", disk.Pool, VolumeName(host, disk), fmt.Sprintf("%dG", disk.Size))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(unsupported) > 0 {
+		return fmt.Errorf("can't change %s on an existing domain, rebuild %s instead", strings.Join(unsupported, ", "), host)
+	}
+	return nil
+}
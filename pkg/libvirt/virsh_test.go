@@ -0,0 +1,231 @@
+package libvirt
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+)
+
+// fakeVirsh returns a Virsh that knows about web01.lab.local, as described
+// by the dumpxml fixture, and records the commands it was given.
+func fakeVirsh(t *testing.T) (*Virsh, *[]string) {
+	dump, err := ioutil.ReadFile(filepath.Join("test-fixtures", "dumpxml.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var commands []string
+	v := New("qemu+ssh://kvm01.lab.local/system")
+	v.run = func(args ...string) ([]byte, error) {
+		if args[0] != "-c" || args[1] != "qemu+ssh://kvm01.lab.local/system" {
+			t.Fatalf("virsh not connected to the buildspec's uri: %v", args)
+		}
+		args = args[2:]
+
+		commands = append(commands, strings.Join(args, " "))
+		switch args[0] {
+		case "list":
+			return []byte("db01.lab.local\nweb01.lab.local\n\n"), nil
+		case "dumpxml":
+			return dump, nil
+		case "vol-info":
+			return []byte("Name:           " + args[len(args)-1] + "\nType:           file\nCapacity:       42949672960 bytes\nAllocation:     1470976000 bytes\n"), nil
+		}
+		return nil, nil
+	}
+
+	return v, &commands
+}
+
+func TestDomain(t *testing.T) {
+	v, commands := fakeVirsh(t)
+
+	domain, err := v.Domain("web01.lab.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if domain == nil || domain.CPUs != 2 || domain.Disks[0].SizeGB != 40 || domain.Disks[1].SizeGB != 40 {
+		t.Fatalf("bad: %#v", domain)
+	}
+
+	domain, err = v.Domain("app01.lab.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if domain != nil {
+		t.Fatalf("expected no domain, got %#v", domain)
+	}
+
+	expected := []string{
+		"list --all --name",
+		"dumpxml web01.lab.local",
+		"vol-info --pool default --bytes web01.lab.local-root.qcow2",
+		"vol-info --pool default --bytes web01.lab.local-scratch.qcow2",
+		"list --all --name",
+	}
+	if !reflect.DeepEqual(*commands, expected) {
+		t.Fatalf("%#v\n\n%#v", *commands, expected)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	v, commands := fakeVirsh(t)
+
+	if err := v.Create("app01.lab.local", labSpec(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"vol-create-as default app01.lab.local-root.qcow2 40G --format qcow2 --backing-vol centos7-base.qcow2 --backing-vol-format qcow2",
+		"vol-create-as fast app01.lab.local-data.qcow2 200G --format qcow2",
+		"define",
+		"start app01.lab.local",
+	}
+	// The domain is defined from a temporary file
+	for i, command := range *commands {
+		if strings.HasPrefix(command, "define ") {
+			(*commands)[i] = "define"
+		}
+	}
+	if !reflect.DeepEqual(*commands, expected) {
+		t.Fatalf("%#v\n\n%#v", *commands, expected)
+	}
+}
+
+func TestCreateSeeded(t *testing.T) {
+	v, commands := fakeVirsh(t)
+
+	var seed []byte
+	run := v.run
+	v.run = func(args ...string) ([]byte, error) {
+		if args[2] == "vol-upload" {
+			var err error
+			if seed, err = ioutil.ReadFile(args[len(args)-1]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return run(args...)
+	}
+
+	if err := v.Create("app01.lab.local", labSpec(), []byte("seed")); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"vol-create-as default app01.lab.local-root.qcow2 40G --format qcow2 --backing-vol centos7-base.qcow2 --backing-vol-format qcow2",
+		"vol-create-as fast app01.lab.local-data.qcow2 200G --format qcow2",
+		"vol-create-as default app01.lab.local-seed.iso 4 --format raw",
+		"vol-upload --pool default app01.lab.local-seed.iso",
+		"define",
+		"start app01.lab.local",
+	}
+	for i, command := range *commands {
+		if strings.HasPrefix(command, "define ") {
+			(*commands)[i] = "define"
+		}
+		if strings.HasPrefix(command, "vol-upload ") {
+			(*commands)[i] = command[:strings.LastIndex(command, " ")]
+		}
+	}
+	if !reflect.DeepEqual(*commands, expected) {
+		t.Fatalf("%#v\n\n%#v", *commands, expected)
+	}
+	if string(seed) != "seed" {
+		t.Fatalf("uploaded %q", seed)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	v, commands := fakeVirsh(t)
+
+	diffs := []drift.Difference{
+		{Field: "cpus", Have: "2", Want: "4"},
+		{Field: "memory", Have: "4096", Want: "8192"},
+		{Field: `disk "data"`, Have: "100GB", Want: "200GB"},
+	}
+	if err := v.Update("web01.lab.local", labSpec(), diffs); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"setvcpus web01.lab.local 4 --config --maximum",
+		"setvcpus web01.lab.local 4 --config",
+		"setmaxmem web01.lab.local 8192M --config",
+		"setmem web01.lab.local 8192M --config",
+		"vol-resize --pool fast web01.lab.local-data.qcow2 200G",
+	}
+	if !reflect.DeepEqual(*commands, expected) {
+		t.Fatalf("%#v\n\n%#v", *commands, expected)
+	}
+
+	diffs = []drift.Difference{{Field: `network "eth1"`, Have: "missing", Want: "network backup"}}
+	err := v.Update("web01.lab.local", labSpec(), diffs)
+	if err == nil || !strings.Contains(err.Error(), "rebuild web01.lab.local") {
+		t.Fatalf("expected an error, got %v", err)
+	}
+}
+
+// TestTestDriver defines the domain against libvirt's test driver, to be
+// sure libvirt accepts the XML, and reads it back. The test driver forgets
+// everything between connections, so it's all done in one virsh.
+func TestTestDriver(t *testing.T) {
+	if _, err := exec.LookPath("virsh"); err != nil {
+		t.Skip("virsh isn't installed")
+	}
+
+	spec := labSpec()
+	spec.URI = "test:///default"
+	for _, disk := range spec.Devices.Disks {
+		disk.Pool = "default-pool"
+		disk.Image = ""
+	}
+
+	def, err := DomainXML("web01.lab.local", spec, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := ioutil.TempFile("", "overseer-domain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Write(def)
+	f.Close()
+
+	out, err := runVirsh("-c", spec.URI, "define "+f.Name()+"; start web01.lab.local; dumpxml web01.lab.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// virsh prints what define and start did before the XML
+	start := strings.Index(string(out), "<domain")
+	if start < 0 {
+		t.Fatalf("no domain XML in:\n%s", out)
+	}
+
+	domain, err := ParseDomain(out[start:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The test driver doesn't know about the volumes, so there are no
+	// sizes to compare
+	for _, disk := range domain.Disks {
+		disk.SizeGB = spec.Devices.Disks[0].Size
+	}
+	spec.Devices.Disks[1].Size = spec.Devices.Disks[0].Size
+
+	if !domain.Running {
+		t.Fatal("domain isn't running")
+	}
+	if diffs := domain.Diff(spec); len(diffs) > 0 {
+		t.Fatalf("bad: %#v", diffs)
+	}
+}
@@ -0,0 +1,402 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/iamthemuffinman/logsip"
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+	"github.com/iamthemuffinman/overseer/pkg/provider"
+)
+
+// StartTimeout is how long a plugin gets to print its handshake.
+var StartTimeout = 10 * time.Second
+
+// KillTimeout is how long a plugin gets to exit once its stdin is closed
+// before it's killed.
+var KillTimeout = 2 * time.Second
+
+// logLine passes on a line a plugin logged. Lines starting [ERROR] or
+// [WARN] are logged at that level, everything else as info.
+var logLine = func(name, line string) {
+	switch {
+	case strings.HasPrefix(line, "[ERROR]"):
+		log.Errorf("%s: %s", name, strings.TrimSpace(strings.TrimPrefix(line, "[ERROR]")))
+	case strings.HasPrefix(line, "[WARN]"):
+		log.Warnf("%s: %s", name, strings.TrimSpace(strings.TrimPrefix(line, "[WARN]")))
+	case strings.HasPrefix(line, "[DEBUG]"):
+		log.Debugf("%s: %s", name, strings.TrimSpace(strings.TrimPrefix(line, "[DEBUG]")))
+	default:
+		log.Infof("%s: %s", name, strings.TrimSpace(strings.TrimPrefix(line, "[INFO]")))
+	}
+}
+
+// Client runs a plugin and talks to it. The plugin is started the first
+// time it's asked for its kinds or one of its providers and keeps running
+// until Kill.
+type Client struct {
+	Name string
+	Path string
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	rpc    *rpc.Client
+	kinds  []string
+	exited chan struct{}
+	err    error
+}
+
+func NewClient(name, path string) *Client {
+	return &Client{Name: name, Path: path}
+}
+
+// Kinds returns the kinds of provider the plugin said it serves in its
+// handshake.
+func (c *Client) Kinds() ([]string, error) {
+	if err := c.start(); err != nil {
+		return nil, err
+	}
+	return c.kinds, nil
+}
+
+// Compute returns the plugin's compute provider, configured for bspec.
+func (c *Client) Compute(bspec *buildspec.Spec, cspec *configspec.Spec) (provider.ComputeProvider, error) {
+	if err := c.configure(KindCompute, bspec, cspec); err != nil {
+		return nil, err
+	}
+	return &remoteCompute{c.rpc}, nil
+}
+
+// IPAM returns the plugin's IPAM provider, configured for bspec.
+func (c *Client) IPAM(bspec *buildspec.Spec, cspec *configspec.Spec) (provider.IPAMProvider, error) {
+	if err := c.configure(KindIPAM, bspec, cspec); err != nil {
+		return nil, err
+	}
+	return &remoteIPAM{c.rpc}, nil
+}
+
+// DNS returns the plugin's DNS provider, configured for bspec.
+func (c *Client) DNS(bspec *buildspec.Spec, cspec *configspec.Spec) (provider.DNSProvider, error) {
+	if err := c.configure(KindDNS, bspec, cspec); err != nil {
+		return nil, err
+	}
+	return &remoteDNS{c.rpc}, nil
+}
+
+// Config returns the plugin's configuration manager, configured for bspec.
+func (c *Client) Config(bspec *buildspec.Spec, cspec *configspec.Spec) (provider.ConfigManager, error) {
+	if err := c.configure(KindConfig, bspec, cspec); err != nil {
+		return nil, err
+	}
+
+	var bootstraps BoolReply
+	if err := c.rpc.Call("Config.Bootstraps", Empty{}, &bootstraps); err != nil {
+		return nil, err
+	}
+	return &remoteConfig{client: c.rpc, bootstraps: bootstraps.Value}, nil
+}
+
+// configure starts the plugin if it isn't running and asks it to set up
+// its provider of the given kind. Its own plugin block is all it's sent
+// of cspec: the rest is other backends' credentials.
+func (c *Client) configure(kind string, bspec *buildspec.Spec, cspec *configspec.Spec) error {
+	if err := c.start(); err != nil {
+		return err
+	}
+
+	var settings map[string]interface{}
+	if p := cspec.Plugins[c.Name]; p != nil {
+		settings = p.Settings
+	}
+
+	args := ConfigureArgs{Kind: kind, Name: c.Name}
+	var err error
+	if args.Buildspec, err = json.Marshal(bspec); err != nil {
+		return err
+	}
+	if args.Settings, err = json.Marshal(settings); err != nil {
+		return err
+	}
+
+	if err := c.rpc.Call("Plugin.Configure", args, &Empty{}); err != nil {
+		return fmt.Errorf("plugin %s: %s", c.Name, err)
+	}
+	return nil
+}
+
+// start runs the plugin and connects to it, once. Later calls return
+// whatever the first one did.
+func (c *Client) start() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cmd != nil {
+		return c.err
+	}
+
+	c.cmd = exec.Command(c.Path)
+	c.cmd.Env = append(os.Environ(), MagicCookieKey+"="+MagicCookieValue)
+	c.err = c.run()
+	if c.err != nil {
+		c.err = fmt.Errorf("unable to start plugin %s: %s", c.Name, c.err)
+		c.kill()
+	}
+	return c.err
+}
+
+func (c *Client) run() error {
+	var err error
+	if c.stdin, err = c.cmd.StdinPipe(); err != nil {
+		return err
+	}
+	stdout, err := c.cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := c.cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := c.cmd.Start(); err != nil {
+		return err
+	}
+
+	// Wait closes the pipes, so it mustn't be called until everything
+	// the plugin wrote has been read
+	var output sync.WaitGroup
+	output.Add(2)
+	c.exited = make(chan struct{})
+	go func() {
+		output.Wait()
+		c.cmd.Wait()
+		close(c.exited)
+	}()
+
+	go func() {
+		defer output.Done()
+		c.logLines(stderr)
+	}()
+
+	handshake := make(chan string, 1)
+	go func() {
+		defer output.Done()
+		lines := bufio.NewScanner(stdout)
+		if lines.Scan() {
+			handshake <- lines.Text()
+		}
+		close(handshake)
+		for lines.Scan() {
+			logLine(c.Name, lines.Text())
+		}
+	}()
+
+	var line string
+	select {
+	case l, ok := <-handshake:
+		if !ok {
+			return fmt.Errorf("it exited without a handshake, is it an overseer plugin?")
+		}
+		line = l
+	case <-time.After(StartTimeout):
+		return fmt.Errorf("no handshake after %s", StartTimeout)
+	}
+
+	var network, address string
+	c.kinds, network, address, err = parseHandshake(line)
+	if err != nil {
+		return err
+	}
+
+	c.rpc, err = rpc.Dial(network, address)
+	return err
+}
+
+func (c *Client) logLines(r io.Reader) {
+	lines := bufio.NewScanner(r)
+	for lines.Scan() {
+		logLine(c.Name, lines.Text())
+	}
+}
+
+// parseHandshake returns the kinds of provider, network and address from
+// a plugin's handshake line.
+func parseHandshake(line string) ([]string, string, string, error) {
+	parts := strings.SplitN(strings.TrimSpace(line), "|", 4)
+
+	// Check the version first, since older plugins' handshakes have fewer
+	// parts
+	version, err := strconv.Atoi(parts[0])
+	if len(parts) < 3 {
+		return nil, "", "", fmt.Errorf("bad handshake %q, is it an overseer plugin?", line)
+	}
+	if err != nil {
+		return nil, "", "", fmt.Errorf("bad protocol version in handshake %q", line)
+	}
+	if version != ProtocolVersion {
+		return nil, "", "", fmt.Errorf("it speaks protocol version %d, but this overseer speaks %d", version, ProtocolVersion)
+	}
+	if len(parts) != 4 {
+		return nil, "", "", fmt.Errorf("bad handshake %q, is it an overseer plugin?", line)
+	}
+
+	var kinds []string
+	for _, kind := range strings.Split(parts[1], ",") {
+		switch kind {
+		case KindCompute, KindIPAM, KindDNS, KindConfig:
+			kinds = append(kinds, kind)
+		default:
+			return nil, "", "", fmt.Errorf("unknown provider kind %q in handshake %q", kind, line)
+		}
+	}
+
+	return kinds, parts[2], parts[3], nil
+}
+
+// Kill stops the plugin if it's running.
+func (c *Client) Kill() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.kill()
+	if c.cmd != nil && c.err == nil {
+		c.err = fmt.Errorf("plugin %s has been stopped", c.Name)
+	}
+}
+
+func (c *Client) kill() {
+	if c.cmd == nil || c.cmd.Process == nil {
+		return
+	}
+
+	if c.rpc != nil {
+		c.rpc.Close()
+	}
+
+	// Plugins exit when their stdin closes. Give them a moment to do so
+	// before killing them.
+	c.stdin.Close()
+	select {
+	case <-c.exited:
+	case <-time.After(KillTimeout):
+		c.cmd.Process.Kill()
+		<-c.exited
+	}
+}
+
+type remoteCompute struct {
+	client *rpc.Client
+}
+
+func (r *remoteCompute) Exists(host string) (bool, error) {
+	var reply BoolReply
+	err := r.client.Call("Compute.Exists", HostArgs{host}, &reply)
+	return reply.Value, err
+}
+
+func (r *remoteCompute) Create(host string) error {
+	return r.client.Call("Compute.Create", HostArgs{host}, &Empty{})
+}
+
+func (r *remoteCompute) Diff(host string) ([]drift.Difference, error) {
+	var reply DiffReply
+	err := r.client.Call("Compute.Diff", HostArgs{host}, &reply)
+	return reply.Diffs, err
+}
+
+func (r *remoteCompute) Update(host string, diffs []drift.Difference) error {
+	return r.client.Call("Compute.Update", UpdateArgs{host, diffs}, &Empty{})
+}
+
+func (r *remoteCompute) Built(host string) (bool, error) {
+	var reply BoolReply
+	err := r.client.Call("Compute.Built", HostArgs{host}, &reply)
+	return reply.Value, err
+}
+
+type remoteIPAM struct {
+	client *rpc.Client
+}
+
+func (r *remoteIPAM) Address(host string) (string, error) {
+	var reply StringReply
+	err := r.client.Call("IPAM.Address", HostArgs{host}, &reply)
+	return reply.Value, err
+}
+
+type remoteDNS struct {
+	client *rpc.Client
+}
+
+func (r *remoteDNS) EnsureRecord(host, ip string) (string, error) {
+	var reply StringReply
+	err := r.client.Call("DNS.EnsureRecord", RecordArgs{host, ip}, &reply)
+	return reply.Value, err
+}
+
+func (r *remoteDNS) Diff(host, ip string) ([]drift.Difference, error) {
+	var reply DiffReply
+	err := r.client.Call("DNS.Diff", RecordArgs{host, ip}, &reply)
+	return reply.Diffs, err
+}
+
+type remoteConfig struct {
+	client     *rpc.Client
+	bootstraps bool
+}
+
+func (r *remoteConfig) ResolveConflict(host string) (string, error) {
+	var reply StringReply
+	err := r.client.Call("Config.ResolveConflict", HostArgs{host}, &reply)
+	return reply.Value, err
+}
+
+func (r *remoteConfig) Registered(host string) (bool, error) {
+	var reply BoolReply
+	err := r.client.Call("Config.Registered", HostArgs{host}, &reply)
+	return reply.Value, err
+}
+
+func (r *remoteConfig) Bootstraps() bool {
+	return r.bootstraps
+}
+
+func (r *remoteConfig) Bootstrap(host string) error {
+	return r.client.Call("Config.Bootstrap", HostArgs{host}, &Empty{})
+}
+
+func (r *remoteConfig) Apply(host string) (string, error) {
+	var reply StringReply
+	err := r.client.Call("Config.Apply", HostArgs{host}, &reply)
+	return reply.Value, err
+}
+
+func (r *remoteConfig) WaitForConverge(host string, since time.Time) error {
+	return r.client.Call("Config.WaitForConverge", WaitArgs{host, since}, &Empty{})
+}
+
+func (r *remoteConfig) Converge(host string) error {
+	return r.client.Call("Config.Converge", HostArgs{host}, &Empty{})
+}
+
+func (r *remoteConfig) Diff(host string) ([]drift.Difference, error) {
+	var reply DiffReply
+	err := r.client.Call("Config.Diff", HostArgs{host}, &reply)
+	return reply.Diffs, err
+}
+
+func (r *remoteConfig) Remove(host string) error {
+	return r.client.Call("Config.Remove", HostArgs{host}, &Empty{})
+}
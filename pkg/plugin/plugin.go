@@ -0,0 +1,164 @@
+// Package plugin runs providers that live outside overseer. A plugin is an
+// executable named overseer-provider-<name> in ~/.overseer/plugins that
+// serves one or more of the provider interfaces over net/rpc. Buildspecs
+// use its providers by that name, like any in-tree provider.
+//
+// Overseer starts every plugin it finds when it starts up. The plugin
+// checks it was started by overseer, listens on a Unix socket and prints
+// a handshake line to stdout:
+//
+//	2|dns,config|unix|/tmp/overseer-plugin123/plugin.sock
+//
+// which is the protocol version, the kinds of provider it serves and the
+// network and address to dial. Anything it writes after that, to stdout
+// or stderr, ends up in overseer's log. The plugin exits when its stdin is
+// closed, which overseer does when it's done with it (or when overseer
+// dies).
+//
+// A plugin is only sent its own configspec block, plugin "<name>", when
+// one of its providers is set up, and can only take the name of an
+// in-tree provider if that block sets replace_builtin.
+//
+// Plugins are written with Serve.
+package plugin
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/iamthemuffinman/logsip"
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/provider"
+)
+
+const (
+	// ProtocolVersion is bumped whenever the RPC interface changes in a
+	// way older plugins can't cope with.
+	ProtocolVersion = 2
+
+	// Prefix is what plugin executables are named with.
+	Prefix = "overseer-provider-"
+
+	// MagicCookieKey and MagicCookieValue are set in a plugin's
+	// environment so it can tell it was started by overseer and not by
+	// someone running it by hand.
+	MagicCookieKey   = "OVERSEER_PLUGIN_MAGIC_COOKIE"
+	MagicCookieValue = "3d1c5b7f9e2a4c6d8b0f1e3a5c7d9b2f"
+)
+
+// Dir returns the directory plugins are looked for in, under home.
+func Dir(home string) string {
+	return filepath.Join(home, ".overseer", "plugins")
+}
+
+// Discover returns the path of every plugin in dir, by name.
+func Discover(dir string) map[string]string {
+	plugins := make(map[string]string)
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return plugins
+	}
+
+	for _, file := range files {
+		name := strings.TrimPrefix(file.Name(), Prefix)
+		if name == file.Name() || name == "" || file.IsDir() || file.Mode()&0111 == 0 {
+			continue
+		}
+		plugins[name] = filepath.Join(dir, file.Name())
+	}
+
+	return plugins
+}
+
+var (
+	clientsMu sync.Mutex
+	clients   []*Client
+)
+
+// Register starts every plugin and makes the providers it says it serves
+// available to buildspecs under its name. A plugin with the same name as
+// an in-tree provider of a kind it serves is stopped and left out, unless
+// its block in settings (the configspec's plugin blocks) sets
+// replace_builtin.
+func Register(plugins map[string]string, settings map[string]*configspec.Plugin) {
+	var names []string
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		c := NewClient(name, plugins[name])
+
+		clientsMu.Lock()
+		clients = append(clients, c)
+		clientsMu.Unlock()
+
+		kinds, err := c.Kinds()
+		if err != nil {
+			log.Warnf("not using plugin %s: %s", name, err)
+			continue
+		}
+
+		if s := settings[name]; s == nil || !s.ReplaceBuiltin {
+			if shadowed := builtinKinds(name, kinds); len(shadowed) > 0 {
+				log.Warnf("not using plugin %s: it would replace the in-tree %s provider of the same name. "+
+					"Set replace_builtin in its plugin block in the configspec if that's what you want.", name, strings.Join(shadowed, " and "))
+				c.Kill()
+				continue
+			}
+		}
+
+		for _, kind := range kinds {
+			register(c, kind)
+		}
+	}
+}
+
+// builtinKinds returns the kinds of provider already registered under
+// name, out of kinds.
+func builtinKinds(name string, kinds []string) []string {
+	var shadowed []string
+	for _, kind := range kinds {
+		if provider.Registered(kind, name) {
+			shadowed = append(shadowed, kind)
+		}
+	}
+	return shadowed
+}
+
+func register(c *Client, kind string) {
+	switch kind {
+	case KindCompute:
+		provider.RegisterCompute(c.Name, func(bspec *buildspec.Spec, cspec *configspec.Spec) (provider.ComputeProvider, error) {
+			return c.Compute(bspec, cspec)
+		})
+	case KindIPAM:
+		provider.RegisterIPAM(c.Name, func(bspec *buildspec.Spec, cspec *configspec.Spec) (provider.IPAMProvider, error) {
+			return c.IPAM(bspec, cspec)
+		})
+	case KindDNS:
+		provider.RegisterDNS(c.Name, func(bspec *buildspec.Spec, cspec *configspec.Spec) (provider.DNSProvider, error) {
+			return c.DNS(bspec, cspec)
+		})
+	case KindConfig:
+		provider.RegisterConfig(c.Name, func(bspec *buildspec.Spec, cspec *configspec.Spec) (provider.ConfigManager, error) {
+			return c.Config(bspec, cspec)
+		})
+	}
+}
+
+// CleanupClients stops every plugin Register started.
+func CleanupClients() {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	for _, c := range clients {
+		c.Kill()
+	}
+}
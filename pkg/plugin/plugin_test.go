@@ -0,0 +1,367 @@
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+	"github.com/iamthemuffinman/overseer/pkg/provider"
+)
+
+func TestDiscover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overseer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]os.FileMode{
+		"overseer-provider-cmdb":    0755,
+		"overseer-provider-notexec": 0644,
+		"something-else":            0755,
+		"overseer-provider-homedns": 0755,
+	}
+	for name, mode := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, mode); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	os.Mkdir(filepath.Join(dir, "overseer-provider-dir"), 0755)
+
+	expected := map[string]string{
+		"cmdb":    filepath.Join(dir, "overseer-provider-cmdb"),
+		"homedns": filepath.Join(dir, "overseer-provider-homedns"),
+	}
+
+	actual := Discover(dir)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	if actual := Discover(filepath.Join(dir, "missing")); len(actual) != 0 {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestParseHandshake(t *testing.T) {
+	cases := []struct {
+		Line    string
+		Kinds   []string
+		Network string
+		Address string
+		Err     string
+	}{
+		{"2|dns|unix|/tmp/plugin.sock", []string{"dns"}, "unix", "/tmp/plugin.sock", ""},
+		{"2|compute,config|unix|/tmp/plugin.sock", []string{"compute", "config"}, "unix", "/tmp/plugin.sock", ""},
+		{"1|unix|/tmp/plugin.sock", nil, "", "", "protocol version 1"},
+		{"3|dns|unix|/tmp/plugin.sock", nil, "", "", "protocol version 3"},
+		{"2|unix|/tmp/plugin.sock", nil, "", "", "bad handshake"},
+		{"2|dns,cmdb|unix|/tmp/plugin.sock", nil, "", "", `unknown provider kind "cmdb"`},
+		{"one|dns|unix|/tmp/plugin.sock", nil, "", "", "bad protocol version"},
+		{"hello", nil, "", "", "bad handshake"},
+	}
+
+	for _, tc := range cases {
+		kinds, network, address, err := parseHandshake(tc.Line)
+		if tc.Err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.Err) {
+				t.Fatalf("%s: expected error containing %q, got %v", tc.Line, tc.Err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.Line, err)
+		}
+		if !reflect.DeepEqual(kinds, tc.Kinds) || network != tc.Network || address != tc.Address {
+			t.Fatalf("%s: bad: %v %s %s", tc.Line, kinds, network, address)
+		}
+	}
+}
+
+// buildHostsFile builds the reference plugin into dir.
+func buildHostsFile(t *testing.T, dir string) string {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go isn't installed")
+	}
+
+	path := filepath.Join(dir, Prefix+"hostsfile")
+	out, err := exec.Command("go", "build", "-o", path, "github.com/iamthemuffinman/overseer/plugins/overseer-provider-hostsfile").CombinedOutput()
+	if err != nil {
+		t.Fatalf("unable to build plugin: %s\n%s", err, out)
+	}
+	return path
+}
+
+func TestHostsFilePlugin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overseer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	buildHostsFile(t, dir)
+
+	hostsFile := filepath.Join(dir, "hosts")
+	cspec := &configspec.Spec{
+		Foreman: configspec.Foreman{Username: "admin", Password: "datpass"},
+		Plugins: map[string]*configspec.Plugin{
+			"hostsfile": {Settings: map[string]interface{}{"path": hostsFile}},
+		},
+	}
+
+	var mu sync.Mutex
+	var logged []string
+	defer func(old func(name, line string)) { logLine = old }(logLine)
+	logLine = func(name, line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		logged = append(logged, name+": "+line)
+	}
+
+	plugins := Discover(dir)
+	Register(plugins, nil)
+	defer CleanupClients()
+
+	// The plugin only has a DNS provider, so that's all it's registered as
+	if !provider.Registered(KindDNS, "hostsfile") || provider.Registered(KindCompute, "hostsfile") {
+		t.Fatal("expected hostsfile to only be registered as a DNS provider")
+	}
+	bspec := &buildspec.Spec{Compute: "hostsfile", IPAM: "foreman", Config: "chef"}
+	_, err = provider.Load(bspec, cspec)
+	if err == nil || !strings.Contains(err.Error(), `compute provider "hostsfile"`) {
+		t.Fatalf("expected error about compute, got %v", err)
+	}
+
+	client := NewClient("hostsfile", plugins["hostsfile"])
+	defer client.Kill()
+
+	if _, err := client.DNS(&buildspec.Spec{DNS: "hostsfile"}, &configspec.Spec{}); err == nil || !strings.Contains(err.Error(), "set path") {
+		t.Fatalf("expected an error without settings, got %v", err)
+	}
+
+	dns, err := client.DNS(&buildspec.Spec{DNS: "hostsfile"}, cspec)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	diffs, err := dns.Diff("web01.qa.local", "10.0.0.10")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if expected := []drift.Difference{drift.Missing("ip", "10.0.0.10")}; !reflect.DeepEqual(diffs, expected) {
+		t.Fatalf("bad: %#v", diffs)
+	}
+
+	for _, expected := range []string{provider.Created, provider.Unchanged} {
+		change, err := dns.EnsureRecord("web01.qa.local", "10.0.0.10")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if change != expected {
+			t.Fatalf("expected %s, got %s", expected, change)
+		}
+	}
+
+	change, err := dns.EnsureRecord("web01.qa.local", "10.0.0.11")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if change != provider.Updated {
+		t.Fatalf("expected %s, got %s", provider.Updated, change)
+	}
+
+	data, err := ioutil.ReadFile(hostsFile)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(data) != "10.0.0.11 web01.qa.local\n" {
+		t.Fatalf("bad: %q", data)
+	}
+
+	// Killing the plugin waits for everything it wrote to be read
+	client.Kill()
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{
+		"hostsfile: created web01.qa.local -> 10.0.0.10",
+		"hostsfile: [WARN] moving web01.qa.local from 10.0.0.10 to 10.0.0.11",
+		"hostsfile: updated web01.qa.local -> 10.0.0.11",
+	}
+	if !reflect.DeepEqual(logged, expected) {
+		t.Fatalf("bad: %#v", logged)
+	}
+
+	if _, err := client.DNS(&buildspec.Spec{}, &configspec.Spec{}); err == nil {
+		t.Fatal("expected an error from a stopped plugin")
+	}
+}
+
+func TestPluginRunByHand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overseer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	out, err := exec.Command(buildHostsFile(t, dir)).CombinedOutput()
+	if err == nil {
+		t.Fatal("expected the plugin to fail")
+	}
+	if !strings.Contains(string(out), "This is an overseer plugin") {
+		t.Fatalf("bad: %s", out)
+	}
+}
+
+func TestClientProtocolMismatch(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+
+	dir, err := ioutil.TempDir("", "overseer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, Prefix+"future")
+	script := "#!/bin/sh\necho '3|dns|unix|/nowhere'\ncat >/dev/null\n"
+	if err := ioutil.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	defer func(old time.Duration) { StartTimeout = old }(StartTimeout)
+	StartTimeout = 5 * time.Second
+
+	client := NewClient("future", path)
+	defer client.Kill()
+
+	_, err = client.DNS(&buildspec.Spec{}, &configspec.Spec{})
+	if err == nil || !strings.Contains(err.Error(), "it speaks protocol version 3, but this overseer speaks 2") {
+		t.Fatalf("expected a version mismatch, got %v", err)
+	}
+}
+
+func TestRegisterShadowing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overseer")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The plugin takes the name of an in-tree DNS provider
+	if err := os.Rename(buildHostsFile(t, dir), filepath.Join(dir, Prefix+"builtindns")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	builtin := func(bspec *buildspec.Spec, cspec *configspec.Spec) (provider.DNSProvider, error) {
+		return nil, fmt.Errorf("in-tree")
+	}
+	provider.RegisterDNS("builtindns", builtin)
+
+	// Foreman's set up first, without talking to it
+	bspec := &buildspec.Spec{IPAM: "foreman", DNS: "builtindns", Config: "chef"}
+	cspec := &configspec.Spec{Foreman: configspec.Foreman{Endpoint: configspec.Endpoint{URL: "https://foreman.qa.local"}}}
+	cases := []struct {
+		Settings map[string]*configspec.Plugin
+		Err      string
+	}{
+		{nil, "in-tree"},
+		{map[string]*configspec.Plugin{"builtindns": {}}, "in-tree"},
+		// The plugin is set up, and looks for its hostsfile block
+		{map[string]*configspec.Plugin{"builtindns": {ReplaceBuiltin: true}}, "set path"},
+	}
+
+	for _, tc := range cases {
+		provider.RegisterDNS("builtindns", builtin)
+		Register(Discover(dir), tc.Settings)
+
+		_, err := provider.Load(bspec, cspec)
+		if err == nil || !strings.Contains(err.Error(), tc.Err) {
+			t.Fatalf("%#v: expected an error containing %q, got %v", tc.Settings, tc.Err, err)
+		}
+		CleanupClients()
+	}
+}
+
+// recorder is a Plugin service that keeps what it's asked to configure.
+type recorder struct {
+	args ConfigureArgs
+}
+
+func (r *recorder) Configure(args ConfigureArgs, reply *Empty) error {
+	r.args = args
+	return nil
+}
+
+func TestConfigureSendsOnlyPluginBlock(t *testing.T) {
+	server := rpc.NewServer()
+	rec := &recorder{}
+	if err := server.RegisterName("Plugin", rec); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	conn, pluginConn := net.Pipe()
+	go server.ServeConn(pluginConn)
+
+	// A client that's already running
+	c := NewClient("cmdb", "")
+	c.cmd = &exec.Cmd{}
+	c.rpc = rpc.NewClient(conn)
+	defer c.rpc.Close()
+
+	cspec := &configspec.Spec{
+		Foreman: configspec.Foreman{Username: "admin", Password: "datpass"},
+		Vault:   configspec.Vault{Token: "s.vaulttoken"},
+		Plugins: map[string]*configspec.Plugin{
+			"cmdb":      {ReplaceBuiltin: true, Settings: map[string]interface{}{"token": "cmdbtoken"}},
+			"hostsfile": {Settings: map[string]interface{}{"path": "/etc/hosts.overseer"}},
+		},
+	}
+	if _, err := c.IPAM(&buildspec.Spec{IPAM: "cmdb"}, cspec); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if rec.args.Kind != KindIPAM || rec.args.Name != "cmdb" || string(rec.args.Settings) != `{"token":"cmdbtoken"}` {
+		t.Fatalf("bad: %s %s %s", rec.args.Kind, rec.args.Name, rec.args.Settings)
+	}
+	for _, secret := range []string{"datpass", "s.vaulttoken", "/etc/hosts.overseer"} {
+		if strings.Contains(string(rec.args.Buildspec)+string(rec.args.Settings), secret) {
+			t.Fatalf("%q was sent to the plugin", secret)
+		}
+	}
+}
+
+func TestConfigureServer(t *testing.T) {
+	var got *configspec.Spec
+	s := &pluginServer{opts: ServeOpts{
+		IPAM: func(bspec *buildspec.Spec, cspec *configspec.Spec) (provider.IPAMProvider, error) {
+			got = cspec
+			return nil, nil
+		},
+	}}
+
+	args := ConfigureArgs{Kind: KindIPAM, Name: "cmdb", Buildspec: []byte(`{}`), Settings: []byte(`{"token":"cmdbtoken"}`)}
+	if err := s.Configure(args, &Empty{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &configspec.Spec{
+		Plugins: map[string]*configspec.Plugin{
+			"cmdb": {Settings: map[string]interface{}{"token": "cmdbtoken"}},
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("bad: %#v", got)
+	}
+}
@@ -0,0 +1,59 @@
+package plugin
+
+import (
+	"time"
+
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+)
+
+// The kinds of provider a plugin can serve.
+const (
+	KindCompute = "compute"
+	KindIPAM    = "ipam"
+	KindDNS     = "dns"
+	KindConfig  = "config"
+)
+
+// ConfigureArgs asks a plugin to set up one of its providers for a
+// buildspec. Name is the plugin's name and Settings its configspec block.
+// The buildspec and settings are sent as JSON, since they can hold
+// anything.
+type ConfigureArgs struct {
+	Kind      string
+	Name      string
+	Buildspec []byte
+	Settings  []byte
+}
+
+type HostArgs struct {
+	Host string
+}
+
+type UpdateArgs struct {
+	Host  string
+	Diffs []drift.Difference
+}
+
+type RecordArgs struct {
+	Host string
+	IP   string
+}
+
+type WaitArgs struct {
+	Host  string
+	Since time.Time
+}
+
+type Empty struct{}
+
+type BoolReply struct {
+	Value bool
+}
+
+type StringReply struct {
+	Value string
+}
+
+type DiffReply struct {
+	Diffs []drift.Difference
+}
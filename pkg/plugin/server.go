@@ -0,0 +1,372 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/provider"
+)
+
+// ServeOpts are the providers a plugin serves. Leave out the ones it
+// doesn't have. The configspec their factories are given only has the
+// plugin's own block, in Plugins.
+type ServeOpts struct {
+	Compute provider.ComputeFactory
+	IPAM    provider.IPAMFactory
+	DNS     provider.DNSFactory
+	Config  provider.ConfigFactory
+}
+
+// kinds returns the kinds of provider opts has.
+func (opts ServeOpts) kinds() []string {
+	var kinds []string
+	if opts.Compute != nil {
+		kinds = append(kinds, KindCompute)
+	}
+	if opts.IPAM != nil {
+		kinds = append(kinds, KindIPAM)
+	}
+	if opts.DNS != nil {
+		kinds = append(kinds, KindDNS)
+	}
+	if opts.Config != nil {
+		kinds = append(kinds, KindConfig)
+	}
+	return kinds
+}
+
+// Serve is a plugin's main function. It serves opts's providers to the
+// overseer that started it and exits once overseer is done with it.
+// Anything the plugin logs to stderr is shown by overseer, at error or
+// warning level if the line starts [ERROR] or [WARN].
+func Serve(opts ServeOpts) {
+	if os.Getenv(MagicCookieKey) != MagicCookieValue {
+		fmt.Fprintf(os.Stderr, "This is an overseer plugin. It's run by overseer rather than by hand.\n"+
+			"Put it in ~/.overseer/plugins.\n")
+		os.Exit(1)
+	}
+
+	if err := serve(opts, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "[ERROR] %s\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// serve listens on a fresh Unix socket, writes the handshake to out and
+// serves RPCs until in is closed.
+func serve(opts ServeOpts, in io.Reader, out io.Writer) error {
+	kinds := opts.kinds()
+	if len(kinds) == 0 {
+		return fmt.Errorf("the plugin doesn't serve any providers")
+	}
+
+	dir, err := ioutil.TempDir("", "overseer-plugin")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	address := filepath.Join(dir, "plugin.sock")
+	listener, err := net.Listen("unix", address)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	server := rpc.NewServer()
+	s := &pluginServer{opts: opts}
+	for name, service := range map[string]interface{}{
+		"Plugin":  s,
+		"Compute": &computeServer{s},
+		"IPAM":    &ipamServer{s},
+		"DNS":     &dnsServer{s},
+		"Config":  &configServer{s},
+	} {
+		if err := server.RegisterName(name, service); err != nil {
+			return err
+		}
+	}
+
+	// rpc.Server.Accept logs when the listener is closed, which is how
+	// every plugin ends, so accept connections here instead
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.ServeConn(conn)
+		}
+	}()
+
+	if _, err := fmt.Fprintf(out, "%d|%s|unix|%s\n", ProtocolVersion, strings.Join(kinds, ","), address); err != nil {
+		return err
+	}
+
+	// Overseer closes stdin when it's finished with the plugin, or when it
+	// dies
+	io.Copy(ioutil.Discard, in)
+	return nil
+}
+
+// pluginServer holds the providers overseer has configured.
+type pluginServer struct {
+	opts ServeOpts
+
+	mu      sync.Mutex
+	compute provider.ComputeProvider
+	ipam    provider.IPAMProvider
+	dns     provider.DNSProvider
+	config  provider.ConfigManager
+}
+
+func (s *pluginServer) Configure(args ConfigureArgs, reply *Empty) error {
+	var bspec buildspec.Spec
+	if err := json.Unmarshal(args.Buildspec, &bspec); err != nil {
+		return fmt.Errorf("unable to read buildspec: %s", err)
+	}
+	// The plugin's own block is all of the configspec it gets
+	var settings map[string]interface{}
+	if err := json.Unmarshal(args.Settings, &settings); err != nil {
+		return fmt.Errorf("unable to read plugin settings: %s", err)
+	}
+	cspec := configspec.Spec{
+		Plugins: map[string]*configspec.Plugin{args.Name: {Settings: settings}},
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	switch {
+	case args.Kind == KindCompute && s.opts.Compute != nil:
+		s.compute, err = s.opts.Compute(&bspec, &cspec)
+	case args.Kind == KindIPAM && s.opts.IPAM != nil:
+		s.ipam, err = s.opts.IPAM(&bspec, &cspec)
+	case args.Kind == KindDNS && s.opts.DNS != nil:
+		s.dns, err = s.opts.DNS(&bspec, &cspec)
+	case args.Kind == KindConfig && s.opts.Config != nil:
+		s.config, err = s.opts.Config(&bspec, &cspec)
+	default:
+		return fmt.Errorf("no %s provider in this plugin", args.Kind)
+	}
+	return err
+}
+
+func (s *pluginServer) notConfigured(kind string) error {
+	return fmt.Errorf("%s provider used before it was configured", kind)
+}
+
+type computeServer struct {
+	s *pluginServer
+}
+
+func (c *computeServer) provider() (provider.ComputeProvider, error) {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+
+	if c.s.compute == nil {
+		return nil, c.s.notConfigured(KindCompute)
+	}
+	return c.s.compute, nil
+}
+
+func (c *computeServer) Exists(args HostArgs, reply *BoolReply) error {
+	p, err := c.provider()
+	if err != nil {
+		return err
+	}
+	reply.Value, err = p.Exists(args.Host)
+	return err
+}
+
+func (c *computeServer) Create(args HostArgs, reply *Empty) error {
+	p, err := c.provider()
+	if err != nil {
+		return err
+	}
+	return p.Create(args.Host)
+}
+
+func (c *computeServer) Diff(args HostArgs, reply *DiffReply) error {
+	p, err := c.provider()
+	if err != nil {
+		return err
+	}
+	reply.Diffs, err = p.Diff(args.Host)
+	return err
+}
+
+func (c *computeServer) Update(args UpdateArgs, reply *Empty) error {
+	p, err := c.provider()
+	if err != nil {
+		return err
+	}
+	return p.Update(args.Host, args.Diffs)
+}
+
+func (c *computeServer) Built(args HostArgs, reply *BoolReply) error {
+	p, err := c.provider()
+	if err != nil {
+		return err
+	}
+	reply.Value, err = p.Built(args.Host)
+	return err
+}
+
+type ipamServer struct {
+	s *pluginServer
+}
+
+func (i *ipamServer) provider() (provider.IPAMProvider, error) {
+	i.s.mu.Lock()
+	defer i.s.mu.Unlock()
+
+	if i.s.ipam == nil {
+		return nil, i.s.notConfigured(KindIPAM)
+	}
+	return i.s.ipam, nil
+}
+
+func (i *ipamServer) Address(args HostArgs, reply *StringReply) error {
+	p, err := i.provider()
+	if err != nil {
+		return err
+	}
+	reply.Value, err = p.Address(args.Host)
+	return err
+}
+
+type dnsServer struct {
+	s *pluginServer
+}
+
+func (d *dnsServer) provider() (provider.DNSProvider, error) {
+	d.s.mu.Lock()
+	defer d.s.mu.Unlock()
+
+	if d.s.dns == nil {
+		return nil, d.s.notConfigured(KindDNS)
+	}
+	return d.s.dns, nil
+}
+
+func (d *dnsServer) EnsureRecord(args RecordArgs, reply *StringReply) error {
+	p, err := d.provider()
+	if err != nil {
+		return err
+	}
+	reply.Value, err = p.EnsureRecord(args.Host, args.IP)
+	return err
+}
+
+func (d *dnsServer) Diff(args RecordArgs, reply *DiffReply) error {
+	p, err := d.provider()
+	if err != nil {
+		return err
+	}
+	reply.Diffs, err = p.Diff(args.Host, args.IP)
+	return err
+}
+
+type configServer struct {
+	s *pluginServer
+}
+
+func (c *configServer) provider() (provider.ConfigManager, error) {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+
+	if c.s.config == nil {
+		return nil, c.s.notConfigured(KindConfig)
+	}
+	return c.s.config, nil
+}
+
+func (c *configServer) ResolveConflict(args HostArgs, reply *StringReply) error {
+	p, err := c.provider()
+	if err != nil {
+		return err
+	}
+	reply.Value, err = p.ResolveConflict(args.Host)
+	return err
+}
+
+func (c *configServer) Registered(args HostArgs, reply *BoolReply) error {
+	p, err := c.provider()
+	if err != nil {
+		return err
+	}
+	reply.Value, err = p.Registered(args.Host)
+	return err
+}
+
+func (c *configServer) Bootstraps(args Empty, reply *BoolReply) error {
+	p, err := c.provider()
+	if err != nil {
+		return err
+	}
+	reply.Value = p.Bootstraps()
+	return nil
+}
+
+func (c *configServer) Bootstrap(args HostArgs, reply *Empty) error {
+	p, err := c.provider()
+	if err != nil {
+		return err
+	}
+	return p.Bootstrap(args.Host)
+}
+
+func (c *configServer) Apply(args HostArgs, reply *StringReply) error {
+	p, err := c.provider()
+	if err != nil {
+		return err
+	}
+	reply.Value, err = p.Apply(args.Host)
+	return err
+}
+
+func (c *configServer) WaitForConverge(args WaitArgs, reply *Empty) error {
+	p, err := c.provider()
+	if err != nil {
+		return err
+	}
+	return p.WaitForConverge(args.Host, args.Since)
+}
+
+func (c *configServer) Converge(args HostArgs, reply *Empty) error {
+	p, err := c.provider()
+	if err != nil {
+		return err
+	}
+	return p.Converge(args.Host)
+}
+
+func (c *configServer) Diff(args HostArgs, reply *DiffReply) error {
+	p, err := c.provider()
+	if err != nil {
+		return err
+	}
+	reply.Diffs, err = p.Diff(args.Host)
+	return err
+}
+
+func (c *configServer) Remove(args HostArgs, reply *Empty) error {
+	p, err := c.provider()
+	if err != nil {
+		return err
+	}
+	return p.Remove(args.Host)
+}
@@ -0,0 +1,150 @@
+package provider
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/ansible"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+)
+
+func init() {
+	RegisterConfig("ansible", newAnsibleManager)
+}
+
+// ansibleManager configures hosts by running the buildspec's playbook
+// against them. There's no server keeping track of hosts, so there's
+// nothing to register, bootstrap or clean up, and a host has converged as
+// soon as the playbook has finished with it.
+type ansibleManager struct {
+	playbook *ansible.Playbook
+
+	mu sync.Mutex
+	// pending are the hosts the next run covers, with their vars
+	pending []string
+	vars    map[string]map[string]string
+	// results are what runs found for hosts that haven't been asked for
+	// them yet, and errs why runs covering them couldn't be done
+	results map[string]*ansible.Result
+	errs    map[string]error
+}
+
+func newAnsibleManager(bspec *buildspec.Spec, cspec *configspec.Spec) (ConfigManager, error) {
+	if bspec.Ansible.Playbook == "" {
+		return nil, fmt.Errorf("the ansible config manager needs an ansible block in the buildspec")
+	}
+	return &ansibleManager{
+		playbook: ansible.New(bspec.Ansible, cspec.SSH),
+		results:  make(map[string]*ansible.Result),
+		errs:     make(map[string]error),
+	}, nil
+}
+
+// Prepare has the next run of the playbook cover all the hosts, so it
+// only runs once however many there are.
+func (m *ansibleManager) Prepare(hosts []string, vars map[string]map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pending = hosts
+	m.vars = vars
+}
+
+func (m *ansibleManager) ResolveConflict(host string) (string, error) { return "", nil }
+func (m *ansibleManager) Registered(host string) (bool, error)        { return false, nil }
+func (m *ansibleManager) Bootstraps() bool                            { return false }
+func (m *ansibleManager) Bootstrap(host string) error                 { return nil }
+
+// Apply runs the playbook, unless an earlier run already covered the
+// host, and returns what it did there.
+func (m *ansibleManager) Apply(host string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ran := m.results[host]
+	_, failed := m.errs[host]
+	if !ran && !failed {
+		hosts := m.pending
+		if !contains(hosts, host) {
+			hosts = []string{host}
+		}
+		m.pending = nil
+
+		results, err := m.playbook.Run(hosts, m.vars, false)
+		for _, h := range hosts {
+			if err != nil {
+				m.errs[h] = err
+			} else if result, ok := results[h]; ok {
+				m.results[h] = result
+			}
+		}
+	}
+
+	result, ok := m.results[host]
+	err := m.errs[host]
+	delete(m.results, host)
+	delete(m.errs, host)
+
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("the playbook didn't run on %s", host)
+	}
+
+	if err := result.Err(); err != nil {
+		return "", fmt.Errorf("playbook failed on %s: %s", host, err)
+	}
+	if result.Changed > 0 {
+		return Updated + " (" + result.String() + ")", nil
+	}
+	return Unchanged, nil
+}
+
+// WaitForConverge has nothing to wait for: Apply only returns once the
+// playbook has finished.
+func (m *ansibleManager) WaitForConverge(host string, since time.Time) error { return nil }
+
+// Converge has nothing left to do once Apply has run the playbook.
+func (m *ansibleManager) Converge(host string) error { return nil }
+
+// Diff runs the playbook against the host in check mode, with the vars it
+// was prepared with, and reports the tasks that would change something.
+func (m *ansibleManager) Diff(host string) ([]drift.Difference, error) {
+	m.mu.Lock()
+	vars := m.vars
+	m.mu.Unlock()
+
+	results, err := m.playbook.Run([]string{host}, vars, true)
+	if err != nil {
+		return nil, err
+	}
+
+	result, ok := results[host]
+	if !ok {
+		return nil, fmt.Errorf("the playbook didn't run on %s", host)
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("playbook failed on %s: %s", host, err)
+	}
+
+	var diffs []drift.Difference
+	for _, task := range result.Changes {
+		diffs = append(diffs, drift.Difference{Field: task, Have: "not applied", Want: "applied"})
+	}
+	return diffs, nil
+}
+
+func (m *ansibleManager) Remove(host string) error { return nil }
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
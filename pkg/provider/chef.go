@@ -0,0 +1,146 @@
+package provider
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/chef"
+	"github.com/iamthemuffinman/overseer/pkg/cloudinit"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+	"github.com/iamthemuffinman/overseer/pkg/ssh"
+)
+
+func init() {
+	RegisterConfig("chef", newChefManager)
+}
+
+// chefManager configures hosts with the buildspec's chef block, running
+// chef-client on them over SSH.
+type chefManager struct {
+	spec    buildspec.Chef
+	cspec   configspec.Chef
+	ssh     configspec.SSH
+	nodes   *chef.NodeManager
+	timeout time.Duration
+
+	// firstBoot is set when cloud-init bootstraps hosts, so there's
+	// nothing left to do over SSH
+	firstBoot bool
+
+	// The bootstrapper reads keys that only bootstrapping needs, so it's
+	// only set up the first time a host is bootstrapped
+	once         sync.Once
+	bootstrapper *chef.Bootstrapper
+	err          error
+}
+
+func newChefManager(bspec *buildspec.Spec, cspec *configspec.Spec) (ConfigManager, error) {
+	nodes, err := chef.NewNodeManager(cspec.Chef.Username, cspec.Chef.ClientKey, chef.ServerEndpoint(bspec.Chef, cspec.Chef))
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := chef.DefaultConvergeTimeout
+	if bspec.Chef.ConvergeTimeout > 0 {
+		timeout = time.Duration(bspec.Chef.ConvergeTimeout) * time.Second
+	}
+
+	return &chefManager{
+		spec:    bspec.Chef,
+		cspec:   cspec.Chef,
+		ssh:     cspec.SSH,
+		nodes:   nodes,
+		timeout: timeout,
+
+		firstBoot: bspec.CloudInit != nil && bspec.CloudInit.ChefBootstrap,
+	}, nil
+}
+
+func (m *chefManager) ResolveConflict(host string) (string, error) {
+	return m.nodes.ResolveConflict(host, m.spec)
+}
+
+func (m *chefManager) Registered(host string) (bool, error) {
+	return m.nodes.Registered(host)
+}
+
+func (m *chefManager) Bootstraps() bool {
+	return !m.spec.SkipBootstrap && !m.firstBoot
+}
+
+func (m *chefManager) Bootstrap(host string) error {
+	if !m.Bootstraps() {
+		return nil
+	}
+
+	if err := m.setup(); err != nil {
+		return err
+	}
+	return m.bootstrapper.Bootstrap(host)
+}
+
+// FirstBoot returns the files and commands cloud-init bootstraps the host
+// with.
+func (m *chefManager) FirstBoot(host string) ([]cloudinit.File, []string, error) {
+	if err := m.setup(); err != nil {
+		return nil, nil, err
+	}
+
+	files, commands, err := m.bootstrapper.FirstBoot(host)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var out []cloudinit.File
+	for _, f := range files {
+		out = append(out, cloudinit.File{Path: f.Path, Mode: f.Mode, Content: f.Content})
+	}
+	return out, commands, nil
+}
+
+func (m *chefManager) setup() error {
+	m.once.Do(func() {
+		m.bootstrapper, m.err = chef.NewBootstrapper(m.spec, m.cspec, m.ssh)
+		if m.err != nil {
+			m.err = fmt.Errorf("unable to set up chef bootstrap: %s", m.err)
+			return
+		}
+		m.bootstrapper.Output = func(host string) io.Writer { return os.Stdout }
+	})
+	return m.err
+}
+
+func (m *chefManager) Apply(host string) (string, error) {
+	change, err := m.nodes.Apply(host, m.spec)
+	return string(change), err
+}
+
+func (m *chefManager) WaitForConverge(host string, since time.Time) error {
+	return m.nodes.WaitForConverge(host, since, m.timeout)
+}
+
+func (m *chefManager) Converge(host string) error {
+	executor := &ssh.Executor{Config: m.ssh, Output: os.Stdout}
+
+	result := executor.Run([]string{host}, "chef-client")[0]
+	if result.Err != nil {
+		return result.Err
+	}
+	if result.ExitStatus != 0 {
+		return fmt.Errorf("chef-client exited %d", result.ExitStatus)
+	}
+	return nil
+}
+
+func (m *chefManager) Diff(host string) ([]drift.Difference, error) {
+	return m.nodes.Diff(host, m.spec)
+}
+
+func (m *chefManager) Remove(host string) error {
+	return m.nodes.Remove(host)
+}
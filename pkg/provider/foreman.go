@@ -0,0 +1,113 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+	"github.com/iamthemuffinman/overseer/pkg/foreman"
+	"github.com/iamthemuffinman/overseer/pkg/hammer"
+)
+
+func init() {
+	RegisterCompute("foreman", newForemanCompute)
+	RegisterIPAM("foreman", newForemanIPAM)
+}
+
+// foremanCompute creates hosts with hammer and looks them up through the
+// Foreman API. Their hardware comes from the buildspec's vsphere block.
+type foremanCompute struct {
+	client *foreman.Client
+	hammer *hammer.Hammer
+	spec   buildspec.Foreman
+}
+
+func newForemanCompute(bspec *buildspec.Spec, cspec *configspec.Spec) (ComputeProvider, error) {
+	client, err := foreman.New(cspec.Foreman)
+	if err != nil {
+		return nil, err
+	}
+
+	return &foremanCompute{
+		client: client,
+		hammer: hammer.New(bspec.Foreman, cspec.Foreman, hammer.Host{
+			CPUs:   bspec.Vsphere.CPUs,
+			Cores:  bspec.Vsphere.Cores,
+			Memory: bspec.Vsphere.Memory,
+			Disks:  bspec.Vsphere.Devices.Disks,
+		}),
+		spec: bspec.Foreman,
+	}, nil
+}
+
+// hammerFor returns a copy of the Hammer pointed at host.
+func (c *foremanCompute) hammerFor(host string) *hammer.Hammer {
+	h := *c.hammer
+	h.Hostname = host
+	return &h
+}
+
+func (c *foremanCompute) Exists(host string) (bool, error) {
+	h, err := c.client.Host(host)
+	if err != nil {
+		return false, fmt.Errorf("unable to look up %s in foreman: %s", host, err)
+	}
+	return h != nil, nil
+}
+
+func (c *foremanCompute) Create(host string) error {
+	return c.hammerFor(host).Execute()
+}
+
+func (c *foremanCompute) Diff(host string) ([]drift.Difference, error) {
+	h, err := c.client.Host(host)
+	if err != nil {
+		return nil, err
+	}
+	if h == nil {
+		return []drift.Difference{drift.Missing("host", "present")}, nil
+	}
+	return h.Diff(c.spec), nil
+}
+
+func (c *foremanCompute) Update(host string, diffs []drift.Difference) error {
+	var fields []string
+	for _, diff := range diffs {
+		fields = append(fields, diff.Field)
+	}
+	return c.hammerFor(host).Update(fields)
+}
+
+func (c *foremanCompute) Built(host string) (bool, error) {
+	// GetBuildStatus returns 0 once Foreman says the host has been built
+	status, err := c.hammerFor(host).GetBuildStatus()
+	if err != nil {
+		return false, err
+	}
+	return status == 0, nil
+}
+
+// foremanIPAM takes the address Foreman gave a host from its subnet.
+type foremanIPAM struct {
+	client *foreman.Client
+}
+
+func newForemanIPAM(bspec *buildspec.Spec, cspec *configspec.Spec) (IPAMProvider, error) {
+	client, err := foreman.New(cspec.Foreman)
+	if err != nil {
+		return nil, err
+	}
+	return &foremanIPAM{client: client}, nil
+}
+
+func (i *foremanIPAM) Address(host string) (string, error) {
+	h, err := i.client.Host(host)
+	if err != nil {
+		return "", fmt.Errorf("unable to look up %s in foreman: %s", host, err)
+	}
+	if h == nil || h.IP == "" {
+		return "", fmt.Errorf("foreman doesn't have an address for %s", host)
+	}
+	return h.IP, nil
+}
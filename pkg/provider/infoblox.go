@@ -0,0 +1,70 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+	"github.com/iamthemuffinman/overseer/pkg/infoblox"
+)
+
+func init() {
+	RegisterIPAM("infoblox", newInfobloxIPAM)
+	RegisterDNS("infoblox", newInfobloxDNS)
+}
+
+// infobloxIPAM reserves hosts' addresses as host records in the
+// buildspec's infoblox subnet, before the hosts are created, so they can
+// go in their cloud-init seeds.
+type infobloxIPAM struct {
+	client *infoblox.Client
+	subnet string
+}
+
+func newInfobloxIPAM(bspec *buildspec.Spec, cspec *configspec.Spec) (IPAMProvider, error) {
+	if bspec.Infoblox.Subnet == "" {
+		return nil, fmt.Errorf("the infoblox ipam provider needs a subnet in the buildspec's infoblox block")
+	}
+	client, err := infoblox.New(cspec.Infoblox)
+	if err != nil {
+		return nil, err
+	}
+	return &infobloxIPAM{client: client, subnet: bspec.Infoblox.Subnet}, nil
+}
+
+func (i *infobloxIPAM) Address(host string) (string, error) {
+	ip, err := i.client.HostAddress(host)
+	if err != nil {
+		return "", err
+	}
+	if ip == "" {
+		return "", fmt.Errorf("infoblox doesn't have an address for %s", host)
+	}
+	return ip, nil
+}
+
+func (i *infobloxIPAM) Allocate(host string) (string, error) {
+	return i.client.AllocateHostAddress(host, i.subnet)
+}
+
+// infobloxDNS keeps each host's A record in Infoblox.
+type infobloxDNS struct {
+	client *infoblox.Client
+}
+
+func newInfobloxDNS(bspec *buildspec.Spec, cspec *configspec.Spec) (DNSProvider, error) {
+	client, err := infoblox.New(cspec.Infoblox)
+	if err != nil {
+		return nil, err
+	}
+	return &infobloxDNS{client: client}, nil
+}
+
+func (d *infobloxDNS) EnsureRecord(host, ip string) (string, error) {
+	return d.client.EnsureARecord(host, ip)
+}
+
+func (d *infobloxDNS) Diff(host, ip string) ([]drift.Difference, error) {
+	return d.client.DiffARecord(host, ip)
+}
@@ -0,0 +1,82 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/cloudinit"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+	"github.com/iamthemuffinman/overseer/pkg/libvirt"
+)
+
+func init() {
+	RegisterCompute("libvirt", newLibvirtCompute)
+}
+
+// libvirtCompute creates hosts as libvirt domains with the hardware in the
+// buildspec's libvirt block.
+type libvirtCompute struct {
+	virsh     *libvirt.Virsh
+	spec      buildspec.Libvirt
+	cloudInit *buildspec.CloudInit
+}
+
+func newLibvirtCompute(bspec *buildspec.Spec, cspec *configspec.Spec) (ComputeProvider, error) {
+	if bspec.Libvirt.URI == "" {
+		return nil, fmt.Errorf("the libvirt compute provider needs a libvirt block in the buildspec")
+	}
+	return &libvirtCompute{virsh: libvirt.New(bspec.Libvirt.URI), spec: bspec.Libvirt, cloudInit: bspec.CloudInit}, nil
+}
+
+func (c *libvirtCompute) Exists(host string) (bool, error) {
+	domain, err := c.virsh.Domain(host)
+	if err != nil {
+		return false, fmt.Errorf("unable to look up %s in libvirt: %s", host, err)
+	}
+	return domain != nil, nil
+}
+
+func (c *libvirtCompute) Create(host string) error {
+	return c.virsh.Create(host, c.spec, nil)
+}
+
+// CreateSeeded creates the host with its seed on an ISO in its CD-ROM
+// drive, where cloud-init's NoCloud datasource finds it.
+func (c *libvirtCompute) CreateSeeded(host string, seed *cloudinit.Seed) error {
+	if c.cloudInit != nil && c.cloudInit.Delivery != buildspec.DeliveryISO {
+		return fmt.Errorf("libvirt hosts can only get their cloud-init seed on an ISO, not by %s", c.cloudInit.Delivery)
+	}
+
+	iso, err := seed.ISO()
+	if err != nil {
+		return err
+	}
+	return c.virsh.Create(host, c.spec, iso)
+}
+
+func (c *libvirtCompute) Diff(host string) ([]drift.Difference, error) {
+	domain, err := c.virsh.Domain(host)
+	if err != nil {
+		return nil, err
+	}
+	if domain == nil {
+		return []drift.Difference{drift.Missing("host", "present")}, nil
+	}
+	return domain.Diff(c.spec), nil
+}
+
+func (c *libvirtCompute) Update(host string, diffs []drift.Difference) error {
+	return c.virsh.Update(host, c.spec, diffs)
+}
+
+// Built reports whether the host's domain is running. Hosts built from an
+// image are ready once they've booted; ones installed over PXE are left to
+// whatever installs them.
+func (c *libvirtCompute) Built(host string) (bool, error) {
+	domain, err := c.virsh.Domain(host)
+	if err != nil {
+		return false, err
+	}
+	return domain != nil && domain.Running, nil
+}
@@ -0,0 +1,264 @@
+// Package provider defines the backends overseer builds hosts with, so
+// provisioning doesn't care whether hosts come from Foreman or get their
+// configuration from Chef. Buildspecs pick providers by name and new ones
+// are added with the Register functions.
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+)
+
+// What applying a buildspec to something did.
+const (
+	Created   = "created"
+	Updated   = "updated"
+	Unchanged = "unchanged"
+)
+
+// None is the DNS provider for buildspecs that leave DNS alone.
+const None = "none"
+
+// ComputeProvider creates hosts and builds their operating system.
+type ComputeProvider interface {
+	// Exists reports whether the provider already has the host.
+	Exists(host string) (bool, error)
+	// Create creates the host and starts it building.
+	Create(host string) error
+	// Diff returns how an existing host differs from the buildspec.
+	Diff(host string) ([]drift.Difference, error)
+	// Update fixes the differences Diff found.
+	Update(host string, diffs []drift.Difference) error
+	// Built reports whether the host has finished building.
+	Built(host string) (bool, error)
+}
+
+// IPAMProvider hands out addresses.
+type IPAMProvider interface {
+	// Address returns the address the host was given.
+	Address(host string) (string, error)
+}
+
+// DNSProvider keeps hosts' DNS records pointing at their addresses.
+type DNSProvider interface {
+	// EnsureRecord creates or corrects the host's record, returning
+	// Created, Updated or Unchanged.
+	EnsureRecord(host, ip string) (string, error)
+	// Diff returns how the host's record differs from pointing at ip.
+	Diff(host, ip string) ([]drift.Difference, error)
+}
+
+// ConfigManager configures hosts once they're built.
+type ConfigManager interface {
+	// ResolveConflict deals with anything left over from an earlier host
+	// with the same name, returning what it did or "" if there was nothing.
+	ResolveConflict(host string) (string, error)
+	// Registered reports whether the host has already been bootstrapped.
+	Registered(host string) (bool, error)
+	// Bootstraps reports whether Bootstrap does anything, or the buildspec
+	// leaves installing the configuration management agent to the build.
+	Bootstraps() bool
+	// Bootstrap installs the agent on the host and runs it for the first
+	// time.
+	Bootstrap(host string) error
+	// Apply gives the host the buildspec's configuration, returning
+	// Created, Updated or Unchanged.
+	Apply(host string) (string, error)
+	// WaitForConverge waits for the host to finish a successful run that
+	// started after since.
+	WaitForConverge(host string, since time.Time) error
+	// Converge runs the agent on the host now.
+	Converge(host string) error
+	// Diff returns how the host's configuration differs from the
+	// buildspec.
+	Diff(host string) ([]drift.Difference, error)
+	// Remove forgets the host, so it can be bootstrapped again from
+	// scratch.
+	Remove(host string) error
+}
+
+// Preparer is implemented by configuration managers that configure hosts
+// together rather than one at a time. The pipeline tells them every host
+// it's about to configure, with the hostspec's variables for each, before
+// configuring the first.
+type Preparer interface {
+	Prepare(hosts []string, vars map[string]map[string]string)
+}
+
+// Factories make a provider for a buildspec, with the configspec's
+// connection settings.
+type (
+	ComputeFactory func(bspec *buildspec.Spec, cspec *configspec.Spec) (ComputeProvider, error)
+	IPAMFactory    func(bspec *buildspec.Spec, cspec *configspec.Spec) (IPAMProvider, error)
+	DNSFactory     func(bspec *buildspec.Spec, cspec *configspec.Spec) (DNSProvider, error)
+	ConfigFactory  func(bspec *buildspec.Spec, cspec *configspec.Spec) (ConfigManager, error)
+)
+
+var (
+	computeProviders = make(map[string]ComputeFactory)
+	ipamProviders    = make(map[string]IPAMFactory)
+	dnsProviders     = make(map[string]DNSFactory)
+	configManagers   = make(map[string]ConfigFactory)
+)
+
+// RegisterCompute makes a compute provider available to buildspecs under
+// name, replacing any already registered with that name.
+func RegisterCompute(name string, factory ComputeFactory) {
+	computeProviders[name] = factory
+}
+
+// RegisterIPAM makes an IPAM provider available to buildspecs under name.
+func RegisterIPAM(name string, factory IPAMFactory) {
+	ipamProviders[name] = factory
+}
+
+// RegisterDNS makes a DNS provider available to buildspecs under name.
+func RegisterDNS(name string, factory DNSFactory) {
+	dnsProviders[name] = factory
+}
+
+// RegisterConfig makes a configuration manager available to buildspecs
+// under name.
+func RegisterConfig(name string, factory ConfigFactory) {
+	configManagers[name] = factory
+}
+
+// Registered reports whether a provider of the given kind ("compute",
+// "ipam", "dns" or "config") is registered under name.
+func Registered(kind, name string) bool {
+	var ok bool
+	switch kind {
+	case "compute":
+		_, ok = computeProviders[name]
+	case "ipam":
+		_, ok = ipamProviders[name]
+	case "dns":
+		_, ok = dnsProviders[name]
+	case "config":
+		_, ok = configManagers[name]
+	}
+	return ok
+}
+
+// Set is the providers a buildspec builds hosts with.
+type Set struct {
+	Compute ComputeProvider
+	IPAM    IPAMProvider
+	// DNS is nil when the buildspec leaves DNS alone.
+	DNS    DNSProvider
+	Config ConfigManager
+
+	// Names are the names of the providers in use, by kind ("compute",
+	// "ipam", "dns" and "config").
+	Names map[string]string
+}
+
+// Load returns the providers the buildspec names, or the defaults for the
+// ones it doesn't.
+func Load(bspec *buildspec.Spec, cspec *configspec.Spec) (*Set, error) {
+	set := Set{Names: make(map[string]string)}
+	var err error
+
+	name := defaultName(bspec.Compute, "foreman")
+	factory, ok := computeProviders[name]
+	if !ok {
+		return nil, unknown("compute", name, computeNames())
+	}
+	if set.Compute, err = factory(bspec, cspec); err != nil {
+		return nil, fmt.Errorf("unable to set up compute provider %q: %s", name, err)
+	}
+	set.Names["compute"] = name
+
+	name = defaultName(bspec.IPAM, "foreman")
+	ipamFactory, ok := ipamProviders[name]
+	if !ok {
+		return nil, unknown("ipam", name, ipamNames())
+	}
+	if set.IPAM, err = ipamFactory(bspec, cspec); err != nil {
+		return nil, fmt.Errorf("unable to set up ipam provider %q: %s", name, err)
+	}
+	set.Names["ipam"] = name
+
+	name = bspec.DNS
+	if name == "" {
+		name = None
+		if bspec.Infoblox != (buildspec.Infoblox{}) {
+			name = "infoblox"
+		}
+	}
+	if name != None {
+		dnsFactory, ok := dnsProviders[name]
+		if !ok {
+			return nil, unknown("dns", name, dnsNames())
+		}
+		if set.DNS, err = dnsFactory(bspec, cspec); err != nil {
+			return nil, fmt.Errorf("unable to set up dns provider %q: %s", name, err)
+		}
+	}
+	set.Names["dns"] = name
+
+	name = defaultName(bspec.Config, "chef")
+	configFactory, ok := configManagers[name]
+	if !ok {
+		return nil, unknown("config", name, configNames())
+	}
+	if set.Config, err = configFactory(bspec, cspec); err != nil {
+		return nil, fmt.Errorf("unable to set up config manager %q: %s", name, err)
+	}
+	set.Names["config"] = name
+
+	return &set, nil
+}
+
+func defaultName(name, def string) string {
+	if name == "" {
+		return def
+	}
+	return name
+}
+
+func unknown(kind, name string, known []string) error {
+	return fmt.Errorf("buildspec asks for %s provider %q, but the only ones overseer knows are: %s", kind, name, strings.Join(known, ", "))
+}
+
+func computeNames() []string {
+	var names []string
+	for name := range computeProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func ipamNames() []string {
+	var names []string
+	for name := range ipamProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func dnsNames() []string {
+	names := []string{None}
+	for name := range dnsProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func configNames() []string {
+	var names []string
+	for name := range configManagers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
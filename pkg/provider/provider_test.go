@@ -0,0 +1,194 @@
+package provider
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+)
+
+type fakeCompute struct{}
+
+func (fakeCompute) Exists(host string) (bool, error)                   { return false, nil }
+func (fakeCompute) Create(host string) error                           { return nil }
+func (fakeCompute) Diff(host string) ([]drift.Difference, error)       { return nil, nil }
+func (fakeCompute) Update(host string, diffs []drift.Difference) error { return nil }
+func (fakeCompute) Built(host string) (bool, error)                    { return true, nil }
+
+type fakeIPAM struct{}
+
+func (fakeIPAM) Address(host string) (string, error) { return "10.0.0.10", nil }
+
+type fakeDNS struct{}
+
+func (fakeDNS) EnsureRecord(host, ip string) (string, error)     { return Unchanged, nil }
+func (fakeDNS) Diff(host, ip string) ([]drift.Difference, error) { return nil, nil }
+
+type fakeConfig struct{}
+
+func (fakeConfig) ResolveConflict(host string) (string, error)        { return "", nil }
+func (fakeConfig) Registered(host string) (bool, error)               { return true, nil }
+func (fakeConfig) Bootstraps() bool                                   { return false }
+func (fakeConfig) Bootstrap(host string) error                        { return nil }
+func (fakeConfig) Apply(host string) (string, error)                  { return Unchanged, nil }
+func (fakeConfig) WaitForConverge(host string, since time.Time) error { return nil }
+func (fakeConfig) Converge(host string) error                         { return nil }
+func (fakeConfig) Diff(host string) ([]drift.Difference, error)       { return nil, nil }
+func (fakeConfig) Remove(host string) error                           { return nil }
+
+func init() {
+	RegisterCompute("fake", func(*buildspec.Spec, *configspec.Spec) (ComputeProvider, error) { return fakeCompute{}, nil })
+	RegisterIPAM("fake", func(*buildspec.Spec, *configspec.Spec) (IPAMProvider, error) { return fakeIPAM{}, nil })
+	RegisterDNS("fake", func(*buildspec.Spec, *configspec.Spec) (DNSProvider, error) { return fakeDNS{}, nil })
+	RegisterConfig("fake", func(*buildspec.Spec, *configspec.Spec) (ConfigManager, error) { return fakeConfig{}, nil })
+}
+
+func TestLoad(t *testing.T) {
+	cases := []struct {
+		Spec buildspec.Spec
+		DNS  bool
+		Err  string
+	}{
+		{
+			buildspec.Spec{Compute: "fake", IPAM: "fake", DNS: "fake", Config: "fake"},
+			true,
+			"",
+		},
+		{
+			// No infoblox block means no DNS
+			buildspec.Spec{Compute: "fake", IPAM: "fake", Config: "fake"},
+			false,
+			"",
+		},
+		{
+			buildspec.Spec{
+				Compute:  "fake",
+				IPAM:     "fake",
+				DNS:      None,
+				Config:   "fake",
+				Infoblox: buildspec.Infoblox{Zone: "qa.local"},
+			},
+			false,
+			"",
+		},
+		{
+			buildspec.Spec{Compute: "ec2", IPAM: "fake", Config: "fake"},
+			false,
+			`compute provider "ec2", but the only ones overseer knows are: fake, foreman`,
+		},
+		{
+			buildspec.Spec{Compute: "fake", IPAM: "fake", DNS: "route53", Config: "fake"},
+			false,
+			`dns provider "route53", but the only ones overseer knows are: fake, infoblox, none`,
+		},
+	}
+
+	for _, tt := range cases {
+		set, err := Load(&tt.Spec, &configspec.Spec{})
+		if tt.Err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.Err) {
+				t.Fatalf("%#v\n\n%v", tt.Spec, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%#v\n\n%s", tt.Spec, err)
+		}
+
+		if (set.DNS != nil) != tt.DNS {
+			t.Fatalf("%#v\n\nDNS provider %#v", tt.Spec, set.DNS)
+		}
+		if set.Compute == nil || set.IPAM == nil || set.Config == nil {
+			t.Fatalf("%#v\n\n%#v", tt.Spec, set)
+		}
+	}
+}
+
+// fakePlaybook is an ansible-playbook that logs how it was run and prints
+// a run where hello.qa.local changed and lol.qa.local failed.
+const fakePlaybook = `#!/bin/sh
+echo "$@" >> "$OVERSEER_TEST_ANSIBLE_LOG"
+cat <<'JSON'
+{
+  "plays": [{"tasks": [{"task": {"name": "Install kafka"}, "hosts": {
+    "hello.qa.local": {"changed": true},
+    "lol.qa.local": {"failed": true, "msg": "No package matching 'kafka' found"}
+  }}]}],
+  "stats": {
+    "hello.qa.local": {"ok": 2, "changed": 1},
+    "lol.qa.local": {"ok": 1, "failures": 1}
+  }
+}
+JSON
+exit 2
+`
+
+func TestAnsibleManager(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overseer-ansible")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "ansible-playbook"), []byte(fakePlaybook), 0755); err != nil {
+		t.Fatal(err)
+	}
+	logPath := filepath.Join(dir, "log")
+	os.Setenv("OVERSEER_TEST_ANSIBLE_LOG", logPath)
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	defer os.Setenv("PATH", path)
+
+	bspec := &buildspec.Spec{Ansible: buildspec.Ansible{Playbook: "kafka.yml"}}
+	config, err := newAnsibleManager(bspec, &configspec.Spec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Bootstraps() {
+		t.Fatal("ansible has nothing to bootstrap")
+	}
+
+	// Every prepared host is configured by the same run
+	config.(Preparer).Prepare([]string{"hello.qa.local", "lol.qa.local"}, nil)
+
+	change, err := config.Apply("hello.qa.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change != "updated (2 ok, 1 changed, 0 skipped)" {
+		t.Fatalf("bad: %s", change)
+	}
+
+	_, err = config.Apply("lol.qa.local")
+	if err == nil || !strings.Contains(err.Error(), "No package matching 'kafka' found") {
+		t.Fatalf("expected lol.qa.local to fail, got %v", err)
+	}
+
+	runs, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(runs), "\n"); n != 1 {
+		t.Fatalf("expected one run of the playbook, got %d:\n%s", n, runs)
+	}
+
+	// Check mode reports what would change
+	diffs, err := config.Diff("hello.qa.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].Field != `task "Install kafka"` {
+		t.Fatalf("bad: %#v", diffs)
+	}
+
+	bspec.Ansible.Playbook = ""
+	if _, err := newAnsibleManager(bspec, &configspec.Spec{}); err == nil {
+		t.Fatal("expected an error without a playbook")
+	}
+}
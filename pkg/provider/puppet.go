@@ -0,0 +1,110 @@
+package provider
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+	"github.com/iamthemuffinman/overseer/pkg/foreman"
+	"github.com/iamthemuffinman/overseer/pkg/puppet"
+	"github.com/iamthemuffinman/overseer/pkg/ssh"
+)
+
+func init() {
+	RegisterConfig("puppet", newPuppetManager)
+}
+
+// puppetManager configures hosts with the buildspec's puppet block. The
+// build installs the agent, Foreman gives it its environment and classes
+// and overseer gets its certificate signed.
+type puppetManager struct {
+	spec    buildspec.Puppet
+	ssh     configspec.SSH
+	manager *puppet.Manager
+	timeout time.Duration
+}
+
+func newPuppetManager(bspec *buildspec.Spec, cspec *configspec.Spec) (ConfigManager, error) {
+	ca, err := puppet.New(cspec.Puppet)
+	if err != nil {
+		return nil, err
+	}
+	client, err := foreman.New(cspec.Foreman)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := bspec.Puppet
+	if spec.Signing == "" {
+		spec.Signing = buildspec.SigningCSR
+	}
+	if spec.OnConflict == "" {
+		spec.OnConflict = buildspec.ConflictReplace
+	}
+
+	timeout := puppet.DefaultConvergeTimeout
+	if spec.ConvergeTimeout > 0 {
+		timeout = time.Duration(spec.ConvergeTimeout) * time.Second
+	}
+
+	return &puppetManager{
+		spec:    spec,
+		ssh:     cspec.SSH,
+		manager: puppet.NewManager(ca, client),
+		timeout: timeout,
+	}, nil
+}
+
+func (m *puppetManager) ResolveConflict(host string) (string, error) {
+	return m.manager.ResolveConflict(host, m.spec)
+}
+
+func (m *puppetManager) Registered(host string) (bool, error) {
+	return m.manager.Registered(host)
+}
+
+// Bootstraps is false: the agent is installed by the build, and its
+// certificate is signed while waiting for it to converge.
+func (m *puppetManager) Bootstraps() bool            { return false }
+func (m *puppetManager) Bootstrap(host string) error { return nil }
+
+func (m *puppetManager) Apply(host string) (string, error) {
+	changed, err := m.manager.Apply(host, m.spec)
+	if err != nil {
+		return "", err
+	}
+	if changed {
+		return Updated, nil
+	}
+	return Unchanged, nil
+}
+
+func (m *puppetManager) WaitForConverge(host string, since time.Time) error {
+	return m.manager.WaitForConverge(host, m.spec, since, m.timeout)
+}
+
+// Converge runs the agent over SSH. It exits 2 when the run changed
+// something, which is still a success.
+func (m *puppetManager) Converge(host string) error {
+	executor := &ssh.Executor{Config: m.ssh, Output: os.Stdout}
+
+	result := executor.Run([]string{host}, "puppet agent --test")[0]
+	if result.Err != nil {
+		return result.Err
+	}
+	if result.ExitStatus != 0 && result.ExitStatus != 2 {
+		return fmt.Errorf("puppet agent exited %d", result.ExitStatus)
+	}
+	return nil
+}
+
+func (m *puppetManager) Diff(host string) ([]drift.Difference, error) {
+	return m.manager.Diff(host, m.spec)
+}
+
+func (m *puppetManager) Remove(host string) error {
+	return m.manager.Remove(host, m.spec)
+}
@@ -0,0 +1,54 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/cloudinit"
+)
+
+// Seeder is implemented by compute providers that can hand a host a
+// cloud-init seed when they create it.
+type Seeder interface {
+	// CreateSeeded creates the host like Create, with the seed attached.
+	CreateSeeded(host string, seed *cloudinit.Seed) error
+}
+
+// Allocator is implemented by IPAM providers that can reserve a host's
+// address before the host exists, which a seed with a static address
+// needs.
+type Allocator interface {
+	// Allocate reserves an address for the host and returns it. A host
+	// that already has one keeps it.
+	Allocate(host string) (string, error)
+}
+
+// FirstBooter is implemented by configuration managers that can have
+// cloud-init bootstrap hosts on first boot instead of doing it over SSH.
+type FirstBooter interface {
+	// FirstBoot returns the files to write on the host and the commands
+	// that bootstrap it.
+	FirstBoot(host string) ([]cloudinit.File, []string, error)
+}
+
+// Seed renders the host's cloud-init seed, with the configuration
+// manager's first boot bootstrap in it when the buildspec asks for one.
+func (s *Set) Seed(host, ip string, spec *buildspec.CloudInit) (*cloudinit.Seed, error) {
+	h := cloudinit.NewHost(host, ip, *spec)
+
+	if spec.ChefBootstrap {
+		booter, ok := s.Config.(FirstBooter)
+		if !ok {
+			return nil, fmt.Errorf("config manager %s can't bootstrap hosts from cloud-init", s.Names["config"])
+		}
+
+		files, commands, err := booter.FirstBoot(host)
+		if err != nil {
+			return nil, err
+		}
+		h.WriteFiles = append(h.WriteFiles, files...)
+		h.RunCmd = append(h.RunCmd, commands...)
+	}
+
+	return cloudinit.Render(*spec, h)
+}
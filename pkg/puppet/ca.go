@@ -0,0 +1,205 @@
+// Package puppet gets the certificates of hosts configured by Puppet
+// signed, through the Puppet CA's HTTP API or autosign entries on a
+// Foreman smart proxy, and gives them their environment and classes
+// through Foreman, which is their ENC.
+package puppet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/transport"
+)
+
+// Certificate states, as the CA reports them.
+const (
+	StateRequested = "requested"
+	StateSigned    = "signed"
+	StateRevoked   = "revoked"
+)
+
+// CA is a small client for the Puppet CA's certificate_status API and the
+// autosign entries of a Foreman smart proxy.
+type CA struct {
+	BaseURL *url.URL
+	// SmartProxy is nil when the configspec doesn't name one, in which
+	// case autosign entries can't be managed.
+	SmartProxy *url.URL
+
+	client *http.Client
+}
+
+// New returns a CA for the puppet block in the configspec.
+func New(cspec configspec.Puppet) (*CA, error) {
+	if cspec.Endpoint.URL == "" {
+		return nil, fmt.Errorf("no puppet ca url configured")
+	}
+
+	base, err := url.Parse(strings.TrimSuffix(cspec.Endpoint.URL, "/") + "/puppet-ca/v1/")
+	if err != nil {
+		return nil, err
+	}
+
+	var proxy *url.URL
+	if cspec.SmartProxy != "" {
+		if proxy, err = url.Parse(strings.TrimSuffix(cspec.SmartProxy, "/") + "/puppet/ca/"); err != nil {
+			return nil, err
+		}
+	}
+
+	client, err := transport.New(cspec.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CA{BaseURL: base, SmartProxy: proxy, client: client}, nil
+}
+
+// Status returns the state of the host's certificate, or "" if the CA
+// has neither a certificate nor a request for it.
+func (c *CA) Status(host string) (string, error) {
+	var status struct {
+		State string `json:"state"`
+	}
+	err := c.do("GET", c.BaseURL, "certificate_status/"+url.PathEscape(host), nil, &status)
+	if IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return status.State, nil
+}
+
+// Sign signs the host's pending certificate request.
+func (c *CA) Sign(host string) error {
+	return c.setState(host, StateSigned)
+}
+
+// Clean revokes the host's certificate, if it's signed, and deletes
+// whatever the CA has for the host, so a new host with the same name can
+// get a certificate of its own.
+func (c *CA) Clean(host string) error {
+	state, err := c.Status(host)
+	if err != nil {
+		return err
+	}
+
+	switch state {
+	case "":
+		return nil
+	case StateSigned:
+		if err := c.setState(host, StateRevoked); err != nil {
+			return err
+		}
+	}
+
+	err = c.do("DELETE", c.BaseURL, "certificate_status/"+url.PathEscape(host), nil, nil)
+	if IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (c *CA) setState(host, state string) error {
+	body := map[string]string{"desired_state": state}
+	return c.do("PUT", c.BaseURL, "certificate_status/"+url.PathEscape(host), body, nil)
+}
+
+// Autosign adds an autosign entry for the host to the smart proxy, so the
+// CA signs its certificate request as soon as it's made.
+func (c *CA) Autosign(host string) error {
+	if c.SmartProxy == nil {
+		return fmt.Errorf("autosign entries need a smart_proxy in the configspec's puppet block")
+	}
+	return c.do("POST", c.SmartProxy, "autosign/"+url.PathEscape(host), nil, nil)
+}
+
+// RemoveAutosign removes the host's autosign entry from the smart proxy,
+// if it has one.
+func (c *CA) RemoveAutosign(host string) error {
+	if c.SmartProxy == nil {
+		return nil
+	}
+	err := c.do("DELETE", c.SmartProxy, "autosign/"+url.PathEscape(host), nil, nil)
+	if IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// Error is an unsuccessful response from the CA or smart proxy.
+type Error struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("puppet: %s %s returned %s: %s", e.Method, e.URL, e.Status, e.Message)
+}
+
+// IsNotFound reports whether err is the CA or smart proxy saying it
+// doesn't have the thing asked for.
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+func (c *CA) do(method string, base *url.URL, path string, body, v interface{}) error {
+	rel, err := url.Parse(path)
+	if err != nil {
+		return err
+	}
+	u := base.ResolveReference(rel).String()
+
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, u, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return &Error{
+			Method:     method,
+			URL:        u,
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Message:    strings.TrimSpace(string(msg)),
+		}
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
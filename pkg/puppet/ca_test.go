@@ -0,0 +1,162 @@
+package puppet
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+)
+
+// fakeCA is a Puppet CA and smart proxy that keep certificate states and
+// autosign entries in memory and record the requests that change them.
+type fakeCA struct {
+	mu       sync.Mutex
+	states   map[string]string
+	autosign map[string]bool
+	requests []string
+}
+
+func (f *fakeCA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	if r.Method != "GET" {
+		f.requests = append(f.requests, strings.TrimSpace(r.Method+" "+r.URL.Path+" "+string(body)))
+	}
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/puppet-ca/v1/certificate_status/"):
+		host := strings.TrimPrefix(r.URL.Path, "/puppet-ca/v1/certificate_status/")
+		state, ok := f.states[host]
+		if !ok {
+			http.Error(w, "Invalid certname "+host, http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			json.NewEncoder(w).Encode(map[string]string{"name": host, "state": state})
+		case "PUT":
+			var desired struct {
+				State string `json:"desired_state"`
+			}
+			json.Unmarshal(body, &desired)
+			f.states[host] = desired.State
+			w.WriteHeader(http.StatusNoContent)
+		case "DELETE":
+			delete(f.states, host)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case strings.HasPrefix(r.URL.Path, "/proxy/puppet/ca/autosign/"):
+		host := strings.TrimPrefix(r.URL.Path, "/proxy/puppet/ca/autosign/")
+		switch r.Method {
+		case "POST":
+			f.autosign[host] = true
+		case "DELETE":
+			if !f.autosign[host] {
+				http.Error(w, "Not found", http.StatusNotFound)
+				return
+			}
+			delete(f.autosign, host)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newFakeCA(t *testing.T, states map[string]string) (*CA, *fakeCA, func()) {
+	fake := &fakeCA{states: states, autosign: make(map[string]bool)}
+	server := httptest.NewServer(fake)
+
+	ca, err := New(configspec.Puppet{
+		SmartProxy: server.URL + "/proxy",
+		Endpoint:   configspec.Endpoint{URL: server.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ca, fake, server.Close
+}
+
+func TestStatus(t *testing.T) {
+	ca, _, done := newFakeCA(t, map[string]string{"hello.qa.local": StateRequested})
+	defer done()
+
+	cases := []struct {
+		Host     string
+		Expected string
+	}{
+		{"hello.qa.local", StateRequested},
+		{"lol.qa.local", ""},
+	}
+
+	for _, tc := range cases {
+		state, err := ca.Status(tc.Host)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.Host, err)
+		}
+		if state != tc.Expected {
+			t.Fatalf("%s: bad: %q", tc.Host, state)
+		}
+	}
+}
+
+func TestClean(t *testing.T) {
+	ca, fake, done := newFakeCA(t, map[string]string{
+		"hello.qa.local": StateSigned,
+		"lol.qa.local":   StateRequested,
+	})
+	defer done()
+
+	for _, host := range []string{"hello.qa.local", "lol.qa.local", "nope.qa.local"} {
+		if err := ca.Clean(host); err != nil {
+			t.Fatalf("%s: %s", host, err)
+		}
+	}
+
+	// Only signed certificates need revoking first
+	expected := []string{
+		`PUT /puppet-ca/v1/certificate_status/hello.qa.local {"desired_state":"revoked"}`,
+		`DELETE /puppet-ca/v1/certificate_status/hello.qa.local`,
+		`DELETE /puppet-ca/v1/certificate_status/lol.qa.local`,
+	}
+	if !reflect.DeepEqual(fake.requests, expected) {
+		t.Fatalf("%#v\n\n%#v", fake.requests, expected)
+	}
+	if len(fake.states) != 0 {
+		t.Fatalf("bad: %#v", fake.states)
+	}
+}
+
+func TestAutosign(t *testing.T) {
+	ca, fake, done := newFakeCA(t, map[string]string{})
+	defer done()
+
+	if err := ca.Autosign("hello.qa.local"); err != nil {
+		t.Fatal(err)
+	}
+	if !fake.autosign["hello.qa.local"] {
+		t.Fatal("no autosign entry")
+	}
+
+	if err := ca.RemoveAutosign("hello.qa.local"); err != nil {
+		t.Fatal(err)
+	}
+	// Removing an entry that isn't there is fine
+	if err := ca.RemoveAutosign("hello.qa.local"); err != nil {
+		t.Fatal(err)
+	}
+
+	ca.SmartProxy = nil
+	if err := ca.Autosign("hello.qa.local"); err == nil || !strings.Contains(err.Error(), "smart_proxy") {
+		t.Fatalf("expected an error without a smart proxy, got %v", err)
+	}
+}
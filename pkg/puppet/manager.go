@@ -0,0 +1,262 @@
+package puppet
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+	"github.com/iamthemuffinman/overseer/pkg/foreman"
+)
+
+const (
+	// DefaultConvergeTimeout is how long to wait for a host's first
+	// puppet agent run when the buildspec doesn't say.
+	DefaultConvergeTimeout = 30 * time.Minute
+
+	// DefaultPollInterval is how often the CA and Foreman are asked
+	// whether a host has asked for a certificate and reported.
+	DefaultPollInterval = 30 * time.Second
+)
+
+// Manager looks after hosts' certificates on the CA and their Puppet
+// settings in Foreman.
+type Manager struct {
+	ca      *CA
+	foreman *foreman.Client
+
+	// PollInterval is how often WaitForConverge checks on a host. Zero
+	// means DefaultPollInterval.
+	PollInterval time.Duration
+}
+
+// NewManager returns a Manager that signs certificates with ca and sets
+// hosts' environments and classes through client.
+func NewManager(ca *CA, client *foreman.Client) *Manager {
+	return &Manager{ca: ca, foreman: client}
+}
+
+// ResolveConflict checks whether the CA already has a certificate or
+// request for the host, as it will when a hostname is re-provisioned, and
+// deals with it as the buildspec's on_conflict says. It's the last thing
+// done before the host is built, so it's also where autosign entries are
+// added. It returns what it found and did, or an empty string if there
+// was nothing to do.
+func (m *Manager) ResolveConflict(host string, spec buildspec.Puppet) (string, error) {
+	state, err := m.ca.Status(host)
+	if err != nil {
+		return "", fmt.Errorf("unable to get the certificate status of %s: %s", host, err)
+	}
+
+	var done []string
+	if state != "" {
+		found := state + " certificate"
+		if state == StateRequested {
+			found = "certificate request"
+		}
+
+		switch spec.OnConflict {
+		case buildspec.ConflictFail:
+			return "", fmt.Errorf("puppet ca already has a %s for %s (on_conflict = %q)", found, host, spec.OnConflict)
+		case buildspec.ConflictKeep:
+			done = append(done, "kept existing "+found)
+		default:
+			if err := m.ca.Clean(host); err != nil {
+				return "", fmt.Errorf("unable to clean the certificate of %s: %s", host, err)
+			}
+			done = append(done, "cleaned existing "+found)
+		}
+	}
+
+	if spec.Signing == buildspec.SigningAutosign {
+		if err := m.ca.Autosign(host); err != nil {
+			return "", fmt.Errorf("unable to add an autosign entry for %s: %s", host, err)
+		}
+		done = append(done, "added autosign entry")
+	}
+
+	return strings.Join(done, ", "), nil
+}
+
+// Registered reports whether the CA has signed the host's certificate.
+func (m *Manager) Registered(host string) (bool, error) {
+	state, err := m.ca.Status(host)
+	if err != nil {
+		return false, fmt.Errorf("unable to get the certificate status of %s: %s", host, err)
+	}
+	return state == StateSigned, nil
+}
+
+// Apply puts the Foreman host in the buildspec's Puppet environment with
+// its classes, reporting whether anything had to change.
+func (m *Manager) Apply(host string, spec buildspec.Puppet) (bool, error) {
+	p, err := m.hostPuppet(host)
+	if err != nil {
+		return false, err
+	}
+
+	var envID int
+	if spec.Environment != "" && p.EnvironmentName != spec.Environment {
+		if envID, err = m.foreman.EnvironmentID(spec.Environment); err != nil {
+			return false, err
+		}
+	}
+
+	var classIDs []int
+	if spec.Classes != nil && !sameClasses(p.Classes(), spec.Classes) {
+		if classIDs, err = m.foreman.PuppetClassIDs(spec.Classes); err != nil {
+			return false, err
+		}
+		if classIDs == nil {
+			classIDs = []int{}
+		}
+	}
+
+	if envID == 0 && classIDs == nil {
+		return false, nil
+	}
+	if err := m.foreman.SetPuppet(p.ID, envID, classIDs); err != nil {
+		return false, fmt.Errorf("unable to set the puppet environment and classes of %s: %s", host, err)
+	}
+	return true, nil
+}
+
+// WaitForConverge waits for the host to report a puppet agent run that
+// didn't fail and happened after since, checking every PollInterval until
+// timeout passes. When the buildspec signs certificate requests through
+// the CA's API, the host's request is signed as soon as it shows up.
+func (m *Manager) WaitForConverge(host string, spec buildspec.Puppet, since time.Time, timeout time.Duration) error {
+	interval := m.PollInterval
+	if interval == 0 {
+		interval = DefaultPollInterval
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		state, err := m.ca.Status(host)
+		if err != nil {
+			return fmt.Errorf("unable to get the certificate status of %s: %s", host, err)
+		}
+		if state == StateRequested && spec.Signing == buildspec.SigningCSR {
+			if err := m.ca.Sign(host); err != nil {
+				return fmt.Errorf("unable to sign the certificate of %s: %s", host, err)
+			}
+			state = StateSigned
+		}
+
+		var p *foreman.Puppet
+		var last time.Time
+		if state == StateSigned {
+			if p, err = m.hostPuppet(host); err != nil {
+				return err
+			}
+			if last, err = p.LastReportTime(); err != nil {
+				return err
+			}
+			if last.After(since) && p.ConfigurationStatusLabel != foreman.ConfigurationError {
+				return nil
+			}
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			switch {
+			case state == "":
+				return fmt.Errorf("%s hasn't asked the puppet ca for a certificate after %s", host, timeout)
+			case state != StateSigned:
+				return fmt.Errorf("the certificate of %s is still %s after %s", host, state, timeout)
+			case !last.After(since):
+				return fmt.Errorf("%s hasn't reported a puppet run to foreman after %s", host, timeout)
+			}
+			return fmt.Errorf("no successful puppet run on %s after %s (last report %s: %s)",
+				host, timeout, p.LastReport, p.ConfigurationStatusLabel)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// Diff returns how the host's certificate and Puppet settings differ from
+// the buildspec.
+func (m *Manager) Diff(host string, spec buildspec.Puppet) ([]drift.Difference, error) {
+	var diffs []drift.Difference
+
+	state, err := m.ca.Status(host)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the certificate status of %s: %s", host, err)
+	}
+	switch state {
+	case "":
+		diffs = append(diffs, drift.Missing("certificate", StateSigned))
+	case StateSigned:
+	default:
+		diffs = append(diffs, drift.Difference{Field: "certificate", Have: state, Want: StateSigned})
+	}
+
+	// A host Foreman doesn't have shows up in Foreman's own diff
+	p, err := m.foreman.HostPuppet(host)
+	if err != nil {
+		return nil, fmt.Errorf("unable to look up %s in foreman: %s", host, err)
+	}
+	if p == nil {
+		return diffs, nil
+	}
+	if spec.Environment != "" && p.EnvironmentName != spec.Environment {
+		diffs = append(diffs, drift.Difference{Field: "environment", Have: p.EnvironmentName, Want: spec.Environment})
+	}
+	if spec.Classes != nil && !sameClasses(p.Classes(), spec.Classes) {
+		diffs = append(diffs, drift.Difference{Field: "classes", Have: strings.Join(p.Classes(), ","), Want: strings.Join(spec.Classes, ",")})
+	}
+
+	return diffs, nil
+}
+
+// Remove cleans the host's certificate off the CA, so a host built with
+// the same name can get one of its own. With autosign signing, the host's
+// autosign entry is kept (or put back) for that host; otherwise any entry
+// it has is removed.
+func (m *Manager) Remove(host string, spec buildspec.Puppet) error {
+	if err := m.ca.Clean(host); err != nil {
+		return fmt.Errorf("unable to clean the certificate of %s: %s", host, err)
+	}
+
+	if spec.Signing == buildspec.SigningAutosign {
+		if err := m.ca.Autosign(host); err != nil {
+			return fmt.Errorf("unable to add an autosign entry for %s: %s", host, err)
+		}
+		return nil
+	}
+	if err := m.ca.RemoveAutosign(host); err != nil {
+		return fmt.Errorf("unable to remove the autosign entry for %s: %s", host, err)
+	}
+	return nil
+}
+
+func (m *Manager) hostPuppet(host string) (*foreman.Puppet, error) {
+	p, err := m.foreman.HostPuppet(host)
+	if err != nil {
+		return nil, fmt.Errorf("unable to look up %s in foreman: %s", host, err)
+	}
+	if p == nil {
+		return nil, fmt.Errorf("foreman doesn't have %s", host)
+	}
+	return p, nil
+}
+
+// sameClasses reports whether the host has exactly the buildspec's
+// classes. have is sorted.
+func sameClasses(have, want []string) bool {
+	if len(have) != len(want) {
+		return false
+	}
+
+	sorted := append([]string(nil), want...)
+	sort.Strings(sorted)
+	for i := range have {
+		if have[i] != sorted[i] {
+			return false
+		}
+	}
+	return true
+}
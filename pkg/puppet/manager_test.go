@@ -0,0 +1,286 @@
+package puppet
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+	"github.com/iamthemuffinman/overseer/pkg/foreman"
+)
+
+// fakeForeman serves hello.qa.local, in the development environment with
+// one class, along with the environments and classes Foreman knows about.
+// PUTs are recorded in requests.
+func fakeForeman(t *testing.T, lastReport string, requests *[]string) (*foreman.Client, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" {
+			body, _ := ioutil.ReadAll(r.Body)
+			*requests = append(*requests, r.Method+" "+r.URL.Path+" "+string(body))
+			w.Write([]byte("{}"))
+			return
+		}
+
+		switch r.URL.Path {
+		case "/api/v2/hosts/hello.qa.local":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"id":                         42,
+				"name":                       "hello.qa.local",
+				"environment_id":             1,
+				"environment_name":           "development",
+				"puppetclasses":              []map[string]interface{}{{"id": 10, "name": "profile::base"}},
+				"last_report":                lastReport,
+				"configuration_status_label": "Active",
+			})
+		case "/api/v2/environments":
+			if r.URL.Query().Get("search") != `name="production"` {
+				t.Fatalf("bad environment search: %s", r.URL.RawQuery)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"results": []map[string]interface{}{{"id": 2, "name": "production"}},
+			})
+		case "/api/v2/puppetclasses":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"results": map[string]interface{}{
+					"profile": []map[string]interface{}{
+						{"id": 10, "name": "profile::base"},
+						{"id": 11, "name": "profile::kafka"},
+					},
+				},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"message":"Resource not found"}}`))
+		}
+	}))
+
+	client, err := foreman.New(configspec.Foreman{Endpoint: configspec.Endpoint{URL: server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, server.Close
+}
+
+func TestResolveConflict(t *testing.T) {
+	cases := []struct {
+		Name     string
+		State    string
+		Spec     buildspec.Puppet
+		Expected string
+		Requests []string
+		Err      bool
+	}{
+		{
+			"new host",
+			"",
+			buildspec.Puppet{Signing: buildspec.SigningCSR, OnConflict: buildspec.ConflictReplace},
+			"",
+			nil,
+			false,
+		},
+		{
+			"replace",
+			StateSigned,
+			buildspec.Puppet{Signing: buildspec.SigningCSR, OnConflict: buildspec.ConflictReplace},
+			"cleaned existing signed certificate",
+			[]string{
+				`PUT /puppet-ca/v1/certificate_status/hello.qa.local {"desired_state":"revoked"}`,
+				`DELETE /puppet-ca/v1/certificate_status/hello.qa.local`,
+			},
+			false,
+		},
+		{
+			"keep with autosign",
+			StateRequested,
+			buildspec.Puppet{Signing: buildspec.SigningAutosign, OnConflict: buildspec.ConflictKeep},
+			"kept existing certificate request, added autosign entry",
+			[]string{`POST /proxy/puppet/ca/autosign/hello.qa.local`},
+			false,
+		},
+		{
+			"fail",
+			StateRevoked,
+			buildspec.Puppet{Signing: buildspec.SigningCSR, OnConflict: buildspec.ConflictFail},
+			"",
+			nil,
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		states := make(map[string]string)
+		if tc.State != "" {
+			states["hello.qa.local"] = tc.State
+		}
+		ca, fake, done := newFakeCA(t, states)
+
+		m := NewManager(ca, nil)
+		detail, err := m.ResolveConflict("hello.qa.local", tc.Spec)
+		done()
+
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %v", tc.Name, err)
+		}
+		if detail != tc.Expected {
+			t.Fatalf("%s: bad detail: %q", tc.Name, detail)
+		}
+		if !reflect.DeepEqual(fake.requests, tc.Requests) {
+			t.Fatalf("%s: %#v\n\n%#v", tc.Name, fake.requests, tc.Requests)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	cases := []struct {
+		Spec     buildspec.Puppet
+		Changed  bool
+		Requests []string
+	}{
+		{
+			buildspec.Puppet{Environment: "development", Classes: []string{"profile::base"}},
+			false,
+			nil,
+		},
+		{
+			buildspec.Puppet{Environment: "production", Classes: []string{"profile::kafka", "profile::base"}},
+			true,
+			[]string{`PUT /api/v2/hosts/42 {"host":{"environment_id":2,"puppetclass_ids":[11,10]}}`},
+		},
+		{
+			buildspec.Puppet{Classes: []string{}},
+			true,
+			[]string{`PUT /api/v2/hosts/42 {"host":{"puppetclass_ids":[]}}`},
+		},
+	}
+
+	for i, tc := range cases {
+		var requests []string
+		client, done := fakeForeman(t, "", &requests)
+
+		m := NewManager(nil, client)
+		changed, err := m.Apply("hello.qa.local", tc.Spec)
+		done()
+
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if changed != tc.Changed {
+			t.Fatalf("%d: changed = %v", i, changed)
+		}
+		if !reflect.DeepEqual(requests, tc.Requests) {
+			t.Fatalf("%d: %#v\n\n%#v", i, requests, tc.Requests)
+		}
+	}
+}
+
+func TestWaitForConverge(t *testing.T) {
+	since := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	spec := buildspec.Puppet{Signing: buildspec.SigningCSR}
+
+	// The request is signed and the host has reported since
+	ca, fake, doneCA := newFakeCA(t, map[string]string{"hello.qa.local": StateRequested})
+	defer doneCA()
+	var requests []string
+	client, doneForeman := fakeForeman(t, "2026-10-19 12:05:00 UTC", &requests)
+	defer doneForeman()
+
+	m := NewManager(ca, client)
+	m.PollInterval = time.Millisecond
+	if err := m.WaitForConverge("hello.qa.local", spec, since, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{`PUT /puppet-ca/v1/certificate_status/hello.qa.local {"desired_state":"signed"}`}
+	if !reflect.DeepEqual(fake.requests, expected) {
+		t.Fatalf("%#v\n\n%#v", fake.requests, expected)
+	}
+
+	// A host that never asks for a certificate times out
+	err := m.WaitForConverge("lol.qa.local", spec, since, 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "hasn't asked the puppet ca for a certificate") {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+
+	// Nor is an autosigned host's request signed for it
+	fake.states["lol.qa.local"] = StateRequested
+	spec.Signing = buildspec.SigningAutosign
+	err = m.WaitForConverge("lol.qa.local", spec, since, 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "still requested") {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+
+	// A report from before since doesn't count
+	err = m.WaitForConverge("hello.qa.local", spec, since.Add(time.Hour), 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "hasn't reported a puppet run") {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	ca, _, doneCA := newFakeCA(t, map[string]string{"hello.qa.local": StateRequested})
+	defer doneCA()
+	var requests []string
+	client, doneForeman := fakeForeman(t, "", &requests)
+	defer doneForeman()
+
+	m := NewManager(ca, client)
+	diffs, err := m.Diff("hello.qa.local", buildspec.Puppet{
+		Environment: "production",
+		Classes:     []string{"profile::kafka", "profile::base"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []drift.Difference{
+		{Field: "certificate", Have: StateRequested, Want: StateSigned},
+		{Field: "environment", Have: "development", Want: "production"},
+		{Field: "classes", Have: "profile::base", Want: "profile::kafka,profile::base"},
+	}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Fatalf("%#v\n\n%#v", diffs, expected)
+	}
+
+	diffs, err = m.Diff("lol.qa.local", buildspec.Puppet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(diffs, []drift.Difference{drift.Missing("certificate", StateSigned)}) {
+		t.Fatalf("bad: %#v", diffs)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	cases := []struct {
+		Signing  string
+		Autosign bool
+	}{
+		{buildspec.SigningCSR, false},
+		{buildspec.SigningAutosign, true},
+	}
+
+	for _, tc := range cases {
+		ca, fake, done := newFakeCA(t, map[string]string{"hello.qa.local": StateSigned})
+		fake.autosign["hello.qa.local"] = true
+
+		m := NewManager(ca, nil)
+		err := m.Remove("hello.qa.local", buildspec.Puppet{Signing: tc.Signing})
+		done()
+
+		if err != nil {
+			t.Fatalf("%s: %s", tc.Signing, err)
+		}
+		if _, ok := fake.states["hello.qa.local"]; ok {
+			t.Fatalf("%s: certificate wasn't cleaned", tc.Signing)
+		}
+		if fake.autosign["hello.qa.local"] != tc.Autosign {
+			t.Fatalf("%s: autosign entry = %v", tc.Signing, fake.autosign["hello.qa.local"])
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package runstate
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/iamthemuffinman/overseer/pkg/summary"
+)
+
+// validID keeps IDs given on the command line from reaching outside the
+// runs directory.
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Run is the saved progress of a provisioning run: what it was building
+// and which steps have been done for each host, so an interrupted run can
+// be picked back up.
+type Run struct {
+	ID        string    `json:"id"`
+	Buildspec string    `json:"buildspec"`
+	Profile   string    `json:"profile,omitempty"`
+	Started   time.Time `json:"started"`
+	// Summary holds each host's steps as they're recorded.
+	Summary *summary.Summary `json:"summary"`
+	// Vars are the hostspec's variables for each host, kept so a resumed
+	// run configures hosts the same way.
+	Vars map[string]map[string]string `json:"vars,omitempty"`
+
+	path string
+	mu   sync.Mutex
+}
+
+// Dir returns where runs are kept for the given home directory.
+func Dir(home string) string {
+	return filepath.Join(home, ".overseer", "runs")
+}
+
+// New starts a run for the hosts and saves it. Its ID is the time it
+// started plus a few random characters so runs started together don't
+// collide.
+func New(home, buildspec, profile string, hosts []string) (*Run, error) {
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+
+	started := time.Now()
+	id := started.Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+
+	r := &Run{
+		ID:        id,
+		Buildspec: buildspec,
+		Profile:   profile,
+		Started:   started,
+		Summary:   summary.New(hosts),
+		path:      filepath.Join(Dir(home), id+".json"),
+	}
+
+	if err := r.Save(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Load reads back the run with the given ID. Steps that failed or were
+// skipped are forgotten so they're tried again; only the ones that
+// succeeded are kept.
+func Load(home, id string) (*Run, error) {
+	if !validID.MatchString(id) {
+		return nil, fmt.Errorf("%q isn't a valid run id", id)
+	}
+
+	path := filepath.Join(Dir(home), id+".json")
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("run %s not found in %s", id, Dir(home))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Run{path: path}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, fmt.Errorf("run state %s is corrupt: %s", path, err)
+	}
+	if r.Summary == nil {
+		return nil, fmt.Errorf("run state %s is corrupt: no hosts", path)
+	}
+
+	r.Summary.KeepSucceeded()
+
+	return r, nil
+}
+
+// Hosts returns the hosts in the run, in the order they were given.
+func (r *Run) Hosts() []string {
+	var hosts []string
+	for _, h := range r.Summary.Hosts {
+		hosts = append(hosts, h.Name)
+	}
+	return hosts
+}
+
+// Save writes the run out readable only by the current user. It's safe to
+// call while other goroutines record to the summary; the summary is
+// marshaled under its own lock.
+func (r *Run) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0700); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so dying halfway through a write
+	// can't leave us with half a run.
+	tmp := r.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, r.path)
+}
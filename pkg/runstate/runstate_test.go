@@ -0,0 +1,123 @@
+package runstate
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	home, err := ioutil.TempDir("", "overseer-runstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+
+	hosts := []string{"hello.qa.local", "lol.qa.local"}
+	run, err := New(home, "indy.prod.kafka", "indy-prod", hosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run.Vars = map[string]map[string]string{"hello.qa.local": {"rack": "a"}}
+	run.Summary.OnRecord = func() {
+		if err := run.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run.Summary.OK("hello.qa.local", "create", "")
+	run.Summary.OK("hello.qa.local", "build", "")
+	run.Summary.OK("lol.qa.local", "create", "")
+	run.Summary.Fail("lol.qa.local", "build", errors.New("build timed out"))
+
+	info, err := os.Stat(filepath.Join(Dir(home), run.ID+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("run state is %s, expected 0600", info.Mode().Perm())
+	}
+
+	resumed, err := Load(home, run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resumed.Buildspec != "indy.prod.kafka" || resumed.Profile != "indy-prod" || !resumed.Started.Equal(run.Started) {
+		t.Fatalf("%#v", resumed)
+	}
+	if !reflect.DeepEqual(resumed.Hosts(), hosts) {
+		t.Fatalf("%#v\n\n%#v", resumed.Hosts(), hosts)
+	}
+	if !reflect.DeepEqual(resumed.Vars, run.Vars) {
+		t.Fatalf("%#v\n\n%#v", resumed.Vars, run.Vars)
+	}
+
+	// Only the steps that succeeded are picked back up
+	if !resumed.Summary.Succeeded("lol.qa.local", "create") {
+		t.Fatalf("lol.qa.local should already be created")
+	}
+	if resumed.Summary.Succeeded("lol.qa.local", "build") || resumed.Summary.Failed() {
+		t.Fatalf("lol.qa.local's build should be run again")
+	}
+
+	if _, err := Load(home, "20261019-150405-abcdef"); err == nil {
+		t.Fatalf("loading a run that doesn't exist should fail")
+	}
+	if _, err := Load(home, "../credentials"); err == nil {
+		t.Fatalf("run ids shouldn't be able to leave the runs directory")
+	}
+}
+
+// TestSaveWhileRecording saves the run from OnRecord while several hosts
+// record at once, the way provisioning does. Run it with -race.
+func TestSaveWhileRecording(t *testing.T) {
+	home, err := ioutil.TempDir("", "overseer-runstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+
+	var hosts []string
+	for i := 0; i < 8; i++ {
+		hosts = append(hosts, fmt.Sprintf("host%02d.qa.local", i))
+	}
+
+	run, err := New(home, "indy.prod.kafka", "", hosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run.Summary.OnRecord = func() {
+		if err := run.Save(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, host := range hosts {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			for _, step := range []string{"create", "build", "dns", "chef"} {
+				run.Summary.OK(host, step, "")
+			}
+			run.Summary.SetOutcome(host, "created")
+		}(host)
+	}
+	wg.Wait()
+
+	resumed, err := Load(home, run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range hosts {
+		if !resumed.Summary.Succeeded(host, "chef") {
+			t.Fatalf("%s's last step wasn't saved", host)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package secret
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/util"
+)
+
+// Provider looks up secrets in a single backend.
+type Provider interface {
+	// Secret returns the secret stored at path. Backends that store more
+	// than one value per path use key to pick one out.
+	Secret(path, key string) (string, error)
+}
+
+// Reference is a parsed secret reference such as
+// "secret://vault/kv/foreman#password" or "env://FOREMAN_PASSWORD".
+type Reference struct {
+	// Provider is the name of the provider to ask: "env", "file", "exec"
+	// or, for secret:// references, the first path element.
+	Provider string
+	Path     string
+	Key      string
+}
+
+// ParseReference parses a secret reference. The second return value is
+// false if value isn't a reference at all, in which case it should be
+// used as is.
+func ParseReference(value string) (*Reference, bool, error) {
+	i := strings.Index(value, "://")
+	if i < 0 {
+		return nil, false, nil
+	}
+
+	scheme, rest := value[:i], value[i+3:]
+
+	switch scheme {
+	case "env", "file":
+		if rest == "" {
+			return nil, true, fmt.Errorf("%q is missing a path", value)
+		}
+		return &Reference{Provider: scheme, Path: rest}, true, nil
+	case "exec":
+		// Commands can contain pretty much anything, so don't try to pull
+		// a key off the end like we do for secret://.
+		if strings.TrimSpace(rest) == "" {
+			return nil, true, fmt.Errorf("%q is missing a command", value)
+		}
+		return &Reference{Provider: scheme, Path: rest}, true, nil
+	case "secret":
+		var key string
+		if j := strings.LastIndex(rest, "#"); j >= 0 {
+			rest, key = rest[:j], rest[j+1:]
+		}
+
+		parts := strings.SplitN(rest, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, true, fmt.Errorf("%q should look like secret://<provider>/<path>#<key>", value)
+		}
+		return &Reference{Provider: parts[0], Path: parts[1], Key: key}, true, nil
+	}
+
+	// Anything else (https:// and friends) isn't ours to resolve.
+	return nil, false, nil
+}
+
+// Resolver resolves secret references using a set of named providers. It
+// satisfies configspec.SecretResolver.
+type Resolver struct {
+	providers map[string]Provider
+}
+
+// NewResolver returns a Resolver that knows about the env://, file:// and
+// exec:// providers, plus Vault when the configspec has a vault block.
+func NewResolver(cspec *configspec.Spec) (*Resolver, error) {
+	r := &Resolver{
+		providers: map[string]Provider{
+			"env":  EnvProvider{},
+			"file": FileProvider{},
+			"exec": ExecProvider{},
+		},
+	}
+
+	if cspec.Vault != (configspec.Vault{}) {
+		vault, err := NewVault(cspec.Vault, r)
+		if err != nil {
+			return nil, err
+		}
+		r.Register("vault", vault)
+	}
+
+	return r, nil
+}
+
+// Register adds a provider under the given name, replacing any provider
+// already registered with that name.
+func (r *Resolver) Register(name string, p Provider) {
+	r.providers[name] = p
+}
+
+// Resolve returns the secret a reference points to, or value itself if
+// it isn't a reference.
+func (r *Resolver) Resolve(value string) (string, error) {
+	ref, ok, err := ParseReference(value)
+	if err != nil || !ok {
+		return value, err
+	}
+
+	p, ok := r.providers[ref.Provider]
+	if !ok {
+		return "", fmt.Errorf("no secret provider named %q", ref.Provider)
+	}
+
+	secret, err := p.Secret(ref.Path, ref.Key)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", ref.Provider, err)
+	}
+
+	return secret, nil
+}
+
+// EnvProvider reads secrets from environment variables.
+type EnvProvider struct{}
+
+func (EnvProvider) Secret(path, key string) (string, error) {
+	value, ok := os.LookupEnv(path)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", path)
+	}
+
+	return value, nil
+}
+
+// FileProvider reads secrets from files, minus any trailing newline.
+type FileProvider struct{}
+
+func (FileProvider) Secret(path, key string) (string, error) {
+	path, err := util.ExpandPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// ExecProvider runs a helper like `pass show foreman` and uses the first
+// line of its output as the secret, which is the convention pass and
+// most of its friends follow.
+type ExecProvider struct{}
+
+func (ExecProvider) Secret(path, key string) (string, error) {
+	args := strings.Fields(path)
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %s: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	line := strings.SplitN(string(out), "\n", 2)[0]
+	return strings.TrimRight(line, "\r"), nil
+}
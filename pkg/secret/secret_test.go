@@ -0,0 +1,113 @@
+package secret
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+)
+
+func TestParseReference(t *testing.T) {
+	cases := []struct {
+		Value    string
+		Expected *Reference
+		IsRef    bool
+		Err      bool
+	}{
+		{"datpass", nil, false, false},
+		{"https://foreman.qa.local", nil, false, false},
+		{"env://FOREMAN_PASSWORD", &Reference{Provider: "env", Path: "FOREMAN_PASSWORD"}, true, false},
+		{"file://~/.overseer/foreman", &Reference{Provider: "file", Path: "~/.overseer/foreman"}, true, false},
+		{"exec://pass show foreman", &Reference{Provider: "exec", Path: "pass show foreman"}, true, false},
+		{"secret://vault/kv/foreman#password", &Reference{Provider: "vault", Path: "kv/foreman", Key: "password"}, true, false},
+		{"secret://vault/kv/foreman", &Reference{Provider: "vault", Path: "kv/foreman"}, true, false},
+		{"secret://vault#password", nil, true, true},
+		{"env://", nil, true, true},
+		{"exec://  ", nil, true, true},
+	}
+
+	for _, tt := range cases {
+		actual, ok, err := ParseReference(tt.Value)
+		if (err != nil) != tt.Err {
+			t.Fatalf("value: %s\n\n%s", tt.Value, err)
+		}
+
+		if ok != tt.IsRef {
+			t.Fatalf("value: %s\n\nexpected reference: %t", tt.Value, tt.IsRef)
+		}
+
+		if !reflect.DeepEqual(actual, tt.Expected) {
+			t.Fatalf("value: %s\n\n%#v\n\n%#v", tt.Value, actual, tt.Expected)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	os.Setenv("OVERSEER_TEST_PASSWORD", "datpass")
+	defer os.Unsetenv("OVERSEER_TEST_PASSWORD")
+
+	path, err := filepath.Abs(filepath.Join("./test-fixtures", "password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewResolver(&configspec.Spec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Value    string
+		Expected string
+		Err      bool
+	}{
+		{"datpass", "datpass", false},
+		{"env://OVERSEER_TEST_PASSWORD", "datpass", false},
+		{"env://OVERSEER_TEST_NOPE", "", true},
+		{"file://" + path, "hunter2", false},
+		{"file://" + path + ".nope", "", true},
+		{"exec://echo hunter2", "hunter2", false},
+		{"exec://false", "", true},
+		{"secret://vault/kv/foreman#password", "", true},
+	}
+
+	for _, tt := range cases {
+		actual, err := r.Resolve(tt.Value)
+		if (err != nil) != tt.Err {
+			t.Fatalf("value: %s\n\n%s", tt.Value, err)
+		}
+
+		if err == nil && actual != tt.Expected {
+			t.Fatalf("value: %s\n\n%q != %q", tt.Value, actual, tt.Expected)
+		}
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	os.Setenv("OVERSEER_TEST_PASSWORD", "datpass")
+	defer os.Unsetenv("OVERSEER_TEST_PASSWORD")
+
+	r, err := NewResolver(&configspec.Spec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec := &configspec.Spec{
+		Foreman: configspec.Foreman{Username: "admin", Password: "env://OVERSEER_TEST_PASSWORD"},
+		Chef:    configspec.Chef{Username: "admin", Password: "exec://echo hunter2"},
+	}
+	if err := spec.ResolveSecrets(r); err != nil {
+		t.Fatal(err)
+	}
+
+	if spec.Foreman.Password != "datpass" || spec.Chef.Password != "hunter2" {
+		t.Fatalf("secrets not resolved: %#v", spec)
+	}
+
+	spec.Infoblox.Password = "env://OVERSEER_TEST_NOPE"
+	if err := spec.ResolveSecrets(r); err == nil {
+		t.Fatalf("expected an error for an unset environment variable")
+	}
+}
@@ -0,0 +1,170 @@
+package secret
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/transport"
+	"github.com/iamthemuffinman/overseer/pkg/util"
+)
+
+// Vault reads secrets out of Vault's KV secrets engine. Both version 1
+// and version 2 mounts are supported; which one a path lives on is
+// looked up the same way the vault CLI does it.
+type Vault struct {
+	Address string
+	Token   string
+
+	client *http.Client
+}
+
+// NewVault returns a Vault provider for the vault block in the configspec.
+// The token may itself be a reference (say, "env://VAULT_TOKEN"), which is
+// resolved with r.
+func NewVault(cspec configspec.Vault, r *Resolver) (*Vault, error) {
+	address := cspec.Endpoint.URL
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if address == "" {
+		return nil, fmt.Errorf("no vault url configured and VAULT_ADDR is not set")
+	}
+
+	token, err := vaultToken(cspec.Token, r)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := transport.New(cspec.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Vault{
+		Address: strings.TrimSuffix(address, "/"),
+		Token:   token,
+		client:  client,
+	}, nil
+}
+
+func vaultToken(token string, r *Resolver) (string, error) {
+	if token != "" {
+		return r.Resolve(token)
+	}
+
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	path, err := util.ExpandPath("~/.vault-token")
+	if err != nil {
+		return "", err
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("no vault token configured, VAULT_TOKEN is not set and ~/.vault-token is unreadable: %s", err)
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
+
+// Secret reads the secret at path (mount included, e.g. "kv/foreman") and
+// returns the value stored under key.
+func (v *Vault) Secret(path, key string) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("%s: no key given, use secret://vault/%s#<key>", path, path)
+	}
+
+	mount, version, err := v.mount(path)
+	if err != nil {
+		return "", err
+	}
+
+	var data map[string]interface{}
+	if version == "2" {
+		// KV v2 keeps the secret under <mount>/data/<path> and wraps it
+		// in a second "data" object alongside its metadata.
+		var secret struct {
+			Data struct {
+				Data map[string]interface{} `json:"data"`
+			} `json:"data"`
+		}
+		if err := v.get(mount+"data/"+strings.TrimPrefix(path, mount), &secret); err != nil {
+			return "", err
+		}
+		data = secret.Data.Data
+	} else {
+		var secret struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		if err := v.get(path, &secret); err != nil {
+			return "", err
+		}
+		data = secret.Data
+	}
+
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("%s: key %q not found", path, key)
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s: key %q is not a string", path, key)
+	}
+
+	return s, nil
+}
+
+// mount figures out which mount path lives on and what KV version it is.
+// Older Vaults don't have the endpoint at all, in which case we assume a
+// version 1 mount at the first path element.
+func (v *Vault) mount(path string) (string, string, error) {
+	var mount struct {
+		Data struct {
+			Path    string `json:"path"`
+			Options struct {
+				Version string `json:"version"`
+			} `json:"options"`
+		} `json:"data"`
+	}
+
+	if err := v.get("sys/internal/ui/mounts/"+path, &mount); err != nil || mount.Data.Path == "" {
+		return strings.SplitN(path, "/", 2)[0] + "/", "1", nil
+	}
+
+	return mount.Data.Path, mount.Data.Options.Version, nil
+}
+
+func (v *Vault) get(path string, result interface{}) error {
+	u, err := url.Parse(fmt.Sprintf("%s/v1/%s", v.Address, path))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("GET %s returned %s: %s", path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,104 @@
+package secret
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+)
+
+// fakeVault serves a KV v2 mount at "kv/" and a KV v1 mount at "secret/".
+func fakeVault(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.overseer" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		var body interface{}
+		switch r.URL.Path {
+		case "/v1/sys/internal/ui/mounts/kv/foreman":
+			body = map[string]interface{}{
+				"data": map[string]interface{}{
+					"path":    "kv/",
+					"options": map[string]string{"version": "2"},
+				},
+			}
+		case "/v1/kv/data/foreman":
+			body = map[string]interface{}{
+				"data": map[string]interface{}{
+					"data":     map[string]string{"password": "datpass"},
+					"metadata": map[string]interface{}{"version": 3},
+				},
+			}
+		case "/v1/secret/infoblox":
+			body = map[string]interface{}{
+				"data": map[string]string{"password": "hunter2"},
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}))
+}
+
+func TestVault(t *testing.T) {
+	server := fakeVault(t)
+	defer server.Close()
+
+	r, err := NewResolver(&configspec.Spec{
+		Vault: configspec.Vault{
+			Token:    "s.overseer",
+			Endpoint: configspec.Endpoint{URL: server.URL},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Value    string
+		Expected string
+		Err      bool
+	}{
+		{"secret://vault/kv/foreman#password", "datpass", false},
+		{"secret://vault/secret/infoblox#password", "hunter2", false},
+		{"secret://vault/kv/foreman#username", "", true},
+		{"secret://vault/kv/foreman", "", true},
+		{"secret://vault/kv/chef#password", "", true},
+	}
+
+	for _, tt := range cases {
+		actual, err := r.Resolve(tt.Value)
+		if (err != nil) != tt.Err {
+			t.Fatalf("value: %s\n\n%s", tt.Value, err)
+		}
+
+		if err == nil && actual != tt.Expected {
+			t.Fatalf("value: %s\n\n%q != %q", tt.Value, actual, tt.Expected)
+		}
+	}
+}
+
+func TestVaultBadToken(t *testing.T) {
+	server := fakeVault(t)
+	defer server.Close()
+
+	vault, err := NewVault(configspec.Vault{
+		Token:    "s.nope",
+		Endpoint: configspec.Endpoint{URL: server.URL},
+	}, &Resolver{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := vault.Secret("kv/foreman", "password"); err == nil {
+		t.Fatalf("expected an error with a bad token")
+	}
+}
@@ -0,0 +1,150 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultParallel is how many hosts a command is run on at once when the
+// configspec doesn't say.
+const DefaultParallel = 10
+
+// Result is how a command went on one host.
+type Result struct {
+	Host string
+	// ExitStatus is the command's exit status, or -1 if it couldn't be
+	// run at all, in which case Err says why.
+	ExitStatus int
+	Err        error
+	// Stdout and Stderr hold the command's output when it was captured
+	// rather than streamed to the Executor's Output.
+	Stdout []byte
+	Stderr []byte
+}
+
+// OK reports whether the command ran and exited zero.
+func (r *Result) OK() bool {
+	return r.Err == nil && r.ExitStatus == 0
+}
+
+// Executor runs a command on many hosts at once.
+type Executor struct {
+	Config configspec.SSH
+
+	// Output, if set, gets each host's output as it's written, with every
+	// line prefixed by the host's name. Otherwise output is captured in
+	// each host's Result.
+	Output io.Writer
+
+	mu sync.Mutex
+}
+
+// Run runs the command on every host, no more than the configspec's
+// parallel setting at a time, and returns a Result per host in the same
+// order as hosts.
+func (e *Executor) Run(hosts []string, cmd string) []*Result {
+	parallel := e.Config.Parallel
+	if parallel == 0 {
+		parallel = DefaultParallel
+	}
+
+	results := make([]*Result, len(hosts))
+	sem := make(chan struct{}, parallel)
+
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = e.run(host, cmd)
+		}(i, host)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func (e *Executor) run(host, cmd string) *Result {
+	result := &Result{Host: host, ExitStatus: -1}
+
+	client, err := Dial(host, e.Config)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer client.Close()
+
+	var stdout, stderr bytes.Buffer
+	var stdoutW, stderrW io.Writer = &stdout, &stderr
+	if e.Output != nil {
+		// stdout and stderr are copied from different goroutines, so they
+		// each get a writer of their own
+		prefixedOut := &prefixWriter{mu: &e.mu, w: e.Output, prefix: host + ": "}
+		prefixedErr := &prefixWriter{mu: &e.mu, w: e.Output, prefix: host + ": "}
+		defer prefixedOut.Flush()
+		defer prefixedErr.Flush()
+		stdoutW, stderrW = prefixedOut, prefixedErr
+	}
+
+	err = client.Run(cmd, nil, stdoutW, stderrW)
+	result.Stdout = stdout.Bytes()
+	result.Stderr = stderr.Bytes()
+
+	switch err := err.(type) {
+	case nil:
+		result.ExitStatus = 0
+	case *ssh.ExitError:
+		result.ExitStatus = err.ExitStatus()
+	default:
+		result.Err = err
+	}
+
+	return result
+}
+
+// prefixWriter writes whole lines to w with prefix in front of each. Lines
+// from different hosts sharing w are kept from interleaving by mu.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		p.mu.Lock()
+		_, err := fmt.Fprintf(p.w, "%s%s\n", p.prefix, p.buf[:i])
+		p.mu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+
+		p.buf = p.buf[i+1:]
+	}
+
+	return len(b), nil
+}
+
+// Flush writes out whatever is left that didn't end in a newline.
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		p.Write([]byte("\n"))
+	}
+}
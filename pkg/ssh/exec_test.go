@@ -0,0 +1,85 @@
+package ssh
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExecutor(t *testing.T) {
+	cfg, _ := testConfig(t)
+
+	hosts := []string{"127.0.0.1", "::1"}
+
+	cases := []struct {
+		Command string
+		Stream  bool
+		Status  []int
+		Output  string
+	}{
+		{"uptime", true, []int{0, -1}, "127.0.0.1: uptime\n"},
+		{"uptime", false, []int{0, -1}, ""},
+		{"exit 3", false, []int{3, -1}, ""},
+	}
+
+	for _, tt := range cases {
+		var output bytes.Buffer
+
+		e := &Executor{Config: cfg}
+		if tt.Stream {
+			e.Output = &output
+		}
+
+		results := e.Run(hosts, tt.Command)
+		if len(results) != len(hosts) {
+			t.Fatalf("command: %s\n\n%d results for %d hosts", tt.Command, len(results), len(hosts))
+		}
+
+		for i, result := range results {
+			if result.Host != hosts[i] {
+				t.Fatalf("command: %s\n\nresult %d is for %s, expected %s", tt.Command, i, result.Host, hosts[i])
+			}
+			if result.ExitStatus != tt.Status[i] {
+				t.Fatalf("command: %s\n\n%s exited %d, expected %d (%v)", tt.Command, result.Host, result.ExitStatus, tt.Status[i], result.Err)
+			}
+			if result.OK() != (tt.Status[i] == 0) {
+				t.Fatalf("command: %s\n\n%s OK() = %t", tt.Command, result.Host, result.OK())
+			}
+		}
+
+		// The host that isn't listening says why
+		if results[1].Err == nil {
+			t.Fatalf("command: %s\n\nexpected a connection error", tt.Command)
+		}
+
+		if output.String() != tt.Output {
+			t.Fatalf("command: %s\n\n%q\n\n%q", tt.Command, output.String(), tt.Output)
+		}
+
+		if !tt.Stream && tt.Status[0] == 0 && string(results[0].Stdout) != tt.Command+"\n" {
+			t.Fatalf("command: %s\n\ncaptured %q", tt.Command, results[0].Stdout)
+		}
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var buf bytes.Buffer
+	var e Executor
+
+	w := &prefixWriter{mu: &e.mu, w: &buf, prefix: "hello.qa.local: "}
+	for _, chunk := range []string{"Starting Chef", " Client\nRecipe: ntp", "\n\nConverged"} {
+		w.Write([]byte(chunk))
+	}
+	w.Flush()
+
+	expected := strings.Join([]string{
+		"hello.qa.local: Starting Chef Client",
+		"hello.qa.local: Recipe: ntp",
+		"hello.qa.local: ",
+		"hello.qa.local: Converged",
+	}, "\n") + "\n"
+
+	if buf.String() != expected {
+		t.Fatalf("%q\n\n%q", buf.String(), expected)
+	}
+}
@@ -0,0 +1,266 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/util"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	DefaultUser       = "root"
+	DefaultPort       = 22
+	DefaultKnownHosts = "~/.ssh/known_hosts"
+)
+
+// Client is a connection to a single host.
+type Client struct {
+	client *ssh.Client
+	jump   *ssh.Client
+	user   string
+	sudo   bool
+}
+
+// Dial connects to the host using the settings from the configspec, going
+// through the jump host if there is one.
+func Dial(host string, cfg configspec.SSH) (*Client, error) {
+	config, err := ClientConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	port := cfg.Port
+	if port == 0 {
+		port = DefaultPort
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+
+	if cfg.JumpHost == "" {
+		client, err := ssh.Dial("tcp", addr, config)
+		if err != nil {
+			return nil, fmt.Errorf("unable to connect to %s: %s", host, err)
+		}
+
+		return &Client{client: client, user: config.User, sudo: cfg.Sudo}, nil
+	}
+
+	jumpConfig := *config
+	jumpAddr := cfg.JumpHost
+	if i := strings.LastIndex(jumpAddr, "@"); i >= 0 {
+		jumpConfig.User = jumpAddr[:i]
+		jumpAddr = jumpAddr[i+1:]
+	}
+	if _, _, err := net.SplitHostPort(jumpAddr); err != nil {
+		jumpAddr = net.JoinHostPort(jumpAddr, strconv.Itoa(DefaultPort))
+	}
+
+	jump, err := ssh.Dial("tcp", jumpAddr, &jumpConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to jump host %s: %s", cfg.JumpHost, err)
+	}
+
+	conn, err := jump.Dial("tcp", addr)
+	if err != nil {
+		jump.Close()
+		return nil, fmt.Errorf("unable to connect to %s through %s: %s", host, cfg.JumpHost, err)
+	}
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		jump.Close()
+		return nil, fmt.Errorf("unable to connect to %s through %s: %s", host, cfg.JumpHost, err)
+	}
+
+	return &Client{
+		client: ssh.NewClient(c, chans, reqs),
+		jump:   jump,
+		user:   config.User,
+		sudo:   cfg.Sudo,
+	}, nil
+}
+
+// ClientConfig builds the user, auth methods and host key checking for
+// a connection from the configspec.
+func ClientConfig(cfg configspec.SSH) (*ssh.ClientConfig, error) {
+	user := cfg.User
+	if user == "" {
+		user = DefaultUser
+	}
+
+	auth, err := authMethods(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	hostKeyCallback, err := HostKeyCallback(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         time.Duration(cfg.Timeout) * time.Second,
+	}, nil
+}
+
+// authMethods returns the key file from the configspec, if there is one,
+// followed by whatever keys the SSH agent has.
+func authMethods(cfg configspec.SSH) ([]ssh.AuthMethod, error) {
+	var signers []ssh.Signer
+
+	if cfg.KeyFile != "" {
+		path, err := util.ExpandPath(cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read ssh key: %s", err)
+		}
+
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse ssh key %s: %s", path, err)
+		}
+		signers = append(signers, signer)
+	}
+
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		conn, err := net.Dial("unix", sock)
+		if err == nil {
+			agentSigners, err := agent.NewClient(conn).Signers()
+			conn.Close()
+			if err == nil {
+				signers = append(signers, agentSigners...)
+			}
+		}
+	}
+
+	if len(signers) == 0 {
+		return nil, fmt.Errorf("no ssh keys to log in with: set key_file in the ssh block or start an ssh agent")
+	}
+
+	return []ssh.AuthMethod{ssh.PublicKeys(signers...)}, nil
+}
+
+// knownHostsMu keeps connections to several hosts at once from writing
+// over each other's known_hosts entries.
+var knownHostsMu sync.Mutex
+
+// HostKeyCallback checks host keys against known_hosts as the configspec
+// asks. With "accept-new", keys for hosts that aren't in known_hosts are
+// added to it, but a key that doesn't match the one on file is still an
+// error.
+func HostKeyCallback(cfg configspec.SSH) (ssh.HostKeyCallback, error) {
+	if cfg.HostKeyChecking == configspec.HostKeyOff {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	path := cfg.KnownHosts
+	if path == "" {
+		path = DefaultKnownHosts
+	}
+	path, err := util.ExpandPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	acceptNew := cfg.HostKeyChecking != configspec.HostKeyStrict
+	if acceptNew {
+		// knownhosts won't read a file that isn't there
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+		f.Close()
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		knownHostsMu.Lock()
+		defer knownHostsMu.Unlock()
+
+		// Read known_hosts each time so keys accepted for other hosts
+		// during this run are seen
+		check, err := knownhosts.New(path)
+		if err != nil {
+			return err
+		}
+
+		err = check(hostname, remote, key)
+		keyErr, ok := err.(*knownhosts.KeyError)
+		if !ok {
+			return err
+		}
+
+		if len(keyErr.Want) > 0 {
+			return fmt.Errorf("host key for %s doesn't match the one in %s; if the host was rebuilt, remove its old entry", hostname, path)
+		}
+		if !acceptNew {
+			return fmt.Errorf("%s isn't in %s", hostname, path)
+		}
+
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+		return err
+	}, nil
+}
+
+// Run runs the command on the host, through sudo if the configspec asks
+// for it. stdin, stdout and stderr may be nil. If the command exits
+// non-zero the error is an *ssh.ExitError.
+func (c *Client) Run(cmd string, stdin io.Reader, stdout, stderr io.Writer) error {
+	session, err := c.client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	if c.sudo && c.user != "root" {
+		cmd = "sudo -n sh -c " + Quote(cmd)
+	}
+
+	return session.Run(cmd)
+}
+
+// Close closes the connection, and the one to the jump host if there is
+// one.
+func (c *Client) Close() error {
+	err := c.client.Close()
+	if c.jump != nil {
+		c.jump.Close()
+	}
+	return err
+}
+
+// Quote quotes s for a POSIX shell.
+func Quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,353 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"golang.org/x/crypto/ssh"
+)
+
+// testServer is an in-process SSH server. It doesn't run anything: every
+// command echoes itself and whatever it was sent on stdin, and "exit N"
+// exits with N.
+type testServer struct {
+	listener  net.Listener
+	config    *ssh.ServerConfig
+	hostKey   ssh.Signer
+	clientKey ssh.PublicKey
+
+	mu       sync.Mutex
+	commands []string
+	forwards []string
+}
+
+func newTestServer(t *testing.T, clientKey ssh.PublicKey) *testServer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &testServer{hostKey: hostKey, clientKey: clientKey}
+	s.config = &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key")
+		},
+	}
+	s.config.AddHostKey(hostKey)
+
+	s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go s.serve()
+	return s
+}
+
+func (s *testServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *testServer) Close() {
+	s.listener.Close()
+}
+
+func (s *testServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			_, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+			if err != nil {
+				return
+			}
+			go ssh.DiscardRequests(reqs)
+
+			for newChan := range chans {
+				switch newChan.ChannelType() {
+				case "session":
+					ch, reqs, err := newChan.Accept()
+					if err != nil {
+						return
+					}
+					go s.session(ch, reqs)
+				case "direct-tcpip":
+					go s.forward(newChan)
+				default:
+					newChan.Reject(ssh.UnknownChannelType, "unsupported channel type")
+				}
+			}
+		}()
+	}
+}
+
+func (s *testServer) session(ch ssh.Channel, reqs <-chan *ssh.Request) {
+	defer ch.Close()
+
+	for req := range reqs {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+
+		cmd := string(req.Payload[4:])
+		s.mu.Lock()
+		s.commands = append(s.commands, cmd)
+		s.mu.Unlock()
+
+		var status uint32
+		if strings.HasPrefix(cmd, "exit ") {
+			n, _ := strconv.Atoi(strings.TrimPrefix(cmd, "exit "))
+			status = uint32(n)
+		} else {
+			stdin, _ := ioutil.ReadAll(ch)
+			fmt.Fprintf(ch, "%s\n%s", cmd, stdin)
+		}
+
+		payload := make([]byte, 4)
+		binary.BigEndian.PutUint32(payload, status)
+		ch.SendRequest("exit-status", false, payload)
+		return
+	}
+}
+
+// forward connects a jump host's client through to the address it asked
+// for.
+func (s *testServer) forward(newChan ssh.NewChannel) {
+	var req struct {
+		Host     string
+		Port     uint32
+		OrigHost string
+		OrigPort uint32
+	}
+	if err := ssh.Unmarshal(newChan.ExtraData(), &req); err != nil {
+		newChan.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	addr := net.JoinHostPort(req.Host, strconv.Itoa(int(req.Port)))
+	s.mu.Lock()
+	s.forwards = append(s.forwards, addr)
+	s.mu.Unlock()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		newChan.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	ch, reqs, err := newChan.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	go func() {
+		io.Copy(ch, conn)
+		ch.CloseWrite()
+	}()
+	io.Copy(conn, ch)
+	conn.Close()
+}
+
+// testKey writes a new private key to dir and returns its path.
+func testKey(t *testing.T, dir string) (string, ssh.PublicKey) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "id_ed25519")
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path, signer.PublicKey()
+}
+
+func testConfig(t *testing.T) (configspec.SSH, *testServer) {
+	dir, err := ioutil.TempDir("", "overseer-ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	os.Unsetenv("SSH_AUTH_SOCK")
+
+	keyPath, pub := testKey(t, dir)
+	server := newTestServer(t, pub)
+	t.Cleanup(server.Close)
+
+	return configspec.SSH{
+		User:       "provision",
+		Port:       server.port(),
+		KeyFile:    keyPath,
+		KnownHosts: filepath.Join(dir, "known_hosts"),
+	}, server
+}
+
+func TestRun(t *testing.T) {
+	cfg, server := testConfig(t)
+
+	cases := []struct {
+		Sudo     bool
+		Command  string
+		Stdin    string
+		Expected string
+		Status   int
+	}{
+		{false, "hostname", "", "hostname\n", 0},
+		{false, "cat > /etc/chef/client.rb", "log_level :info\n", "cat > /etc/chef/client.rb\nlog_level :info\n", 0},
+		{true, "echo 'hi'", "", "sudo -n sh -c 'echo '\\''hi'\\'''\n", 0},
+		{false, "exit 3", "", "", 3},
+	}
+
+	for _, tt := range cases {
+		cfg.Sudo = tt.Sudo
+
+		client, err := Dial("127.0.0.1", cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var stdout bytes.Buffer
+		err = client.Run(tt.Command, strings.NewReader(tt.Stdin), &stdout, nil)
+		client.Close()
+
+		status := 0
+		if exitErr, ok := err.(*ssh.ExitError); ok {
+			status = exitErr.ExitStatus()
+		} else if err != nil {
+			t.Fatalf("command: %s\n\n%s", tt.Command, err)
+		}
+
+		if status != tt.Status {
+			t.Fatalf("command: %s\n\nexit status %d != %d", tt.Command, status, tt.Status)
+		}
+		if stdout.String() != tt.Expected {
+			t.Fatalf("command: %s\n\n%q\n\n%q", tt.Command, stdout.String(), tt.Expected)
+		}
+	}
+
+	if len(server.commands) != len(cases) {
+		t.Fatalf("server saw %d commands, expected %d", len(server.commands), len(cases))
+	}
+}
+
+func TestHostKeyChecking(t *testing.T) {
+	cfg, _ := testConfig(t)
+
+	// Strict checking refuses a host that isn't in known_hosts yet
+	cfg.HostKeyChecking = configspec.HostKeyStrict
+	if _, err := Dial("127.0.0.1", cfg); err == nil {
+		t.Fatalf("strict checking should refuse an unknown host")
+	}
+
+	// accept-new remembers it...
+	cfg.HostKeyChecking = configspec.HostKeyAcceptNew
+	client, err := Dial("127.0.0.1", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	// ...so strict checking lets it through afterwards
+	cfg.HostKeyChecking = configspec.HostKeyStrict
+	client, err = Dial("127.0.0.1", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	// A host that comes back with a different key is refused even with
+	// accept-new
+	keyPath, pub := testKey(t, filepath.Dir(cfg.KnownHosts))
+	rebuilt := newTestServer(t, pub)
+	defer rebuilt.Close()
+
+	known, err := ioutil.ReadFile(cfg.KnownHosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	known = bytes.Replace(known, []byte(":"+strconv.Itoa(cfg.Port)+" "), []byte(":"+strconv.Itoa(rebuilt.port())+" "), 1)
+	if err := ioutil.WriteFile(cfg.KnownHosts, known, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.HostKeyChecking = configspec.HostKeyAcceptNew
+	cfg.Port = rebuilt.port()
+	cfg.KeyFile = keyPath
+	if _, err := Dial("127.0.0.1", cfg); err == nil {
+		t.Fatalf("a changed host key should be refused")
+	}
+}
+
+func TestDialJumpHost(t *testing.T) {
+	cfg, target := testConfig(t)
+
+	jump := newTestServer(t, target.clientKey)
+	defer jump.Close()
+
+	cfg.JumpHost = "jump@127.0.0.1:" + strconv.Itoa(jump.port())
+
+	client, err := Dial("127.0.0.1", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var stdout bytes.Buffer
+	if err := client.Run("hostname", nil, &stdout, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if stdout.String() != "hostname\n" {
+		t.Fatalf("%q", stdout.String())
+	}
+
+	expected := []string{"127.0.0.1:" + strconv.Itoa(target.port())}
+	if !reflect.DeepEqual(jump.forwards, expected) {
+		t.Fatalf("%#v\n\n%#v", jump.forwards, expected)
+	}
+	if len(jump.commands) != 0 || len(target.commands) != 1 {
+		t.Fatalf("command should only run on the target: jump %v, target %v", jump.commands, target.commands)
+	}
+}
@@ -0,0 +1,244 @@
+package summary
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// Status is how a step went for a host.
+type Status string
+
+const (
+	OK      Status = "ok"
+	Failed  Status = "failed"
+	Skipped Status = "skipped"
+)
+
+// Step is the outcome of one step of provisioning (building the host,
+// setting up its Chef node, ...) for a host.
+type Step struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	// Detail is what happened ("created", "updated") or, for failures,
+	// the error.
+	Detail string `json:"detail,omitempty"`
+}
+
+// Host is every step recorded for a host, in the order they ran.
+type Host struct {
+	Name string `json:"name"`
+	// Outcome sums up what the run did to the host: "created", "updated"
+	// or "unchanged".
+	Outcome string  `json:"outcome,omitempty"`
+	Steps   []*Step `json:"steps"`
+}
+
+// Summary collects per-host results over a provisioning run. It's safe to
+// record to from more than one goroutine.
+type Summary struct {
+	mu    sync.Mutex
+	Hosts []*Host `json:"hosts"`
+
+	// OnRecord, if set, is called after every step is recorded, so the
+	// summary can be saved as the run goes.
+	OnRecord func() `json:"-"`
+}
+
+// New returns a Summary for the given hosts, which are reported in the
+// same order.
+func New(hosts []string) *Summary {
+	s := &Summary{}
+	for _, host := range hosts {
+		s.Hosts = append(s.Hosts, &Host{Name: host})
+	}
+	return s
+}
+
+// Record sets the status of a step for a host, replacing anything recorded
+// for that step before.
+func (s *Summary) Record(host, step string, status Status, detail string) {
+	s.record(host, step, status, detail)
+
+	if s.OnRecord != nil {
+		s.OnRecord()
+	}
+}
+
+func (s *Summary) record(host, step string, status Status, detail string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h := s.host(host)
+	for _, st := range h.Steps {
+		if st.Name == step {
+			st.Status = status
+			st.Detail = detail
+			return
+		}
+	}
+
+	h.Steps = append(h.Steps, &Step{Name: step, Status: status, Detail: detail})
+}
+
+// OK records a step that succeeded.
+func (s *Summary) OK(host, step, detail string) {
+	s.Record(host, step, OK, detail)
+}
+
+// Fail records a step that failed with err.
+func (s *Summary) Fail(host, step string, err error) {
+	s.Record(host, step, Failed, err.Error())
+}
+
+// Skip records a step that wasn't attempted, along with why.
+func (s *Summary) Skip(host, step, reason string) {
+	s.Record(host, step, Skipped, reason)
+}
+
+// Detail returns what was recorded for the host's step, or an empty
+// string if nothing was.
+func (s *Summary) Detail(host, step string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, st := range s.host(host).Steps {
+		if st.Name == step {
+			return st.Detail
+		}
+	}
+	return ""
+}
+
+// SetOutcome records what the run did to the host overall.
+func (s *Summary) SetOutcome(host, outcome string) {
+	s.mu.Lock()
+	s.host(host).Outcome = outcome
+	s.mu.Unlock()
+
+	if s.OnRecord != nil {
+		s.OnRecord()
+	}
+}
+
+// HostFailed reports whether any step failed for the host.
+func (s *Summary) HostFailed(host string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, st := range s.host(host).Steps {
+		if st.Status == Failed {
+			return true
+		}
+	}
+	return false
+}
+
+// Succeeded reports whether the step has been recorded as OK for the host.
+func (s *Summary) Succeeded(host, step string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, st := range s.host(host).Steps {
+		if st.Name == step {
+			return st.Status == OK
+		}
+	}
+	return false
+}
+
+// KeepSucceeded forgets every step that failed or was skipped, so they can
+// be run again.
+func (s *Summary) KeepSucceeded() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, h := range s.Hosts {
+		var steps []*Step
+		for _, st := range h.Steps {
+			if st.Status == OK {
+				steps = append(steps, st)
+			}
+		}
+		h.Steps = steps
+	}
+}
+
+// Failed reports whether any step failed for any host.
+func (s *Summary) Failed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, h := range s.Hosts {
+		for _, st := range h.Steps {
+			if st.Status == Failed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// String renders the summary as a table with a line per host and step,
+// followed by each host's outcome if any have been set.
+func (s *Summary) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tSTEP\tSTATUS\tDETAIL")
+	for _, h := range s.Hosts {
+		for _, st := range h.Steps {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", h.Name, st.Name, st.Status, st.Detail)
+		}
+	}
+	w.Flush()
+
+	var outcomes []string
+	for _, h := range s.Hosts {
+		if h.Outcome != "" {
+			outcomes = append(outcomes, fmt.Sprintf("%s: %s", h.Name, h.Outcome))
+		}
+	}
+	if len(outcomes) > 0 {
+		fmt.Fprintf(&buf, "\n%s\n", strings.Join(outcomes, "\n"))
+	}
+
+	return buf.String()
+}
+
+// JSON renders the summary as JSON.
+func (s *Summary) JSON() ([]byte, error) {
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// MarshalJSON holds the lock while the summary is marshaled, so it can be
+// saved (on its own or as part of something else) while steps are still
+// being recorded.
+func (s *Summary) MarshalJSON() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// plain has the same fields without the MarshalJSON method, so this
+	// doesn't come back here
+	type plain Summary
+	return json.Marshal((*plain)(s))
+}
+
+// host returns the named host, adding it if it's not there already. The
+// caller must hold the lock.
+func (s *Summary) host(name string) *Host {
+	for _, h := range s.Hosts {
+		if h.Name == name {
+			return h
+		}
+	}
+
+	h := &Host{Name: name}
+	s.Hosts = append(s.Hosts, h)
+	return h
+}
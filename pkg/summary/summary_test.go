@@ -0,0 +1,112 @@
+package summary
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSummary(t *testing.T) {
+	s := New([]string{"hello.qa.local", "lol.qa.local"})
+
+	s.OK("hello.qa.local", "build", "")
+	s.OK("hello.qa.local", "chef", "created")
+	s.OK("lol.qa.local", "build", "")
+	s.Fail("lol.qa.local", "chef", errors.New("403 Forbidden"))
+
+	if !s.Failed() {
+		t.Fatalf("summary should have failed")
+	}
+	if s.HostFailed("hello.qa.local") || !s.HostFailed("lol.qa.local") {
+		t.Fatalf("only lol.qa.local should have failed")
+	}
+
+	// Recording the same step again replaces it
+	s.OK("lol.qa.local", "chef", "updated")
+	if s.Failed() {
+		t.Fatalf("summary shouldn't have failed after the retry")
+	}
+
+	lines := strings.Split(strings.TrimSpace(s.String()), "\n")
+	if len(lines) != 5 || !strings.HasPrefix(lines[0], "HOST") || !strings.Contains(lines[4], "updated") {
+		t.Fatalf("unexpected table:\n%s", s.String())
+	}
+
+	b, err := s.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actual struct {
+		Hosts []*Host `json:"hosts"`
+	}
+	if err := json.Unmarshal(b, &actual); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*Host{
+		{Name: "hello.qa.local", Steps: []*Step{{Name: "build", Status: OK}, {Name: "chef", Status: OK, Detail: "created"}}},
+		{Name: "lol.qa.local", Steps: []*Step{{Name: "build", Status: OK}, {Name: "chef", Status: OK, Detail: "updated"}}},
+	}
+	if !reflect.DeepEqual(actual.Hosts, expected) {
+		t.Fatalf("%s", b)
+	}
+}
+
+func TestKeepSucceeded(t *testing.T) {
+	s := New([]string{"hello.qa.local", "lol.qa.local"})
+
+	recorded := 0
+	s.OnRecord = func() { recorded++ }
+
+	s.OK("hello.qa.local", "create", "")
+	s.OK("hello.qa.local", "build", "")
+	s.OK("lol.qa.local", "create", "")
+	s.Fail("lol.qa.local", "build", errors.New("build timed out"))
+	s.Skip("lol.qa.local", "chef", "host not built")
+
+	if recorded != 5 {
+		t.Fatalf("OnRecord called %d times, expected 5", recorded)
+	}
+
+	s.KeepSucceeded()
+
+	if s.Failed() {
+		t.Fatalf("failed steps should have been forgotten")
+	}
+	if !s.Succeeded("lol.qa.local", "create") || s.Succeeded("lol.qa.local", "build") {
+		t.Fatalf("only lol.qa.local's create step should be left:\n%s", s.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(s.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("unexpected table:\n%s", s.String())
+	}
+}
+
+func TestOutcome(t *testing.T) {
+	s := New([]string{"hello.qa.local", "lol.qa.local"})
+
+	s.OK("hello.qa.local", "host", "created")
+	s.OK("lol.qa.local", "host", "unchanged")
+	s.SetOutcome("hello.qa.local", "created")
+	s.SetOutcome("lol.qa.local", "unchanged")
+
+	if s.Detail("hello.qa.local", "host") != "created" || s.Detail("hello.qa.local", "chef") != "" {
+		t.Fatalf("unexpected details:\n%s", s.String())
+	}
+
+	if !strings.HasSuffix(s.String(), "\nhello.qa.local: created\nlol.qa.local: unchanged\n") {
+		t.Fatalf("unexpected table:\n%s", s.String())
+	}
+
+	b, err := s.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"outcome": "created"`) {
+		t.Fatalf("%s", b)
+	}
+}
@@ -0,0 +1,160 @@
+package terraform
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// block is an HCL block: a type, its labels and a body of attributes and
+// nested blocks, written in the order they were added.
+type block struct {
+	Type   string
+	Labels []string
+	items  []interface{}
+}
+
+// attribute is a name and an expression, already rendered as HCL.
+type attribute struct {
+	Name  string
+	Value string
+}
+
+// comment is a line comment, written without the leading "#".
+type comment string
+
+func newBlock(typ string, labels ...string) *block {
+	return &block{Type: typ, Labels: labels}
+}
+
+// Set adds an attribute with an expression that's written as is, such
+// as a reference to another resource.
+func (b *block) Set(name, expr string) *block {
+	b.items = append(b.items, attribute{name, expr})
+	return b
+}
+
+// String adds an attribute with a string value.
+func (b *block) String(name, value string) *block {
+	return b.Set(name, quote(value))
+}
+
+// Int adds an attribute with a number value.
+func (b *block) Int(name string, value int) *block {
+	return b.Set(name, strconv.Itoa(value))
+}
+
+// Bool adds an attribute with a bool value.
+func (b *block) Bool(name string, value bool) *block {
+	return b.Set(name, strconv.FormatBool(value))
+}
+
+// Block adds a nested block and returns it.
+func (b *block) Block(typ string, labels ...string) *block {
+	nested := newBlock(typ, labels...)
+	b.items = append(b.items, nested)
+	return nested
+}
+
+// Comment adds a comment line.
+func (b *block) Comment(format string, args ...interface{}) *block {
+	b.items = append(b.items, comment(fmt.Sprintf(format, args...)))
+	return b
+}
+
+// Bytes renders the body of the block, without the block itself, as an
+// HCL file.
+func (b *block) Bytes() []byte {
+	var buf bytes.Buffer
+	writeItems(&buf, b.items, "")
+	return buf.Bytes()
+}
+
+// write writes the block the way terraform fmt would: indented two spaces
+// a level, with the equals signs of neighbouring attributes lined up and
+// nested blocks set apart by a blank line.
+func (b *block) write(buf *bytes.Buffer, indent string) {
+	buf.WriteString(indent + b.Type)
+	for _, label := range b.Labels {
+		buf.WriteString(" " + quote(label))
+	}
+	buf.WriteString(" {\n")
+	writeItems(buf, b.items, indent+"  ")
+	buf.WriteString(indent + "}\n")
+}
+
+func writeItems(buf *bytes.Buffer, items []interface{}, indent string) {
+	for i := 0; i < len(items); i++ {
+		_, isBlock := items[i].(*block)
+		if i > 0 {
+			if _, prevBlock := items[i-1].(*block); isBlock || prevBlock {
+				buf.WriteString("\n")
+			}
+		}
+
+		switch item := items[i].(type) {
+		case comment:
+			buf.WriteString(indent + "# " + string(item) + "\n")
+		case *block:
+			item.write(buf, indent)
+		case attribute:
+			// Line up the run of attributes this one starts
+			end := i
+			width := 0
+			for ; end < len(items); end++ {
+				attr, ok := items[end].(attribute)
+				if !ok {
+					break
+				}
+				if len(attr.Name) > width {
+					width = len(attr.Name)
+				}
+			}
+			for ; i < end; i++ {
+				attr := items[i].(attribute)
+				fmt.Fprintf(buf, "%s%-*s = %s\n", indent, width, attr.Name, attr.Value)
+			}
+			i--
+		}
+	}
+}
+
+// quote returns s as an HCL string literal. Template sequences are escaped
+// so they're taken literally.
+func quote(s string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+
+	out := buf.String()
+	out = strings.Replace(out, "${", "$${", -1)
+	out = strings.Replace(out, "%{", "%%{", -1)
+	return out
+}
+
+// object renders an inline HCL object, with its attributes in the given
+// order.
+func object(attrs ...attribute) string {
+	var parts []string
+	for _, attr := range attrs {
+		parts = append(parts, attr.Name+" = "+attr.Value)
+	}
+	return "{ " + strings.Join(parts, ", ") + " }"
+}
@@ -0,0 +1,300 @@
+// Package terraform renders the hosts a buildspec and hostspec describe as
+// Terraform configuration for the vsphere, foreman and infoblox providers,
+// so they can be handed over to Terraform rather than described twice.
+package terraform
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+)
+
+// DefaultGuestID is the vSphere guest OS VMs are created with when the
+// export isn't told otherwise. Buildspecs leave it to Foreman's compute
+// profile.
+const DefaultGuestID = "otherLinux64Guest"
+
+// Options are what the Terraform configuration needs that a buildspec
+// doesn't say.
+type Options struct {
+	// GuestID is the vSphere guest OS identifier of the VMs. Empty means
+	// DefaultGuestID.
+	GuestID string
+}
+
+// scsiTypes maps the controller types buildspecs use to the vsphere
+// provider's scsi_type.
+var scsiTypes = map[string]string{
+	"paravirtual":  "pvscsi",
+	"lsilogic":     "lsilogic",
+	"lsilogic-sas": "lsilogic-sas",
+}
+
+// Render returns the Terraform configuration for the hosts. Each host gets
+// a vsphere_virtual_machine with the buildspec's hardware and a
+// foreman_host that installs it over the network. When the buildspec puts
+// hosts in Infoblox, each also gets an address allocated from the
+// infoblox block's subnet and an A record pointing at it.
+func Render(bspec *buildspec.Spec, hosts []string, opts Options) ([]byte, error) {
+	if err := check(bspec, hosts); err != nil {
+		return nil, err
+	}
+
+	guestID := opts.GuestID
+	if guestID == "" {
+		guestID = DefaultGuestID
+	}
+	useInfoblox := bspec.DNS == "infoblox" || (bspec.DNS == "" && bspec.Infoblox != (buildspec.Infoblox{}))
+
+	file := newBlock("")
+	file.Comment("Generated by \"overseer export terraform\" from the buildspec %q.", bspec.Name)
+	if bspec.Foreman.Location != "" || bspec.Foreman.Organization != "" {
+		file.Comment("The foreman provider should be set up for location %q and organization %q.", bspec.Foreman.Location, bspec.Foreman.Organization)
+	}
+	if bspec.Config != "" || bspec.Chef.Server != "" || len(bspec.Chef.RunList) > 0 {
+		file.Comment("Configuring the hosts (config = %q) isn't part of the export.", defaultString(bspec.Config, "chef"))
+	}
+
+	providers := file.Block("terraform").Block("required_providers")
+	providers.Set("vsphere", object(attribute{"source", quote("hashicorp/vsphere")}))
+	providers.Set("foreman", object(attribute{"source", quote("terraform-coop/foreman")}))
+	if useInfoblox {
+		providers.Set("infoblox", object(attribute{"source", quote("infobloxopen/infoblox")}))
+	}
+
+	// Everything the hosts share is looked up once
+	vs := bspec.Vsphere
+	file.Block("data", "vsphere_datacenter", "datacenter").
+		String("name", vs.Datacenter)
+	file.Block("data", "vsphere_compute_cluster", "cluster").
+		String("name", vs.Cluster).
+		Set("datacenter_id", "data.vsphere_datacenter.datacenter.id")
+	file.Block("data", "vsphere_datastore", "datastore").
+		String("name", vs.Datastore).
+		Set("datacenter_id", "data.vsphere_datacenter.datacenter.id")
+
+	networks := make(map[string]bool)
+	for _, network := range vs.Devices.Networks {
+		name := networkName(network)
+		if networks[name] {
+			continue
+		}
+		networks[name] = true
+		file.Block("data", "vsphere_network", resourceName(name)).
+			String("name", name).
+			Set("datacenter_id", "data.vsphere_datacenter.datacenter.id")
+	}
+
+	fs := bspec.Foreman
+	if fs.Hostgroup != "" {
+		file.Block("data", "foreman_hostgroup", "hostgroup").String("title", fs.Hostgroup)
+	}
+	if fs.Environment != "" {
+		file.Block("data", "foreman_environment", "environment").String("name", fs.Environment)
+	}
+	if fs.Medium != "" {
+		file.Block("data", "foreman_media", "medium").String("name", fs.Medium)
+	}
+
+	for _, host := range hosts {
+		name := resourceName(host)
+		vmRef := "vsphere_virtual_machine." + name
+
+		vm := file.Block("resource", "vsphere_virtual_machine", name).
+			String("name", host).
+			Set("resource_pool_id", "data.vsphere_compute_cluster.cluster.resource_pool_id").
+			Set("datastore_id", "data.vsphere_datastore.datastore.id")
+		if vs.Folder != "" {
+			vm.String("folder", vs.Folder)
+		}
+		vm.Int("num_cpus", vs.CPUs)
+		if vs.Cores > 0 {
+			vm.Int("num_cores_per_socket", vs.Cores)
+		}
+		vm.Int("memory", vs.Memory).
+			String("guest_id", guestID)
+		if scsis := vs.Devices.SCSIs; len(scsis) > 0 {
+			vm.String("scsi_type", scsiTypes[scsis[0].Type])
+			if len(scsis) > 1 {
+				vm.Int("scsi_controller_count", len(scsis))
+			}
+		}
+		// The OS is installed over the network, so there are no VMware
+		// tools to report an address until it's done
+		vm.Int("wait_for_guest_net_timeout", 0)
+
+		for _, network := range vs.Devices.Networks {
+			nic := vm.Block("network_interface")
+			if network.BuildVLAN != "" && network.BuildVLAN != networkName(network) {
+				nic.Comment("Overseer builds hosts on %s and moves them here afterwards, which Terraform can't.", network.BuildVLAN)
+			}
+			nic.Set("network_id", "data.vsphere_network."+resourceName(networkName(network))+".id").
+				String("adapter_type", "vmxnet3")
+		}
+		for i, disk := range vs.Devices.Disks {
+			d := vm.Block("disk").
+				String("label", disk.DeviceName).
+				Int("size", disk.Size)
+			if i > 0 {
+				d.Int("unit_number", i)
+			}
+		}
+
+		var ipRef string
+		if useInfoblox {
+			fqdn := qualify(host, bspec.Infoblox.Zone)
+			ipRef = "infoblox_ip_allocation." + name + ".allocated_ipv4_addr"
+
+			file.Block("resource", "infoblox_ip_allocation", name).
+				String("fqdn", fqdn).
+				String("ipv4_cidr", bspec.Infoblox.Subnet).
+				Bool("enable_dns", false)
+			file.Block("resource", "infoblox_a_record", name).
+				String("fqdn", fqdn).
+				Set("ip_addr", ipRef)
+		}
+
+		fh := file.Block("resource", "foreman_host", name).
+			String("name", host).
+			String("method", "build")
+		if fs.Hostgroup != "" {
+			fh.Set("hostgroup_id", "data.foreman_hostgroup.hostgroup.id")
+		}
+		if fs.Environment != "" {
+			fh.Set("environment_id", "data.foreman_environment.environment.id")
+		}
+		ids := []struct {
+			name  string
+			value int
+		}{
+			{"domain_id", fs.DomainID},
+			{"operatingsystem_id", fs.OperatingSystemID},
+			{"architecture_id", fs.ArchitectureID},
+			{"ptable_id", fs.PartitionTableID},
+		}
+		for _, id := range ids {
+			if id.value != 0 {
+				fh.Int(id.name, id.value)
+			}
+		}
+		if fs.Medium != "" {
+			fh.Set("medium_id", "data.foreman_media.medium.id")
+		}
+		// vSphere powers the VM on; Foreman only has to build it
+		fh.Bool("set_build_flag", true).
+			Bool("manage_power_operations", false)
+
+		nic := fh.Block("interfaces_attributes").
+			String("type", "interface").
+			Bool("primary", true).
+			Bool("provision", true).
+			Bool("managed", true).
+			Set("mac", vmRef+".network_interface[0].mac_address")
+		if ipRef != "" {
+			nic.Set("ip", ipRef)
+		}
+	}
+
+	return file.Bytes(), nil
+}
+
+// check makes sure the buildspec says enough to be exported, and in a way
+// the Terraform providers can express.
+func check(bspec *buildspec.Spec, hosts []string) error {
+	if bspec.Compute != "" && bspec.Compute != "foreman" {
+		return fmt.Errorf("only hosts foreman builds in vSphere can be exported, but the buildspec has compute = %q", bspec.Compute)
+	}
+	if len(hosts) == 0 {
+		return fmt.Errorf("the hostspec doesn't have any hosts")
+	}
+
+	var errs error
+
+	vs := bspec.Vsphere
+	for _, required := range []struct{ key, value string }{
+		{"datacenter", vs.Datacenter},
+		{"cluster", vs.Cluster},
+		{"datastore", vs.Datastore},
+	} {
+		if required.value == "" {
+			errs = multierror.Append(errs, fmt.Errorf("the vsphere block needs a %s", required.key))
+		}
+	}
+	if vs.CPUs == 0 || vs.Memory == 0 {
+		errs = multierror.Append(errs, fmt.Errorf("the vsphere block needs cpus and memory"))
+	}
+	if len(vs.Devices.Networks) == 0 {
+		errs = multierror.Append(errs, fmt.Errorf("the vsphere block needs a network device for foreman to build the host over"))
+	}
+	for _, network := range vs.Devices.Networks {
+		if networkName(network) == "" {
+			errs = multierror.Append(errs, fmt.Errorf("network %q needs a vlan", network.DeviceName))
+		}
+	}
+	for _, scsi := range vs.Devices.SCSIs {
+		if _, ok := scsiTypes[scsi.Type]; !ok {
+			errs = multierror.Append(errs, fmt.Errorf("scsi %q: the vsphere provider doesn't support %q controllers", scsi.DeviceName, scsi.Type))
+		}
+		if scsi.Type != vs.Devices.SCSIs[0].Type {
+			errs = multierror.Append(errs, fmt.Errorf("scsi %q: the vsphere provider needs every controller to be the same type", scsi.DeviceName))
+		}
+	}
+
+	if bspec.DNS == "infoblox" || (bspec.DNS == "" && bspec.Infoblox != (buildspec.Infoblox{})) {
+		if bspec.Infoblox.Subnet == "" {
+			errs = multierror.Append(errs, fmt.Errorf("the infoblox block needs a subnet to allocate addresses from"))
+		}
+	} else if bspec.DNS != "" && bspec.DNS != "none" {
+		errs = multierror.Append(errs, fmt.Errorf("dns = %q can't be exported", bspec.DNS))
+	}
+
+	names := make(map[string]string)
+	for _, host := range hosts {
+		name := resourceName(host)
+		if other, ok := names[name]; ok {
+			errs = multierror.Append(errs, fmt.Errorf("%s and %s would both be named %s in terraform", other, host, name))
+		}
+		names[name] = host
+	}
+
+	return errs
+}
+
+// networkName is the port group the interface ends up on.
+func networkName(network *buildspec.Network) string {
+	if network.VLAN != "" {
+		return network.VLAN
+	}
+	return network.BuildVLAN
+}
+
+var invalidNameChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// resourceName turns a hostname or vSphere name into a Terraform name:
+// letters, digits, underscores and dashes, starting with a letter or an
+// underscore.
+func resourceName(s string) string {
+	name := invalidNameChars.ReplaceAllString(s, "_")
+	if name == "" || !(name[0] == '_' || (name[0] >= 'A' && name[0] <= 'Z') || (name[0] >= 'a' && name[0] <= 'z')) {
+		name = "_" + name
+	}
+	return name
+}
+
+// qualify adds the zone to hostnames that aren't fully qualified.
+func qualify(host, zone string) string {
+	if zone == "" || strings.Contains(host, ".") {
+		return host
+	}
+	return host + "." + zone
+}
+
+func defaultString(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
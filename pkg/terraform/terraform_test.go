@@ -0,0 +1,131 @@
+package terraform
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+)
+
+// completeSpec is the buildspec package's complete.hcl fixture, with a
+// second disk.
+func completeSpec(t *testing.T) *buildspec.Spec {
+	spec, err := buildspec.ParseFile(filepath.Join("..", "buildspec", "test-fixtures", "complete.hcl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec.Vsphere.Devices.Disks = append(spec.Vsphere.Devices.Disks, &buildspec.Disk{DeviceName: "Hard disk 2", DeviceType: "disk", Size: 100})
+	return spec
+}
+
+func TestRender(t *testing.T) {
+	expected, err := ioutil.ReadFile(filepath.Join("test-fixtures", "complete.tf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := Render(completeSpec(t), []string{"kafka01.qa.local", "kafka02"}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(actual, expected) {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	cases := []struct {
+		Name   string
+		Change func(*buildspec.Spec)
+		Hosts  []string
+		Err    string
+	}{
+		{
+			"libvirt",
+			func(s *buildspec.Spec) { s.Compute = "libvirt" },
+			[]string{"kafka01.qa.local"},
+			`compute = "libvirt"`,
+		},
+		{
+			"no hosts",
+			func(s *buildspec.Spec) {},
+			nil,
+			"doesn't have any hosts",
+		},
+		{
+			"no datastore",
+			func(s *buildspec.Spec) { s.Vsphere.Datastore = "" },
+			[]string{"kafka01.qa.local"},
+			"needs a datastore",
+		},
+		{
+			"no subnet",
+			func(s *buildspec.Spec) { s.Infoblox.Subnet = "" },
+			[]string{"kafka01.qa.local"},
+			"needs a subnet",
+		},
+		{
+			"buslogic",
+			func(s *buildspec.Spec) { s.Vsphere.Devices.SCSIs[0].Type = "buslogic" },
+			[]string{"kafka01.qa.local"},
+			`doesn't support "buslogic"`,
+		},
+		{
+			"same name",
+			func(s *buildspec.Spec) {},
+			[]string{"kafka01.qa.local", "kafka01_qa.local"},
+			"would both be named kafka01_qa_local",
+		},
+	}
+
+	for _, tc := range cases {
+		spec := completeSpec(t)
+		tc.Change(spec)
+
+		_, err := Render(spec, tc.Hosts, Options{})
+		if err == nil || !strings.Contains(err.Error(), tc.Err) {
+			t.Fatalf("%s: expected an error containing %q, got %v", tc.Name, tc.Err, err)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected string
+	}{
+		{"dv-build", `"dv-build"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`C:\temp`, `"C:\\temp"`},
+		{"${var.name}", `"$${var.name}"`},
+		{"%{if true}", `"%%{if true}"`},
+	}
+
+	for _, tc := range cases {
+		if actual := quote(tc.Input); actual != tc.Expected {
+			t.Fatalf("%q: bad: %s", tc.Input, actual)
+		}
+	}
+}
+
+func TestResourceName(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected string
+	}{
+		{"kafka01.qa.local", "kafka01_qa_local"},
+		{"dv-appservers", "dv-appservers"},
+		{"01.qa.local", "_01_qa_local"},
+		{"VM Network", "VM_Network"},
+	}
+
+	for _, tc := range cases {
+		if actual := resourceName(tc.Input); actual != tc.Expected {
+			t.Fatalf("%q: bad: %s", tc.Input, actual)
+		}
+	}
+}
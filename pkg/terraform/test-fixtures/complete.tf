@@ -0,0 +1,170 @@
+# Generated by "overseer export terraform" from the buildspec "indy.prod.kafka".
+# The foreman provider should be set up for location "location01" and organization "org01".
+# Configuring the hosts (config = "chef") isn't part of the export.
+
+terraform {
+  required_providers {
+    vsphere  = { source = "hashicorp/vsphere" }
+    foreman  = { source = "terraform-coop/foreman" }
+    infoblox = { source = "infobloxopen/infoblox" }
+  }
+}
+
+data "vsphere_datacenter" "datacenter" {
+  name = "dc01"
+}
+
+data "vsphere_compute_cluster" "cluster" {
+  name          = "cluster01"
+  datacenter_id = data.vsphere_datacenter.datacenter.id
+}
+
+data "vsphere_datastore" "datastore" {
+  name          = "ds01"
+  datacenter_id = data.vsphere_datacenter.datacenter.id
+}
+
+data "vsphere_network" "dv-appservers" {
+  name          = "dv-appservers"
+  datacenter_id = data.vsphere_datacenter.datacenter.id
+}
+
+data "foreman_hostgroup" "hostgroup" {
+  title = "hg01"
+}
+
+data "foreman_environment" "environment" {
+  name = "env01"
+}
+
+data "foreman_media" "medium" {
+  name = "centos-7"
+}
+
+resource "vsphere_virtual_machine" "kafka01_qa_local" {
+  name                       = "kafka01.qa.local"
+  resource_pool_id           = data.vsphere_compute_cluster.cluster.resource_pool_id
+  datastore_id               = data.vsphere_datastore.datastore.id
+  folder                     = "folder01"
+  num_cpus                   = 2
+  num_cores_per_socket       = 1
+  memory                     = 8096
+  guest_id                   = "otherLinux64Guest"
+  scsi_type                  = "pvscsi"
+  wait_for_guest_net_timeout = 0
+
+  network_interface {
+    # Overseer builds hosts on dv-build and moves them here afterwards, which Terraform can't.
+    network_id   = data.vsphere_network.dv-appservers.id
+    adapter_type = "vmxnet3"
+  }
+
+  disk {
+    label = "Hard disk 1"
+    size  = 40
+  }
+
+  disk {
+    label       = "Hard disk 2"
+    size        = 100
+    unit_number = 1
+  }
+}
+
+resource "infoblox_ip_allocation" "kafka01_qa_local" {
+  fqdn       = "kafka01.qa.local"
+  ipv4_cidr  = "192.168.1.0/24"
+  enable_dns = false
+}
+
+resource "infoblox_a_record" "kafka01_qa_local" {
+  fqdn    = "kafka01.qa.local"
+  ip_addr = infoblox_ip_allocation.kafka01_qa_local.allocated_ipv4_addr
+}
+
+resource "foreman_host" "kafka01_qa_local" {
+  name                    = "kafka01.qa.local"
+  method                  = "build"
+  hostgroup_id            = data.foreman_hostgroup.hostgroup.id
+  environment_id          = data.foreman_environment.environment.id
+  domain_id               = 6
+  operatingsystem_id      = 2
+  architecture_id         = 6
+  ptable_id               = 6
+  medium_id               = data.foreman_media.medium.id
+  set_build_flag          = true
+  manage_power_operations = false
+
+  interfaces_attributes {
+    type      = "interface"
+    primary   = true
+    provision = true
+    managed   = true
+    mac       = vsphere_virtual_machine.kafka01_qa_local.network_interface[0].mac_address
+    ip        = infoblox_ip_allocation.kafka01_qa_local.allocated_ipv4_addr
+  }
+}
+
+resource "vsphere_virtual_machine" "kafka02" {
+  name                       = "kafka02"
+  resource_pool_id           = data.vsphere_compute_cluster.cluster.resource_pool_id
+  datastore_id               = data.vsphere_datastore.datastore.id
+  folder                     = "folder01"
+  num_cpus                   = 2
+  num_cores_per_socket       = 1
+  memory                     = 8096
+  guest_id                   = "otherLinux64Guest"
+  scsi_type                  = "pvscsi"
+  wait_for_guest_net_timeout = 0
+
+  network_interface {
+    # Overseer builds hosts on dv-build and moves them here afterwards, which Terraform can't.
+    network_id   = data.vsphere_network.dv-appservers.id
+    adapter_type = "vmxnet3"
+  }
+
+  disk {
+    label = "Hard disk 1"
+    size  = 40
+  }
+
+  disk {
+    label       = "Hard disk 2"
+    size        = 100
+    unit_number = 1
+  }
+}
+
+resource "infoblox_ip_allocation" "kafka02" {
+  fqdn       = "kafka02.qa.local"
+  ipv4_cidr  = "192.168.1.0/24"
+  enable_dns = false
+}
+
+resource "infoblox_a_record" "kafka02" {
+  fqdn    = "kafka02.qa.local"
+  ip_addr = infoblox_ip_allocation.kafka02.allocated_ipv4_addr
+}
+
+resource "foreman_host" "kafka02" {
+  name                    = "kafka02"
+  method                  = "build"
+  hostgroup_id            = data.foreman_hostgroup.hostgroup.id
+  environment_id          = data.foreman_environment.environment.id
+  domain_id               = 6
+  operatingsystem_id      = 2
+  architecture_id         = 6
+  ptable_id               = 6
+  medium_id               = data.foreman_media.medium.id
+  set_build_flag          = true
+  manage_power_operations = false
+
+  interfaces_attributes {
+    type      = "interface"
+    primary   = true
+    provision = true
+    managed   = true
+    mac       = vsphere_virtual_machine.kafka02.network_interface[0].mac_address
+    ip        = infoblox_ip_allocation.kafka02.allocated_ipv4_addr
+  }
+}
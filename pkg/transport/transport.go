@@ -0,0 +1,108 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/util"
+)
+
+// New returns an http.Client that talks to the given endpoint using its
+// TLS, timeout and proxy settings.
+func New(endpoint configspec.Endpoint) (*http.Client, error) {
+	tlsConfig, err := TLSConfig(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, err := Proxy(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:           proxy,
+			TLSClientConfig: tlsConfig,
+		},
+		Timeout: time.Duration(endpoint.Timeout) * time.Second,
+	}, nil
+}
+
+// TLSConfig builds a tls.Config from the CA bundle, client certificate
+// and verification settings of the endpoint.
+func TLSConfig(endpoint configspec.Endpoint) (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: endpoint.InsecureSkipVerify,
+	}
+
+	if endpoint.CAFile != "" {
+		pool, err := CertPool(endpoint.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+
+	if endpoint.CertFile != "" {
+		certFile, err := util.ExpandPath(endpoint.CertFile)
+		if err != nil {
+			return nil, err
+		}
+
+		keyFile, err := util.ExpandPath(endpoint.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %s", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// CertPool reads a PEM encoded CA bundle into a new x509.CertPool.
+func CertPool(caFile string) (*x509.CertPool, error) {
+	path, err := util.ExpandPath(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CA bundle: %s", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+
+	return pool, nil
+}
+
+// Proxy returns the proxy function for the endpoint. Without an explicit
+// proxy we fall back to the usual HTTP_PROXY/HTTPS_PROXY environment
+// variables.
+func Proxy(endpoint configspec.Endpoint) (func(*http.Request) (*url.URL, error), error) {
+	if endpoint.Proxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	u, err := url.Parse(endpoint.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	return http.ProxyURL(u), nil
+}
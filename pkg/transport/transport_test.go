@@ -0,0 +1,79 @@
+package transport
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+)
+
+func TestNew(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "overseer-transport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, caPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		Name     string
+		Endpoint configspec.Endpoint
+		Err      bool
+	}{
+		{"no ca", configspec.Endpoint{URL: server.URL}, true},
+		{"ca file", configspec.Endpoint{URL: server.URL, CAFile: caFile}, false},
+		{"insecure", configspec.Endpoint{URL: server.URL, InsecureSkipVerify: true}, false},
+		{"timeout", configspec.Endpoint{URL: server.URL, CAFile: caFile, Timeout: 5}, false},
+	}
+
+	for _, tt := range cases {
+		client, err := New(tt.Endpoint)
+		if err != nil {
+			t.Fatalf("case: %s\n\n%s", tt.Name, err)
+		}
+
+		resp, err := client.Get(tt.Endpoint.URL)
+		if (err != nil) != tt.Err {
+			t.Fatalf("case: %s\n\n%s", tt.Name, err)
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+}
+
+func TestCertPool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overseer-transport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bogus := filepath.Join(dir, "bogus.pem")
+	if err := ioutil.WriteFile(bogus, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := CertPool(bogus); err == nil {
+		t.Fatalf("expected an error for a CA bundle without certificates")
+	}
+
+	if _, err := CertPool(filepath.Join(dir, "missing.pem")); err == nil {
+		t.Fatalf("expected an error for a missing CA bundle")
+	}
+}
@@ -7,7 +7,7 @@ import (
 )
 
 func ExpandPath(path string) (string, error) {
-	if path[:1] != "~" {
+	if !strings.HasPrefix(path, "~") {
 		return path, nil
 	}
 
@@ -0,0 +1,229 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/ssh"
+)
+
+const (
+	// DefaultTimeout is how long a check gets when the buildspec doesn't
+	// say.
+	DefaultTimeout = 10 * time.Second
+
+	// DefaultRetryInterval is how long to wait before trying failed
+	// checks again when the buildspec doesn't say.
+	DefaultRetryInterval = 10 * time.Second
+)
+
+// maxBody is how much of a response body http_get checks look at.
+const maxBody = 1 << 20
+
+// Result is how a check went on one host.
+type Result struct {
+	Check *buildspec.Check
+	// Detail is what the check saw when it passed, like the addresses a
+	// name resolved to.
+	Detail string
+	Err    error
+}
+
+// OK reports whether the check passed.
+func (r *Result) OK() bool {
+	return r.Err == nil
+}
+
+// Verifier runs a buildspec's verify checks against hosts.
+type Verifier struct {
+	// Exec runs a command on a host for command checks.
+	Exec func(host, cmd string) *ssh.Result
+	// LookupHost resolves a name for dns_resolves checks.
+	LookupHost func(ctx context.Context, host string) ([]string, error)
+	// RetryInterval is how long to wait before trying failed checks again.
+	RetryInterval time.Duration
+
+	spec buildspec.Verify
+}
+
+// New returns a Verifier for the buildspec's verify block that runs
+// command checks over SSH with the configspec's settings.
+func New(spec buildspec.Verify, sshConfig configspec.SSH) *Verifier {
+	executor := &ssh.Executor{Config: sshConfig}
+
+	v := &Verifier{
+		Exec: func(host, cmd string) *ssh.Result {
+			return executor.Run([]string{host}, cmd)[0]
+		},
+		LookupHost:    net.DefaultResolver.LookupHost,
+		RetryInterval: DefaultRetryInterval,
+		spec:          spec,
+	}
+	if spec.RetryInterval > 0 {
+		v.RetryInterval = time.Duration(spec.RetryInterval) * time.Second
+	}
+
+	return v
+}
+
+// Verify runs every check against the host and returns a Result for each,
+// in the order they're in the buildspec. Checks that fail are tried again
+// as many times as the buildspec's retries allows, since services often
+// take a little while to come up after chef-client has started them.
+func (v *Verifier) Verify(host string) []*Result {
+	results := make([]*Result, len(v.spec.Checks))
+
+	for attempt := 0; ; attempt++ {
+		failed := false
+		for i, check := range v.spec.Checks {
+			if results[i] != nil && results[i].OK() {
+				continue
+			}
+
+			results[i] = v.check(host, check)
+			if !results[i].OK() {
+				failed = true
+			}
+		}
+
+		if !failed || attempt >= v.spec.Retries {
+			return results
+		}
+
+		time.Sleep(v.RetryInterval)
+	}
+}
+
+func (v *Verifier) check(host string, check *buildspec.Check) *Result {
+	target := host
+	if check.Host != "" {
+		target = check.Host
+	}
+
+	timeout := DefaultTimeout
+	if check.Timeout > 0 {
+		timeout = time.Duration(check.Timeout) * time.Second
+	}
+
+	result := &Result{Check: check}
+	switch check.Type {
+	case buildspec.CheckTCPPort:
+		result.Err = checkTCPPort(target, check.Port, timeout)
+	case buildspec.CheckHTTPGet:
+		result.Detail, result.Err = checkHTTPGet(target, check, timeout)
+	case buildspec.CheckCommand:
+		result.Detail, result.Err = v.checkCommand(host, check, timeout)
+	case buildspec.CheckDNSResolves:
+		result.Detail, result.Err = v.checkDNSResolves(target, check.Address, timeout)
+	default:
+		result.Err = fmt.Errorf("unknown check type %q", check.Type)
+	}
+
+	return result
+}
+
+func checkTCPPort(host string, port int, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func checkHTTPGet(host string, check *buildspec.Check, timeout time.Duration) (string, error) {
+	addr := host
+	if check.Port != 0 {
+		addr = net.JoinHostPort(host, strconv.Itoa(check.Port))
+	}
+	url := fmt.Sprintf("%s://%s%s", check.Scheme, addr, check.Path)
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != check.Status {
+		return "", fmt.Errorf("GET %s returned %d, expected %d", url, resp.StatusCode, check.Status)
+	}
+
+	if check.Body != "" {
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBody))
+		if err != nil {
+			return "", fmt.Errorf("unable to read response from %s: %s", url, err)
+		}
+
+		if !regexp.MustCompile(check.Body).Match(body) {
+			return "", fmt.Errorf("response from %s doesn't match %q", url, check.Body)
+		}
+	}
+
+	return fmt.Sprintf("%d", resp.StatusCode), nil
+}
+
+func (v *Verifier) checkCommand(host string, check *buildspec.Check, timeout time.Duration) (string, error) {
+	// The SSH session can't be interrupted, so a command that hangs is
+	// left to finish on its own
+	resultCh := make(chan *ssh.Result, 1)
+	go func() { resultCh <- v.Exec(host, check.Command) }()
+
+	var result *ssh.Result
+	select {
+	case result = <-resultCh:
+	case <-time.After(timeout):
+		return "", fmt.Errorf("%q didn't finish within %s", check.Command, timeout)
+	}
+
+	if result.Err != nil {
+		return "", result.Err
+	}
+
+	output := string(result.Stdout) + string(result.Stderr)
+	if result.ExitStatus != check.ExitCode {
+		return "", fmt.Errorf("%q exited %d, expected %d: %s", check.Command, result.ExitStatus, check.ExitCode, strings.TrimSpace(output))
+	}
+
+	// ^ and $ match at line boundaries, so "^active$" matches the one line
+	// systemctl prints
+	if check.Output != "" && !regexp.MustCompile("(?m)"+check.Output).MatchString(output) {
+		return "", fmt.Errorf("output of %q doesn't match %q: %s", check.Command, check.Output, strings.TrimSpace(output))
+	}
+
+	return fmt.Sprintf("exit %d", result.ExitStatus), nil
+}
+
+func (v *Verifier) checkDNSResolves(name, address string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	addrs, err := v.LookupHost(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	if address != "" {
+		found := false
+		for _, addr := range addrs {
+			if addr == address {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("%s resolves to %s, not %s", name, strings.Join(addrs, ", "), address)
+		}
+	}
+
+	return strings.Join(addrs, ", "), nil
+}
@@ -0,0 +1,144 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/ssh"
+)
+
+// closedPort returns a port nothing is listening on.
+func closedPort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	return port
+}
+
+func TestVerify(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	openPort := listener.Addr().(*net.TCPAddr).Port
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"status":"green"}`)
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	httpPort, _ := strconv.Atoi(u.Port())
+
+	v := &Verifier{
+		Exec: func(host, cmd string) *ssh.Result {
+			switch cmd {
+			case "systemctl is-active kafka":
+				return &ssh.Result{Host: host, Stdout: []byte("active\n")}
+			case "systemctl is-active zookeeper":
+				return &ssh.Result{Host: host, ExitStatus: 3, Stdout: []byte("inactive\n")}
+			}
+			return &ssh.Result{Host: host, ExitStatus: -1, Err: fmt.Errorf("unable to connect")}
+		},
+		LookupHost: func(ctx context.Context, host string) ([]string, error) {
+			if host == "127.0.0.1" {
+				return []string{"127.0.0.1"}, nil
+			}
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		},
+	}
+
+	cases := []struct {
+		Check    buildspec.Check
+		Expected bool
+	}{
+		{buildspec.Check{Type: buildspec.CheckTCPPort, Port: openPort}, true},
+		{buildspec.Check{Type: buildspec.CheckTCPPort, Port: closedPort(t)}, false},
+		{buildspec.Check{Type: buildspec.CheckHTTPGet, Scheme: "http", Port: httpPort, Path: "/health", Status: 200}, true},
+		{buildspec.Check{Type: buildspec.CheckHTTPGet, Scheme: "http", Port: httpPort, Path: "/health", Status: 200, Body: `"status":"green"`}, true},
+		{buildspec.Check{Type: buildspec.CheckHTTPGet, Scheme: "http", Port: httpPort, Path: "/health", Status: 200, Body: `"status":"red"`}, false},
+		{buildspec.Check{Type: buildspec.CheckHTTPGet, Scheme: "http", Port: httpPort, Path: "/", Status: 200}, false},
+		{buildspec.Check{Type: buildspec.CheckCommand, Command: "systemctl is-active kafka"}, true},
+		{buildspec.Check{Type: buildspec.CheckCommand, Command: "systemctl is-active kafka", Output: "^active$"}, true},
+		{buildspec.Check{Type: buildspec.CheckCommand, Command: "systemctl is-active kafka", Output: "^inactive"}, false},
+		{buildspec.Check{Type: buildspec.CheckCommand, Command: "systemctl is-active zookeeper"}, false},
+		{buildspec.Check{Type: buildspec.CheckCommand, Command: "systemctl is-active zookeeper", ExitCode: 3}, true},
+		{buildspec.Check{Type: buildspec.CheckCommand, Command: "hostname"}, false},
+		{buildspec.Check{Type: buildspec.CheckDNSResolves}, true},
+		{buildspec.Check{Type: buildspec.CheckDNSResolves, Address: "127.0.0.1"}, true},
+		{buildspec.Check{Type: buildspec.CheckDNSResolves, Address: "10.0.0.10"}, false},
+		{buildspec.Check{Type: buildspec.CheckDNSResolves, Host: "kafka.qa.local"}, false},
+	}
+
+	for _, tt := range cases {
+		check := tt.Check
+		v.spec = buildspec.Verify{Checks: []*buildspec.Check{&check}}
+
+		results := v.Verify("127.0.0.1")
+		if len(results) != 1 {
+			t.Fatalf("%#v\n\n%d results", tt.Check, len(results))
+		}
+		if results[0].OK() != tt.Expected {
+			t.Fatalf("%#v\n\nok = %v, expected %v: %v", tt.Check, results[0].OK(), tt.Expected, results[0].Err)
+		}
+	}
+}
+
+func TestVerifyRetries(t *testing.T) {
+	runs := map[string]int{}
+	v := &Verifier{
+		Exec: func(host, cmd string) *ssh.Result {
+			runs[cmd]++
+			// kafka takes a couple of tries to come up
+			if cmd == "systemctl is-active kafka" && runs[cmd] < 3 {
+				return &ssh.Result{Host: host, ExitStatus: 3}
+			}
+			return &ssh.Result{Host: host}
+		},
+		spec: buildspec.Verify{
+			Retries: 5,
+			Checks: []*buildspec.Check{
+				{Name: "ntp", Type: buildspec.CheckCommand, Command: "systemctl is-active ntpd"},
+				{Name: "kafka", Type: buildspec.CheckCommand, Command: "systemctl is-active kafka"},
+			},
+		},
+	}
+
+	results := v.Verify("kafka01.qa.local")
+	for _, result := range results {
+		if !result.OK() {
+			t.Fatalf("%s: %s", result.Check.Name, result.Err)
+		}
+	}
+
+	// Checks that passed aren't run again
+	if runs["systemctl is-active ntpd"] != 1 || runs["systemctl is-active kafka"] != 3 {
+		t.Fatalf("%#v", runs)
+	}
+
+	// Out of retries
+	runs = map[string]int{}
+	v.spec.Retries = 1
+	results = v.Verify("kafka01.qa.local")
+	if results[1].OK() {
+		t.Fatalf("kafka should have failed after %d tries", runs["systemctl is-active kafka"])
+	}
+	if runs["systemctl is-active kafka"] != 2 {
+		t.Fatalf("%#v", runs)
+	}
+}
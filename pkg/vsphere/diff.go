@@ -0,0 +1,91 @@
+package vsphere
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+)
+
+// Diff returns the ways the VM's hardware doesn't match the buildspec's
+// vsphere block. Devices are matched up by name, and devices the VM has
+// that the buildspec doesn't are reported too.
+func (vm *VM) Diff(spec buildspec.Vsphere) []drift.Difference {
+	var diffs []drift.Difference
+
+	number := func(field string, have, want int) {
+		if want != 0 && have != want {
+			diffs = append(diffs, drift.Difference{Field: field, Have: strconv.Itoa(have), Want: strconv.Itoa(want)})
+		}
+	}
+	number("cpus", vm.CPUs, spec.CPUs)
+	number("cores", vm.CoresPerSocket, spec.Cores)
+	number("memory", vm.MemoryMB, spec.Memory)
+
+	disks := make(map[string]*Disk)
+	for _, disk := range vm.Disks {
+		disks[disk.Label] = disk
+	}
+	for _, want := range spec.Devices.Disks {
+		field := fmt.Sprintf("disk %q", want.DeviceName)
+		have, ok := disks[want.DeviceName]
+		delete(disks, want.DeviceName)
+
+		switch {
+		case !ok:
+			diffs = append(diffs, drift.Missing(field, gb(want.Size)))
+		case have.SizeGB != want.Size:
+			diffs = append(diffs, drift.Difference{Field: field, Have: gb(have.SizeGB), Want: gb(want.Size)})
+		}
+	}
+	for _, disk := range vm.Disks {
+		if _, ok := disks[disk.Label]; ok {
+			diffs = append(diffs, drift.Difference{Field: fmt.Sprintf("disk %q", disk.Label), Have: gb(disk.SizeGB), Want: "absent"})
+		}
+	}
+
+	networks := make(map[string]*Network)
+	for _, network := range vm.Networks {
+		networks[network.Label] = network
+	}
+	for _, want := range spec.Devices.Networks {
+		field := fmt.Sprintf("network %q", want.DeviceName)
+		have, ok := networks[want.DeviceName]
+		delete(networks, want.DeviceName)
+
+		switch {
+		case !ok:
+			diffs = append(diffs, drift.Missing(field, want.VLAN))
+		case have.Network != "" && want.VLAN != "" && have.Network != want.VLAN:
+			diffs = append(diffs, drift.Difference{Field: field, Have: have.Network, Want: want.VLAN})
+		}
+	}
+	for _, network := range vm.Networks {
+		if _, ok := networks[network.Label]; ok {
+			diffs = append(diffs, drift.Difference{Field: fmt.Sprintf("network %q", network.Label), Have: network.Network, Want: "absent"})
+		}
+	}
+
+	scsis := make(map[string]*SCSI)
+	for _, scsi := range vm.SCSIs {
+		scsis[scsi.Label] = scsi
+	}
+	for _, want := range spec.Devices.SCSIs {
+		field := fmt.Sprintf("scsi %q", want.DeviceName)
+		have, ok := scsis[want.DeviceName]
+
+		switch {
+		case !ok:
+			diffs = append(diffs, drift.Missing(field, want.Type))
+		case have.Type != "" && want.Type != "" && have.Type != want.Type:
+			diffs = append(diffs, drift.Difference{Field: field, Have: have.Type, Want: want.Type})
+		}
+	}
+
+	return diffs
+}
+
+func gb(size int) string {
+	return fmt.Sprintf("%dGB", size)
+}
@@ -0,0 +1,90 @@
+package vsphere
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+)
+
+func TestDiff(t *testing.T) {
+	vm := &VM{
+		CPUs:           2,
+		CoresPerSocket: 1,
+		MemoryMB:       8192,
+		Disks: []*Disk{
+			{Label: "Hard disk 1", SizeGB: 40},
+			{Label: "Hard disk 2", SizeGB: 100},
+		},
+		Networks: []*Network{
+			{Label: "Network adapter 1", Network: "dv-appservers"},
+		},
+		SCSIs: []*SCSI{
+			{Label: "SCSI controller 0", Type: "paravirtual"},
+		},
+	}
+
+	cases := []struct {
+		Spec     buildspec.Vsphere
+		Expected []drift.Difference
+	}{
+		{
+			buildspec.Vsphere{
+				CPUs:   2,
+				Memory: 8192,
+				Devices: buildspec.Devices{
+					Disks: []*buildspec.Disk{
+						{DeviceName: "Hard disk 1", Size: 40},
+						{DeviceName: "Hard disk 2", Size: 100},
+					},
+					Networks: []*buildspec.Network{
+						{DeviceName: "Network adapter 1", VLAN: "dv-appservers"},
+					},
+					SCSIs: []*buildspec.SCSI{
+						{DeviceName: "SCSI controller 0", Type: "paravirtual"},
+					},
+				},
+			},
+			nil,
+		},
+		{
+			buildspec.Vsphere{
+				CPUs:   4,
+				Cores:  2,
+				Memory: 16384,
+				Devices: buildspec.Devices{
+					Disks: []*buildspec.Disk{
+						{DeviceName: "Hard disk 1", Size: 60},
+						{DeviceName: "Hard disk 3", Size: 200},
+					},
+					Networks: []*buildspec.Network{
+						{DeviceName: "Network adapter 1", VLAN: "dv-kafka"},
+						{DeviceName: "Network adapter 2", VLAN: "dv-backup"},
+					},
+					SCSIs: []*buildspec.SCSI{
+						{DeviceName: "SCSI controller 0", Type: "lsilogic"},
+					},
+				},
+			},
+			[]drift.Difference{
+				{Field: "cpus", Have: "2", Want: "4"},
+				{Field: "cores", Have: "1", Want: "2"},
+				{Field: "memory", Have: "8192", Want: "16384"},
+				{Field: `disk "Hard disk 1"`, Have: "40GB", Want: "60GB"},
+				{Field: `disk "Hard disk 3"`, Have: "missing", Want: "200GB"},
+				{Field: `disk "Hard disk 2"`, Have: "100GB", Want: "absent"},
+				{Field: `network "Network adapter 1"`, Have: "dv-appservers", Want: "dv-kafka"},
+				{Field: `network "Network adapter 2"`, Have: "missing", Want: "dv-backup"},
+				{Field: `scsi "SCSI controller 0"`, Have: "paravirtual", Want: "lsilogic"},
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		actual := vm.Diff(tt.Spec)
+		if !reflect.DeepEqual(actual, tt.Expected) {
+			t.Fatalf("%#v\n\n%#v", actual, tt.Expected)
+		}
+	}
+}
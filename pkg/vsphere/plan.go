@@ -0,0 +1,271 @@
+package vsphere
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+)
+
+// ShutdownTimeout is how long a guest gets to shut down before a
+// power-off change is given up on.
+var ShutdownTimeout = 10 * time.Minute
+
+// Change is one change to bring a VM in line with its buildspec.
+type Change struct {
+	Description string
+	// PowerOff says the VM has to be shut down for the change to be made.
+	PowerOff bool
+
+	// args is the govc command that makes the change.
+	args []string
+}
+
+func (c *Change) String() string {
+	if c.PowerOff {
+		return c.Description + " (needs power off)"
+	}
+	return c.Description
+}
+
+// Plan is what it takes to make a VM match its buildspec.
+type Plan struct {
+	VM      string
+	Changes []*Change
+	// Unsupported are differences overseer won't make itself, like
+	// shrinking a disk, and have to be dealt with by hand.
+	Unsupported []string
+}
+
+// Empty reports whether there's nothing to change.
+func (p *Plan) Empty() bool {
+	return len(p.Changes) == 0 && len(p.Unsupported) == 0
+}
+
+// Hot returns the changes that can be made with the VM running.
+func (p *Plan) Hot() []*Change {
+	var changes []*Change
+	for _, change := range p.Changes {
+		if !change.PowerOff {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// Cold returns the changes that need the VM shut down.
+func (p *Plan) Cold() []*Change {
+	var changes []*Change
+	for _, change := range p.Changes {
+		if change.PowerOff {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+func (p *Plan) String() string {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "%s:\n", p.VM)
+	if p.Empty() {
+		buf.WriteString("  no changes\n")
+	}
+	for _, change := range p.Changes {
+		fmt.Fprintf(&buf, "  ~ %s\n", change)
+	}
+	for _, problem := range p.Unsupported {
+		fmt.Fprintf(&buf, "  ! %s\n", problem)
+	}
+
+	return buf.String()
+}
+
+// scsiAddTypes maps the controller types buildspecs use to govc's
+// device.scsi.add types.
+var scsiAddTypes = map[string]string{
+	"paravirtual":  "pvscsi",
+	"lsilogic":     "lsilogic",
+	"lsilogic-sas": "lsilogic-sas",
+	"buslogic":     "buslogic",
+}
+
+// NewPlan works out the changes that bring the VM in line with the
+// buildspec's vsphere block. CPUs and memory can only grow without a
+// power off if the VM has hot-add enabled for them; disks only grow and
+// devices are only added, never removed.
+func NewPlan(vm *VM, spec buildspec.Vsphere) *Plan {
+	plan := &Plan{VM: vm.Name}
+
+	add := func(powerOff bool, description string, args ...string) {
+		plan.Changes = append(plan.Changes, &Change{
+			Description: description,
+			// A VM that's already off doesn't need shutting down
+			PowerOff: powerOff && vm.PoweredOn,
+			args:     args,
+		})
+	}
+
+	if spec.CPUs != 0 && spec.CPUs != vm.CPUs {
+		hot := spec.CPUs > vm.CPUs && vm.CPUHotAdd
+		add(!hot, fmt.Sprintf("cpus %d -> %d", vm.CPUs, spec.CPUs),
+			"vm.change", "-vm", vm.Name, "-c", strconv.Itoa(spec.CPUs))
+	}
+	if spec.Cores != 0 && spec.Cores != vm.CoresPerSocket {
+		add(true, fmt.Sprintf("cores %d -> %d", vm.CoresPerSocket, spec.Cores),
+			"vm.change", "-vm", vm.Name, "-e", "cpuid.coresPerSocket="+strconv.Itoa(spec.Cores))
+	}
+	if spec.Memory != 0 && spec.Memory != vm.MemoryMB {
+		hot := spec.Memory > vm.MemoryMB && vm.MemoryHotAdd
+		add(!hot, fmt.Sprintf("memory %dMB -> %dMB", vm.MemoryMB, spec.Memory),
+			"vm.change", "-vm", vm.Name, "-m", strconv.Itoa(spec.Memory))
+	}
+
+	disks := make(map[string]*Disk)
+	for _, disk := range vm.Disks {
+		disks[disk.Label] = disk
+	}
+	for _, want := range spec.Devices.Disks {
+		have, ok := disks[want.DeviceName]
+		delete(disks, want.DeviceName)
+
+		switch {
+		case !ok:
+			args := []string{"vm.disk.create", "-vm", vm.Name,
+				"-name", vm.Name + "/" + strings.ToLower(strings.Replace(want.DeviceName, " ", "-", -1)),
+				"-size", fmt.Sprintf("%dG", want.Size)}
+			if spec.Datastore != "" {
+				args = append(args, "-ds", spec.Datastore)
+			}
+			add(false, fmt.Sprintf("add disk %q of %s", want.DeviceName, gb(want.Size)), args...)
+		case want.Size > have.SizeGB:
+			add(false, fmt.Sprintf("grow disk %q %s -> %s", want.DeviceName, gb(have.SizeGB), gb(want.Size)),
+				"vm.disk.change", "-vm", vm.Name, "-disk.label", want.DeviceName, "-size", fmt.Sprintf("%dG", want.Size))
+		case want.Size < have.SizeGB:
+			plan.Unsupported = append(plan.Unsupported,
+				fmt.Sprintf("disk %q is %s but the buildspec says %s: disks can't be shrunk", want.DeviceName, gb(have.SizeGB), gb(want.Size)))
+		}
+	}
+	for _, disk := range vm.Disks {
+		if _, ok := disks[disk.Label]; ok {
+			plan.Unsupported = append(plan.Unsupported,
+				fmt.Sprintf("disk %q isn't in the buildspec: remove it by hand if it should go", disk.Label))
+		}
+	}
+
+	networks := make(map[string]int)
+	for i, network := range vm.Networks {
+		networks[network.Label] = i
+	}
+	for _, want := range spec.Devices.Networks {
+		i, ok := networks[want.DeviceName]
+		delete(networks, want.DeviceName)
+
+		switch {
+		case !ok:
+			add(false, fmt.Sprintf("add network %q on %s", want.DeviceName, want.VLAN),
+				"vm.network.add", "-vm", vm.Name, "-net", want.VLAN, "-net.adapter", "vmxnet3")
+		case vm.Networks[i].Network != "" && want.VLAN != "" && vm.Networks[i].Network != want.VLAN:
+			// govc names adapters by their position on the VM
+			add(false, fmt.Sprintf("move network %q %s -> %s", want.DeviceName, vm.Networks[i].Network, want.VLAN),
+				"vm.network.change", "-vm", vm.Name, "-net", want.VLAN, fmt.Sprintf("ethernet-%d", i))
+		}
+	}
+	for _, network := range vm.Networks {
+		if _, ok := networks[network.Label]; ok {
+			plan.Unsupported = append(plan.Unsupported,
+				fmt.Sprintf("network %q isn't in the buildspec: remove it by hand if it should go", network.Label))
+		}
+	}
+
+	scsis := make(map[string]*SCSI)
+	for _, scsi := range vm.SCSIs {
+		scsis[scsi.Label] = scsi
+	}
+	for _, want := range spec.Devices.SCSIs {
+		have, ok := scsis[want.DeviceName]
+
+		switch {
+		case !ok:
+			args := []string{"device.scsi.add", "-vm", vm.Name}
+			if t, ok := scsiAddTypes[want.Type]; ok {
+				args = append(args, "-type", t)
+			}
+			add(false, fmt.Sprintf("add scsi %q", want.DeviceName), args...)
+		case have.Type != "" && want.Type != "" && have.Type != want.Type:
+			// The guest needs the new controller's driver before it's
+			// switched over, or it won't find its root disk
+			plan.Unsupported = append(plan.Unsupported,
+				fmt.Sprintf("scsi %q is %s but the buildspec says %s: change controller types by hand", want.DeviceName, have.Type, want.Type))
+		}
+	}
+
+	return plan
+}
+
+// ApplyHot makes the plan's changes that don't need the VM shut down.
+func (g *Govc) ApplyHot(plan *Plan) error {
+	for _, change := range plan.Hot() {
+		if _, err := g.run(g.env(), change.args...); err != nil {
+			return fmt.Errorf("unable to %s: %s", change.Description, err)
+		}
+	}
+	return nil
+}
+
+// ApplyCold shuts the guest down, makes the plan's changes that need it
+// off and powers it back on.
+func (g *Govc) ApplyCold(plan *Plan) error {
+	changes := plan.Cold()
+	if len(changes) == 0 {
+		return nil
+	}
+
+	if _, err := g.run(g.env(), "vm.power", "-s", plan.VM); err != nil {
+		return fmt.Errorf("unable to shut down %s: %s", plan.VM, err)
+	}
+	if err := g.waitPoweredOff(plan.VM); err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		if _, err := g.run(g.env(), change.args...); err != nil {
+			// Don't leave the VM off because one change failed
+			g.run(g.env(), "vm.power", "-on", plan.VM)
+			return fmt.Errorf("unable to %s: %s", change.Description, err)
+		}
+	}
+
+	if _, err := g.run(g.env(), "vm.power", "-on", plan.VM); err != nil {
+		return fmt.Errorf("unable to power on %s: %s", plan.VM, err)
+	}
+	return nil
+}
+
+func (g *Govc) waitPoweredOff(name string) error {
+	interval := g.PollInterval
+	if interval == 0 {
+		interval = 10 * time.Second
+	}
+
+	deadline := time.Now().Add(ShutdownTimeout)
+	for {
+		vm, err := g.VM(name)
+		if err != nil {
+			return err
+		}
+		if vm == nil {
+			return fmt.Errorf("%s disappeared while shutting down", name)
+		}
+		if !vm.PoweredOn {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s didn't shut down within %s", name, ShutdownTimeout)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,187 @@
+package vsphere
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+)
+
+func TestNewPlan(t *testing.T) {
+	vm := &VM{
+		Name:           "hello.qa.local",
+		PoweredOn:      true,
+		CPUs:           2,
+		CoresPerSocket: 1,
+		MemoryMB:       8192,
+		CPUHotAdd:      true,
+		Disks: []*Disk{
+			{Label: "Hard disk 1", SizeGB: 40},
+			{Label: "Hard disk 2", SizeGB: 100},
+		},
+		Networks: []*Network{
+			{Label: "Network adapter 1", Network: "dv-appservers"},
+		},
+		SCSIs: []*SCSI{
+			{Label: "SCSI controller 0", Type: "paravirtual"},
+		},
+	}
+
+	devices := buildspec.Devices{
+		Disks: []*buildspec.Disk{
+			{DeviceName: "Hard disk 1", Size: 40},
+			{DeviceName: "Hard disk 2", Size: 100},
+		},
+		Networks: []*buildspec.Network{
+			{DeviceName: "Network adapter 1", VLAN: "dv-appservers"},
+		},
+		SCSIs: []*buildspec.SCSI{
+			{DeviceName: "SCSI controller 0", Type: "paravirtual"},
+		},
+	}
+
+	cases := []struct {
+		Spec        buildspec.Vsphere
+		Expected    []string
+		Unsupported int
+	}{
+		{
+			buildspec.Vsphere{CPUs: 2, Memory: 8192, Devices: devices},
+			nil,
+			0,
+		},
+		{
+			// CPUs hot-add, memory doesn't on this VM
+			buildspec.Vsphere{CPUs: 4, Cores: 2, Memory: 16384, Devices: devices},
+			[]string{
+				"vm.change -vm hello.qa.local -c 4",
+				"vm.change -vm hello.qa.local -e cpuid.coresPerSocket=2 (needs power off)",
+				"vm.change -vm hello.qa.local -m 16384 (needs power off)",
+			},
+			0,
+		},
+		{
+			// Taking CPUs away always needs a power off
+			buildspec.Vsphere{CPUs: 1, Devices: devices},
+			[]string{"vm.change -vm hello.qa.local -c 1 (needs power off)"},
+			0,
+		},
+		{
+			buildspec.Vsphere{
+				Datastore: "ds01",
+				Devices: buildspec.Devices{
+					Disks: []*buildspec.Disk{
+						{DeviceName: "Hard disk 1", Size: 40},
+						{DeviceName: "Hard disk 2", Size: 200},
+						{DeviceName: "Hard disk 3", Size: 50},
+					},
+					Networks: []*buildspec.Network{
+						{DeviceName: "Network adapter 1", VLAN: "dv-dmz"},
+						{DeviceName: "Network adapter 2", VLAN: "dv-backup"},
+					},
+					SCSIs: devices.SCSIs,
+				},
+			},
+			[]string{
+				"vm.disk.change -vm hello.qa.local -disk.label Hard disk 2 -size 200G",
+				"vm.disk.create -vm hello.qa.local -name hello.qa.local/hard-disk-3 -size 50G -ds ds01",
+				"vm.network.change -vm hello.qa.local -net dv-dmz ethernet-0",
+				"vm.network.add -vm hello.qa.local -net dv-backup -net.adapter vmxnet3",
+			},
+			0,
+		},
+		{
+			// Shrinking, removing and changing controller types are left
+			// to a person
+			buildspec.Vsphere{
+				Devices: buildspec.Devices{
+					Disks: []*buildspec.Disk{
+						{DeviceName: "Hard disk 1", Size: 20},
+					},
+					Networks: devices.Networks,
+					SCSIs: []*buildspec.SCSI{
+						{DeviceName: "SCSI controller 0", Type: "lsilogic"},
+						{DeviceName: "SCSI controller 1", Type: "paravirtual"},
+					},
+				},
+			},
+			[]string{"device.scsi.add -vm hello.qa.local -type pvscsi"},
+			3,
+		},
+	}
+
+	for _, tt := range cases {
+		plan := NewPlan(vm, tt.Spec)
+
+		var actual []string
+		for _, change := range plan.Changes {
+			command := strings.Join(change.args, " ")
+			if change.PowerOff {
+				command += " (needs power off)"
+			}
+			actual = append(actual, command)
+		}
+
+		if !reflect.DeepEqual(actual, tt.Expected) {
+			t.Fatalf("%#v\n\n%#v\n\n%#v", tt.Spec, actual, tt.Expected)
+		}
+		if len(plan.Unsupported) != tt.Unsupported {
+			t.Fatalf("%#v\n\n%#v", tt.Spec, plan.Unsupported)
+		}
+	}
+
+	// Nothing needs a power off on a VM that's already off
+	off := *vm
+	off.PoweredOn = false
+	plan := NewPlan(&off, buildspec.Vsphere{Cores: 2, Memory: 16384})
+	if len(plan.Cold()) != 0 || len(plan.Hot()) != 2 {
+		t.Fatalf("%s", plan)
+	}
+}
+
+func TestApplyCold(t *testing.T) {
+	g, commands := fakeGovc(t)
+
+	// The fixture's VM is always on, so answer vm.info ourselves once
+	// it's been told to shut down
+	run := g.run
+	poweredOn := true
+	g.run = func(env []string, args ...string) ([]byte, error) {
+		out, err := run(env, args...)
+		switch {
+		case args[0] == "vm.power" && args[1] == "-s":
+			poweredOn = false
+		case args[0] == "vm.power" && args[1] == "-on":
+			poweredOn = true
+		case args[0] == "vm.info" && !poweredOn:
+			out = []byte(strings.Replace(string(out), "poweredOn", "poweredOff", 1))
+		}
+		return out, err
+	}
+
+	vm, err := g.VM("hello.qa.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan := NewPlan(vm, buildspec.Vsphere{CPUs: 4, Memory: 16384})
+	if err := g.ApplyHot(plan); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.ApplyCold(plan); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"vm.info -json hello.qa.local",
+		"vm.change -vm hello.qa.local -c 4",
+		"vm.power -s hello.qa.local",
+		"vm.info -json hello.qa.local",
+		"vm.change -vm hello.qa.local -m 16384",
+		"vm.power -on hello.qa.local",
+	}
+	if !reflect.DeepEqual(*commands, expected) {
+		t.Fatalf("%#v\n\n%#v", *commands, expected)
+	}
+}
@@ -0,0 +1,97 @@
+package vsphere
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+)
+
+// Reclone replaces the VM with a fresh clone of template, keeping its name
+// and the MAC addresses of its network adapters so its DHCP reservations
+// and DNS records still point at it. The clone gets the buildspec's
+// hardware and the guestinfo properties, such as a cloud-init seed, before
+// it's powered on.
+func (g *Govc) Reclone(vm *VM, template string, spec buildspec.Vsphere, guestinfo map[string]string) error {
+	if vm.PoweredOn {
+		if _, err := g.run(g.env(), "vm.power", "-off", "-force", vm.Name); err != nil {
+			return fmt.Errorf("unable to power off %s: %s", vm.Name, err)
+		}
+	}
+
+	if _, err := g.run(g.env(), "vm.destroy", vm.Name); err != nil {
+		return fmt.Errorf("unable to destroy %s: %s", vm.Name, err)
+	}
+
+	args := []string{"vm.clone", "-vm", template, "-on=false"}
+	if spec.Datastore != "" {
+		args = append(args, "-ds", spec.Datastore)
+	}
+	if spec.Folder != "" {
+		args = append(args, "-folder", spec.Folder)
+	}
+	if spec.Cluster != "" {
+		args = append(args, "-pool", spec.Cluster+"/Resources")
+	}
+	args = append(args, vm.Name)
+
+	if _, err := g.run(g.env(), args...); err != nil {
+		return fmt.Errorf("unable to clone %s from %s: %s", vm.Name, template, err)
+	}
+
+	clone, err := g.VM(vm.Name)
+	if err != nil {
+		return err
+	}
+	if clone == nil {
+		return fmt.Errorf("%s wasn't there after cloning it from %s", vm.Name, template)
+	}
+
+	// The clone is off, so every change can be made now
+	if err := g.ApplyHot(NewPlan(clone, spec)); err != nil {
+		return err
+	}
+
+	clone, err = g.VM(vm.Name)
+	if err != nil {
+		return err
+	}
+
+	for i, network := range vm.Networks {
+		if i >= len(clone.Networks) || network.MAC == "" {
+			break
+		}
+
+		portGroup := network.Network
+		if portGroup == "" {
+			portGroup = clone.Networks[i].Network
+		}
+
+		if _, err := g.run(g.env(), "vm.network.change", "-vm", vm.Name,
+			"-net", portGroup, "-net.address", network.MAC, fmt.Sprintf("ethernet-%d", i)); err != nil {
+			return fmt.Errorf("unable to set the MAC address of %s's %s: %s", vm.Name, network.Label, err)
+		}
+	}
+
+	if len(guestinfo) > 0 {
+		var keys []string
+		for key := range guestinfo {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		args := []string{"vm.change", "-vm", vm.Name}
+		for _, key := range keys {
+			args = append(args, "-e", key+"="+guestinfo[key])
+		}
+		if _, err := g.run(g.env(), args...); err != nil {
+			return fmt.Errorf("unable to set %s's guestinfo: %s", vm.Name, err)
+		}
+	}
+
+	if _, err := g.run(g.env(), "vm.power", "-on", vm.Name); err != nil {
+		return fmt.Errorf("unable to power on %s: %s", vm.Name, err)
+	}
+
+	return nil
+}
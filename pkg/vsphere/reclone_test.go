@@ -0,0 +1,39 @@
+package vsphere
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+)
+
+func TestReclone(t *testing.T) {
+	g, commands := fakeGovc(t)
+
+	vm, err := g.VM("hello.qa.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	*commands = nil
+
+	spec := buildspec.Vsphere{CPUs: 4, Datastore: "ds01", Folder: "qa", Cluster: "c01"}
+	guestinfo := map[string]string{"guestinfo.userdata": "I2Nsb3VkLWNvbmZpZwo=", "guestinfo.userdata.encoding": "base64"}
+	if err := g.Reclone(vm, "templates/centos-7", spec, guestinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"vm.power -off -force hello.qa.local",
+		"vm.destroy hello.qa.local",
+		"vm.clone -vm templates/centos-7 -on=false -ds ds01 -folder qa -pool c01/Resources hello.qa.local",
+		"vm.info -json hello.qa.local",
+		"vm.change -vm hello.qa.local -c 4",
+		"vm.info -json hello.qa.local",
+		"vm.network.change -vm hello.qa.local -net dv-appservers -net.address 00:50:56:a1:2b:3c ethernet-0",
+		"vm.change -vm hello.qa.local -e guestinfo.userdata=I2Nsb3VkLWNvbmZpZwo= -e guestinfo.userdata.encoding=base64",
+		"vm.power -on hello.qa.local",
+	}
+	if !reflect.DeepEqual(*commands, expected) {
+		t.Fatalf("%#v\n\n%#v", *commands, expected)
+	}
+}
@@ -0,0 +1,198 @@
+package vsphere
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+)
+
+// Govc talks to vCenter through the govc command line tool, the same way
+// hammer is used for Foreman.
+type Govc struct {
+	Config     configspec.Vsphere
+	Datacenter string
+
+	// PollInterval is how often a VM is checked while waiting for it to
+	// shut down. Defaults to 10 seconds.
+	PollInterval time.Duration
+
+	// run runs govc with args and returns what it printed. It's swapped
+	// out in tests.
+	run func(env []string, args ...string) ([]byte, error)
+}
+
+// New returns a Govc for the vCenter in the configspec, looking VMs up in
+// the buildspec's datacenter.
+func New(cspec configspec.Vsphere, datacenter string) *Govc {
+	return &Govc{Config: cspec, Datacenter: datacenter, run: runGovc}
+}
+
+func runGovc(env []string, args ...string) ([]byte, error) {
+	govc := exec.Command("govc", args...)
+	govc.Env = env
+
+	var stderr strings.Builder
+	govc.Stderr = &stderr
+
+	out, err := govc.Output()
+	if err != nil {
+		return nil, fmt.Errorf("govc %s: %s: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// env returns the environment govc reads its connection settings from.
+func (g *Govc) env() []string {
+	env := append(os.Environ(),
+		"GOVC_URL="+g.Config.Endpoint.URL,
+		"GOVC_USERNAME="+g.Config.Username,
+		"GOVC_PASSWORD="+g.Config.Password,
+	)
+
+	if g.Datacenter != "" {
+		env = append(env, "GOVC_DATACENTER="+g.Datacenter)
+	}
+	if g.Config.Endpoint.CAFile != "" {
+		env = append(env, "GOVC_TLS_CA_CERTS="+g.Config.Endpoint.CAFile)
+	}
+	if g.Config.Endpoint.InsecureSkipVerify {
+		env = append(env, "GOVC_INSECURE=1")
+	}
+	if g.Config.Endpoint.Proxy != "" {
+		env = append(env, "http_proxy="+g.Config.Endpoint.Proxy, "https_proxy="+g.Config.Endpoint.Proxy)
+	}
+
+	return env
+}
+
+// VM is the hardware of a virtual machine, with its devices named by their
+// labels ("Hard disk 1") the way buildspecs name them.
+type VM struct {
+	Name           string
+	PoweredOn      bool
+	CPUs           int
+	CoresPerSocket int
+	MemoryMB       int
+	// CPUHotAdd and MemoryHotAdd say whether CPUs and memory can be added
+	// while the VM is running.
+	CPUHotAdd    bool
+	MemoryHotAdd bool
+	Disks        []*Disk
+	Networks     []*Network
+	SCSIs        []*SCSI
+}
+
+type Disk struct {
+	Label  string
+	SizeGB int
+}
+
+type Network struct {
+	Label string
+	// Network is the port group the adapter is on, if vCenter says.
+	Network string
+	MAC     string
+}
+
+type SCSI struct {
+	Label string
+	// Type is the controller type ("paravirtual", "lsilogic", ...), if
+	// vCenter says.
+	Type string
+}
+
+// scsiTypes maps vSphere's controller types to the names buildspecs use.
+var scsiTypes = map[string]string{
+	"ParaVirtualSCSIController":    "paravirtual",
+	"VirtualLsiLogicController":    "lsilogic",
+	"VirtualLsiLogicSASController": "lsilogic-sas",
+	"VirtualBusLogicController":    "buslogic",
+}
+
+// vmInfo is the part of `govc vm.info -json` that overseer reads. Field
+// names are matched case-insensitively, so it works with both the older
+// and newer govc output.
+type vmInfo struct {
+	VirtualMachines []struct {
+		Name    string
+		Runtime struct {
+			PowerState string
+		}
+		Config *struct {
+			CpuHotAddEnabled    bool
+			MemoryHotAddEnabled bool
+			Hardware            struct {
+				NumCPU            int
+				NumCoresPerSocket int
+				MemoryMB          int
+				Device            []struct {
+					TypeName   string `json:"_typeName"`
+					DeviceInfo *struct {
+						Label string
+					}
+					CapacityInKB int64
+					MacAddress   string
+					Backing      *struct {
+						DeviceName string
+					}
+				}
+			}
+		}
+	}
+}
+
+// VM returns the named virtual machine, or nil if there isn't one.
+func (g *Govc) VM(name string) (*VM, error) {
+	out, err := g.run(g.env(), "vm.info", "-json", name)
+	if err != nil {
+		return nil, err
+	}
+
+	var info vmInfo
+	if err := json.Unmarshal(out, &info); err != nil {
+		return nil, fmt.Errorf("unable to read govc vm.info output for %s: %s", name, err)
+	}
+
+	if len(info.VirtualMachines) == 0 || info.VirtualMachines[0].Config == nil {
+		return nil, nil
+	}
+
+	config := info.VirtualMachines[0].Config
+	hw := config.Hardware
+	vm := &VM{
+		Name:           info.VirtualMachines[0].Name,
+		PoweredOn:      info.VirtualMachines[0].Runtime.PowerState == "poweredOn",
+		CPUs:           hw.NumCPU,
+		CoresPerSocket: hw.NumCoresPerSocket,
+		MemoryMB:       hw.MemoryMB,
+		CPUHotAdd:      config.CpuHotAddEnabled,
+		MemoryHotAdd:   config.MemoryHotAddEnabled,
+	}
+
+	for _, device := range hw.Device {
+		if device.DeviceInfo == nil {
+			continue
+		}
+		label := device.DeviceInfo.Label
+
+		switch {
+		case strings.HasPrefix(label, "Hard disk"):
+			vm.Disks = append(vm.Disks, &Disk{Label: label, SizeGB: int(device.CapacityInKB / (1024 * 1024))})
+		case strings.HasPrefix(label, "Network adapter"):
+			network := &Network{Label: label, MAC: device.MacAddress}
+			if device.Backing != nil {
+				network.Network = device.Backing.DeviceName
+			}
+			vm.Networks = append(vm.Networks, network)
+		case strings.HasPrefix(label, "SCSI controller"):
+			vm.SCSIs = append(vm.SCSIs, &SCSI{Label: label, Type: scsiTypes[device.TypeName]})
+		}
+	}
+
+	return vm, nil
+}
@@ -0,0 +1,85 @@
+package vsphere
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+)
+
+// fakeGovc returns a Govc that answers vm.info for hello.qa.local from
+// the fixture and finds nothing else, recording the commands it was given.
+func fakeGovc(t *testing.T) (*Govc, *[]string) {
+	info, err := ioutil.ReadFile(filepath.Join("test-fixtures", "vm-info.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var commands []string
+	g := New(configspec.Vsphere{
+		Username: "administrator@vsphere.local",
+		Password: "datpass",
+		Endpoint: configspec.Endpoint{URL: "https://vcenter.qa.local/sdk", InsecureSkipVerify: true},
+	}, "dc01")
+	g.run = func(env []string, args ...string) ([]byte, error) {
+		for _, expected := range []string{"GOVC_URL=https://vcenter.qa.local/sdk", "GOVC_DATACENTER=dc01", "GOVC_INSECURE=1"} {
+			found := false
+			for _, e := range env {
+				found = found || e == expected
+			}
+			if !found {
+				t.Fatalf("%s not in govc's environment", expected)
+			}
+		}
+
+		commands = append(commands, strings.Join(args, " "))
+		if args[0] == "vm.info" && args[len(args)-1] != "hello.qa.local" {
+			return []byte(`{"virtualMachines":null}`), nil
+		}
+		if args[0] == "vm.info" {
+			return info, nil
+		}
+		return nil, nil
+	}
+
+	return g, &commands
+}
+
+func TestVM(t *testing.T) {
+	g, _ := fakeGovc(t)
+
+	vm, err := g.VM("hello.qa.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &VM{
+		Name:           "hello.qa.local",
+		PoweredOn:      true,
+		CPUs:           2,
+		CoresPerSocket: 1,
+		MemoryMB:       8192,
+		CPUHotAdd:      true,
+		Disks: []*Disk{
+			{Label: "Hard disk 1", SizeGB: 40},
+			{Label: "Hard disk 2", SizeGB: 100},
+		},
+		Networks: []*Network{
+			{Label: "Network adapter 1", Network: "dv-appservers", MAC: "00:50:56:a1:2b:3c"},
+		},
+		SCSIs: []*SCSI{
+			{Label: "SCSI controller 0", Type: "paravirtual"},
+		},
+	}
+	if !reflect.DeepEqual(vm, expected) {
+		t.Fatalf("%#v\n\n%#v", vm, expected)
+	}
+
+	vm, err = g.VM("lol.qa.local")
+	if err != nil || vm != nil {
+		t.Fatalf("a missing VM should be nil without an error: %#v, %v", vm, err)
+	}
+}
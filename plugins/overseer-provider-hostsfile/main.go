@@ -0,0 +1,131 @@
+// overseer-provider-hostsfile is a DNS provider plugin that keeps hosts'
+// addresses in a hosts(5) style file. It's small enough to read in one
+// go, so it doubles as the example to start from when writing a plugin of
+// your own.
+//
+// Build it, put it in ~/.overseer/plugins, name the file in the
+// configspec:
+//
+//	plugin "hostsfile" {
+//	    path = "/etc/hosts.overseer"
+//	}
+//
+// and set
+//
+//	dns = "hostsfile"
+//
+// in a buildspec.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/iamthemuffinman/overseer/configspec"
+	"github.com/iamthemuffinman/overseer/pkg/buildspec"
+	"github.com/iamthemuffinman/overseer/pkg/drift"
+	"github.com/iamthemuffinman/overseer/pkg/plugin"
+	"github.com/iamthemuffinman/overseer/pkg/provider"
+)
+
+func main() {
+	plugin.Serve(plugin.ServeOpts{
+		DNS: newHostsFile,
+	})
+}
+
+type hostsFile struct {
+	path string
+	mu   sync.Mutex
+}
+
+func newHostsFile(bspec *buildspec.Spec, cspec *configspec.Spec) (provider.DNSProvider, error) {
+	// The plugin's block in the configspec is all it's given of it
+	var path string
+	if p := cspec.Plugins["hostsfile"]; p != nil {
+		path, _ = p.Settings["path"].(string)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("set path in the configspec's hostsfile plugin block to the file to keep records in")
+	}
+	return &hostsFile{path: path}, nil
+}
+
+func (h *hostsFile) EnsureRecord(host, ip string) (string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	lines, err := h.read()
+	if err != nil {
+		return "", err
+	}
+
+	change := provider.Created
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[1] != host {
+			continue
+		}
+		if fields[0] == ip {
+			return provider.Unchanged, nil
+		}
+
+		fmt.Fprintf(os.Stderr, "[WARN] moving %s from %s to %s\n", host, fields[0], ip)
+		lines = append(lines[:i], lines[i+1:]...)
+		change = provider.Updated
+		break
+	}
+
+	lines = append(lines, ip+" "+host)
+	if err := ioutil.WriteFile(h.path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return "", err
+	}
+
+	fmt.Fprintf(os.Stderr, "%s %s -> %s\n", change, host, ip)
+	return change, nil
+}
+
+func (h *hostsFile) Diff(host, ip string) ([]drift.Difference, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	lines, err := h.read()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[1] != host {
+			continue
+		}
+		if fields[0] == ip {
+			return nil, nil
+		}
+		return []drift.Difference{{Field: "ip", Have: fields[0], Want: ip}}, nil
+	}
+
+	return []drift.Difference{drift.Missing("ip", ip)}, nil
+}
+
+// read returns the file's lines, or none if it doesn't exist yet.
+func (h *hostsFile) read() ([]string, error) {
+	data, err := ioutil.ReadFile(h.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}